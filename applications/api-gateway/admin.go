@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	"api-gateway/models"
+	service "github.com/faidon-laboratory/go-service"
+	"github.com/gorilla/mux"
+)
+
+// Admin API
+//
+// Operational endpoints under /admin, authenticated separately from the
+// public API by a bearer token (ADMIN_TOKEN, ADMIN_TOKENS) or, on the admin
+// listener (ADMIN_PORT), a client certificate (ADMIN_CLIENT_CA); see
+// service.Admin. Without credentials configured every admin request is
+// rejected unless ADMIN_AUTH=none. Every admin request, allowed or not, is
+// written to the audit log.
+//
+// GET /admin/goroutines lists the background goroutines started through the
+// service group (workers, scheduler, leader election, shadow requests) with
+// per-name counters of starts, panics and failures, plus the total number of
+// goroutines in the process.
+//
+// GET /admin/dependencies shows each upstream's state and the functionality
+// it affects (see dependencies.go).
+
+// adminConfig holds the admin listener settings and credentials
+var adminConfig = service.LoadAdmin(config)
+
+// adminMiddleware authenticates admin requests and writes the audit log
+func adminMiddleware(next http.Handler) http.Handler {
+	return adminConfig.Middleware(service.AdminHooks{
+		Logger: logger,
+		Reject: rejectAdminRequest,
+		Authenticated: func(ctx context.Context, elapsed time.Duration) {
+			recordPhase(ctx, phaseAuth, elapsed)
+		},
+	})(next)
+}
+
+// rejectAdminRequest answers an admin request without valid credentials
+func rejectAdminRequest(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "admin_unauthorized")
+	defer endSpan()
+
+	start := time.Now()
+	route := r.URL.Path
+	if current := mux.CurrentRoute(r); current != nil {
+		route, _ = current.GetPathTemplate()
+	}
+
+	writeError(w, http.StatusUnauthorized, "Admin credentials required")
+	logger.CountRequest(ctx, route, 401)
+	logger.RecordDuration(ctx, route, time.Since(start))
+}
+
+// registerAdminRoutes adds the admin endpoints to a router
+func registerAdminRoutes(routes *routeRegistry) {
+	admin := routes.subrouter("/admin", routeAuthAdmin)
+	admin.use("admin_auth", adminMiddleware)
+	admin.handleFunc("/goroutines", adminGoroutinesHandler, "GET")
+	admin.handleFunc("/clock", adminClockHandler, "GET", "POST")
+	admin.handleFunc("/routes", adminRoutesHandler, "GET")
+	admin.handleFunc("/dependencies", adminDependenciesHandler, "GET")
+	admin.handleFunc("/features", adminFeaturesHandler, "GET")
+	admin.handleFunc("/streams", adminStreamsHandler, "GET")
+}
+
+// newAdminServer returns the admin listener, or nil when ADMIN_PORT is unset
+func newAdminServer() (*http.Server, error) {
+	r := mux.NewRouter()
+	r.NotFoundHandler = unmatchedHandler(http.StatusNotFound)
+	r.MethodNotAllowedHandler = unmatchedHandler(http.StatusMethodNotAllowed)
+	registerAdminRoutes(newRouteRegistry(r, listenerAdmin))
+	return adminConfig.NewServer(r)
+}
+
+// serveAdmin runs the admin listener until it is shut down
+func serveAdmin(server *http.Server) {
+	if err := adminConfig.Serve(server); err != nil {
+		logger.Error(context.Background(), "Admin server failed to start", err)
+		os.Exit(1)
+	}
+}
+
+// Goroutine registry endpoint
+func adminGoroutinesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	logger.AddSpanAttribute(ctx, "admin.identity", service.AdminIdentity(ctx))
+
+	writeJSON(w, http.StatusOK, models.Goroutines{
+		OK:                true,
+		Goroutines:        background.Tasks(),
+		Stages:            background.Stages(),
+		ProcessGoroutines: runtime.NumGoroutine(),
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/faidon-laboratory/go-logging"
+)
+
+// User affinity
+//
+// When USER_SERVICE_REPLICAS lists several user-service replicas (e.g. the
+// pod addresses behind a headless service), calls are sent to them directly
+// instead of to USER_SERVICE_URL. With USER_SERVICE_AFFINITY=user_id every
+// call about a user goes to the same replica, chosen on a consistent-hash
+// ring (USER_SERVICE_AFFINITY_VNODES points per replica), so adding or
+// removing a replica only moves the users of its share of the ring. Calls
+// without a user (POST /users) and USER_SERVICE_AFFINITY=none rotate through
+// the replicas.
+//
+// Requests per replica are counted in user_service_affinity_requests_total,
+// and user_service_affinity_skew is the busiest replica's request count over
+// the average (1 is an even spread).
+
+const (
+	affinityNone   = "none"
+	affinityUserID = "user_id"
+)
+
+// affinityTransport sends each request to the replica owning its user
+type affinityTransport struct {
+	base     http.RoundTripper
+	replicas []*url.URL
+	affinity string
+	ring     []ringPoint
+	next     atomic.Uint64
+
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// ringPoint is a replica's position on the hash ring
+type ringPoint struct {
+	hash    uint64
+	replica int
+}
+
+// withUserAffinity routes user-service calls to USER_SERVICE_REPLICAS, if set
+func withUserAffinity(base http.RoundTripper) http.RoundTripper {
+	var replicas []*url.URL
+	for _, raw := range strings.Split(getEnvString("USER_SERVICE_REPLICAS", ""), ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		replica, err := url.Parse(raw)
+		if err != nil || replica.Host == "" {
+			configWarning("Ignoring USER_SERVICE_REPLICAS entry %q, expected a URL", raw)
+			continue
+		}
+		replicas = append(replicas, replica)
+	}
+	if len(replicas) == 0 {
+		return base
+	}
+
+	affinity := getEnvString("USER_SERVICE_AFFINITY", affinityUserID)
+	if affinity != affinityUserID && affinity != affinityNone {
+		configWarning("Invalid USER_SERVICE_AFFINITY %q, expected user_id or none; using user_id", affinity)
+		affinity = affinityUserID
+	}
+
+	t := &affinityTransport{
+		base:     base,
+		replicas: replicas,
+		affinity: affinity,
+		ring:     buildRing(replicas, max(getEnvInt("USER_SERVICE_AFFINITY_VNODES", 100), 1)),
+		counts:   make(map[string]int64, len(replicas)),
+	}
+	logger.ObservableGauge("user_service_affinity_skew", func(ctx context.Context, observe logging.Observer) {
+		if skew, ok := t.skew(); ok {
+			observe(skew)
+		}
+	})
+	return t
+}
+
+// buildRing places vnodes points per replica on the hash ring
+func buildRing(replicas []*url.URL, vnodes int) []ringPoint {
+	ring := make([]ringPoint, 0, len(replicas)*vnodes)
+	for i, replica := range replicas {
+		for v := 0; v < vnodes; v++ {
+			ring = append(ring, ringPoint{hash: hashKey(fmt.Sprintf("%s#%d", replica.Host, v)), replica: i})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	return ring
+}
+
+// hashKey is the ring position of a key. FNV alone leaves short keys that
+// differ in their last characters (user IDs, "host#1", "host#2") bunched
+// together, so its result goes through MurmurHash3's finalizer.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// replicaFor returns the replica owning a user, or the next one in rotation
+// for requests without one
+func (t *affinityTransport) replicaFor(userID string) *url.URL {
+	if t.affinity == affinityNone || userID == "" {
+		return t.replicas[(t.next.Add(1)-1)%uint64(len(t.replicas))]
+	}
+	hash := hashKey(userID)
+	i := sort.Search(len(t.ring), func(i int) bool { return t.ring[i].hash >= hash })
+	if i == len(t.ring) {
+		i = 0
+	}
+	return t.replicas[t.ring[i].replica]
+}
+
+func (t *affinityTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	replica := t.replicaFor(affinityKey(req))
+
+	// A transport must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.URL.Scheme = replica.Scheme
+	req.URL.Host = replica.Host
+	req.Host = ""
+
+	t.mu.Lock()
+	t.counts[replica.Host]++
+	t.mu.Unlock()
+	logger.Counter("user_service_affinity_requests_total").Inc(req.Context(), logging.Labels{"replica": replica.Host})
+
+	return t.base.RoundTrip(req)
+}
+
+// skew returns the busiest replica's request count over the average
+func (t *affinityTransport) skew() (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var total, busiest int64
+	for _, count := range t.counts {
+		total += count
+		busiest = max(busiest, count)
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return float64(busiest) * float64(len(t.replicas)) / float64(total), true
+}
+
+// affinityKey returns the user a user-service call is about: the ID in
+// /users/{id}... or the user_id query parameter of /work
+func affinityKey(req *http.Request) string {
+	if rest, ok := strings.CutPrefix(req.URL.Path, "/users/"); ok {
+		id, _, _ := strings.Cut(rest, "/")
+		return id
+	}
+	return req.URL.Query().Get("user_id")
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Client disconnects
+//
+// net/http cancels a request's context when the client closes the connection.
+// Every downstream call is made with that context, so an aborted request stops
+// waiting on the user and notification services (which in turn stop their own
+// work) instead of running to completion for nobody. Handlers that see their
+// downstream call fail because of the cancellation skip the error response,
+// and the logging middleware records the request with nginx's 499 status;
+// cancellationMiddleware counts them in http_requests_cancelled_total.
+
+// abortIfClientGone reports whether the client has disconnected, so the
+// handler should return without a response. Handlers call it when a
+// downstream call fails; the logging middleware records the request as 499.
+func abortIfClientGone(ctx context.Context) bool {
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		return false
+	}
+	logger.Warn(ctx, "Client disconnected, abandoning request")
+	return true
+}
+
+// cancellationMiddleware counts requests whose client disconnected before the
+// handler finished
+func cancellationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		if !errors.Is(r.Context().Err(), context.Canceled) {
+			return
+		}
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+		recordCancelledRequest(r.Context(), route)
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/faidon-laboratory/go-logging"
+)
+
+// Certificate expiry
+//
+// The gateway reports the days left on the certificates it depends on in
+// tls_certificate_expiry_days, by certificate: the upstreams reached over
+// HTTPS (USER_SERVICE_URL, NOTIFICATION_SERVICE_URL), its own admin
+// listener's ADMIN_TLS_CERT, and any server listed in TLS_EXPIRY_TARGETS as
+// name=host:port pairs. They are checked every TLS_EXPIRY_CHECK_INTERVAL_SEC
+// and logged as a warning within TLS_EXPIRY_WARN_DAYS of expiry. Upstream
+// certificates are also refreshed on every call made through the clients.
+
+// certificateMonitor returns the certificates to check, with no checks when
+// the gateway serves and calls nothing over TLS
+func certificateMonitor() logging.CertificateMonitor {
+	monitor := logging.CertificateMonitor{
+		Interval:   time.Duration(getEnvInt("TLS_EXPIRY_CHECK_INTERVAL_SEC", 3600)) * time.Second,
+		WarnBefore: time.Duration(getEnvInt("TLS_EXPIRY_WARN_DAYS", 30)) * 24 * time.Hour,
+	}
+	if check, ok := logging.CertificateCheckForURL("user-service", userServiceURL); ok {
+		monitor.Checks = append(monitor.Checks, check)
+	}
+	if check, ok := logging.CertificateCheckForURL("notification-service", notificationServiceURL); ok {
+		monitor.Checks = append(monitor.Checks, check)
+	}
+	if adminConfig.TLSCert != "" {
+		monitor.Checks = append(monitor.Checks, logging.CertificateCheck{Name: "api-gateway-admin", File: adminConfig.TLSCert})
+	}
+	for _, entry := range strings.Split(getEnvString("TLS_EXPIRY_TARGETS", ""), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, address, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || !strings.Contains(address, ":") {
+			configWarning("Ignoring TLS_EXPIRY_TARGETS entry %q, expected name=host:port", entry)
+			continue
+		}
+		monitor.Checks = append(monitor.Checks, logging.CertificateCheck{Name: name, Address: address})
+	}
+	return monitor
+}
@@ -0,0 +1,110 @@
+// Package failures classifies failed upstream calls by what a caller can do
+// about them, so the clients' retries and the gateway's dependency tracking
+// agree on which failures are worth repeating:
+//
+//	retryable      the upstream couldn't be reached or failed transiently
+//	               (refused or reset connection, DNS failure, 500, 502, 503)
+//	throttled      the upstream asked the caller to slow down (429)
+//	timeout        the call ran out of time (deadline exceeded, 408, 504)
+//	non_retryable  repeating the call won't help (other 4xx and 5xx, TLS
+//	               certificate errors, unknown hosts)
+//
+// A successful call has no class.
+package failures
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Class is the kind of a failed call
+type Class string
+
+const (
+	None         Class = ""
+	Retryable    Class = "retryable"
+	NonRetryable Class = "non_retryable"
+	Throttled    Class = "throttled"
+	Timeout      Class = "timeout"
+)
+
+// Classes lists the classes of failed calls
+var Classes = []Class{Retryable, NonRetryable, Throttled, Timeout}
+
+// Retry reports whether a call that failed with the class may be repeated
+func (c Class) Retry() bool {
+	return c == Retryable || c == Throttled || c == Timeout
+}
+
+// Classify returns the class of a call's outcome: the transport error if
+// there is one, else the response status
+func Classify(resp *http.Response, err error) Class {
+	if err != nil {
+		return ClassifyError(err)
+	}
+	if resp == nil {
+		return None
+	}
+	return ClassifyStatus(resp.StatusCode)
+}
+
+// ClassifyStatus returns the class of a response status, None if successful
+func ClassifyStatus(status int) Class {
+	switch {
+	case status < http.StatusBadRequest:
+		return None
+	case status == http.StatusTooManyRequests:
+		return Throttled
+	case status == http.StatusRequestTimeout, status == http.StatusGatewayTimeout:
+		return Timeout
+	case status == http.StatusInternalServerError,
+		status == http.StatusBadGateway,
+		status == http.StatusServiceUnavailable:
+		return Retryable
+	default:
+		return NonRetryable
+	}
+}
+
+// ClassifyError returns the class of a transport error, None if err is nil.
+// Errors it doesn't recognize are retryable, as most transport errors are.
+func ClassifyError(err error) Class {
+	if err == nil {
+		return None
+	}
+
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	var recordErr tls.RecordHeaderError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthority),
+		errors.As(err, &hostnameErr), errors.As(err, &invalidCert),
+		errors.As(err, &recordErr):
+		return NonRetryable
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return Timeout
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		// An unknown host stays unknown, unless the cluster DNS is still
+		// catching up
+		if dnsErr.IsNotFound && !dnsErr.IsTemporary {
+			return NonRetryable
+		}
+		return Retryable
+	}
+	// Refused and reset connections, closed keep-alive connections and the
+	// like
+	return Retryable
+}
@@ -0,0 +1,322 @@
+// Package notifications is the client for sending notifications through the
+// notification service. It wraps the generated client (api-gateway/notificationclient)
+// with what every sender needs: an Idempotency-Key per notification, retries
+// of transient failures under a RetryPolicy, batches sent with bounded
+// concurrency, and a deadline, span and log line per call. Unsuccessful
+// responses are returned as a *StatusError.
+//
+// Senders depend on the API interface, so tests can substitute a fake.
+package notifications
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"api-gateway/clients/failures"
+	"api-gateway/notificationclient"
+	logging "github.com/faidon-laboratory/go-logging"
+)
+
+// API is implemented by Client and by fakes in tests
+type API interface {
+	// Send sends one notification (POST /notifications/send)
+	Send(ctx context.Context, req SendRequest) (*SendResponse, error)
+	// SendBatch sends several notifications; results are in request order
+	SendBatch(ctx context.Context, reqs []SendRequest) []BatchResult
+}
+
+// ErrInvalidResponse is returned when a successful response can't be decoded
+var ErrInvalidResponse = errors.New("invalid notification service response")
+
+// StatusError is an unsuccessful response of the notification service
+type StatusError struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("notification service returned status %d", e.StatusCode)
+}
+
+// IdempotencyKeyHeader carries the key identifying a notification across retries
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey makes Send use key instead of a random one, so a caller
+// that repeats a whole operation (e.g. a workflow run) sends the same key.
+// SendBatch appends the item's index ("key-0", "key-1", ...).
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// RetryPolicy decides which sends are repeated and how long to wait between
+// attempts. The RetryStatuses and the transport errors that
+// failures.ClassifyError deems worth repeating (not e.g. TLS certificate
+// errors) are retried; the wait doubles from InitialBackoff up to MaxBackoff
+// (with jitter) unless the response has a Retry-After header.
+type RetryPolicy struct {
+	// MaxAttempts includes the first one; 1 disables retries
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	RetryStatuses  []int
+}
+
+// DefaultRetryPolicy retries twice on overload and unavailability. 502 is
+// left out because the gateway uses it for responses that broke their schema.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	RetryStatuses:  []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+}
+
+// Options configure a Client
+type Options struct {
+	BaseURL   string
+	Transport http.RoundTripper
+	// Timeout is the deadline of each attempt, 5 seconds if zero
+	Timeout time.Duration
+	// Retry is DefaultRetryPolicy if MaxAttempts is zero
+	Retry RetryPolicy
+	// BatchConcurrency is the number of sends of a batch in flight, 4 if zero
+	BatchConcurrency int
+	// Logger gets a span and a log line per call; nil disables both
+	Logger  *logging.Logger
+	Editors []notificationclient.RequestEditorFn
+}
+
+// Client sends notifications over HTTP
+type Client struct {
+	generated        *notificationclient.Client
+	timeout          time.Duration
+	retry            RetryPolicy
+	batchConcurrency int
+	logger           *logging.Logger
+}
+
+var _ API = (*Client)(nil)
+
+// New returns a client for the notification service at opts.BaseURL
+func New(opts Options) *Client {
+	transport := opts.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	retry := opts.Retry
+	if retry.MaxAttempts <= 0 {
+		retry = DefaultRetryPolicy
+	}
+	batchConcurrency := opts.BatchConcurrency
+	if batchConcurrency <= 0 {
+		batchConcurrency = 4
+	}
+	editors := append([]notificationclient.RequestEditorFn{setIdempotencyKey}, opts.Editors...)
+	return &Client{
+		generated:        notificationclient.NewClient(opts.BaseURL, &http.Client{Transport: transport}, editors...),
+		timeout:          timeout,
+		retry:            retry,
+		batchConcurrency: batchConcurrency,
+		logger:           opts.Logger,
+	}
+}
+
+// setIdempotencyKey adds the key of the notification being sent
+func setIdempotencyKey(ctx context.Context, req *http.Request, body []byte) error {
+	if key, ok := ctx.Value(idempotencyKey{}).(string); ok {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	return nil
+}
+
+// Send sends one notification, retrying transient failures with the same
+// idempotency key
+func (c *Client) Send(ctx context.Context, req SendRequest) (resp *SendResponse, err error) {
+	key, ok := ctx.Value(idempotencyKey{}).(string)
+	if !ok || key == "" {
+		key = newKey()
+		ctx = WithIdempotencyKey(ctx, key)
+	}
+
+	start := time.Now()
+	attempts := 0
+	status := 0
+	if c.logger != nil {
+		var endSpan func()
+		ctx, endSpan = c.logger.StartSpan(ctx, "notification_service_send")
+		defer func() {
+			fields := map[string]interface{}{
+				"user_id":         req.UserID,
+				"channel":         req.Channel,
+				"idempotency_key": key,
+				"attempts":        attempts,
+				"status_code":     status,
+				"duration_ms":     time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				fields["failure_class"] = string(classify(err))
+				c.logger.Error(ctx, "Notification service call failed", err, fields)
+			} else {
+				c.logger.Debug(ctx, "Notification service call completed", fields)
+			}
+			endSpan()
+		}()
+	}
+
+	for {
+		attempts++
+		var header http.Header
+		resp, header, err = c.sendOnce(ctx, req)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			status = statusErr.StatusCode
+		} else if err == nil {
+			status = http.StatusOK
+		}
+
+		wait, retry := c.shouldRetry(ctx, err, attempts, header)
+		if !retry {
+			return resp, err
+		}
+		if c.logger != nil {
+			c.logger.Warn(ctx, "Retrying notification", map[string]interface{}{
+				"attempt": attempts,
+				"wait_ms": wait.Milliseconds(),
+				"error":   err.Error(),
+				"user_id": req.UserID,
+			})
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// sendOnce makes one attempt under its own deadline
+func (c *Client) sendOnce(ctx context.Context, req SendRequest) (*SendResponse, http.Header, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	resp, err := c.generated.SendNotification(ctx, req)
+	if err != nil && resp == nil {
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, resp.Header, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.Header, &StatusError{StatusCode: resp.StatusCode, Header: resp.Header, Body: resp.Body}
+	}
+	if resp.JSON200 == nil {
+		return nil, resp.Header, fmt.Errorf("%w: content type %q", ErrInvalidResponse, resp.Header.Get("Content-Type"))
+	}
+	return resp.JSON200, resp.Header, nil
+}
+
+// shouldRetry says whether a failed attempt is repeated and after how long
+func (c *Client) shouldRetry(ctx context.Context, err error, attempts int, header http.Header) (time.Duration, bool) {
+	if err == nil || attempts >= c.retry.MaxAttempts || ctx.Err() != nil {
+		return 0, false
+	}
+	var statusErr *StatusError
+	switch {
+	case errors.As(err, &statusErr):
+		retryable := false
+		for _, status := range c.retry.RetryStatuses {
+			retryable = retryable || status == statusErr.StatusCode
+		}
+		if !retryable {
+			return 0, false
+		}
+	case errors.Is(err, ErrInvalidResponse):
+		return 0, false
+	case !failures.ClassifyError(err).Retry():
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds >= 0 {
+		wait := time.Duration(seconds) * time.Second
+		if c.retry.MaxBackoff > 0 && wait > c.retry.MaxBackoff {
+			wait = c.retry.MaxBackoff
+		}
+		return wait, true
+	}
+	wait := c.retry.InitialBackoff << (attempts - 1)
+	if c.retry.MaxBackoff > 0 && (wait > c.retry.MaxBackoff || wait <= 0) {
+		wait = c.retry.MaxBackoff
+	}
+	// Jitter keeps a burst of failed senders from retrying in lockstep
+	if wait > 0 {
+		wait = wait/2 + time.Duration(mathrand.Int63n(int64(wait/2)+1))
+	}
+	return wait, true
+}
+
+// classify returns the failure class of a Send error
+func classify(err error) failures.Class {
+	var statusErr *StatusError
+	switch {
+	case errors.As(err, &statusErr):
+		return failures.ClassifyStatus(statusErr.StatusCode)
+	case errors.Is(err, ErrInvalidResponse):
+		return failures.NonRetryable
+	}
+	return failures.ClassifyError(err)
+}
+
+// SendBatch sends the notifications with at most BatchConcurrency in flight.
+// Every notification is retried on its own; one failing doesn't stop the rest.
+func (c *Client) SendBatch(ctx context.Context, reqs []SendRequest) []BatchResult {
+	batchKey, _ := ctx.Value(idempotencyKey{}).(string)
+	if c.logger != nil {
+		var endSpan func()
+		ctx, endSpan = c.logger.StartSpan(ctx, "notification_service_send_batch")
+		defer endSpan()
+		c.logger.AddSpanAttributeInt(ctx, "batch.size", len(reqs))
+	}
+
+	results := make([]BatchResult, len(reqs))
+	slots := make(chan struct{}, c.batchConcurrency)
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, req SendRequest) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			itemCtx := ctx
+			if batchKey != "" {
+				itemCtx = WithIdempotencyKey(ctx, batchKey+"-"+strconv.Itoa(i))
+			}
+			resp, err := c.Send(itemCtx, req)
+			results[i] = BatchResult{Response: resp, Err: err}
+		}(i, req)
+	}
+	wg.Wait()
+	return results
+}
+
+// newKey returns a random idempotency key
+func newKey() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
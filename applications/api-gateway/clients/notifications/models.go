@@ -0,0 +1,16 @@
+package notifications
+
+import "api-gateway/notificationclient"
+
+// SendRequest is the body of POST /notifications/send
+type SendRequest = notificationclient.SendRequest
+
+// SendResponse is the response to a sent notification
+type SendResponse = notificationclient.SendResponse
+
+// BatchResult is the outcome of one notification of a batch; Err is nil
+// when Response is set
+type BatchResult struct {
+	Response *SendResponse
+	Err      error
+}
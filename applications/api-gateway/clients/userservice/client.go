@@ -0,0 +1,211 @@
+// Package userservice is the gateway's client for the user service. Calls
+// return typed models or an error: ErrNotFound for unknown users, a
+// *StatusError for other unsuccessful responses, ErrInvalidResponse for
+// bodies that don't decode, or the transport error. Each
+// call runs under its own deadline and gets a span and a log line.
+//
+// Handlers depend on the API interface, so tests can substitute a fake.
+package userservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	logging "github.com/faidon-laboratory/go-logging"
+)
+
+// API is implemented by Client and by fakes in tests
+type API interface {
+	// Work runs an action for a user (GET /work)
+	Work(ctx context.Context, userID, action string) (*WorkResult, error)
+	// GetUser looks a user up (GET /users/{id})
+	GetUser(ctx context.Context, userID string) (*User, error)
+	// CreateUser creates a user (POST /users)
+	CreateUser(ctx context.Context, req CreateUserRequest) (*User, error)
+	// GetProfile returns a user's extended profile (GET /users/{id}/profile)
+	GetProfile(ctx context.Context, userID string) (*Profile, error)
+}
+
+var (
+	// ErrNotFound is returned for users the service doesn't know
+	ErrNotFound = errors.New("user not found")
+	// ErrInvalidResponse is returned when a successful response can't be decoded
+	ErrInvalidResponse = errors.New("invalid user service response")
+)
+
+// StatusError is an unsuccessful response of the user service
+type StatusError struct {
+	Operation  string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("user service %s returned status %d", e.Operation, e.StatusCode)
+}
+
+// Is makes a 404 match ErrNotFound
+func (e *StatusError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// RequestEditorFn changes a request before it is sent (e.g. to sign it);
+// body is the encoded request body, nil for requests without one
+type RequestEditorFn func(ctx context.Context, req *http.Request, body []byte) error
+
+// Options configure a Client
+type Options struct {
+	BaseURL   string
+	Transport http.RoundTripper
+	// Timeout is the deadline of each call, 5 seconds if zero
+	Timeout time.Duration
+	// Logger gets a span and a log line per call; nil disables both
+	Logger  *logging.Logger
+	Editors []RequestEditorFn
+}
+
+// Client calls the user service over HTTP
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	timeout    time.Duration
+	logger     *logging.Logger
+	editors    []RequestEditorFn
+}
+
+var _ API = (*Client)(nil)
+
+// New returns a client for the user service at opts.BaseURL
+func New(opts Options) *Client {
+	transport := opts.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(opts.BaseURL, "/"),
+		httpClient: &http.Client{Transport: transport},
+		timeout:    timeout,
+		logger:     opts.Logger,
+		editors:    opts.Editors,
+	}
+}
+
+// Work runs an action for a user (GET /work)
+func (c *Client) Work(ctx context.Context, userID, action string) (*WorkResult, error) {
+	var result WorkResult
+	query := url.Values{"user_id": {userID}, "action": {action}}
+	if err := c.call(ctx, "work", http.MethodGet, "/work?"+query.Encode(), nil, &result, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetUser looks a user up (GET /users/{id})
+func (c *Client) GetUser(ctx context.Context, userID string) (*User, error) {
+	var result userEnvelope
+	if err := c.call(ctx, "get_user", http.MethodGet, "/users/"+url.PathEscape(userID), nil, &result, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &result.User, nil
+}
+
+// CreateUser creates a user (POST /users)
+func (c *Client) CreateUser(ctx context.Context, req CreateUserRequest) (*User, error) {
+	var result userEnvelope
+	if err := c.call(ctx, "create_user", http.MethodPost, "/users", req, &result, http.StatusCreated, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &result.User, nil
+}
+
+// GetProfile returns a user's extended profile (GET /users/{id}/profile)
+func (c *Client) GetProfile(ctx context.Context, userID string) (*Profile, error) {
+	var result profileEnvelope
+	if err := c.call(ctx, "get_profile", http.MethodGet, "/users/"+url.PathEscape(userID)+"/profile", nil, &result, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &result.Profile, nil
+}
+
+// call sends one request and decodes a response with one of the expected
+// statuses into out
+func (c *Client) call(ctx context.Context, operation, method, path string, in, out interface{}, expected ...int) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	status := 0
+	if c.logger != nil {
+		var endSpan func()
+		ctx, endSpan = c.logger.StartSpan(ctx, "user_service_"+operation)
+		defer func() {
+			fields := map[string]interface{}{
+				"operation":   operation,
+				"status_code": status,
+				"duration_ms": time.Since(start).Milliseconds(),
+			}
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				c.logger.Error(ctx, "User service call failed", err, fields)
+			} else {
+				c.logger.Debug(ctx, "User service call completed", fields)
+			}
+			endSpan()
+		}()
+	}
+
+	var body []byte
+	if in != nil {
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("encoding %s request: %w", operation, err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, edit := range c.editors {
+		if err := edit(ctx, req, body); err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+	if c.logger != nil {
+		c.logger.AddSpanAttributeInt(ctx, "http.status_code", status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading %s response: %w", operation, err)
+	}
+	for _, want := range expected {
+		if resp.StatusCode == want {
+			if err := json.Unmarshal(data, out); err != nil {
+				return fmt.Errorf("%w to %s: %w", ErrInvalidResponse, operation, err)
+			}
+			return nil
+		}
+	}
+	return &StatusError{Operation: operation, StatusCode: resp.StatusCode, Header: resp.Header, Body: data}
+}
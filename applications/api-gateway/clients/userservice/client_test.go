@@ -0,0 +1,41 @@
+package userservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// User IDs come from the gateway's request path, so the client escapes them
+// instead of letting them add segments or a query to the upstream URL
+func TestClientEscapesUserID(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath()+"?"+r.URL.RawQuery)
+		http.Error(w, `{"ok": false}`, http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := New(Options{BaseURL: server.URL})
+	id := "42/../admin?x=1"
+	if _, err := client.GetUser(context.Background(), id); err == nil {
+		t.Fatal("GetUser: expected ErrNotFound")
+	}
+	if _, err := client.GetProfile(context.Background(), id); err == nil {
+		t.Fatal("GetProfile: expected ErrNotFound")
+	}
+
+	want := []string{
+		"/users/42%2F..%2Fadmin%3Fx=1?",
+		"/users/42%2F..%2Fadmin%3Fx=1/profile?",
+	}
+	if len(paths) != len(want) {
+		t.Fatalf("requests = %q, want %q", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("request %d = %q, want %q", i, paths[i], want[i])
+		}
+	}
+}
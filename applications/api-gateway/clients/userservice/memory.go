@@ -0,0 +1,171 @@
+package userservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Memory is an in-memory user store implementing API, for running the
+// gateway without the user service. Users live as long as the process.
+type Memory struct {
+	// Greeting is returned by Work, like the user service's GREETING
+	Greeting string
+
+	mu     sync.RWMutex
+	users  map[string]User
+	nextID int
+}
+
+var _ API = (*Memory)(nil)
+
+// NewMemory returns a store holding the given users
+func NewMemory(greeting string, users ...User) *Memory {
+	m := &Memory{Greeting: greeting, users: make(map[string]User, len(users)), nextID: 1000}
+	for _, user := range users {
+		m.users[user.UserID] = user
+	}
+	return m
+}
+
+// DemoUsers are the users a Memory store can be seeded with; 123 is the ID
+// the examples use
+func DemoUsers() []User {
+	users := make([]User, 0, 3)
+	for _, id := range []string{"123", "456", "789"} {
+		users = append(users, User{
+			UserID:    id,
+			Name:      "User " + id,
+			Email:     "user" + id + "@example.com",
+			Status:    "active",
+			CreatedAt: "2024-01-01T00:00:00Z",
+		})
+	}
+	return users
+}
+
+// Work returns the user's record with the greeting
+func (m *Memory) Work(ctx context.Context, userID, action string) (*WorkResult, error) {
+	user, err := m.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &WorkResult{Greeting: m.Greeting, UserData: *user}, nil
+}
+
+// GetUser returns a stored user or ErrNotFound
+func (m *Memory) GetUser(ctx context.Context, userID string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+// CreateUser stores a new active user with the next free ID
+func (m *Memory) CreateUser(ctx context.Context, req CreateUserRequest) (*User, error) {
+	if req.Name == "" || req.Email == "" {
+		return nil, &StatusError{Operation: "create_user", StatusCode: http.StatusBadRequest, Body: []byte(`{"ok":false,"error":"Name and email are required"}`)}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	user := User{
+		UserID:    fmt.Sprintf("user_%d", m.nextID),
+		Name:      req.Name,
+		Email:     req.Email,
+		Status:    "active",
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	m.users[user.UserID] = user
+	return &user, nil
+}
+
+// GetProfile returns a stored user with a placeholder profile
+func (m *Memory) GetProfile(ctx context.Context, userID string) (*Profile, error) {
+	user, err := m.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Profile{
+		User: *user,
+		Profile: ProfileDetails{
+			Bio:         "This is the profile for user " + userID,
+			Website:     "https://example.com/users/" + url.PathEscape(userID),
+			Preferences: map[string]interface{}{},
+			Stats:       map[string]int{},
+		},
+	}, nil
+}
+
+// Fallback is an API calling Primary and answering from Secondary when
+// Primary can't be reached. Responses from Primary, errors included, are
+// returned as they are: only transport errors (refused connections, DNS
+// failures, timeouts) fall back. Writes that reached Primary are not copied
+// to Secondary.
+type Fallback struct {
+	Primary   API
+	Secondary API
+	// OnFallback, if set, is called before each call answered by Secondary
+	OnFallback func(ctx context.Context, operation string, err error)
+}
+
+var _ API = (*Fallback)(nil)
+
+// Work runs an action for a user
+func (f *Fallback) Work(ctx context.Context, userID, action string) (*WorkResult, error) {
+	result, err := f.Primary.Work(ctx, userID, action)
+	if f.unreachable(ctx, "work", err) {
+		return f.Secondary.Work(ctx, userID, action)
+	}
+	return result, err
+}
+
+// GetUser looks a user up
+func (f *Fallback) GetUser(ctx context.Context, userID string) (*User, error) {
+	user, err := f.Primary.GetUser(ctx, userID)
+	if f.unreachable(ctx, "get_user", err) {
+		return f.Secondary.GetUser(ctx, userID)
+	}
+	return user, err
+}
+
+// CreateUser creates a user
+func (f *Fallback) CreateUser(ctx context.Context, req CreateUserRequest) (*User, error) {
+	user, err := f.Primary.CreateUser(ctx, req)
+	if f.unreachable(ctx, "create_user", err) {
+		return f.Secondary.CreateUser(ctx, req)
+	}
+	return user, err
+}
+
+// GetProfile returns a user's extended profile
+func (f *Fallback) GetProfile(ctx context.Context, userID string) (*Profile, error) {
+	profile, err := f.Primary.GetProfile(ctx, userID)
+	if f.unreachable(ctx, "get_profile", err) {
+		return f.Secondary.GetProfile(ctx, userID)
+	}
+	return profile, err
+}
+
+// unreachable reports whether err means Primary couldn't be reached, and
+// calls OnFallback if so. A caller that went away doesn't fall back.
+func (f *Fallback) unreachable(ctx context.Context, operation string, err error) bool {
+	var transportErr *url.Error
+	if err == nil || ctx.Err() != nil || !errors.As(err, &transportErr) {
+		return false
+	}
+	if f.OnFallback != nil {
+		f.OnFallback(ctx, operation, err)
+	}
+	return true
+}
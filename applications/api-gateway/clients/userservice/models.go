@@ -0,0 +1,46 @@
+package userservice
+
+// User is a user record
+type User struct {
+	UserID    string  `json:"user_id"`
+	Name      string  `json:"name"`
+	Email     string  `json:"email"`
+	Status    string  `json:"status"`
+	CreatedAt string  `json:"created_at,omitempty"`
+	LastLogin *string `json:"last_login"`
+}
+
+// CreateUserRequest is the body of POST /users
+type CreateUserRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// WorkResult is the response of GET /work
+type WorkResult struct {
+	Greeting string `json:"greeting"`
+	UserData User   `json:"user_data"`
+}
+
+// Profile is a user record with its extended profile
+type Profile struct {
+	User
+	Profile ProfileDetails `json:"profile"`
+}
+
+// ProfileDetails are the extended profile fields
+type ProfileDetails struct {
+	Bio         string                 `json:"bio"`
+	Location    string                 `json:"location"`
+	Website     string                 `json:"website"`
+	Preferences map[string]interface{} `json:"preferences"`
+	Stats       map[string]int         `json:"stats"`
+}
+
+type userEnvelope struct {
+	User User `json:"user"`
+}
+
+type profileEnvelope struct {
+	Profile Profile `json:"profile"`
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"api-gateway/models"
+	service "github.com/faidon-laboratory/go-service"
+)
+
+// Clock
+//
+// Readiness and workflow schedules read the time through clock rather than
+// time.Now, so they can be tested without waiting. It is the system clock
+// unless FAKE_CLOCK_START (RFC 3339) is set: the gateway then runs on a fake
+// clock stopped at that time, moved through the admin API:
+//
+//	GET  /admin/clock  the current time and whether it is fake
+//	POST /admin/clock  {"advance": "90s"} or {"set": "2026-01-05T09:00:00Z"}
+//
+// Request durations, timeouts and the scheduler lease stay on real time.
+
+var clock = service.ConfiguredClock(config)
+
+// Clock endpoint
+func adminClockHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	fake, isFake := clock.(*service.Fake)
+
+	if r.Method == http.MethodPost {
+		if !isFake {
+			writeError(w, http.StatusConflict, "The clock can only be moved when FAKE_CLOCK_START is set")
+			return
+		}
+
+		var change models.ClockChange
+		previous := fake.Now()
+		err := json.NewDecoder(r.Body).Decode(&change)
+		if err == nil {
+			err = fake.Move(change.Advance, change.Set)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, `Expected {"advance": "<duration>"} or {"set": "<RFC 3339 time>"}`)
+			return
+		}
+		logger.Info(ctx, "Fake clock moved", map[string]interface{}{
+			"from":     previous.UTC().Format(time.RFC3339),
+			"to":       fake.Now().UTC().Format(time.RFC3339),
+			"identity": service.AdminIdentity(ctx),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, models.ClockStatus{
+		OK:   true,
+		Now:  clock.Now().UTC(),
+		Fake: isFake,
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"api-gateway/notificationclient"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"empty header", "", encodingIdentity},
+		{"single encoding", "gzip", encodingGzip},
+		{"case insensitive", "GZip", encodingGzip},
+		{"tie prefers brotli", "gzip, br", encodingBrotli},
+		{"equal q prefers brotli", "gzip;q=0.8, br;q=0.8", encodingBrotli},
+		{"higher q wins", "br;q=0.5, gzip", encodingGzip},
+		{"q=0 refuses", "gzip;q=0", encodingIdentity},
+		{"identity above the rest", "gzip;q=0.5, identity", encodingIdentity},
+		{"wildcard", "*", encodingBrotli},
+		{"wildcard below explicit", "*;q=0.5, gzip;q=0.8", encodingGzip},
+		{"wildcard refusing the rest", "gzip, *;q=0", encodingGzip},
+		{"nothing acceptable", "identity;q=0, *;q=0", encodingIdentity},
+		{"unsupported only", "deflate", encodingIdentity},
+		{"invalid q counts as 1", "br;q=high, gzip;q=0.9", encodingBrotli},
+		{"whitespace", " br ; q=0.2 ,gzip ; q=0.4 ", encodingGzip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiateEncoding(tt.header); got != tt.want {
+				t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+// notificationsPayload returns a 100-entry notifications list as the
+// gateway serves it
+func notificationsPayload(b *testing.B) []byte {
+	channels := []string{"email", "sms", "push"}
+	priorities := []string{"low", "normal", "high"}
+	list := notificationclient.NotificationList{OK: true, TotalCount: 100}
+	sentAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		sent := sentAt.Add(time.Duration(i) * time.Minute)
+		list.Notifications = append(list.Notifications, notificationclient.NotificationSummary{
+			ID:       fmt.Sprintf("notif-%d-%06d", sent.Unix(), i),
+			UserID:   fmt.Sprintf("user-%d", i%17),
+			Channel:  channels[i%len(channels)],
+			Priority: priorities[i%len(priorities)],
+			Message:  fmt.Sprintf("Your order #%d has shipped and should arrive within %d days", 10000+i, 2+i%5),
+			Status:   "sent",
+			SentAt:   &sent,
+		})
+	}
+	payload, err := json.Marshal(list)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return payload
+}
+
+// BenchmarkCompression compresses the notifications list at each level,
+// reporting the compressed size next to the CPU time
+func BenchmarkCompression(b *testing.B) {
+	payload := notificationsPayload(b)
+	b.Logf("payload: %d bytes", len(payload))
+
+	encoders := []struct {
+		name string
+		new  func() responseEncoder
+	}{
+		{"gzip-1", func() responseEncoder { w, _ := gzip.NewWriterLevel(nil, 1); return w }},
+		{"gzip-6", func() responseEncoder { w, _ := gzip.NewWriterLevel(nil, 6); return w }},
+		{"brotli-1", func() responseEncoder { return brotli.NewWriterLevel(nil, 1) }},
+		{"brotli-4", func() responseEncoder { return brotli.NewWriterLevel(nil, 4) }},
+		{"brotli-6", func() responseEncoder { return brotli.NewWriterLevel(nil, 6) }},
+		{"brotli-11", func() responseEncoder { return brotli.NewWriterLevel(nil, 11) }},
+	}
+	for _, encoder := range encoders {
+		b.Run(encoder.name, func(b *testing.B) {
+			enc := encoder.new()
+			var out bytes.Buffer
+			b.SetBytes(int64(len(payload)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				out.Reset()
+				enc.Reset(&out)
+				if _, err := enc.Write(payload); err != nil {
+					b.Fatal(err)
+				}
+				if err := enc.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(out.Len()), "compressed-bytes")
+		})
+	}
+}
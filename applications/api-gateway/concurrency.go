@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// Per-client concurrency limit
+//
+// Caps the number of requests a single client can have open at the same time
+// (CLIENT_MAX_CONCURRENT, 0 disables the limit), independent of any
+// per-second rate. Clients are identified by their X-API-Key header, or by IP
+// address otherwise. The IP is taken from the connection unless
+// CLIENT_IP_HEADER names a header set by a trusted proxy (e.g.
+// X-Forwarded-For). Requests over the limit get 429 straight away.
+//
+// Every limited response carries the draft RateLimit headers so clients can
+// throttle themselves before hitting the limit:
+//
+//	RateLimit-Limit      CLIENT_MAX_CONCURRENT
+//	RateLimit-Remaining  requests the client may still open alongside this one
+//	RateLimit-Reset      seconds until it should retry when none are left
+//	                     (slots free up as open requests finish, so always 1)
+
+const apiKeyHeader = "X-API-Key"
+
+// concurrencyLimiter counts open requests per client
+type concurrencyLimiter struct {
+	mu     sync.Mutex
+	active map[string]int
+	limit  int
+}
+
+var (
+	clientLimiter  *concurrencyLimiter
+	clientIPHeader string
+)
+
+func init() {
+	clientLimiter = &concurrencyLimiter{
+		active: make(map[string]int),
+		limit:  getEnvInt("CLIENT_MAX_CONCURRENT", 0),
+	}
+	clientIPHeader = getEnvString("CLIENT_IP_HEADER", "")
+}
+
+// acquire takes a slot for the client, returning false if it has none left,
+// and the number of slots still free
+func (l *concurrencyLimiter) acquire(client string) (remaining int, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active[client] >= l.limit {
+		return 0, false
+	}
+	l.active[client]++
+	return l.limit - l.active[client], true
+}
+
+// release frees a slot taken by acquire
+func (l *concurrencyLimiter) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Drop idle clients so the map only holds clients with open requests
+	if l.active[client] <= 1 {
+		delete(l.active, client)
+		return
+	}
+	l.active[client]--
+}
+
+// clientKey identifies the client of a request
+func clientKey(r *http.Request) string {
+	if apiKey := r.Header.Get(apiKeyHeader); apiKey != "" {
+		return "key:" + apiKey
+	}
+	if clientIPHeader != "" {
+		if value := r.Header.Get(clientIPHeader); value != "" {
+			first, _, _ := strings.Cut(value, ",")
+			return "ip:" + strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// concurrencyLimitMiddleware rejects requests from clients that already have
+// CLIENT_MAX_CONCURRENT requests open
+func concurrencyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if clientLimiter.limit <= 0 || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := clientKey(r)
+		remaining, ok := clientLimiter.acquire(client)
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(clientLimiter.limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", "1")
+		if !ok {
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				if tmpl, err := current.GetPathTemplate(); err == nil {
+					route = tmpl
+				}
+			}
+
+			// Don't log API keys
+			logClient := client
+			if strings.HasPrefix(client, "key:") {
+				logClient = "key:" + redactedValue
+			}
+			logger.Warn(r.Context(), "Client exceeded concurrent request limit", map[string]interface{}{
+				"client":   logClient,
+				"endpoint": route,
+				"limit":    clientLimiter.limit,
+			})
+
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, "Too many concurrent requests")
+			logger.CountRequest(r.Context(), route, 429)
+			return
+		}
+		defer clientLimiter.release(client)
+
+		next.ServeHTTP(w, r)
+	})
+}
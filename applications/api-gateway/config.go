@@ -0,0 +1,28 @@
+package main
+
+import (
+	"embed"
+
+	service "github.com/faidon-laboratory/go-service"
+)
+
+// Configuration profiles
+//
+// Defaults depend on ENVIRONMENT: development, staging and production each
+// have a profile of KEY=VALUE lines embedded in the binary
+// (profiles/<environment>.env) covering log level, trace sampling, timeouts
+// and fail rates. A setting is taken from the first of: the process
+// environment, the file named by CONFIG_FILE (same format), the profile, and
+// the default in the code. Other environments get no profile. The development
+// profile matches the code defaults.
+
+//go:embed profiles/*.env
+var profileFiles embed.FS
+
+// config reads the settings; invalid ones are kept for --selftest
+var config = service.NewConfig(profileFiles)
+
+// configWarning logs an invalid setting and keeps it for the self-test
+func configWarning(format string, args ...interface{}) {
+	config.Warn(format, args...)
+}
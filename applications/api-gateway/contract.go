@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"api-gateway/models"
+)
+
+// Upstream contract validation
+//
+// With SCHEMA_VALIDATION=warn or enforce, successful (2xx) responses of the
+// user and notification services are checked against a JSON Schema per
+// endpoint (schemas/<service>.json, keyed by "METHOD /path/{id}") before the
+// gateway uses them. Violations are counted in
+// upstream_contract_violations_total and logged with the offending fields; in
+// enforce mode the response is also replaced by a 502 so broken data never
+// reaches clients. Endpoints without a schema and bodies larger than
+// SCHEMA_MAX_BYTES are not checked.
+//
+// Only the subset of JSON Schema the contracts need is supported: type (a
+// name or a list), enum, required, properties, additionalProperties (as a
+// boolean) and items.
+
+const (
+	schemaValidationOff     = "off"
+	schemaValidationWarn    = "warn"
+	schemaValidationEnforce = "enforce"
+
+	// contractViolationHeader marks the 502 replacing a rejected response
+	contractViolationHeader = "X-Contract-Violation"
+)
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// notificationServiceTransport is used by every client calling the
+// notification service
+var notificationServiceTransport http.RoundTripper = http.DefaultTransport
+
+var (
+	schemaValidation string
+	schemaMaxBytes   int64
+)
+
+func init() {
+	schemaValidation = getEnvString("SCHEMA_VALIDATION", schemaValidationOff)
+	schemaMaxBytes = int64(getEnvInt("SCHEMA_MAX_BYTES", 1<<20))
+}
+
+// schemaTypes is the "type" keyword, a single name or a list of names
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type must be a string or a list of strings")
+	}
+	*t = list
+	return nil
+}
+
+// jsonSchema is the supported subset of a JSON Schema
+type jsonSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+}
+
+// validate appends the ways value breaks the schema to violations
+func (s *jsonSchema) validate(path string, value interface{}, violations *[]string) {
+	if len(*violations) >= maxReportedDifferences {
+		return
+	}
+	if path == "" {
+		path = "$"
+	}
+
+	if len(s.Type) > 0 && !s.matchesType(value) {
+		*violations = append(*violations, fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(s.Type, " or "), jsonTypeName(value)))
+		return
+	}
+
+	if len(s.Enum) > 0 {
+		allowed := false
+		for _, candidate := range s.Enum {
+			if candidate == value {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			*violations = append(*violations, fmt.Sprintf("%s: %s is not one of the allowed values", path, diffValueString(value)))
+			return
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := v[key]; !ok {
+				*violations = append(*violations, fmt.Sprintf("%s.%s: required field missing", path, key))
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if property, ok := s.Properties[key]; ok {
+				property.validate(path+"."+key, v[key], violations)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*violations = append(*violations, fmt.Sprintf("%s.%s: unexpected field", path, key))
+			}
+		}
+
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, violations)
+			}
+		}
+	}
+}
+
+// matchesType reports whether value has one of the schema's types
+func (s *jsonSchema) matchesType(value interface{}) bool {
+	actual := jsonTypeName(value)
+	for _, expected := range s.Type {
+		switch {
+		case expected == actual:
+			return true
+		case expected == "integer" && actual == "number":
+			if f := value.(float64); f == math.Trunc(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonTypeName returns the JSON Schema type of a decoded JSON value
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// contractTransport validates upstream responses against their schemas
+type contractTransport struct {
+	base     http.RoundTripper
+	upstream string
+	schemas  map[string]*jsonSchema
+	enforce  bool
+}
+
+// withContractValidation wraps a transport calling upstream, unless
+// validation is off or the upstream has no schemas
+func withContractValidation(upstream string, base http.RoundTripper) http.RoundTripper {
+	switch schemaValidation {
+	case schemaValidationOff:
+		return base
+	case schemaValidationWarn, schemaValidationEnforce:
+	default:
+		configWarning("Unknown SCHEMA_VALIDATION %q, not validating upstream responses", schemaValidation)
+		return base
+	}
+
+	data, err := schemaFiles.ReadFile("schemas/" + upstream + ".json")
+	if err != nil {
+		return base
+	}
+	var schemas map[string]*jsonSchema
+	if err := json.Unmarshal(data, &schemas); err != nil {
+		log.Printf("Invalid response schemas for %s, not validating: %v", upstream, err)
+		return base
+	}
+
+	return &contractTransport{
+		base:     base,
+		upstream: upstream,
+		schemas:  schemas,
+		enforce:  schemaValidation == schemaValidationEnforce,
+	}
+}
+
+func (t *contractTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	// Only the gateway may mark a response as rejected
+	resp.Header.Del(contractViolationHeader)
+
+	endpoint := req.Method + " " + normalizeUserServicePath(req.URL.Path)
+	schema, ok := t.schemas[endpoint]
+	if !ok || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, schemaMaxBytes+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > schemaMaxBytes {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var violations []string
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		violations = []string{"$: invalid JSON: " + err.Error()}
+	} else {
+		schema.validate("", decoded, &violations)
+	}
+	if len(violations) == 0 {
+		return resp, nil
+	}
+
+	ctx := req.Context()
+	recordContractViolation(ctx, t.upstream, endpoint)
+	logger.Warn(ctx, "Upstream response violates its schema", map[string]interface{}{
+		"upstream":    t.upstream,
+		"endpoint":    endpoint,
+		"status_code": resp.StatusCode,
+		"violations":  violations,
+		"enforced":    t.enforce,
+	})
+	if !t.enforce {
+		return resp, nil
+	}
+	return contractViolationResponse(req, t.upstream), nil
+}
+
+// contractViolationResponse is the 502 replacing a rejected upstream response
+func contractViolationResponse(req *http.Request, upstream string) *http.Response {
+	body, _ := json.Marshal(models.Error{
+		OK:    false,
+		Error: "Invalid response from " + upstream,
+	})
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	header.Set(contractViolationHeader, upstream)
+	return &http.Response{
+		Status:        "502 Bad Gateway",
+		StatusCode:    http.StatusBadGateway,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
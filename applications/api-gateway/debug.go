@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	logging "github.com/faidon-laboratory/go-logging"
+)
+
+// Per-request debugging
+//
+// A request with "X-Debug: true" and admin credentials (see admin.go) is
+// debugged on its own: it is logged at debug level whatever LOG_LEVEL says,
+// its trace is always sampled and tagged debug=true, and the response carries
+// a second Server-Timing header with the time spent in each span that
+// finished before the response was written (upstream calls, workflow steps).
+// Without valid credentials the header is ignored.
+
+const debugHeader = "X-Debug"
+
+// debugWriter adds the timing breakdown when the response headers go out
+type debugWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	wroteHeader bool
+}
+
+func (dw *debugWriter) WriteHeader(status int) {
+	if !dw.wroteHeader {
+		dw.wroteHeader = true
+		if timing := serverTiming(dw.r); timing != "" {
+			dw.Header().Add("Server-Timing", timing)
+		}
+	}
+	dw.ResponseWriter.WriteHeader(status)
+}
+
+func (dw *debugWriter) Write(data []byte) (int, error) {
+	if !dw.wroteHeader {
+		dw.WriteHeader(http.StatusOK)
+	}
+	return dw.ResponseWriter.Write(data)
+}
+
+func (dw *debugWriter) Flush() {
+	if !dw.wroteHeader {
+		dw.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := dw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (dw *debugWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := dw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+func (dw *debugWriter) Unwrap() http.ResponseWriter {
+	return dw.ResponseWriter
+}
+
+// serverTiming formats the finished spans of a debug request as a
+// Server-Timing header value
+func serverTiming(r *http.Request) string {
+	var entries []string
+	for _, timing := range logging.Timings(r.Context()) {
+		entries = append(entries, fmt.Sprintf("%s;dur=%.1f", timing.Operation, milliseconds(timing.Duration)))
+	}
+	return strings.Join(entries, ", ")
+}
+
+// debugMiddleware turns on debugging for requests that ask for it
+func debugMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(debugHeader) != "true" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authStart := time.Now()
+		identity, method, ok := adminConfig.Authenticate(r)
+		recordPhase(r.Context(), phaseAuth, time.Since(authStart))
+		if !ok {
+			logger.Warn(r.Context(), "Debug header ignored without admin credentials", map[string]interface{}{
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"remote_addr": r.RemoteAddr,
+			})
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.WithContext(logging.WithDebug(r.Context()))
+		logger.Info(r.Context(), "Debug request", map[string]interface{}{
+			"identity":    identity,
+			"auth_method": method,
+			"method":      r.Method,
+			"path":        r.URL.Path,
+		})
+		next.ServeHTTP(&debugWriter{ResponseWriter: w, r: r}, r)
+	})
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"api-gateway/clients/failures"
+	service "github.com/faidon-laboratory/go-service"
+)
+
+// Dependency matrix
+//
+// GET /admin/dependencies shows what is broken and what it affects: for each
+// upstream, its state, its error rate over the last DEPENDENCY_WINDOW_SEC
+// seconds, the last error, and the gateway functionality that depends on it
+// with how that functionality behaves while the upstream isn't healthy.
+// degraded_functionality lists the entries affected right now. States:
+//
+//	healthy      error rate below DEPENDENCY_DEGRADED_ERROR_RATE (0.1)
+//	degraded     at or above it
+//	unavailable  at or above DEPENDENCY_UNAVAILABLE_ERROR_RATE (0.5)
+//	bypassed     not called at all (the user service in USER_SERVICE_MODE=memory)
+//
+// A call fails when the upstream can't be reached, answers with a 5xx, or
+// throttles or times out the request (429, 408); other 4xx are the caller's
+// doing. Failures are classified (see clients/failures) and counted in
+// dependency_errors_total by dependency and class, and the class of the last
+// one is shown. Calls abandoned because the client went away are not
+// counted. The gateway has no circuit breaker, so there is no circuit-open
+// state: an upstream failing every call shows as unavailable.
+
+const (
+	dependencyHealthy     = "healthy"
+	dependencyDegraded    = "degraded"
+	dependencyUnavailable = "unavailable"
+	dependencyBypassed    = "bypassed"
+)
+
+// dependencyImpact is a piece of functionality relying on a dependency
+type dependencyImpact struct {
+	Functionality string `json:"functionality"`
+	Effect        string `json:"effect"`
+}
+
+// dependency is an upstream whose calls are tracked
+type dependency struct {
+	name   string
+	url    func() string
+	impact func() []dependencyImpact
+
+	mu        sync.Mutex
+	slots     []dependencySlot
+	lastError string
+	lastClass failures.Class
+	lastAt    time.Time
+}
+
+// dependencySlot counts the calls of one second
+type dependencySlot struct {
+	second   int64
+	requests int
+	errors   int
+}
+
+var (
+	dependencyWindow          int
+	dependencyDegradedRate    float64
+	dependencyUnavailableRate float64
+
+	userServiceDependency = &dependency{
+		name:   "user-service",
+		url:    func() string { return userServiceURL },
+		impact: userServiceImpact,
+	}
+	notificationServiceDependency = &dependency{
+		name: "notification-service",
+		url:  func() string { return notificationServiceURL },
+		impact: func() []dependencyImpact {
+			return []dependencyImpact{
+				{"POST /process-user", "fails with 500 after the user service call"},
+				{"POST /api/process", "workflows fail at the notify step"},
+				{"GET /api/notifications", "fails with 5xx"},
+				{"GET /api/users/{id}/summary", "partial response without notifications"},
+			}
+		},
+	}
+	dependencies = []*dependency{userServiceDependency, notificationServiceDependency}
+)
+
+func init() {
+	dependencyWindow = max(getEnvInt("DEPENDENCY_WINDOW_SEC", 60), 1)
+	dependencyDegradedRate = getEnvFloat("DEPENDENCY_DEGRADED_ERROR_RATE", 0.1)
+	dependencyUnavailableRate = getEnvFloat("DEPENDENCY_UNAVAILABLE_ERROR_RATE", 0.5)
+	for _, dep := range dependencies {
+		dep.slots = make([]dependencySlot, dependencyWindow)
+	}
+}
+
+// userServiceImpact describes user functionality for USER_SERVICE_MODE
+func userServiceImpact() []dependencyImpact {
+	if userServiceMode != userServiceRemote {
+		const fromMemory = "answered from the in-memory store (demo users, no shared state)"
+		return []dependencyImpact{
+			{"GET /api/users/{id}", fromMemory},
+			{"POST /api/users", fromMemory},
+			{"POST /process-user", fromMemory},
+			{"POST /api/process", fromMemory},
+			{"GET /api/users/{id}/summary", fromMemory},
+		}
+	}
+	return []dependencyImpact{
+		{"GET /api/users/{id}", "fails with 5xx"},
+		{"POST /api/users", "fails with 5xx"},
+		{"POST /process-user", "fails with 500"},
+		{"POST /api/process", "workflows fail at the fetch_user step"},
+		{"GET /api/users/{id}/summary", "partial response without the profile"},
+	}
+}
+
+// withDependencyTracking records the outcome of every call through base
+func withDependencyTracking(dep *dependency, base http.RoundTripper) http.RoundTripper {
+	return &dependencyTransport{base: base, dep: dep}
+}
+
+// dependencyTransport counts the calls and failures of a dependency
+type dependencyTransport struct {
+	base http.RoundTripper
+	dep  *dependency
+}
+
+func (t *dependencyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil && errors.Is(req.Context().Err(), context.Canceled) {
+		// The client went away, the upstream is not to blame
+		return resp, err
+	}
+	class := failures.Classify(resp, err)
+	if class == failures.NonRetryable && err == nil && resp.StatusCode < http.StatusInternalServerError {
+		// A 4xx answer to a bad request
+		class = failures.None
+	}
+	switch {
+	case class == failures.None:
+		t.dep.record("", class)
+	case err != nil:
+		t.dep.record(err.Error(), class)
+	default:
+		t.dep.record(resp.Status, class)
+	}
+	if class != failures.None {
+		recordDependencyError(req.Context(), t.dep.name, class)
+	}
+	return resp, err
+}
+
+// record counts a call, failed with class if failure is not empty
+func (d *dependency) record(failure string, class failures.Class) {
+	now := time.Now()
+	second := now.Unix()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	slot := &d.slots[second%int64(len(d.slots))]
+	if slot.second != second {
+		*slot = dependencySlot{second: second}
+	}
+	slot.requests++
+	if failure != "" {
+		slot.errors++
+		d.lastError = failure
+		d.lastClass = class
+		d.lastAt = now
+	}
+}
+
+// dependencyStatus is a dependency's entry in /admin/dependencies
+type dependencyStatus struct {
+	Name        string             `json:"name"`
+	URL         string             `json:"url,omitempty"`
+	State       string             `json:"state"`
+	Requests    int                `json:"requests"`
+	Errors      int                `json:"errors"`
+	ErrorRate   float64            `json:"error_rate"`
+	LastError   string             `json:"last_error,omitempty"`
+	LastClass   string             `json:"last_error_class,omitempty"`
+	LastErrorAt *time.Time         `json:"last_error_at,omitempty"`
+	Impact      []dependencyImpact `json:"impact"`
+}
+
+// status returns the dependency's state over the window
+func (d *dependency) status() dependencyStatus {
+	s := dependencyStatus{Name: d.name, URL: d.url(), Impact: d.impact()}
+	oldest := time.Now().Unix() - int64(len(d.slots)) + 1
+
+	d.mu.Lock()
+	for _, slot := range d.slots {
+		if slot.second >= oldest {
+			s.Requests += slot.requests
+			s.Errors += slot.errors
+		}
+	}
+	if !d.lastAt.IsZero() {
+		s.LastError = d.lastError
+		s.LastClass = string(d.lastClass)
+		lastAt := d.lastAt.UTC()
+		s.LastErrorAt = &lastAt
+	}
+	d.mu.Unlock()
+
+	if s.Requests > 0 {
+		s.ErrorRate = float64(s.Errors) / float64(s.Requests)
+	}
+	switch {
+	case d == userServiceDependency && userServiceMode == userServiceMemory:
+		s.State = dependencyBypassed
+	case s.Requests > 0 && s.ErrorRate >= dependencyUnavailableRate:
+		s.State = dependencyUnavailable
+	case s.Requests > 0 && s.ErrorRate >= dependencyDegradedRate:
+		s.State = dependencyDegraded
+	default:
+		s.State = dependencyHealthy
+	}
+	return s
+}
+
+// degradedFunctionality is a functionality affected by an unhealthy
+// dependency
+type degradedFunctionality struct {
+	Functionality string `json:"functionality"`
+	Dependency    string `json:"dependency"`
+	State         string `json:"state"`
+	Effect        string `json:"effect"`
+}
+
+// dependencyMatrix is the body of GET /admin/dependencies
+type dependencyMatrix struct {
+	OK                    bool                    `json:"ok"`
+	WindowSeconds         int                     `json:"window_seconds"`
+	Dependencies          []dependencyStatus      `json:"dependencies"`
+	DegradedFunctionality []degradedFunctionality `json:"degraded_functionality"`
+}
+
+// Dependency matrix endpoint
+func adminDependenciesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	logger.AddSpanAttribute(ctx, "admin.identity", service.AdminIdentity(ctx))
+
+	statuses := make([]dependencyStatus, 0, len(dependencies))
+	degraded := []degradedFunctionality{}
+	for _, dep := range dependencies {
+		s := dep.status()
+		statuses = append(statuses, s)
+		if s.State == dependencyHealthy {
+			continue
+		}
+		for _, impact := range s.Impact {
+			degraded = append(degraded, degradedFunctionality{
+				Functionality: impact.Functionality,
+				Dependency:    s.Name,
+				State:         s.State,
+				Effect:        impact.Effect,
+			})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, dependencyMatrix{
+		OK:                    true,
+		WindowSeconds:         dependencyWindow,
+		Dependencies:          statuses,
+		DegradedFunctionality: degraded,
+	})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Response diffing
+//
+// Mirrored requests compare the body of the shadow response with the
+// primary's. JSON bodies are decoded and compared structurally after dropping
+// volatile fields (SHADOW_DIFF_IGNORE_FIELDS: a bare name ignores the field at
+// any depth, a dotted path such as "user.updated_at" only that one); other
+// bodies are compared byte for byte after trimming whitespace. Bodies larger
+// than SHADOW_DIFF_MAX_BYTES are not compared.
+
+// maxReportedDifferences caps the differences kept per comparison
+const maxReportedDifferences = 10
+
+// responseDiffer compares primary and shadow responses
+type responseDiffer struct {
+	ignoreNames map[string]bool
+	ignorePaths map[string]bool
+}
+
+// newResponseDiffer creates a differ ignoring a comma-separated list of
+// field names and dotted paths
+func newResponseDiffer(ignore string) *responseDiffer {
+	d := &responseDiffer{
+		ignoreNames: make(map[string]bool),
+		ignorePaths: make(map[string]bool),
+	}
+	for _, field := range strings.Split(ignore, ",") {
+		field = strings.TrimSpace(field)
+		switch {
+		case field == "":
+		case strings.Contains(field, "."):
+			d.ignorePaths[field] = true
+		default:
+			d.ignoreNames[field] = true
+		}
+	}
+	return d
+}
+
+// diff returns the differences between two response bodies, empty if they
+// match
+func (d *responseDiffer) diff(primary, shadow []byte) []string {
+	var primaryValue, shadowValue interface{}
+	primaryErr := json.Unmarshal(primary, &primaryValue)
+	shadowErr := json.Unmarshal(shadow, &shadowValue)
+
+	if primaryErr != nil || shadowErr != nil {
+		if bytes.Equal(bytes.TrimSpace(primary), bytes.TrimSpace(shadow)) {
+			return nil
+		}
+		return []string{fmt.Sprintf("body: primary=%s shadow=%s", truncateDiffValue(string(primary)), truncateDiffValue(string(shadow)))}
+	}
+
+	var differences []string
+	d.compare("", primaryValue, shadowValue, &differences)
+	return differences
+}
+
+// compare walks two decoded JSON values and appends their differences
+func (d *responseDiffer) compare(path string, primary, shadow interface{}, differences *[]string) {
+	if len(*differences) >= maxReportedDifferences {
+		return
+	}
+
+	switch p := primary.(type) {
+	case map[string]interface{}:
+		s, ok := shadow.(map[string]interface{})
+		if !ok {
+			d.report(path, primary, shadow, differences)
+			return
+		}
+		keys := make(map[string]bool, len(p)+len(s))
+		for key := range p {
+			keys[key] = true
+		}
+		for key := range s {
+			keys[key] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+
+		for _, key := range sorted {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if d.ignoreNames[key] || d.ignorePaths[childPath] {
+				continue
+			}
+			primaryChild, inPrimary := p[key]
+			shadowChild, inShadow := s[key]
+			switch {
+			case !inPrimary:
+				d.report(childPath, "<missing>", shadowChild, differences)
+			case !inShadow:
+				d.report(childPath, primaryChild, "<missing>", differences)
+			default:
+				d.compare(childPath, primaryChild, shadowChild, differences)
+			}
+		}
+
+	case []interface{}:
+		s, ok := shadow.([]interface{})
+		if !ok || len(p) != len(s) {
+			d.report(path, primary, shadow, differences)
+			return
+		}
+		for i := range p {
+			d.compare(fmt.Sprintf("%s[%d]", path, i), p[i], s[i], differences)
+		}
+
+	default:
+		if primary != shadow {
+			d.report(path, primary, shadow, differences)
+		}
+	}
+}
+
+// report appends a single difference
+func (d *responseDiffer) report(path string, primary, shadow interface{}, differences *[]string) {
+	if path == "" {
+		path = "$"
+	}
+	*differences = append(*differences, fmt.Sprintf("%s: primary=%s shadow=%s", path, diffValueString(primary), diffValueString(shadow)))
+}
+
+// diffValueString renders a value of a difference for logging
+func diffValueString(value interface{}) string {
+	if s, ok := value.(string); ok && s == "<missing>" {
+		return s
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return truncateDiffValue(fmt.Sprint(value))
+	}
+	return truncateDiffValue(string(encoded))
+}
+
+// truncateDiffValue keeps logged values short
+func truncateDiffValue(value string) string {
+	const maxLength = 100
+	if len(value) <= maxLength {
+		return value
+	}
+	return value[:maxLength] + "..."
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"api-gateway/clients/userservice"
+	"api-gateway/models"
+	service "github.com/faidon-laboratory/go-service"
+	"github.com/gorilla/mux"
+)
+
+// Feature previews
+//
+// Clients opt into preview response shapes of existing routes with the
+// X-Feature-Preview header, a comma-separated list of preview names, e.g.
+// "X-Feature-Preview: users-v2". Each preview is a feature flag rolled out to
+// a share of clients (FEATURE_PREVIEWS, e.g. "users-v2=25"; 0 turns it off):
+// a client is in the rollout if the hash of its key (API key or IP, as for
+// the concurrency limit) and the preview name falls under the percentage, so
+// it sees the same shape on every request while the share is raised.
+//
+// A route that serves a preview names it in the X-Feature-Preview response
+// header, and every route with a preview shape sends Vary: X-Feature-Preview.
+// Requests for a preview are counted in feature_preview_requests_total by
+// preview, endpoint and outcome (applied or not_rolled_out). Previews not
+// offered by a route are ignored. GET /admin/features lists the previews and
+// their rollout.
+
+const featurePreviewHeader = "X-Feature-Preview"
+
+// Preview names
+const (
+	// previewUsersV2 serves users with the v2 schema: "id" instead of
+	// "user_id", and "last_login_at" omitted until the first login
+	previewUsersV2 = "users-v2"
+)
+
+// featureFlag is a preview and the share of clients it is rolled out to
+type featureFlag struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Routes      []string `json:"routes"`
+	Rollout     int      `json:"rollout_percent"`
+}
+
+// featureFlags are the known previews by name
+var featureFlags = map[string]*featureFlag{
+	previewUsersV2: {
+		Name:        previewUsersV2,
+		Description: "v2 user schema: id instead of user_id, last_login_at only once set",
+		Routes:      []string{"GET /api/users/{id}", "POST /api/users"},
+	},
+}
+
+func init() {
+	for name, rollout := range parseFeaturePreviews(getEnvString("FEATURE_PREVIEWS", previewUsersV2+"=100")) {
+		flag, ok := featureFlags[name]
+		if !ok {
+			configWarning("Ignoring unknown preview %q in FEATURE_PREVIEWS", name)
+			continue
+		}
+		flag.Rollout = rollout
+	}
+}
+
+// parseFeaturePreviews parses "name=percent,..." into rollout percentages
+func parseFeaturePreviews(spec string) map[string]int {
+	rollouts := make(map[string]int)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(entry, "=")
+		percent, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || percent < 0 || percent > 100 {
+			configWarning("Invalid FEATURE_PREVIEWS entry %q, expected name=0..100", entry)
+			continue
+		}
+		rollouts[strings.TrimSpace(name)] = percent
+	}
+	return rollouts
+}
+
+// inRollout tells whether a client falls in a flag's rollout
+func (f *featureFlag) inRollout(client string) bool {
+	return hashKey(f.Name+"|"+client)%100 < uint64(f.Rollout)
+}
+
+// requestedPreview tells whether a request asks for a preview
+func requestedPreview(r *http.Request, name string) bool {
+	for _, value := range r.Header.Values(featurePreviewHeader) {
+		for _, requested := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(requested), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usePreview tells whether to answer a request with a preview shape. It marks
+// the response as varying with the header and, if the preview applies, names
+// it in the response.
+func usePreview(w http.ResponseWriter, r *http.Request, name string) bool {
+	w.Header().Add("Vary", featurePreviewHeader)
+	if !requestedPreview(r, name) {
+		return false
+	}
+
+	endpoint := r.URL.Path
+	if current := mux.CurrentRoute(r); current != nil {
+		if tmpl, err := current.GetPathTemplate(); err == nil {
+			endpoint = tmpl
+		}
+	}
+
+	flag := featureFlags[name]
+	applied := flag != nil && flag.inRollout(clientKey(r))
+	outcome := "not_rolled_out"
+	if applied {
+		outcome = "applied"
+		w.Header().Add(featurePreviewHeader, name)
+		logger.AddSpanAttribute(r.Context(), "feature_preview", name)
+	}
+	recordFeaturePreview(r.Context(), name, endpoint, outcome)
+	return applied
+}
+
+// toUserV2 converts a user to the v2 schema
+func toUserV2(user *userservice.User) models.UserV2 {
+	return models.UserV2{
+		ID:          user.UserID,
+		Name:        user.Name,
+		Email:       user.Email,
+		Status:      user.Status,
+		CreatedAt:   user.CreatedAt,
+		LastLoginAt: user.LastLogin,
+	}
+}
+
+// userResponse is the body answering a request with a user, in the v2 schema
+// if the client opted into it
+func userResponse(w http.ResponseWriter, r *http.Request, user *userservice.User) interface{} {
+	if usePreview(w, r, previewUsersV2) {
+		return models.UserResponseV2{OK: true, User: toUserV2(user), SchemaVersion: 2}
+	}
+	return models.UserResponse{OK: true, User: user}
+}
+
+// previewList is the body of GET /admin/features
+type previewList struct {
+	OK       bool           `json:"ok"`
+	Header   string         `json:"header"`
+	Previews []*featureFlag `json:"previews"`
+}
+
+// Feature preview listing endpoint
+func adminFeaturesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	logger.AddSpanAttribute(ctx, "admin.identity", service.AdminIdentity(ctx))
+
+	flags := make([]*featureFlag, 0, len(featureFlags))
+	for _, flag := range featureFlags {
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+
+	writeJSON(w, http.StatusOK, previewList{
+		OK:       true,
+		Header:   featurePreviewHeader,
+		Previews: flags,
+	})
+}
+
+// previewsSummary lists the previews rolled out to anyone, for the startup log
+func previewsSummary() string {
+	var enabled []string
+	for name, flag := range featureFlags {
+		if flag.Rollout > 0 {
+			enabled = append(enabled, fmt.Sprintf("%s=%d", name, flag.Rollout))
+		}
+	}
+	sort.Strings(enabled)
+	return strings.Join(enabled, ",")
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"api-gateway/models"
+	"github.com/gorilla/mux"
+)
+
+// Hello endpoint
+//
+// GET /hello/{name} greets the caller, as a small fully instrumented route to
+// change in workshops. The message is GREETING_TEMPLATE (Go text/template,
+// fields .Greeting, .Name and .Locale, functions title, upper and lower)
+// rendered with the greeting word of the caller's locale: GREETING for
+// DEFAULT_LOCALE, GREETING_TRANSLATIONS ("de=hallo,fr=bonjour") for the
+// others. The locale is the ?locale= parameter, else the best supported
+// Accept-Language tag, else DEFAULT_LOCALE, and is returned in
+// Content-Language. Greetings are counted in greetings_total by locale.
+
+const maxGreetingName = 64
+
+// defaultGreetingTemplate is used when GREETING_TEMPLATE is unset or invalid
+const defaultGreetingTemplate = "{{.Greeting | title}}, {{.Name}}!"
+
+var (
+	greetingTemplate *template.Template
+	defaultLocale    string
+	// greetings maps each supported locale to its greeting word
+	greetings map[string]string
+)
+
+// greetingFuncs are the functions available to GREETING_TEMPLATE
+var greetingFuncs = template.FuncMap{
+	"title": func(s string) string {
+		if s == "" {
+			return s
+		}
+		r, size := utf8.DecodeRuneInString(s)
+		return string(unicode.ToTitle(r)) + s[size:]
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+func init() {
+	defaultLocale = strings.ToLower(getEnvString("DEFAULT_LOCALE", "en"))
+	greetings = parseGreetingTranslations(getEnvString("GREETING_TRANSLATIONS", "de=hallo,fr=bonjour,es=hola,el=γεια σου"))
+	// Read here as well, as main.go's init runs after this file's
+	greetings[defaultLocale] = getEnvString("GREETING", "hello")
+
+	text := getEnvString("GREETING_TEMPLATE", defaultGreetingTemplate)
+	tmpl, err := template.New("greeting").Funcs(greetingFuncs).Option("missingkey=error").Parse(text)
+	if err == nil {
+		// Catch unknown fields now rather than on every request
+		err = tmpl.Execute(&bytes.Buffer{}, greetingData{Greeting: greetings[defaultLocale], Name: "test", Locale: defaultLocale})
+	}
+	if err != nil {
+		configWarning("Invalid GREETING_TEMPLATE %q, using %q: %v", text, defaultGreetingTemplate, err)
+		tmpl = template.Must(template.New("greeting").Funcs(greetingFuncs).Parse(defaultGreetingTemplate))
+	}
+	greetingTemplate = tmpl
+}
+
+// greetingData are the fields of GREETING_TEMPLATE
+type greetingData struct {
+	Greeting string
+	Name     string
+	Locale   string
+}
+
+// parseGreetingTranslations parses "locale=word,..." into greetings by locale
+func parseGreetingTranslations(spec string) map[string]string {
+	translations := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		locale, word, found := strings.Cut(entry, "=")
+		if !found || strings.TrimSpace(locale) == "" || strings.TrimSpace(word) == "" {
+			configWarning("Invalid GREETING_TRANSLATIONS entry %q, expected locale=greeting", entry)
+			continue
+		}
+		translations[strings.ToLower(strings.TrimSpace(locale))] = strings.TrimSpace(word)
+	}
+	return translations
+}
+
+// negotiateLocale picks the supported locale for a request
+func negotiateLocale(r *http.Request) string {
+	if locale := strings.ToLower(r.URL.Query().Get("locale")); locale != "" {
+		if _, ok := greetings[locale]; ok {
+			return locale
+		}
+		return defaultLocale
+	}
+
+	// Accept-Language: "fr-CH, fr;q=0.9, en;q=0.8, *;q=0.5"
+	type tag struct {
+		locale string
+		q      float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		locale, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if locale != "" && q > 0 {
+			tags = append(tags, tag{locale: strings.ToLower(locale), q: q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	for _, t := range tags {
+		if _, ok := greetings[t.locale]; ok {
+			return t.locale
+		}
+		// fr-CH falls back to fr
+		if primary, _, found := strings.Cut(t.locale, "-"); found {
+			if _, ok := greetings[primary]; ok {
+				return primary
+			}
+		}
+	}
+	return defaultLocale
+}
+
+// Hello endpoint
+func helloHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	name := mux.Vars(r)["name"]
+	if utf8.RuneCountInString(name) > maxGreetingName {
+		writeError(w, http.StatusBadRequest, "Name longer than "+strconv.Itoa(maxGreetingName)+" characters")
+		return
+	}
+
+	locale := negotiateLocale(r)
+	logger.AddSpanAttribute(ctx, "locale", locale)
+
+	var message bytes.Buffer
+	err := greetingTemplate.Execute(&message, greetingData{Greeting: greetings[locale], Name: name, Locale: locale})
+	if err != nil {
+		logger.Error(ctx, "Failed to render greeting", err, map[string]interface{}{
+			"locale": locale,
+		})
+		writeError(w, http.StatusInternalServerError, "Failed to render greeting")
+		return
+	}
+
+	recordGreeting(ctx, locale)
+	logger.Info(ctx, "Greeted caller", map[string]interface{}{
+		"locale": locale,
+	})
+
+	w.Header().Set("Content-Language", locale)
+	w.Header().Add("Vary", "Accept-Language")
+	writeJSON(w, http.StatusOK, models.Greeting{
+		OK:       true,
+		Message:  message.String(),
+		Greeting: greetings[locale],
+		Locale:   locale,
+	})
+}
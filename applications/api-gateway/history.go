@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/models"
+	"github.com/faidon-laboratory/go-logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Workflow execution history
+//
+// Every finished workflow run, from the API or a schedule, is kept in a
+// bounded in-memory history (WORKFLOW_HISTORY_SIZE) with its step durations,
+// outcome and trace ID, so a run listed by GET /api/process/history can be
+// looked up in Tempo. Inputs are stored redacted: only the workflow ID and
+// priority are kept verbatim, the data payload keeps its shape but not its
+// values. When TRACE_URL_TEMPLATE is set (e.g.
+// "https://grafana.example.com/explore?traceId={trace_id}") each entry also
+// carries a ready-made trace link. Finished runs are also counted in
+// workflows_processed_total and workflow_duration_seconds by source and
+// outcome, and in sli_requests_total under workflow_success, where only runs
+// failed by the gateway or an upstream (5xx) are bad.
+
+const redactedValue = "[redacted]"
+
+// Sources of a workflow run
+const (
+	runSourceAPI      = "api"
+	runSourceSchedule = "schedule"
+)
+
+// WorkflowExecution is the record of a finished workflow run
+type WorkflowExecution = models.WorkflowExecution
+
+// executionHistory keeps the most recent workflow runs in a ring buffer
+type executionHistory struct {
+	mu      sync.RWMutex
+	entries []WorkflowExecution
+	next    int
+	full    bool
+	nextID  int
+}
+
+var (
+	workflowHistory  *executionHistory
+	traceURLTemplate string
+)
+
+func init() {
+	workflowHistory = &executionHistory{
+		entries: make([]WorkflowExecution, max(getEnvInt("WORKFLOW_HISTORY_SIZE", 1000), 1)),
+	}
+	traceURLTemplate = getEnvString("TRACE_URL_TEMPLATE", "")
+}
+
+// add stores an execution, evicting the oldest once the history is full
+func (h *executionHistory) add(execution WorkflowExecution) WorkflowExecution {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	execution.ID = fmt.Sprintf("run_%d", h.nextID)
+
+	h.entries[h.next] = execution
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+	return execution
+}
+
+// list returns up to limit executions, newest first, optionally filtered by
+// workflow ID
+func (h *executionHistory) list(workflowID string, limit int) []WorkflowExecution {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	count := h.next
+	if h.full {
+		count = len(h.entries)
+	}
+
+	result := make([]WorkflowExecution, 0, min(limit, count))
+	for i := 0; i < count && len(result) < limit; i++ {
+		execution := h.entries[(h.next-1-i+len(h.entries))%len(h.entries)]
+		if workflowID != "" && execution.WorkflowID != workflowID {
+			continue
+		}
+		result = append(result, execution)
+	}
+	return result
+}
+
+// recordExecution adds a finished run to the history and returns its ID
+func recordExecution(ctx context.Context, source, scheduleID string, run *workflowRun, err error, started time.Time) string {
+	execution := WorkflowExecution{
+		WorkflowID: run.WorkflowID,
+		Source:     source,
+		ScheduleID: scheduleID,
+		Input:      redactWorkflowInput(run),
+		Steps:      append([]stepResult(nil), run.Steps...),
+		Outcome:    "completed",
+		StatusCode: http.StatusOK,
+		StartedAt:  started.UTC(),
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		execution.Outcome = "failed"
+		execution.StatusCode, execution.Error = workflowErrorStatus(err)
+	}
+
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		execution.TraceID = spanContext.TraceID().String()
+		if traceURLTemplate != "" {
+			execution.TraceURL = strings.ReplaceAll(traceURLTemplate, "{trace_id}", execution.TraceID)
+		}
+	}
+
+	labels := logging.Labels{"source": source, "outcome": execution.Outcome}
+	logger.Counter("workflows_processed_total").Inc(ctx, labels)
+	logger.Histogram("workflow_duration_seconds").Record(ctx, time.Since(started).Seconds(), labels)
+	logger.CountSLI(ctx, "workflow_success", execution.StatusCode < http.StatusInternalServerError)
+
+	recorded := workflowHistory.add(execution)
+	workflowEvents.broadcast("execution", recorded.WorkflowID, recorded)
+	return recorded.ID
+}
+
+// redactWorkflowInput returns the run's input with personal and free-form
+// values replaced
+func redactWorkflowInput(run *workflowRun) map[string]interface{} {
+	input := map[string]interface{}{
+		"workflow_id": run.WorkflowID,
+	}
+	if run.Priority != "" {
+		input["priority"] = run.Priority
+	}
+	if run.UserID != "" {
+		input["user_id"] = redactedValue
+	}
+	if run.Message != "" {
+		input["message"] = redactedValue
+	}
+	if run.Records > 0 {
+		input["records"] = run.Records
+	}
+	if len(run.Data) > 0 {
+		var data interface{}
+		if err := json.Unmarshal(run.Data, &data); err != nil {
+			input["data"] = redactedValue
+		} else {
+			input["data"] = redactValue(data)
+		}
+	}
+	return input
+}
+
+// redactValue keeps the structure of a decoded JSON value and replaces its
+// leaves
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			redacted[key] = redactValue(item)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactValue(item)
+		}
+		return redacted
+	case nil:
+		return nil
+	default:
+		return redactedValue
+	}
+}
+
+// Workflow history endpoint
+func workflowHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	workflowID := r.URL.Query().Get("workflow_id")
+
+	limit := 50
+	if value, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && value > 0 && value <= 500 {
+		limit = value
+	}
+
+	result := workflowHistory.list(workflowID, limit)
+
+	writeJSON(w, http.StatusOK, models.ExecutionList{
+		OK:         true,
+		WorkflowID: workflowID,
+		Executions: result,
+		TotalCount: len(result),
+	})
+}
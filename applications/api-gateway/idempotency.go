@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Idempotency-Key replays
+//
+// A client retrying POST /api/users or POST /process-user after a timeout
+// can't tell whether its first attempt went through. When such a request
+// carries an Idempotency-Key header, the gateway keeps the response (status,
+// Content-Type and body) in the "idempotency" blob store (store.go) for
+// IDEMPOTENCY_TTL_SEC and answers a repeat of the request with it, marked
+// Idempotent-Replayed: true, instead of running it again. Keys are scoped to
+// the client (API key or IP, as for the concurrency limit) and stored hashed.
+//
+// A repeat while the first request is still running gets 409, and the same
+// key with another method, path or body gets 422. 5xx responses, bodies over
+// idempotencyMaxBytes and requests that ended without a response or whose
+// client left aren't kept, so those requests can be retried.
+// When the store can't be reached the request runs as if it had no key.
+// Requests with a key are counted in idempotent_requests_total by endpoint
+// and outcome. With STORE_BACKEND=redis, replays work across replicas.
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	idempotencyMaxBytes       = 1 << 20
+	idempotencyMaxKeyLength   = 255
+	idempotencyStateRunning   = "running"
+	idempotencyStateCompleted = "completed"
+	// idempotencyLockTTL frees the key of a request that never finished,
+	// e.g. because its replica stopped
+	idempotencyLockTTL = time.Minute
+)
+
+// idempotentRoutes are the path templates whose POST requests honor the key
+var idempotentRoutes = map[string]bool{
+	"/api/users":    true,
+	"/process-user": true,
+}
+
+var (
+	idempotencyStore blobStore
+	idempotencyTTL   time.Duration
+)
+
+func init() {
+	idempotencyStore = newBlobStore("idempotency")
+	idempotencyTTL = time.Duration(getEnvInt("IDEMPOTENCY_TTL_SEC", 86400)) * time.Second
+}
+
+// idempotencyRecord is the stored state of a key
+type idempotencyRecord struct {
+	State       string `json:"state"`
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// responseRecorder keeps a copy of the response it writes
+type responseRecorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(p []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	if !rr.overflow {
+		if rr.body.Len()+len(p) > idempotencyMaxBytes {
+			rr.overflow = true
+			rr.body.Reset()
+		} else {
+			rr.body.Write(p)
+		}
+	}
+	return rr.ResponseWriter.Write(p)
+}
+
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// idempotencyMiddleware replays the response of a repeated request with the
+// same Idempotency-Key
+func idempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+		if !idempotentRoutes[route] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+
+		if len(key) > idempotencyMaxKeyLength {
+			writeError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, idempotencyMaxBytes+1))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		if len(body) > idempotencyMaxBytes {
+			recordIdempotentRequest(ctx, route, "not_stored")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		storeKey := hashHex(clientKey(r) + "|" + key)
+		fingerprint := hashHex(r.Method + " " + r.URL.Path + "\n" + string(body))
+		logger.AddSpanAttribute(ctx, "idempotency_key", key)
+
+		running, _ := json.Marshal(idempotencyRecord{State: idempotencyStateRunning, Fingerprint: fingerprint})
+		claimed, err := idempotencyStore.SetNX(ctx, storeKey, running, idempotencyLockTTL)
+		if err != nil {
+			logger.Warn(ctx, "Idempotency store unavailable, running the request without replay", map[string]interface{}{
+				"endpoint": route,
+				"error":    err.Error(),
+			})
+			recordIdempotentRequest(ctx, route, "unavailable")
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !claimed {
+			replayIdempotent(w, r, route, storeKey, fingerprint)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		// A client leaving mustn't leave the key locked
+		storeCtx := context.WithoutCancel(ctx)
+		if recorder.status == 0 || recorder.status >= http.StatusInternalServerError || recorder.overflow || ctx.Err() != nil {
+			// Let the client retry
+			if err := idempotencyStore.Delete(storeCtx, storeKey); err != nil {
+				logger.Warn(ctx, "Failed to release Idempotency-Key", map[string]interface{}{
+					"endpoint": route,
+					"error":    err.Error(),
+				})
+			}
+			recordIdempotentRequest(ctx, route, "not_stored")
+			return
+		}
+		completed, _ := json.Marshal(idempotencyRecord{
+			State:       idempotencyStateCompleted,
+			Fingerprint: fingerprint,
+			Status:      recorder.status,
+			ContentType: recorder.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+		})
+		if err := idempotencyStore.Set(storeCtx, storeKey, completed, idempotencyTTL); err != nil {
+			logger.Warn(ctx, "Failed to store response for Idempotency-Key", map[string]interface{}{
+				"endpoint": route,
+				"error":    err.Error(),
+			})
+			recordIdempotentRequest(ctx, route, "not_stored")
+			return
+		}
+		recordIdempotentRequest(ctx, route, "stored")
+	})
+}
+
+// replayIdempotent answers a request whose key is already taken
+func replayIdempotent(w http.ResponseWriter, r *http.Request, route, storeKey, fingerprint string) {
+	ctx := r.Context()
+
+	value, ok, err := idempotencyStore.Get(ctx, storeKey)
+	var record idempotencyRecord
+	if err == nil && ok {
+		err = json.Unmarshal(value, &record)
+	}
+	if err == nil && ok && record.State == idempotencyStateCompleted && record.Status == 0 {
+		// Kept without a response by an older gateway; free the key
+		if err = idempotencyStore.Delete(context.WithoutCancel(ctx), storeKey); err == nil {
+			ok = false
+		}
+	}
+	switch {
+	case err == nil && ok && record.Fingerprint != fingerprint:
+		recordIdempotentRequest(ctx, route, "mismatch")
+		writeError(w, http.StatusUnprocessableEntity, "Idempotency-Key was used for a different request")
+	case err != nil || !ok || record.State != idempotencyStateCompleted:
+		// Still running, or released or expired in between
+		recordIdempotentRequest(ctx, route, "in_progress")
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusConflict, "A request with this Idempotency-Key is in progress")
+	default:
+		recordIdempotentRequest(ctx, route, "replayed")
+		logger.AddSpanAttributeBool(ctx, "idempotency.replayed", true)
+		logger.Info(ctx, "Replayed response for Idempotency-Key", map[string]interface{}{
+			"endpoint": route,
+			"status":   record.Status,
+		})
+		if record.ContentType != "" {
+			w.Header().Set("Content-Type", record.ContentType)
+		}
+		w.Header().Set(idempotentReplayedHeader, "true")
+		w.WriteHeader(record.Status)
+		w.Write(record.Body)
+	}
+}
+
+// hashHex returns the hex SHA-256 of s
+func hashHex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Scheduler leader election
+//
+// With several gateway replicas only one of them may fire scheduled
+// workflows. When SCHEDULER_LEADER_ELECTION is enabled the replicas compete
+// for a Kubernetes Lease (coordination.k8s.io/v1) through the in-cluster API;
+// the holder renews it every few seconds and the others take over once it
+// expires. The service account needs get, create and update on leases.
+// Without leader election the replica always considers itself the leader.
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	leaseTimeFormat   = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// leaderElector reports whether this replica currently leads
+type leaderElector interface {
+	IsLeader() bool
+}
+
+// localLeader is used when leader election is disabled
+type localLeader struct{}
+
+func (localLeader) IsLeader() bool { return true }
+
+// leaseElector holds leadership through a Kubernetes Lease
+type leaseElector struct {
+	client    *http.Client
+	url       string
+	token     string
+	namespace string
+	name      string
+	identity  string
+	duration  time.Duration
+	leader    atomic.Bool
+}
+
+// lease is the subset of a coordination.k8s.io/v1 Lease the elector uses
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+}
+
+var schedulerLeader leaderElector = localLeader{}
+
+// newLeaseElector creates an elector from the pod's service account
+func newLeaseElector(name string, duration time.Duration) (*leaseElector, error) {
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("reading service account token: %w", err)
+	}
+	namespace, err := os.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return nil, fmt.Errorf("reading service account namespace: %w", err)
+	}
+	caCert, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("reading cluster CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no certificates in cluster CA")
+	}
+
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("resolving identity: %w", err)
+	}
+
+	host := getEnvString("KUBERNETES_SERVICE_HOST", "kubernetes.default.svc")
+	port := getEnvString("KUBERNETES_SERVICE_PORT", "443")
+	ns := strings.TrimSpace(string(namespace))
+
+	return &leaseElector{
+		client: &http.Client{
+			Timeout:   5 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+		url:       fmt.Sprintf("https://%s:%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", host, port, ns),
+		token:     strings.TrimSpace(string(token)),
+		namespace: ns,
+		name:      name,
+		identity:  identity,
+		duration:  duration,
+	}, nil
+}
+
+func (e *leaseElector) IsLeader() bool { return e.leader.Load() }
+
+// run tries to acquire or renew the lease every third of its duration until
+// ctx is cancelled
+func (e *leaseElector) run(ctx context.Context) {
+	ticker := time.NewTicker(e.duration / 3)
+	defer ticker.Stop()
+
+	for {
+		jobCtx, endJob := logger.StartJob(ctx, "renew_scheduler_lease")
+		leading, err := e.tryAcquireOrRenew(jobCtx)
+		if err != nil {
+			logger.Warn(jobCtx, "Scheduler lease update failed", map[string]interface{}{
+				"lease": e.name,
+				"error": err.Error(),
+			})
+		}
+		if leading != e.leader.Swap(leading) {
+			logger.Info(jobCtx, "Scheduler leadership changed", map[string]interface{}{
+				"lease":    e.name,
+				"identity": e.identity,
+				"leader":   leading,
+			})
+		}
+		endJob(err)
+
+		select {
+		case <-ctx.Done():
+			e.leader.Store(false)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tryAcquireOrRenew returns whether this replica holds the lease afterwards
+func (e *leaseElector) tryAcquireOrRenew(ctx context.Context) (bool, error) {
+	now := time.Now().UTC()
+	nowStr := now.Format(leaseTimeFormat)
+
+	current, status, err := e.do(ctx, "GET", e.url+"/"+e.name, nil)
+	if err != nil {
+		return false, err
+	}
+
+	if status == http.StatusNotFound {
+		created := lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   leaseMetadata{Name: e.name, Namespace: e.namespace},
+			Spec: leaseSpec{
+				HolderIdentity:       e.identity,
+				LeaseDurationSeconds: int(e.duration.Seconds()),
+				AcquireTime:          nowStr,
+				RenewTime:            nowStr,
+			},
+		}
+		_, status, err = e.do(ctx, "POST", e.url, &created)
+		if err != nil {
+			return false, err
+		}
+		return status == http.StatusCreated, nil
+	}
+	if status != http.StatusOK {
+		return false, fmt.Errorf("GET lease returned status %d", status)
+	}
+
+	if current.Spec.HolderIdentity != e.identity {
+		if current.Spec.HolderIdentity != "" {
+			renewed, err := time.Parse(leaseTimeFormat, current.Spec.RenewTime)
+			if err != nil {
+				// It may still be renewed; taking it over could make two leaders
+				logger.Warn(ctx, "Scheduler lease has an unreadable renew time, treating it as held", map[string]interface{}{
+					"lease":      e.name,
+					"holder":     current.Spec.HolderIdentity,
+					"renew_time": current.Spec.RenewTime,
+					"error":      err.Error(),
+				})
+				return false, nil
+			}
+			if now.Before(renewed.Add(time.Duration(current.Spec.LeaseDurationSeconds) * time.Second)) {
+				return false, nil
+			}
+		}
+		current.Spec.HolderIdentity = e.identity
+		current.Spec.AcquireTime = nowStr
+	}
+	current.Spec.LeaseDurationSeconds = int(e.duration.Seconds())
+	current.Spec.RenewTime = nowStr
+
+	// The resourceVersion makes the update fail with 409 if another replica
+	// changed the lease since we read it
+	_, status, err = e.do(ctx, "PUT", e.url+"/"+e.name, current)
+	if err != nil {
+		return false, err
+	}
+	if status == http.StatusConflict {
+		return false, nil
+	}
+	if status != http.StatusOK {
+		return false, fmt.Errorf("PUT lease returned status %d", status)
+	}
+	return true, nil
+}
+
+// do sends a request to the Lease API and decodes the returned lease
+func (e *leaseElector) do(ctx context.Context, method, url string, body *lease) (*lease, int, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, 0, err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+e.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	var result lease
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return nil, resp.StatusCode, err
+		}
+	}
+	return &result, resp.StatusCode, nil
+}
+
+// startLeaderElection configures schedulerLeader from the environment
+func startLeaderElection(ctx context.Context) {
+	if getEnvString("SCHEDULER_LEADER_ELECTION", "false") != "true" {
+		return
+	}
+
+	elector, err := newLeaseElector(
+		getEnvString("SCHEDULER_LEASE_NAME", "api-gateway-scheduler"),
+		time.Duration(getEnvInt("SCHEDULER_LEASE_DURATION_SEC", 15))*time.Second,
+	)
+	if err != nil {
+		// Never lead rather than risk several replicas firing the same schedules
+		logger.Error(ctx, "Leader election unavailable, scheduled workflows will not run", err)
+		schedulerLeader = &leaseElector{}
+		return
+	}
+
+	schedulerLeader = elector
+	background.Go("leader_election", func(ctx context.Context) error {
+		elector.run(ctx)
+		return nil
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Priority load shedding
+//
+// With LOAD_SHED_MAX_IN_FLIGHT set, the gateway caps the requests it works on
+// at once across all clients (CLIENT_MAX_CONCURRENT caps each client). Routes
+// have a priority, declared where they are registered:
+//
+//	routes.withPriority(priorityLow).handleFunc("/api/notifications", ...)
+//
+// and each priority may only fill its share of the cap, so under overload
+// the least important requests are turned away first while the rest keep
+// their latency:
+//
+//	critical  never shed and not counted against the cap (health checks)
+//	stream    the same for streaming endpoints, which hold their request
+//	          open and are capped by STREAM_MAX_CONNECTIONS instead
+//	high      up to the whole cap (SLI routes such as /api/users reads)
+//	normal    up to 80% (routes without a priority)
+//	low       up to 50% (the /api/notifications listing)
+//
+// A shed request gets 503 with Retry-After: 1. It is counted in
+// load_shed_requests_total by priority and endpoint, and like any other
+// response in the route's request metrics. GET /admin/routes shows each
+// route's priority.
+
+// Route priorities
+const (
+	priorityCritical = "critical"
+	priorityStream   = "stream"
+	priorityHigh     = "high"
+	priorityNormal   = "normal"
+	priorityLow      = "low"
+)
+
+// priorityShares is the share of LOAD_SHED_MAX_IN_FLIGHT each priority may
+// fill
+var priorityShares = map[string]float64{
+	priorityHigh:   1,
+	priorityNormal: 0.8,
+	priorityLow:    0.5,
+}
+
+var (
+	maxInFlight int
+	// inFlight counts the open requests of routes that can be shed
+	inFlight atomic.Int64
+)
+
+func init() {
+	maxInFlight = getEnvInt("LOAD_SHED_MAX_IN_FLIGHT", 0)
+}
+
+// shedsLoad reports whether routes with the given priority can be shed
+func shedsLoad(priority string) bool {
+	return priority != priorityCritical && priority != priorityStream
+}
+
+// shedLoad rejects the requests of a route with the given priority while
+// the gateway is past that priority's share of LOAD_SHED_MAX_IN_FLIGHT.
+// route is the path template the shed requests are counted under.
+func shedLoad(priority, route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !shedsLoad(priority) {
+			return next
+		}
+		share := priorityShares[priority]
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maxInFlight <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			open := inFlight.Add(1)
+			if float64(open) > share*float64(maxInFlight) {
+				// Release the slot first, a slow 503 write must not shed others
+				inFlight.Add(-1)
+				logger.Warn(r.Context(), "Shedding request under load", map[string]interface{}{
+					"priority":      priority,
+					"endpoint":      route,
+					"in_flight":     open - 1,
+					"max_in_flight": maxInFlight,
+				})
+				recordShedRequest(r.Context(), priority, route)
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusServiceUnavailable, "Gateway overloaded, retry later")
+				return
+			}
+
+			defer inFlight.Add(-1)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
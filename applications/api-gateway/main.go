@@ -4,15 +4,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
-	"io"
-	"math/rand"
+	"errors"
+	"flag"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"api-gateway/clients/notifications"
+	"api-gateway/clients/userservice"
+	"api-gateway/models"
+	"api-gateway/notificationclient"
 	"github.com/faidon-laboratory/go-logging"
+	"github.com/faidon-laboratory/go-service"
 	"github.com/gorilla/mux"
 )
 
@@ -24,7 +30,9 @@ var (
 	startTime              time.Time
 	userServiceURL         string
 	notificationServiceURL string
+	upstreamTimeout        time.Duration
 	logger                 *logging.Logger
+	background             *service.Group
 )
 
 func init() {
@@ -34,7 +42,8 @@ func init() {
 	greeting = getEnvString("GREETING", "hello")
 	userServiceURL = getEnvString("USER_SERVICE_URL", "http://user-service:80")
 	notificationServiceURL = getEnvString("NOTIFICATION_SERVICE_URL", "http://notification-service:80")
-	startTime = time.Now()
+	upstreamTimeout = time.Duration(getEnvInt("UPSTREAM_TIMEOUT_MS", 5000)) * time.Millisecond
+	startTime = clock.Now()
 
 	// Initialize logger
 	logger = logging.New(logging.Config{
@@ -42,60 +51,80 @@ func init() {
 		Version:     getEnvString("SERVICE_VERSION", "1.0.0"),
 		Environment: getEnvString("ENVIRONMENT", "development"),
 		AlloyURL:    getEnvString("ALLOY_URL", "grafana-alloy.monitoring.svc.cluster.local:4318"),
+		Protocol:    getEnvString("ALLOY_PROTOCOL", "http"),
+
+		TLS:           getEnvString("ALLOY_TLS", "false") == "true",
+		TLSCACert:     getEnvString("ALLOY_CA_CERT", ""),
+		TLSClientCert: getEnvString("ALLOY_CLIENT_CERT", ""),
+		TLSClientKey:  getEnvString("ALLOY_CLIENT_KEY", ""),
+		Headers:       logging.ParseHeaders(getEnvString("ALLOY_HEADERS", "")),
+
+		LogLevel:         getEnvString("LOG_LEVEL", "debug"),
+		Format:           getEnvString("LOG_FORMAT", logging.FormatJSON),
+		Caller:           getEnvString("LOG_CALLER", "false") == "true",
+		StackTraces:      getEnvString("LOG_STACK_TRACES", "false") == "true",
+		TraceSampleRatio: getEnvFloat("TRACE_SAMPLE_RATIO", 1),
+		FlushTimeout:     time.Duration(getEnvInt("TELEMETRY_FLUSH_TIMEOUT_SEC", 5)) * time.Second,
+		ExportInterval:   time.Duration(getEnvInt("METRICS_EXPORT_INTERVAL_SEC", 60)) * time.Second,
+		Propagators:      strings.Split(getEnvString("TRACE_PROPAGATORS", "tracecontext,baggage"), ","),
+		Exemplars:        getEnvString("METRICS_EXEMPLARS", "trace_based"),
+		RuntimeMetrics:   getEnvString("RUNTIME_METRICS", "true") == "true",
+		LogExport:        getEnvString("OTLP_LOGS", "false") == "true",
+		Sinks:            logging.ParseSinks(getEnvString("LOG_SINKS", "")),
+
+		AsyncLogBuffer: getEnvInt("ASYNC_LOG_BUFFER", 0),
+		LogSampling: &logging.LogSampling{
+			Initial:    getEnvInt("LOG_SAMPLING_INITIAL", 0),
+			Thereafter: getEnvInt("LOG_SAMPLING_THEREAFTER", 100),
+		},
+		DedupWindow: time.Duration(getEnvInt("LOG_DEDUP_WINDOW_SEC", 0)) * time.Second,
+		Batching: logging.Batching{
+			MaxQueueSize:       getEnvInt("TELEMETRY_MAX_QUEUE_SIZE", 0),
+			MaxExportBatchSize: getEnvInt("TELEMETRY_MAX_BATCH_SIZE", 0),
+			BatchTimeout:       time.Duration(getEnvInt("TELEMETRY_BATCH_TIMEOUT_MS", 0)) * time.Millisecond,
+			ExportTimeout:      time.Duration(getEnvInt("TELEMETRY_EXPORT_TIMEOUT_SEC", 0)) * time.Second,
+		},
+		Routes: logging.QuietRoutes(getEnvFloat("QUIET_ROUTES_TRACE_RATIO", 0), strings.Split(getEnvString("QUIET_ROUTES", ""), ",")...),
+		ExportRetry: logging.ExportRetry{
+			InitialInterval: time.Duration(getEnvInt("TELEMETRY_RETRY_INITIAL_MS", 0)) * time.Millisecond,
+			MaxInterval:     time.Duration(getEnvInt("TELEMETRY_RETRY_MAX_INTERVAL_SEC", 0)) * time.Second,
+			MaxElapsedTime:  time.Duration(getEnvInt("TELEMETRY_RETRY_MAX_ELAPSED_SEC", 0)) * time.Second,
+			BufferSize:      getEnvInt("TELEMETRY_EXPORT_BUFFER", 0),
+		},
 	})
+
+	// Background goroutines (workers, scheduler, shadow requests)
+	background = service.NewGroup(logger)
 }
 
-// Helper functions for environment variables
+// Helper functions for environment variables (see config.go for profiles)
 func getEnvString(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
+	return config.String(key, defaultValue)
 }
 
 func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
-	}
-	return defaultValue
+	return config.Int(key, defaultValue)
 }
 
 func getEnvFloat(key string, defaultValue float64) float64 {
-	if value := os.Getenv(key); value != "" {
-		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
-			return floatValue
-		}
-	}
-	return defaultValue
+	return config.Float(key, defaultValue)
 }
 
 // Health endpoint
 func healthzHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, endSpan := logger.StartSpan(r.Context(), "healthz")
-	defer endSpan()
-
-	start := time.Now()
+	ctx := r.Context()
 
 	logger.Info(ctx, "Health check requested")
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("ok"))
-
-	// Record metrics
-	logger.CountRequest(ctx, "/healthz", 200)
-	logger.RecordDuration(ctx, "/healthz", time.Since(start))
 }
 
 // Readiness endpoint
 func readyzHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, endSpan := logger.StartSpan(r.Context(), "readyz")
-	defer endSpan()
-
-	start := time.Now()
+	ctx := r.Context()
 
-	elapsed := time.Since(startTime)
+	elapsed := clock.Now().Sub(startTime)
 	if elapsed < time.Duration(readyDelay)*time.Second {
 		logger.Warn(ctx, "Service not ready yet", map[string]interface{}{
 			"elapsed_seconds":     elapsed.Seconds(),
@@ -105,8 +134,6 @@ func readyzHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		w.Write([]byte("not ready"))
 
-		logger.CountRequest(ctx, "/readyz", 503)
-		logger.RecordDuration(ctx, "/readyz", time.Since(start))
 		return
 	}
 
@@ -114,40 +141,24 @@ func readyzHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("ready"))
-
-	logger.CountRequest(ctx, "/readyz", 200)
-	logger.RecordDuration(ctx, "/readyz", time.Since(start))
 }
 
 // Process user request endpoint - calls user service and notification service
 func processUserHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, endSpan := logger.StartSpan(r.Context(), "process_user_request")
-	defer endSpan()
+	ctx := r.Context()
 
 	start := time.Now()
 
 	// Parse request body
-	var req struct {
-		UserID  string `json:"user_id"`
-		Action  string `json:"action"`
-		Message string `json:"message"`
-	}
-
+	var req models.ProcessUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		logger.Error(ctx, "Failed to parse user request", err, map[string]interface{}{
 			"method":   r.Method,
 			"endpoint": "/process-user",
 		})
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    false,
-			"error": "Invalid request body",
-		})
+		writeError(w, http.StatusBadRequest, "Invalid request body")
 
-		logger.CountRequest(ctx, "/process-user", 400)
-		logger.RecordDuration(ctx, "/process-user", time.Since(start))
 		return
 	}
 
@@ -157,42 +168,34 @@ func processUserHandler(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Step 1: Call User Service
-	userServiceResult, err := callUserService(ctx, req.UserID, req.Action)
+	userServiceResult, err := userService.Work(ctx, req.UserID, req.Action)
 	if err != nil {
+		if abortIfClientGone(ctx) {
+			return
+		}
 		logger.Error(ctx, "User service call failed", err, map[string]interface{}{
 			"user_id": req.UserID,
 			"action":  req.Action,
 		})
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    false,
-			"error": "User service unavailable",
-		})
+		writeError(w, http.StatusInternalServerError, "User service unavailable")
 
-		logger.CountRequest(ctx, "/process-user", 500)
-		logger.RecordDuration(ctx, "/process-user", time.Since(start))
 		return
 	}
 
 	// Step 2: Call Notification Service
-	notificationResult, err := callNotificationService(ctx, req.UserID, req.Message, userServiceResult)
+	notificationResult, err := notifyUser(ctx, req.UserID, req.Message, userServiceResult.Greeting)
 	if err != nil {
+		if abortIfClientGone(ctx) {
+			return
+		}
 		logger.Error(ctx, "Notification service call failed", err, map[string]interface{}{
 			"user_id": req.UserID,
 			"action":  req.Action,
 		})
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    false,
-			"error": "Notification service unavailable",
-		})
+		writeError(w, http.StatusInternalServerError, "Notification service unavailable")
 
-		logger.CountRequest(ctx, "/process-user", 500)
-		logger.RecordDuration(ctx, "/process-user", time.Since(start))
 		return
 	}
 
@@ -206,142 +209,126 @@ func processUserHandler(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Success response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"ok":                  true,
-		"message":             "User request processed successfully",
-		"user_id":             req.UserID,
-		"action":              req.Action,
-		"user_service_result": userServiceResult,
-		"notification_result": notificationResult,
-		"processed_at":        time.Now().UTC().Format(time.RFC3339),
+	writeJSON(w, http.StatusOK, models.ProcessUserResponse{
+		OK:                 true,
+		Message:            "User request processed successfully",
+		UserID:             req.UserID,
+		Action:             req.Action,
+		UserServiceResult:  userServiceResult,
+		NotificationResult: notificationResult,
+		ProcessedAt:        responseTime(time.Now()),
 	})
-
-	logger.CountRequest(ctx, "/process-user", 200)
-	logger.RecordDuration(ctx, "/process-user", time.Since(start))
 }
 
-// Call User Service (Python service)
-func callUserService(ctx context.Context, userID, action string) (string, error) {
-	ctx, endSpan := logger.StartSpan(ctx, "call_user_service")
-	defer endSpan()
-
-	logger.Info(ctx, "Calling user service", map[string]interface{}{
-		"user_id": userID,
-		"action":  action,
-		"url":     userServiceURL,
-	})
-
-	// Create HTTP client
-	client := &http.Client{
-		Timeout: 5 * time.Second,
-	}
-
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, "GET", userServiceURL+"/work", nil)
-	if err != nil {
-		logger.Error(ctx, "Failed to create user service request", err)
-		return "", err
-	}
-
-	// Make request
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.Error(ctx, "User service request failed", err)
-		return "", err
-	}
-	defer resp.Body.Close()
+// userService calls the user service; main sets it up once the transport
+// (mirroring, contract validation, timing) is complete
+var userService userservice.API
+
+// newUserService returns a client for the user service, or the in-memory
+// store standing in for it (USER_SERVICE_MODE). Requests carry the
+// tenant and the signature like every internal call.
+func newUserService() userservice.API {
+	return withOfflineMode(userservice.New(userservice.Options{
+		BaseURL:   userServiceURL,
+		Transport: userServiceTransport,
+		Timeout:   upstreamTimeout,
+		Logger:    logger,
+		Editors: []userservice.RequestEditorFn{
+			func(ctx context.Context, req *http.Request, body []byte) error {
+				propagateTenant(ctx, req)
+				signRequest(req, body)
+				return nil
+			},
+		},
+	}))
+}
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.Error(ctx, "Failed to read user service response", err)
-		return "", err
-	}
+// notificationService returns a client for the notification service,
+// generated from its OpenAPI document (see notificationclient/). Requests carry
+// the tenant and the signature like every internal call.
+func notificationService() *notificationclient.Client {
+	return notificationclient.NewClient(notificationServiceURL,
+		&http.Client{Timeout: upstreamTimeout, Transport: notificationServiceTransport},
+		func(ctx context.Context, req *http.Request, body []byte) error {
+			propagateTenant(ctx, req)
+			signRequest(req, body)
+			return nil
+		})
+}
 
-	logger.Info(ctx, "User service call completed", map[string]interface{}{
-		"status_code":     resp.StatusCode,
-		"response_length": len(body),
+// notifier sends notifications (see clients/notifications/)
+var notifier notifications.API
+
+// newNotifier returns the notification sender, retrying under the
+// NOTIFICATION_RETRY_* policy. Requests carry the tenant and the signature
+// like every internal call.
+func newNotifier() notifications.API {
+	return notifications.New(notifications.Options{
+		BaseURL:   notificationServiceURL,
+		Transport: notificationServiceTransport,
+		Timeout:   upstreamTimeout,
+		Retry: notifications.RetryPolicy{
+			MaxAttempts:    getEnvInt("NOTIFICATION_RETRY_ATTEMPTS", 3),
+			InitialBackoff: time.Duration(getEnvInt("NOTIFICATION_RETRY_BACKOFF_MS", 100)) * time.Millisecond,
+			MaxBackoff:     notifications.DefaultRetryPolicy.MaxBackoff,
+			RetryStatuses:  notifications.DefaultRetryPolicy.RetryStatuses,
+		},
+		Logger: logger,
+		Editors: []notificationclient.RequestEditorFn{
+			func(ctx context.Context, req *http.Request, body []byte) error {
+				propagateTenant(ctx, req)
+				signRequest(req, body)
+				return nil
+			},
+		},
 	})
-
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("user service returned status %d", resp.StatusCode)
-	}
-
-	return string(body), nil
 }
 
-// Call Notification Service
-func callNotificationService(ctx context.Context, userID, message string, userServiceResult string) (string, error) {
-	ctx, endSpan := logger.StartSpan(ctx, "call_notification_service")
-	defer endSpan()
-
-	logger.Info(ctx, "Calling notification service", map[string]interface{}{
-		"user_id": userID,
-		"url":     notificationServiceURL,
+// notifyUser emails the user about a processed request
+func notifyUser(ctx context.Context, userID, message string, greeting string) (*notifications.SendResponse, error) {
+	return notifier.Send(ctx, notifications.SendRequest{
+		UserID:   userID,
+		Message:  message + " (User service greeting: " + greeting + ")",
+		Channel:  "email",
+		Priority: "normal",
 	})
+}
 
-	// Create HTTP client
-	client := &http.Client{
-		Timeout: 5 * time.Second,
-	}
-
-	// Create request body
-	reqBody := map[string]interface{}{
-		"user_id":  userID,
-		"message":  message + " (User service result: " + userServiceResult + ")",
-		"channel":  "email",
-		"priority": "normal",
-	}
-
-	jsonBody, err := json.Marshal(reqBody)
-	if err != nil {
-		logger.Error(ctx, "Failed to marshal notification request", err)
-		return "", err
-	}
-
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, "POST", notificationServiceURL+"/notifications/send", bytes.NewBuffer(jsonBody))
-	if err != nil {
-		logger.Error(ctx, "Failed to create notification service request", err)
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	// Make request
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.Error(ctx, "Notification service request failed", err)
-		return "", err
+// Helper function to write a JSON response
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	// Encode before the headers go out so Server-Timing can include it
+	start := time.Now()
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(body)
+	if timings := phaseRecorder(w); timings != nil {
+		timings.add(phaseSerialization, time.Since(start))
 	}
-	defer resp.Body.Close()
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.Error(ctx, "Failed to read notification service response", err)
-		return "", err
-	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(buf.Bytes())
+}
 
-	logger.Info(ctx, "Notification service call completed", map[string]interface{}{
-		"status_code":     resp.StatusCode,
-		"response_length": len(body),
-	})
+// Helper function to write an error response
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, models.Error{OK: false, Error: message})
+}
 
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("notification service returned status %d", resp.StatusCode)
-	}
+// Helper function to write an error response on a route relaying an upstream
+func writeProxyError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, models.ProxyError{Error: message})
+}
 
-	return string(body), nil
+// responseTime is a timestamp of a response: UTC, to the second
+func responseTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
 }
 
-// Business-level API handlers for SLI tracking
+// Business-level API handlers
 
-// Get user by ID - latency SLI endpoint
+// Get user by ID
 func getUserHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, endSpan := logger.StartSpan(r.Context(), "get_user")
-	defer endSpan()
+	ctx := r.Context()
 
 	start := time.Now()
 	vars := mux.Vars(r)
@@ -352,85 +339,37 @@ func getUserHandler(w http.ResponseWriter, r *http.Request) {
 		"method":  r.Method,
 	})
 
-	// Call user service to get user data
-	client := &http.Client{Timeout: 5 * time.Second}
-	req, err := http.NewRequestWithContext(ctx, "GET", userServiceURL+"/users/"+userID, nil)
-	if err != nil {
-		logger.Error(ctx, "Failed to create user service request", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "Internal server error"})
-		logger.CountRequest(ctx, "/api/users/{id}", 500)
-		logger.RecordDuration(ctx, "/api/users/{id}", time.Since(start))
-		return
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.Error(ctx, "User service request failed", err)
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "User service unavailable"})
-		logger.CountRequest(ctx, "/api/users/{id}", 503)
-		logger.RecordDuration(ctx, "/api/users/{id}", time.Since(start))
+	user, err := userService.GetUser(ctx, userID)
+	if errors.Is(err, userservice.ErrNotFound) {
+		writeProxyError(w, http.StatusNotFound, "User not found")
 		return
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logger.Error(ctx, "Failed to read user service response", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "Internal server error"})
-		logger.CountRequest(ctx, "/api/users/{id}", 500)
-		logger.RecordDuration(ctx, "/api/users/{id}", time.Since(start))
-		return
-	}
-
-	if resp.StatusCode == 404 {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "User not found"})
-		logger.CountRequest(ctx, "/api/users/{id}", 404)
-		logger.RecordDuration(ctx, "/api/users/{id}", time.Since(start))
+		if abortIfClientGone(ctx) {
+			return
+		}
+		writeUserServiceError(ctx, w, r, err, "User service error")
 		return
 	}
 
-	if resp.StatusCode != 200 {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "User service error"})
-		logger.CountRequest(ctx, "/api/users/{id}", 500)
-		logger.RecordDuration(ctx, "/api/users/{id}", time.Since(start))
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(body)
+	writeJSON(w, http.StatusOK, userResponse(w, r, user))
 
 	logger.Info(ctx, "User retrieved successfully", map[string]interface{}{
 		"user_id":     userID,
 		"duration_ms": time.Since(start).Milliseconds(),
 	})
-	logger.CountRequest(ctx, "/api/users/{id}", 200)
-	logger.RecordDuration(ctx, "/api/users/{id}", time.Since(start))
 }
 
-// Create user - availability SLI endpoint
+// Create user
 func createUserHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, endSpan := logger.StartSpan(r.Context(), "create_user")
-	defer endSpan()
+	ctx := r.Context()
 
 	start := time.Now()
 
-	var req struct {
-		Name  string `json:"name"`
-		Email string `json:"email"`
-	}
-
+	var req userservice.CreateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		logger.Error(ctx, "Failed to parse create user request", err)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "Invalid request body"})
-		logger.CountRequest(ctx, "/api/users", 400)
-		logger.RecordDuration(ctx, "/api/users", time.Since(start))
+		writeProxyError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
@@ -439,80 +378,45 @@ func createUserHandler(w http.ResponseWriter, r *http.Request) {
 		"email": req.Email,
 	})
 
-	// Call user service to create user
-	client := &http.Client{Timeout: 5 * time.Second}
-	reqBody := map[string]interface{}{
-		"name":  req.Name,
-		"email": req.Email,
-	}
-
-	jsonBody, err := json.Marshal(reqBody)
-	if err != nil {
-		logger.Error(ctx, "Failed to marshal create user request", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "Internal server error"})
-		logger.CountRequest(ctx, "/api/users", 500)
-		logger.RecordDuration(ctx, "/api/users", time.Since(start))
-		return
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", userServiceURL+"/users", bytes.NewBuffer(jsonBody))
-	if err != nil {
-		logger.Error(ctx, "Failed to create user service request", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "Internal server error"})
-		logger.CountRequest(ctx, "/api/users", 500)
-		logger.RecordDuration(ctx, "/api/users", time.Since(start))
-		return
-	}
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(httpReq)
+	user, err := userService.CreateUser(ctx, req)
 	if err != nil {
-		logger.Error(ctx, "User service request failed", err)
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "User service unavailable"})
-		logger.CountRequest(ctx, "/api/users", 503)
-		logger.RecordDuration(ctx, "/api/users", time.Since(start))
-		return
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.Error(ctx, "Failed to read user service response", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "Internal server error"})
-		logger.CountRequest(ctx, "/api/users", 500)
-		logger.RecordDuration(ctx, "/api/users", time.Since(start))
+		if abortIfClientGone(ctx) {
+			return
+		}
+		writeUserServiceError(ctx, w, r, err, "User creation failed")
 		return
 	}
 
-	if resp.StatusCode != 201 && resp.StatusCode != 200 {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "User creation failed"})
-		logger.CountRequest(ctx, "/api/users", 500)
-		logger.RecordDuration(ctx, "/api/users", time.Since(start))
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	w.Write(body)
+	writeJSON(w, http.StatusCreated, userResponse(w, r, user))
 
 	logger.Info(ctx, "User created successfully", map[string]interface{}{
 		"name":        req.Name,
 		"email":       req.Email,
 		"duration_ms": time.Since(start).Milliseconds(),
 	})
-	logger.CountRequest(ctx, "/api/users", 201)
-	logger.RecordDuration(ctx, "/api/users", time.Since(start))
 }
 
-// Get notifications - throughput SLI endpoint
+// writeUserServiceError answers a request whose user service call failed
+func writeUserServiceError(ctx context.Context, w http.ResponseWriter, r *http.Request, err error, message string) {
+	var statusErr *userservice.StatusError
+	switch {
+	case errors.As(err, &statusErr) && statusErr.Header.Get(contractViolationHeader) != "":
+		// The response broke its schema (SCHEMA_VALIDATION=enforce)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write(statusErr.Body)
+	case errors.As(err, &statusErr):
+		writeUpstreamError(ctx, w, r, "user-service", http.StatusInternalServerError, message, statusErr.StatusCode, statusErr.Header, statusErr.Body)
+	case errors.Is(err, userservice.ErrInvalidResponse):
+		writeProxyError(w, http.StatusInternalServerError, "Internal server error")
+	default:
+		writeProxyError(w, http.StatusServiceUnavailable, "User service unavailable")
+	}
+}
+
+// Get notifications
 func getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, endSpan := logger.StartSpan(r.Context(), "get_notifications")
-	defer endSpan()
+	ctx := r.Context()
 
 	start := time.Now()
 
@@ -521,43 +425,32 @@ func getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Call notification service to get notifications
-	client := &http.Client{Timeout: 5 * time.Second}
-	req, err := http.NewRequestWithContext(ctx, "GET", notificationServiceURL+"/notifications", nil)
-	if err != nil {
-		logger.Error(ctx, "Failed to create notification service request", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "Internal server error"})
-		logger.CountRequest(ctx, "/api/notifications", 500)
-		logger.RecordDuration(ctx, "/api/notifications", time.Since(start))
+	resp, err := notificationService().ListNotifications(ctx)
+	if err != nil && resp == nil {
+		if abortIfClientGone(ctx) {
+			return
+		}
+		logger.Error(ctx, "Notification service request failed", err)
+		writeProxyError(w, http.StatusServiceUnavailable, "Notification service unavailable")
 		return
 	}
-
-	resp, err := client.Do(req)
+	body := resp.Body
 	if err != nil {
-		logger.Error(ctx, "Notification service request failed", err)
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "Notification service unavailable"})
-		logger.CountRequest(ctx, "/api/notifications", 503)
-		logger.RecordDuration(ctx, "/api/notifications", time.Since(start))
+		logger.Error(ctx, "Invalid notification service response", err)
+		writeProxyError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.Error(ctx, "Failed to read notification service response", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "Internal server error"})
-		logger.CountRequest(ctx, "/api/notifications", 500)
-		logger.RecordDuration(ctx, "/api/notifications", time.Since(start))
+	// The response broke its schema (SCHEMA_VALIDATION=enforce)
+	if resp.Header.Get(contractViolationHeader) != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write(body)
 		return
 	}
 
 	if resp.StatusCode != 200 {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "Notification service error"})
-		logger.CountRequest(ctx, "/api/notifications", 500)
-		logger.RecordDuration(ctx, "/api/notifications", time.Since(start))
+		writeUpstreamError(ctx, w, r, "notification-service", http.StatusInternalServerError, "Notification service error", resp.StatusCode, resp.Header, body)
 		return
 	}
 
@@ -568,103 +461,249 @@ func getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Info(ctx, "Notifications retrieved successfully", map[string]interface{}{
 		"duration_ms": time.Since(start).Milliseconds(),
 	})
-	logger.CountRequest(ctx, "/api/notifications", 200)
-	logger.RecordDuration(ctx, "/api/notifications", time.Since(start))
 }
 
-// Process workflow - success rate SLI endpoint
+// Process workflow
 func processWorkflowHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, endSpan := logger.StartSpan(r.Context(), "process_workflow")
-	defer endSpan()
+	ctx := r.Context()
 
 	start := time.Now()
 
-	var req struct {
-		WorkflowID string `json:"workflow_id"`
-		Data       string `json:"data"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		logger.Error(ctx, "Failed to parse workflow request", err)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": "Invalid request body"})
-		logger.CountRequest(ctx, "/api/process", 400)
-		logger.RecordDuration(ctx, "/api/process", time.Since(start))
+	run, err := decodeWorkflowRequest(w, r)
+	if err != nil {
+		status, message := http.StatusBadRequest, "Invalid request body"
+		if errors.Is(err, errPayloadTooLarge) {
+			status, message = http.StatusRequestEntityTooLarge, err.Error()
+		}
+		logger.Error(ctx, "Failed to parse workflow request", err, map[string]interface{}{
+			"content_type": r.Header.Get("Content-Type"),
+			"status_code":  status,
+		})
+		writeError(w, status, message)
 		return
 	}
 
 	logger.Info(ctx, "Processing workflow", map[string]interface{}{
-		"workflow_id": req.WorkflowID,
+		"workflow_id": run.WorkflowID,
+		"records":     run.Records,
+		"steps":       len(workflowSteps),
 	})
 
-	// Simulate workflow processing with potential failure
-	if rand.Float64() < failRate {
-		logger.Error(ctx, "Workflow processing failed", fmt.Errorf("simulated workflow failure"), map[string]interface{}{
-			"workflow_id": req.WorkflowID,
+	err = runWorkflow(ctx, run)
+	runID := recordExecution(ctx, runSourceAPI, "", run, err, start)
+	if err != nil {
+		if abortIfClientGone(ctx) {
+			return
+		}
+		status, message := workflowErrorStatus(err)
+		logger.Error(ctx, "Workflow processing failed", err, map[string]interface{}{
+			"workflow_id": run.WorkflowID,
+			"status_code": status,
 		})
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    false,
-			"error": "Workflow processing failed",
+		writeJSON(w, status, models.WorkflowFailure{
+			OK:         false,
+			WorkflowID: run.WorkflowID,
+			RunID:      runID,
+			Error:      message,
+			Steps:      run.Steps,
 		})
-		logger.CountRequest(ctx, "/api/process", 500)
-		logger.RecordDuration(ctx, "/api/process", time.Since(start))
 		return
 	}
 
-	// Simulate processing time
-	processingTime := time.Duration(50+rand.Intn(100)) * time.Millisecond
-	time.Sleep(processingTime)
-
-	result := map[string]interface{}{
-		"ok":           true,
-		"workflow_id":  req.WorkflowID,
-		"status":       "completed",
-		"processed_at": time.Now().UTC().Format(time.RFC3339),
-		"duration_ms":  time.Since(start).Milliseconds(),
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(result)
+	writeJSON(w, http.StatusOK, models.WorkflowResult{
+		OK:          true,
+		WorkflowID:  run.WorkflowID,
+		RunID:       runID,
+		Status:      "completed",
+		Steps:       run.Steps,
+		ProcessedAt: responseTime(time.Now()),
+		DurationMs:  time.Since(start).Milliseconds(),
+		Results:     run.Results,
+	})
 
 	logger.Info(ctx, "Workflow processed successfully", map[string]interface{}{
-		"workflow_id":   req.WorkflowID,
-		"duration_ms":   time.Since(start).Milliseconds(),
-		"processing_ms": processingTime.Milliseconds(),
+		"workflow_id": run.WorkflowID,
+		"duration_ms": time.Since(start).Milliseconds(),
 	})
-	logger.CountRequest(ctx, "/api/process", 200)
-	logger.RecordDuration(ctx, "/api/process", time.Since(start))
 }
 
 func main() {
+	flag.Parse()
 	port := getEnvString("PORT", "8000")
 
 	// Create router
 	r := mux.NewRouter()
+	r.NotFoundHandler = unmatchedHandler(http.StatusNotFound)
+	r.MethodNotAllowedHandler = unmatchedHandler(http.StatusMethodNotAllowed)
+	routes := newRouteRegistry(r, listenerPublic)
+	routes.use("server_timing", serverTimingMiddleware)
+	routes.use("cancellation", cancellationMiddleware)
+	routes.use("concurrency_limit", concurrencyLimitMiddleware)
+	routes.use("tenant", tenantMiddleware)
+	routes.use("debug", debugMiddleware)
+	routes.use("compression", compressionMiddleware)
+	routes.use("idempotency", idempotencyMiddleware)
 
 	// Add routes
-	r.HandleFunc("/healthz", healthzHandler).Methods("GET")
-	r.HandleFunc("/readyz", readyzHandler).Methods("GET")
-	r.HandleFunc("/process-user", processUserHandler).Methods("POST")
+	// Health checks are never shed (LOAD_SHED_MAX_IN_FLIGHT)
+	routes.withPriority(priorityCritical).handleFunc("/healthz", healthzHandler, "GET")
+	routes.withPriority(priorityCritical).handleFunc("/readyz", readyzHandler, "GET")
+	routes.handleFunc("/.well-known/service-manifest", serviceManifestHandler, "GET")
+	routes.handleFunc("/process-user", processUserHandler, "POST")
+	routes.handleFunc("/hello/{name}", helloHandler, "GET")
+
+	// Business-level API endpoints, counted in sli_requests_total. Under
+	// overload the notification listing is shed first and the other SLI
+	// routes last.
+	sliRoutes := routes.withPriority(priorityHigh)
+	sliRoutes.sli(logging.Latency(300*time.Millisecond)).handleFunc("/api/users/{id}", getUserHandler, "GET")
+	routes.handleFunc("/api/users/{id}/summary", getUserSummaryHandler, "GET")
+	sliRoutes.sli(logging.Availability()).handleFunc("/api/users", createUserHandler, "POST")
+	routes.withPriority(priorityLow).sli(logging.Throughput()).handleFunc("/api/notifications", getNotificationsHandler, "GET")
+	sliRoutes.sli(logging.Availability()).handleFunc("/api/process", processWorkflowHandler, "POST")
+	routes.handleFunc("/api/process/history", workflowHistoryHandler, "GET")
+	routes.withPriority(priorityStream).handleFunc("/api/process/events", workflowEventsHandler, "GET")
+	routes.handleFunc("/api/process/schedules", createScheduleHandler, "POST")
+	routes.handleFunc("/api/process/schedules", listSchedulesHandler, "GET")
+	routes.handleFunc("/api/process/schedules/{id}/pause", pauseScheduleHandler(true), "POST")
+	routes.handleFunc("/api/process/schedules/{id}/resume", pauseScheduleHandler(false), "POST")
+
+	// Admin routes, on the public port unless the admin listener owns them
+	adminServer, err := newAdminServer()
+	if err != nil {
+		logger.Error(context.Background(), "Invalid admin listener configuration", err)
+		// Write out lines held by ASYNC_LOG_BUFFER
+		logger.ForceFlush(context.Background())
+		os.Exit(1)
+	}
+	if adminServer == nil || !adminConfig.ListenerOnly {
+		registerAdminRoutes(routes)
+	}
+
+	// Combined OpenAPI document and forwarded upstream operations (OPENAPI_AGGREGATION)
+	registerOpenAPIRoutes(routes)
+
+	// A route shadowed by another would never run
+	if err := routeRegistrationError(); err != nil {
+		logger.Error(context.Background(), "Conflicting route registrations", err)
+		logger.ForceFlush(context.Background())
+		os.Exit(1)
+	}
+
+	// Pin each user to one user-service replica (USER_SERVICE_REPLICAS)
+	userServiceTransport = withUserAffinity(userServiceTransport)
+	// Count upstream failures for /admin/dependencies
+	userServiceTransport = withDependencyTracking(userServiceDependency, userServiceTransport)
+	notificationServiceTransport = withDependencyTracking(notificationServiceDependency, notificationServiceTransport)
+	// Check upstream responses against their schemas (SCHEMA_VALIDATION)
+	userServiceTransport = withContractValidation("user-service", userServiceTransport)
+	notificationServiceTransport = withContractValidation("notification-service", notificationServiceTransport)
+	userServiceTransport = withPhaseTiming(phaseUserService, userServiceTransport)
+	notificationServiceTransport = withPhaseTiming(phaseNotificationService, notificationServiceTransport)
+	// Send the trace on and time every upstream call
+	userServiceTransport = logger.HTTPTransport("user-service", userServiceTransport)
+	notificationServiceTransport = logger.HTTPTransport("notification-service", notificationServiceTransport)
+	userService = newUserService()
+	notifier = newNotifier()
+
+	// --selftest checks the wiring and exits instead of serving
+	if *selfTestMode {
+		os.Exit(runSelfTest(gatewaySelfTestChecks()))
+	}
+
+	// Log level, sampling and export interval follow TELEMETRY_CONFIG_FILE
+	if path := getEnvString("TELEMETRY_CONFIG_FILE", ""); path != "" {
+		background.Supervise("telemetry_config", func(ctx context.Context) error {
+			return logger.WatchConfig(ctx, path)
+		})
+	}
+
+	// Soak tests record heap, goroutines and open files over the run
+	if interval := getEnvInt("SOAK_DIAGNOSTICS_INTERVAL_SEC", 0); interval > 0 {
+		diagnostics := logging.SoakDiagnostics{
+			Interval:            time.Duration(interval) * time.Second,
+			HeapGrowthThreshold: uint64(getEnvInt("SOAK_HEAP_GROWTH_MB", 0)) << 20,
+			ProfileDir:          getEnvString("SOAK_PROFILE_DIR", ""),
+		}
+		background.Supervise("soak_diagnostics", func(ctx context.Context) error {
+			return logger.RunSoakDiagnostics(ctx, diagnostics)
+		})
+	}
 
-	// Business-level API endpoints for SLI tracking
-	r.HandleFunc("/api/users/{id}", getUserHandler).Methods("GET")
-	r.HandleFunc("/api/users", createUserHandler).Methods("POST")
-	r.HandleFunc("/api/notifications", getNotificationsHandler).Methods("GET")
-	r.HandleFunc("/api/process", processWorkflowHandler).Methods("POST")
+	// Days left on the TLS certificates of the upstreams and the admin listener
+	if monitor := certificateMonitor(); len(monitor.Checks) > 0 {
+		background.Supervise("certificate_monitor", func(ctx context.Context) error {
+			return logger.MonitorCertificates(ctx, monitor)
+		})
+	}
+
+	// Scheduled workflows run on the async worker pool of the lease holder
+	startWorkflowWorkers(getEnvInt("WORKFLOW_WORKERS", 4))
+	startLeaderElection(context.Background())
+	loadSchedules(context.Background(), getEnvString("WORKFLOW_SCHEDULES", ""))
+	background.Supervise("workflow_scheduler", func(ctx context.Context) error {
+		runScheduler(ctx)
+		return nil
+	})
 
 	// Start server
+	startupBanner(port)
 	logger.Info(context.Background(), "API Gateway started successfully", map[string]interface{}{
 		"port":                     port,
 		"user_service_url":         userServiceURL,
+		"user_service_mode":        userServiceMode,
+		"user_service_replicas":    getEnvString("USER_SERVICE_REPLICAS", ""),
 		"notification_service_url": notificationServiceURL,
 		"fail_rate":                failRate,
 		"ready_delay_sec":          readyDelay,
+		"request_signing":          len(signingSecret) > 0,
+		"client_max_concurrent":    clientLimiter.limit,
+		"feature_previews":         previewsSummary(),
+		"store_backend":            storeBackendName,
 		"service_type":             "api-gateway",
 	})
 
-	if err := http.ListenAndServe(":"+port, r); err != nil {
-		logger.Error(context.Background(), "Server failed to start", err)
+	server := &http.Server{Addr: ":" + port, Handler: withPathNormalization(withStandardMethods(r))}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error(context.Background(), "Server failed to start", err)
+			logger.ForceFlush(context.Background())
+			os.Exit(1)
+		}
+	}()
+	if adminServer != nil {
+		go serveAdmin(adminServer)
+	}
+
+	// Stop accepting requests, let open ones finish, then stop the background
+	// goroutines in reverse start order
+	stop, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	<-stop.Done()
+
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), time.Duration(getEnvInt("SHUTDOWN_TIMEOUT_SEC", 20))*time.Second)
+	defer cancelShutdown()
+
+	logger.Info(ctx, "API Gateway shutting down")
+	// Open event streams would keep Shutdown waiting until the timeout
+	closeStreams()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error(ctx, "HTTP server shutdown failed", err)
+	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			logger.Error(ctx, "Admin server shutdown failed", err)
+		}
+	}
+	if err := background.Shutdown(ctx); err != nil {
+		logger.Error(ctx, "Background goroutines did not stop", err)
+	}
+	if err := closeStore(); err != nil {
+		logger.Error(ctx, "Closing the blob store failed", err)
+	}
+
+	// Export the last spans and metrics, with their own timeout
+	if err := logger.Shutdown(context.Background()); err != nil {
+		logger.Error(ctx, "Telemetry flush failed", err)
 	}
 }
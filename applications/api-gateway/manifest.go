@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"api-gateway/models"
+	"github.com/faidon-laboratory/go-logging"
+)
+
+// Service manifest
+//
+// GET /.well-known/service-manifest describes the gateway for inventory
+// tooling: its name, version and environment, the routes in the route
+// registry, the upstreams it depends on and what relies on them, the feature
+// previews with their rollout, and an SLO for each SLI a route is measured
+// by. Availability and latency SLOs have the objective SLO_OBJECTIVE (0.99),
+// the share of requests that must meet the SLI; a throughput SLI is only
+// watched, so it has none. The manifest is built on each request from the
+// registry and configuration, so it can't drift from what is served.
+//
+// The same summary is printed to stderr as a banner at startup
+// (STARTUP_BANNER=false leaves it out), for whoever runs the gateway by hand.
+
+var sloObjective float64
+
+func init() {
+	sloObjective = getEnvFloat("SLO_OBJECTIVE", 0.99)
+}
+
+// serviceManifest describes the running gateway
+func serviceManifest() models.ServiceManifest {
+	manifest := models.ServiceManifest{
+		Name:         getEnvString("SERVICE_NAME", "api-gateway"),
+		Version:      getEnvString("SERVICE_VERSION", "1.0.0"),
+		Environment:  getEnvString("ENVIRONMENT", "development"),
+		StartedAt:    responseTime(startTime),
+		Routes:       []models.ManifestRoute{},
+		Dependencies: []models.ManifestDependency{},
+		FeatureFlags: []models.ManifestFeature{},
+		SLOs:         []models.ManifestSLO{},
+	}
+
+	for _, route := range listRoutes() {
+		manifest.Routes = append(manifest.Routes, models.ManifestRoute{
+			Listener: route.Listener,
+			Path:     route.Path,
+			Prefix:   route.Prefix,
+			Methods:  route.Methods,
+			Auth:     route.Auth,
+			Priority: route.Priority,
+		})
+		for _, sli := range route.group.slis {
+			slo := models.ManifestSLO{
+				Route:   route.Path,
+				Methods: route.Methods,
+				SLI:     sli.Kind,
+			}
+			switch sli.Kind {
+			case logging.SLILatency:
+				slo.TargetMs = sli.Target.Milliseconds()
+				slo.Objective = sloObjective
+			case logging.SLIAvailability:
+				slo.Objective = sloObjective
+			}
+			manifest.SLOs = append(manifest.SLOs, slo)
+		}
+	}
+
+	for _, dep := range dependencies {
+		listed := models.ManifestDependency{Name: dep.name, URL: dep.url(), Functionality: []string{}}
+		for _, impact := range dep.impact() {
+			listed.Functionality = append(listed.Functionality, impact.Functionality)
+		}
+		manifest.Dependencies = append(manifest.Dependencies, listed)
+	}
+
+	for _, flag := range featureFlags {
+		manifest.FeatureFlags = append(manifest.FeatureFlags, models.ManifestFeature{
+			Name:           flag.Name,
+			Description:    flag.Description,
+			Routes:         flag.Routes,
+			RolloutPercent: flag.Rollout,
+		})
+	}
+	sort.Slice(manifest.FeatureFlags, func(i, j int) bool {
+		return manifest.FeatureFlags[i].Name < manifest.FeatureFlags[j].Name
+	})
+	return manifest
+}
+
+// Service manifest endpoint
+func serviceManifestHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, serviceManifest())
+}
+
+// printBanner writes a summary of the manifest for a person reading the
+// console
+func printBanner(out io.Writer, manifest models.ServiceManifest, port string) {
+	fmt.Fprintf(out, "%s %s (%s)\n", manifest.Name, manifest.Version, manifest.Environment)
+	listening := "  listening on :" + port
+	if adminConfig.Port != "" {
+		listening += ", admin on :" + adminConfig.Port
+	}
+	fmt.Fprintln(out, listening)
+	fmt.Fprintf(out, "  %d routes, %d SLOs at %.4g; manifest at /.well-known/service-manifest\n",
+		len(manifest.Routes), len(manifest.SLOs), sloObjective)
+
+	upstreams := make([]string, 0, len(manifest.Dependencies))
+	for _, dep := range manifest.Dependencies {
+		upstreams = append(upstreams, dep.Name+" "+dep.URL)
+	}
+	fmt.Fprintln(out, "  upstreams: "+strings.Join(upstreams, ", "))
+
+	previews := previewsSummary()
+	if previews == "" {
+		previews = "none"
+	}
+	fmt.Fprintln(out, "  feature previews rolled out: "+previews)
+}
+
+// startupBanner prints the banner unless STARTUP_BANNER=false
+func startupBanner(port string) {
+	if getEnvString("STARTUP_BANNER", "true") != "true" {
+		return
+	}
+	printBanner(os.Stderr, serviceManifest(), port)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// HEAD, OPTIONS and CORS
+//
+// Routes are registered with the methods their handlers implement; the router
+// is wrapped so that every GET route also answers HEAD (the GET handler runs
+// and net/http drops the body), every route answers OPTIONS with an Allow
+// header, and 405 responses carry Allow as well.
+//
+// CORS is off unless CORS_ALLOWED_ORIGINS lists the allowed origins
+// (comma-separated, "*" for any). Preflight requests from those origins get
+// the route's methods, CORS_ALLOWED_HEADERS and a CORS_MAX_AGE_SEC cache
+// lifetime; actual requests get Access-Control-Allow-Origin.
+
+// routeMethods lists the methods tried when computing a path's Allow header
+var routeMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+var (
+	corsAllowedOrigins map[string]bool
+	corsAnyOrigin      bool
+	corsAllowedHeaders string
+	corsMaxAge         string
+)
+
+func init() {
+	corsAllowedOrigins = make(map[string]bool)
+	for _, origin := range strings.Split(getEnvString("CORS_ALLOWED_ORIGINS", ""), ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		switch origin {
+		case "":
+		case "*":
+			corsAnyOrigin = true
+		default:
+			corsAllowedOrigins[origin] = true
+		}
+	}
+	corsAllowedHeaders = getEnvString("CORS_ALLOWED_HEADERS", "Content-Type, Authorization, X-API-Key, X-Tenant-ID, X-Debug")
+	corsMaxAge = strconv.Itoa(getEnvInt("CORS_MAX_AGE_SEC", 600))
+}
+
+// corsOriginAllowed reports whether a browser origin may call the gateway
+func corsOriginAllowed(origin string) bool {
+	return origin != "" && (corsAnyOrigin || corsAllowedOrigins[origin])
+}
+
+// allowedMethods returns the methods the router accepts for the request's
+// path and the path's route template; allowed is empty if no route matches
+func allowedMethods(router *mux.Router, r *http.Request) (allowed []string, route string) {
+	for _, method := range routeMethods {
+		probe := r.WithContext(r.Context())
+		probe.Method = method
+		if match, ok := matchRoute(router, probe); ok {
+			allowed = append(allowed, method)
+			if method == http.MethodGet {
+				allowed = append(allowed, http.MethodHead)
+			}
+			if route == "" {
+				route, _ = match.Route.GetPathTemplate()
+			}
+		}
+	}
+	if len(allowed) > 0 {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	return allowed, route
+}
+
+// matchRoute reports whether a route handles the request. Router.Match alone
+// also succeeds for requests going to the NotFound and MethodNotAllowed
+// handlers.
+func matchRoute(router *mux.Router, r *http.Request) (mux.RouteMatch, bool) {
+	var match mux.RouteMatch
+	ok := router.Match(r, &match) && match.MatchErr == nil
+	return match, ok
+}
+
+// withStandardMethods adds HEAD, OPTIONS, Allow and CORS handling to the router
+func withStandardMethods(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if !corsAnyOrigin && len(corsAllowedOrigins) > 0 {
+			// Responses differ per origin
+			w.Header().Add("Vary", "Origin")
+		}
+		if corsOriginAllowed(origin) {
+			if corsAnyOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			w.Header().Set("Access-Control-Expose-Headers", "Retry-After, Server-Timing, X-Correlation-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset")
+		}
+
+		switch r.Method {
+		case http.MethodOptions:
+			allowed, route := allowedMethods(router, r)
+			if len(allowed) == 0 {
+				router.ServeHTTP(w, r)
+				return
+			}
+			serveOptions(w, r, allowed, route)
+			return
+
+		case http.MethodHead:
+			get := r.WithContext(r.Context())
+			get.Method = http.MethodGet
+			if _, ok := matchRoute(router, get); ok {
+				router.ServeHTTP(w, get)
+				return
+			}
+		}
+
+		if match, _ := matchRoute(router, r); match.MatchErr == mux.ErrMethodMismatch {
+			allowed, _ := allowedMethods(router, r)
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+		}
+		router.ServeHTTP(w, r)
+	})
+}
+
+// serveOptions answers an OPTIONS request, including CORS preflights
+func serveOptions(w http.ResponseWriter, r *http.Request, allowed []string, route string) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "options")
+	defer endSpan()
+
+	start := time.Now()
+	allow := strings.Join(allowed, ", ")
+	w.Header().Set("Allow", allow)
+	if r.Header.Get("Access-Control-Request-Method") != "" && corsOriginAllowed(r.Header.Get("Origin")) {
+		w.Header().Set("Access-Control-Allow-Methods", allow)
+		w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+		w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	logger.CountRequest(ctx, route, 204)
+	logger.RecordDuration(ctx, route, time.Since(start))
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"api-gateway/clients/failures"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Gateway metrics
+//
+// The shared logger only provides the generic HTTP request metrics, so the
+// gateway-specific instruments are created on the global meter provider that
+// the logger registers.
+
+var (
+	shadowRequests       metric.Int64Counter
+	shadowDuration       metric.Float64Histogram
+	cancelledRequests    metric.Int64Counter
+	contractViolations   metric.Int64Counter
+	userServiceFallbacks metric.Int64Counter
+	featurePreviews      metric.Int64Counter
+	greetingsServed      metric.Int64Counter
+	storeOperations      metric.Int64Counter
+	storeDuration        metric.Float64Histogram
+	idempotentRequests   metric.Int64Counter
+	dependencyErrors     metric.Int64Counter
+	streamConnections    metric.Int64UpDownCounter
+	streamDisconnects    metric.Int64Counter
+	shedRequests         metric.Int64Counter
+)
+
+func init() {
+	meter := otel.Meter("api-gateway")
+
+	var err error
+	shadowRequests, err = meter.Int64Counter(
+		"shadow_requests_total",
+		metric.WithDescription("Mirrored user-service requests by endpoint, primary and shadow status class and outcome"),
+	)
+	if err != nil {
+		log.Printf("Failed to create shadow_requests_total counter: %v", err)
+	}
+
+	shadowDuration, err = meter.Float64Histogram(
+		"shadow_request_duration_seconds",
+		metric.WithDescription("Duration of mirrored user-service requests in seconds by endpoint and upstream (primary or shadow)"),
+	)
+	if err != nil {
+		log.Printf("Failed to create shadow_request_duration_seconds histogram: %v", err)
+	}
+
+	cancelledRequests, err = meter.Int64Counter(
+		"http_requests_cancelled_total",
+		metric.WithDescription("Requests abandoned by the client before the gateway responded, by endpoint"),
+	)
+	if err != nil {
+		log.Printf("Failed to create http_requests_cancelled_total counter: %v", err)
+	}
+
+	contractViolations, err = meter.Int64Counter(
+		"upstream_contract_violations_total",
+		metric.WithDescription("Upstream responses not matching their schema, by upstream and endpoint"),
+	)
+	if err != nil {
+		log.Printf("Failed to create upstream_contract_violations_total counter: %v", err)
+	}
+
+	userServiceFallbacks, err = meter.Int64Counter(
+		"user_service_fallbacks_total",
+		metric.WithDescription("User-service calls answered by the in-memory store because the service was unreachable, by operation"),
+	)
+	if err != nil {
+		log.Printf("Failed to create user_service_fallbacks_total counter: %v", err)
+	}
+
+	featurePreviews, err = meter.Int64Counter(
+		"feature_preview_requests_total",
+		metric.WithDescription("Requests asking for a preview response shape, by preview, endpoint and outcome (applied or not_rolled_out)"),
+	)
+	if err != nil {
+		log.Printf("Failed to create feature_preview_requests_total counter: %v", err)
+	}
+
+	greetingsServed, err = meter.Int64Counter(
+		"greetings_total",
+		metric.WithDescription("Greetings served by /hello/{name}, by locale"),
+	)
+	if err != nil {
+		log.Printf("Failed to create greetings_total counter: %v", err)
+	}
+
+	storeOperations, err = meter.Int64Counter(
+		"store_operations_total",
+		metric.WithDescription("Blob store operations by namespace, operation and outcome (hit, miss, stored, exists, deleted or error)"),
+	)
+	if err != nil {
+		log.Printf("Failed to create store_operations_total counter: %v", err)
+	}
+
+	storeDuration, err = meter.Float64Histogram(
+		"store_operation_duration_seconds",
+		metric.WithDescription("Duration of blob store operations in seconds by namespace and operation"),
+	)
+	if err != nil {
+		log.Printf("Failed to create store_operation_duration_seconds histogram: %v", err)
+	}
+
+	idempotentRequests, err = meter.Int64Counter(
+		"idempotent_requests_total",
+		metric.WithDescription("Requests with an Idempotency-Key by endpoint and outcome (stored, replayed, in_progress, mismatch, not_stored or unavailable)"),
+	)
+	if err != nil {
+		log.Printf("Failed to create idempotent_requests_total counter: %v", err)
+	}
+
+	dependencyErrors, err = meter.Int64Counter(
+		"dependency_errors_total",
+		metric.WithDescription("Failed upstream calls by dependency and class (retryable, non_retryable, throttled or timeout)"),
+	)
+	if err != nil {
+		log.Printf("Failed to create dependency_errors_total counter: %v", err)
+	}
+
+	streamConnections, err = meter.Int64UpDownCounter(
+		"stream_connections",
+		metric.WithDescription("Open server-sent event connections by stream"),
+	)
+	if err != nil {
+		log.Printf("Failed to create stream_connections gauge: %v", err)
+	}
+
+	streamDisconnects, err = meter.Int64Counter(
+		"stream_disconnects_total",
+		metric.WithDescription("Ended server-sent event connections by stream and reason (client_closed, slow_client or shutdown)"),
+	)
+	if err != nil {
+		log.Printf("Failed to create stream_disconnects_total counter: %v", err)
+	}
+
+	shedRequests, err = meter.Int64Counter(
+		"load_shed_requests_total",
+		metric.WithDescription("Requests rejected with 503 because the gateway was overloaded, by priority and endpoint"),
+	)
+	if err != nil {
+		log.Printf("Failed to create load_shed_requests_total counter: %v", err)
+	}
+}
+
+// recordShadowComparison records the outcome of one mirrored request and the
+// latency of both upstreams
+func recordShadowComparison(ctx context.Context, endpoint, primaryStatus, shadowStatus, outcome string, primary, shadow time.Duration) {
+	if shadowRequests != nil {
+		shadowRequests.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("endpoint", endpoint),
+			attribute.String("primary_status", primaryStatus),
+			attribute.String("shadow_status", shadowStatus),
+			attribute.String("outcome", outcome),
+		))
+	}
+	if shadowDuration != nil && shadowStatus != "" {
+		shadowDuration.Record(ctx, primary.Seconds(), metric.WithAttributes(
+			attribute.String("endpoint", endpoint),
+			attribute.String("upstream", "primary"),
+		))
+		shadowDuration.Record(ctx, shadow.Seconds(), metric.WithAttributes(
+			attribute.String("endpoint", endpoint),
+			attribute.String("upstream", "shadow"),
+		))
+	}
+}
+
+// recordCancelledRequest counts a request the client abandoned
+func recordCancelledRequest(ctx context.Context, endpoint string) {
+	if cancelledRequests != nil {
+		cancelledRequests.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("endpoint", endpoint),
+		))
+	}
+}
+
+// recordContractViolation counts an upstream response that broke its schema
+func recordContractViolation(ctx context.Context, upstream, endpoint string) {
+	if contractViolations != nil {
+		contractViolations.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("upstream", upstream),
+			attribute.String("endpoint", endpoint),
+		))
+	}
+}
+
+// recordUserServiceFallback counts a user-service call answered offline
+func recordUserServiceFallback(ctx context.Context, operation string) {
+	if userServiceFallbacks != nil {
+		userServiceFallbacks.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("operation", operation),
+		))
+	}
+}
+
+// recordFeaturePreview counts a request for a preview response shape
+func recordFeaturePreview(ctx context.Context, preview, endpoint, outcome string) {
+	if featurePreviews != nil {
+		featurePreviews.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("preview", preview),
+			attribute.String("endpoint", endpoint),
+			attribute.String("outcome", outcome),
+		))
+	}
+}
+
+// recordGreeting counts a greeting served in a locale
+func recordGreeting(ctx context.Context, locale string) {
+	if greetingsServed != nil {
+		greetingsServed.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("locale", locale),
+		))
+	}
+}
+
+// recordStoreOperation counts and times one blob store operation
+func recordStoreOperation(ctx context.Context, namespace, operation, outcome string, duration time.Duration) {
+	if storeOperations != nil {
+		storeOperations.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("namespace", namespace),
+			attribute.String("operation", operation),
+			attribute.String("outcome", outcome),
+		))
+	}
+	if storeDuration != nil {
+		storeDuration.Record(ctx, duration.Seconds(), metric.WithAttributes(
+			attribute.String("namespace", namespace),
+			attribute.String("operation", operation),
+		))
+	}
+}
+
+// recordIdempotentRequest counts a request carrying an Idempotency-Key
+func recordIdempotentRequest(ctx context.Context, endpoint, outcome string) {
+	if idempotentRequests != nil {
+		idempotentRequests.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("endpoint", endpoint),
+			attribute.String("outcome", outcome),
+		))
+	}
+}
+
+// recordDependencyError counts a failed upstream call by its class
+func recordDependencyError(ctx context.Context, dependency string, class failures.Class) {
+	if dependencyErrors != nil {
+		dependencyErrors.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("dependency", dependency),
+			attribute.String("class", string(class)),
+		))
+	}
+}
+
+// recordStreamConnections adjusts the open connection count of a stream
+func recordStreamConnections(ctx context.Context, stream string, delta int64) {
+	if streamConnections != nil {
+		streamConnections.Add(ctx, delta, metric.WithAttributes(
+			attribute.String("stream", stream),
+		))
+	}
+}
+
+// recordStreamDisconnect counts an ended stream connection
+func recordStreamDisconnect(ctx context.Context, stream, reason string) {
+	if streamDisconnects != nil {
+		streamDisconnects.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("stream", stream),
+			attribute.String("reason", reason),
+		))
+	}
+}
+
+// recordShedRequest counts a request shed under overload
+func recordShedRequest(ctx context.Context, priority, endpoint string) {
+	if shedRequests != nil {
+		shedRequests.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("priority", priority),
+			attribute.String("endpoint", endpoint),
+		))
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Shadow traffic
+//
+// When SHADOW_USER_SERVICE_URL is set, SHADOW_PERCENT percent of the calls to
+// the user service are duplicated to the shadow upstream (e.g. the new Go
+// user-service). The copy is sent in the background once the primary call
+// has completed and its response never reaches the client; status, latency
+// and body (see diff.go) are compared with the primary's and reported as
+// metrics. Only the methods in SHADOW_METHODS are mirrored (GET by default)
+// so writes aren't applied twice, and at most SHADOW_MAX_INFLIGHT copies run
+// at once; extra ones are dropped.
+
+const (
+	shadowOutcomeMatch          = "match"
+	shadowOutcomeStatusMismatch = "status_mismatch"
+	shadowOutcomeBodyMismatch   = "body_mismatch"
+	shadowOutcomeError          = "shadow_error"
+	shadowOutcomeDropped        = "dropped"
+)
+
+// mirrorTransport sends requests to the primary upstream and a sample of them
+// to the shadow upstream as well
+type mirrorTransport struct {
+	base      http.RoundTripper
+	shadowURL string
+	percent   float64
+	methods   map[string]bool
+	timeout   time.Duration
+	inflight  chan struct{}
+
+	differ        *responseDiffer
+	maxDiffBytes  int64
+	diffLogSample float64
+}
+
+// userServiceTransport is used by every client calling the user service
+var userServiceTransport http.RoundTripper = http.DefaultTransport
+
+func init() {
+	shadowURL := strings.TrimRight(getEnvString("SHADOW_USER_SERVICE_URL", ""), "/")
+	percent := getEnvFloat("SHADOW_PERCENT", 0)
+	if shadowURL == "" || percent <= 0 {
+		return
+	}
+
+	methods := make(map[string]bool)
+	for _, method := range strings.Split(getEnvString("SHADOW_METHODS", "GET"), ",") {
+		if method = strings.ToUpper(strings.TrimSpace(method)); method != "" {
+			methods[method] = true
+		}
+	}
+
+	userServiceTransport = &mirrorTransport{
+		base:      http.DefaultTransport,
+		shadowURL: shadowURL,
+		percent:   percent,
+		methods:   methods,
+		timeout:   time.Duration(getEnvInt("SHADOW_TIMEOUT_MS", 5000)) * time.Millisecond,
+		inflight:  make(chan struct{}, getEnvInt("SHADOW_MAX_INFLIGHT", 50)),
+
+		differ: newResponseDiffer(getEnvString("SHADOW_DIFF_IGNORE_FIELDS",
+			"timestamp,generated_at,processed_at,created_at,updated_at,duration_ms,request_id,trace_id")),
+		maxDiffBytes:  int64(getEnvInt("SHADOW_DIFF_MAX_BYTES", 256<<10)),
+		diffLogSample: getEnvFloat("SHADOW_DIFF_LOG_SAMPLE", 0.1),
+	}
+}
+
+func (t *mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.methods[req.Method] || rand.Float64()*100 >= t.percent {
+		return t.base.RoundTrip(req)
+	}
+
+	// Keep a copy of the body for the shadow request
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	primaryDuration := time.Since(start)
+
+	primaryStatus := "error"
+	var primaryBody []byte
+	if err == nil {
+		primaryStatus = statusClass(resp.StatusCode)
+		if primaryBody, err = t.captureBody(resp); err != nil {
+			return nil, err
+		}
+	}
+
+	endpoint := normalizeUserServicePath(req.URL.Path)
+	select {
+	case t.inflight <- struct{}{}:
+		err := background.Go("shadow_request", func(stop context.Context) error {
+			defer func() { <-t.inflight }()
+			t.mirror(stop, req, body, endpoint, primaryStatus, primaryBody, primaryDuration)
+			return nil
+		})
+		if err != nil {
+			// Shutting down
+			<-t.inflight
+			recordShadowComparison(req.Context(), endpoint, primaryStatus, "", shadowOutcomeDropped, primaryDuration, 0)
+		}
+	default:
+		recordShadowComparison(req.Context(), endpoint, primaryStatus, "", shadowOutcomeDropped, primaryDuration, 0)
+	}
+
+	return resp, err
+}
+
+// mirror sends the copy of a request to the shadow upstream and compares the
+// result with the primary's. It is abandoned when stop is cancelled.
+func (t *mirrorTransport) mirror(stop context.Context, original *http.Request, body []byte, endpoint, primaryStatus string, primaryBody []byte, primaryDuration time.Duration) {
+	// The shadow call outlives the client request but stays in its trace
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(original.Context()), t.timeout)
+	defer cancel()
+	defer context.AfterFunc(stop, cancel)()
+
+	url := t.shadowURL + original.URL.Path
+	if original.URL.RawQuery != "" {
+		url += "?" + original.URL.RawQuery
+	}
+	req, err := http.NewRequestWithContext(ctx, original.Method, url, bytes.NewReader(body))
+	if err != nil {
+		recordShadowComparison(ctx, endpoint, primaryStatus, "error", shadowOutcomeError, primaryDuration, 0)
+		return
+	}
+	req.Header = original.Header.Clone()
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	shadowDuration := time.Since(start)
+	if err != nil {
+		recordShadowComparison(ctx, endpoint, primaryStatus, "error", shadowOutcomeError, primaryDuration, shadowDuration)
+		logger.Debug(ctx, "Shadow request failed", map[string]interface{}{
+			"endpoint": endpoint,
+			"error":    err.Error(),
+		})
+		return
+	}
+	shadowBody, readErr := io.ReadAll(io.LimitReader(resp.Body, t.maxDiffBytes+1))
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	shadowStatus := statusClass(resp.StatusCode)
+	outcome := shadowOutcomeMatch
+	switch {
+	case shadowStatus != primaryStatus:
+		outcome = shadowOutcomeStatusMismatch
+		logger.Warn(ctx, "Shadow response status differs from primary", map[string]interface{}{
+			"endpoint":       endpoint,
+			"primary_status": primaryStatus,
+			"shadow_status":  shadowStatus,
+			"status_code":    resp.StatusCode,
+		})
+
+	// Bodies over the limit (nil primary body) are only compared by status
+	case primaryBody != nil && readErr == nil && int64(len(shadowBody)) <= t.maxDiffBytes:
+		if differences := t.differ.diff(primaryBody, shadowBody); len(differences) > 0 {
+			outcome = shadowOutcomeBodyMismatch
+			if rand.Float64() < t.diffLogSample {
+				logger.Warn(ctx, "Shadow response body differs from primary", map[string]interface{}{
+					"endpoint":    endpoint,
+					"differences": differences,
+				})
+			}
+		}
+	}
+	recordShadowComparison(ctx, endpoint, primaryStatus, shadowStatus, outcome, primaryDuration, shadowDuration)
+}
+
+// captureBody keeps a copy of a primary response body for diffing, leaving
+// the response readable by the caller. It returns nil for bodies above
+// SHADOW_DIFF_MAX_BYTES.
+func (t *mirrorTransport) captureBody(resp *http.Response) ([]byte, error) {
+	captured, err := io.ReadAll(io.LimitReader(resp.Body, t.maxDiffBytes+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	if int64(len(captured)) > t.maxDiffBytes {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(captured), resp.Body), resp.Body}
+		return nil, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(captured))
+	return captured, nil
+}
+
+// statusClass turns a status code into a bounded label value such as "2xx"
+func statusClass(code int) string {
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+// normalizeUserServicePath replaces IDs in user-service paths so they can be
+// used as metric labels, e.g. /users/42/profile becomes /users/{id}/profile
+func normalizeUserServicePath(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		if segments[i-1] == "users" {
+			segments[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
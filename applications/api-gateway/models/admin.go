@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/faidon-laboratory/go-service"
+)
+
+// Goroutines is the body of GET /admin/goroutines
+type Goroutines struct {
+	OK                bool                `json:"ok"`
+	Goroutines        []service.TaskInfo  `json:"goroutines"`
+	Stages            []service.StageInfo `json:"stages"`
+	ProcessGoroutines int                 `json:"process_goroutines"`
+}
+
+// ClockChange is the body of POST /admin/clock: Advance is a duration
+// ("90m"), Set a time to jump to
+type ClockChange struct {
+	Advance string     `json:"advance"`
+	Set     *time.Time `json:"set"`
+}
+
+// ClockStatus is the body of GET and POST /admin/clock; Now keeps its
+// nanoseconds
+type ClockStatus struct {
+	OK   bool      `json:"ok"`
+	Now  time.Time `json:"now"`
+	Fake bool      `json:"fake"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// ServiceManifest is the body of GET /.well-known/service-manifest, the
+// gateway's description of itself for inventory tooling
+type ServiceManifest struct {
+	Name         string               `json:"name"`
+	Version      string               `json:"version"`
+	Environment  string               `json:"environment"`
+	StartedAt    time.Time            `json:"started_at"`
+	Routes       []ManifestRoute      `json:"routes"`
+	Dependencies []ManifestDependency `json:"dependencies"`
+	FeatureFlags []ManifestFeature    `json:"feature_flags"`
+	SLOs         []ManifestSLO        `json:"slos"`
+}
+
+// ManifestRoute is a route served by the gateway
+type ManifestRoute struct {
+	Listener string   `json:"listener"`
+	Path     string   `json:"path"`
+	Prefix   bool     `json:"prefix,omitempty"`
+	Methods  []string `json:"methods"`
+	Auth     []string `json:"auth"`
+	Priority string   `json:"priority"`
+}
+
+// ManifestDependency is an upstream the gateway calls, with the
+// functionality relying on it
+type ManifestDependency struct {
+	Name          string   `json:"name"`
+	URL           string   `json:"url"`
+	Functionality []string `json:"functionality"`
+}
+
+// ManifestFeature is a feature flag and how far it is rolled out
+type ManifestFeature struct {
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	Routes         []string `json:"routes"`
+	RolloutPercent int      `json:"rollout_percent"`
+}
+
+// ManifestSLO is the objective of one SLI of a route; TargetMs is the
+// threshold of a latency SLI. A throughput SLI has no objective.
+type ManifestSLO struct {
+	Route     string   `json:"route"`
+	Methods   []string `json:"methods"`
+	SLI       string   `json:"sli"`
+	TargetMs  int64    `json:"target_ms,omitempty"`
+	Objective float64  `json:"objective,omitempty"`
+}
@@ -0,0 +1,43 @@
+// Package models holds the request and response bodies of the gateway's own
+// routes, one type per body instead of anonymous structs and maps. Bodies of
+// the upstream services are their clients' types (clients/userservice and
+// the generated notificationclient), embedded here where the gateway
+// composes them.
+//
+// The admin listings of the gateway's registries (routes, schedules,
+// dependencies, feature previews, streams) are typed next to the registry
+// they list, as their entries carry its internal state.
+//
+// Timestamps are time.Time in UTC and serialize as RFC 3339; the ones of
+// responses are truncated to the second.
+package models
+
+// Error is the body of a failed request on the gateway's own routes
+type Error struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// ProxyError is the body of a failed request on a route relaying an upstream
+// service (/api/users, /api/notifications), in the user service's error
+// shape
+type ProxyError struct {
+	Error string `json:"error"`
+}
+
+// Problem is an RFC 9457 problem detail: the body of requests no route
+// matches, and of upstream failures, with the upstream's own error under the
+// passthrough policy
+type Problem struct {
+	Type          string `json:"type"`
+	Title         string `json:"title"`
+	Status        int    `json:"status"`
+	Detail        string `json:"detail"`
+	Instance      string `json:"instance"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	Upstream      string `json:"upstream,omitempty"`
+	// UpstreamStatus and UpstreamError are set with Upstream
+	UpstreamStatus int `json:"upstream_status,omitempty"`
+	// UpstreamError holds the sanitized fields of the upstream's error body
+	UpstreamError map[string]interface{} `json:"upstream_error,omitempty"`
+}
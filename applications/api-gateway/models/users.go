@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"api-gateway/clients/userservice"
+	"api-gateway/notificationclient"
+)
+
+// UserResponse answers GET /api/users/{id} and POST /api/users
+type UserResponse struct {
+	OK   bool              `json:"ok"`
+	User *userservice.User `json:"user"`
+}
+
+// UserV2 is a user in the v2 schema (the users-v2 preview): id instead of
+// user_id, last_login_at only once set
+type UserV2 struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Email       string  `json:"email"`
+	Status      string  `json:"status"`
+	CreatedAt   string  `json:"created_at,omitempty"`
+	LastLoginAt *string `json:"last_login_at,omitempty"`
+}
+
+// UserResponseV2 is UserResponse for clients opted into the v2 schema
+type UserResponseV2 struct {
+	OK            bool   `json:"ok"`
+	User          UserV2 `json:"user"`
+	SchemaVersion int    `json:"schema_version"`
+}
+
+// UserSummary is the body of GET /api/users/{id}/summary. A part whose
+// service failed is null, with its error in Errors and Partial set.
+type UserSummary struct {
+	UserID              string                            `json:"user_id"`
+	Partial             bool                              `json:"partial"`
+	GeneratedAt         time.Time                         `json:"generated_at"`
+	Profile             *userservice.Profile              `json:"profile"`
+	RecentNotifications []notificationclient.Notification `json:"recent_notifications"`
+	UnreadCount         *int                              `json:"unread_count"`
+	Errors              map[string]string                 `json:"errors,omitempty"`
+}
+
+// Greeting is the body of GET /hello/{name}
+type Greeting struct {
+	OK       bool   `json:"ok"`
+	Message  string `json:"message"`
+	Greeting string `json:"greeting"`
+	Locale   string `json:"locale"`
+}
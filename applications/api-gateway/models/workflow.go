@@ -0,0 +1,106 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"api-gateway/clients/userservice"
+	"api-gateway/notificationclient"
+)
+
+// ProcessUserRequest is the body of POST /process-user
+type ProcessUserRequest struct {
+	UserID  string `json:"user_id"`
+	Action  string `json:"action"`
+	Message string `json:"message"`
+}
+
+// ProcessUserResponse answers a processed user request
+type ProcessUserResponse struct {
+	OK                 bool                             `json:"ok"`
+	Message            string                           `json:"message"`
+	UserID             string                           `json:"user_id"`
+	Action             string                           `json:"action"`
+	UserServiceResult  *userservice.WorkResult          `json:"user_service_result"`
+	NotificationResult *notificationclient.SendResponse `json:"notification_result"`
+	ProcessedAt        time.Time                        `json:"processed_at"`
+}
+
+// StepResult is the outcome of one step of a workflow run
+type StepResult struct {
+	Name       string `json:"name"`
+	DurationMs int64  `json:"duration_ms"`
+	Skipped    bool   `json:"skipped,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WorkflowResult is the body of a completed POST /api/process
+type WorkflowResult struct {
+	OK          bool         `json:"ok"`
+	WorkflowID  string       `json:"workflow_id"`
+	RunID       string       `json:"run_id"`
+	Status      string       `json:"status"`
+	Steps       []StepResult `json:"steps"`
+	ProcessedAt time.Time    `json:"processed_at"`
+	DurationMs  int64        `json:"duration_ms"`
+	// Results are the values the steps return to the caller
+	// (user_service_result, notification_result, processing_ms, ...), at the
+	// top level of the body
+	Results map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON writes the results next to the other fields
+func (r WorkflowResult) MarshalJSON() ([]byte, error) {
+	type fields WorkflowResult
+	body, err := json.Marshal(fields(r))
+	if err != nil || len(r.Results) == 0 {
+		return body, err
+	}
+
+	merged := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range r.Results {
+		if merged[key], err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(merged)
+}
+
+// WorkflowFailure is the body of a failed POST /api/process, with the steps
+// run until the failure
+type WorkflowFailure struct {
+	OK         bool         `json:"ok"`
+	WorkflowID string       `json:"workflow_id"`
+	RunID      string       `json:"run_id"`
+	Error      string       `json:"error"`
+	Steps      []StepResult `json:"steps"`
+}
+
+// WorkflowExecution is the record of a finished workflow run
+type WorkflowExecution struct {
+	ID         string `json:"id"`
+	WorkflowID string `json:"workflow_id"`
+	Source     string `json:"source"`
+	ScheduleID string `json:"schedule_id,omitempty"`
+	// Input is the run's request with personal values redacted
+	Input      map[string]interface{} `json:"input"`
+	Steps      []StepResult           `json:"steps"`
+	Outcome    string                 `json:"outcome"`
+	StatusCode int                    `json:"status_code"`
+	Error      string                 `json:"error,omitempty"`
+	TraceID    string                 `json:"trace_id,omitempty"`
+	TraceURL   string                 `json:"trace_url,omitempty"`
+	StartedAt  time.Time              `json:"started_at"`
+	DurationMs int64                  `json:"duration_ms"`
+}
+
+// ExecutionList is the body of GET /api/process/history
+type ExecutionList struct {
+	OK         bool                `json:"ok"`
+	WorkflowID string              `json:"workflow_id"`
+	Executions []WorkflowExecution `json:"executions"`
+	TotalCount int                 `json:"total_count"`
+}
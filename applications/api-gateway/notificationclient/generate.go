@@ -0,0 +1,6 @@
+// Package notificationclient is the gateway's client for the notification
+// service, generated from the service's OpenAPI document. After changing
+// notification-service/openapi.json, regenerate it with go generate ./...
+package notificationclient
+
+//go:generate go run ../tools/clientgen -spec ../../notification-service/openapi.json -package notificationclient -out client.gen.go
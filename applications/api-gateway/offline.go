@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+
+	"api-gateway/clients/userservice"
+)
+
+// Offline mode
+//
+// USER_SERVICE_MODE picks where user calls (/api/users, /process-user, the
+// workflow's fetch_user step and summaries) are answered:
+//
+//	remote    the user service at USER_SERVICE_URL
+//	fallback  the user service, or an in-memory store when it can't be
+//	          reached (refused connection, DNS failure, timeout); its error
+//	          responses are still returned as they are
+//	memory    only the in-memory store, without calling the user service
+//
+// Without USER_SERVICE_URL, fallback mode still calls the default
+// http://user-service:80, so a gateway running standalone is answered by the
+// store once that fails to resolve; only memory mode skips the user service
+// altogether. The store starts with users
+// 123, 456 and 789 and keeps the users created through it until the gateway
+// stops; users created on the user service are not copied to it. Calls it
+// answers in fallback mode are logged and counted in
+// user_service_fallbacks_total.
+
+const (
+	userServiceRemote   = "remote"
+	userServiceFallback = "fallback"
+	userServiceMemory   = "memory"
+)
+
+var userServiceMode string
+
+func init() {
+	userServiceMode = getEnvString("USER_SERVICE_MODE", userServiceFallback)
+	switch userServiceMode {
+	case userServiceRemote, userServiceFallback, userServiceMemory:
+	default:
+		configWarning("Invalid USER_SERVICE_MODE %q, expected remote, fallback or memory; using fallback", userServiceMode)
+		userServiceMode = userServiceFallback
+	}
+}
+
+// withOfflineMode returns the user service API for USER_SERVICE_MODE
+func withOfflineMode(client userservice.API) userservice.API {
+	switch userServiceMode {
+	case userServiceMemory:
+		return userservice.NewMemory(greeting, userservice.DemoUsers()...)
+	case userServiceFallback:
+		return &userservice.Fallback{
+			Primary:    client,
+			Secondary:  userservice.NewMemory(greeting, userservice.DemoUsers()...),
+			OnFallback: onUserServiceFallback,
+		}
+	default:
+		return client
+	}
+}
+
+// onUserServiceFallback logs and counts a call answered by the store
+func onUserServiceFallback(ctx context.Context, operation string, err error) {
+	logger.Warn(ctx, "User service unreachable, answering from the in-memory store", map[string]interface{}{
+		"operation": operation,
+		"error":     err.Error(),
+	})
+	logger.AddSpanAttribute(ctx, "user_service.fallback", "memory")
+	recordUserServiceFallback(ctx, operation)
+}
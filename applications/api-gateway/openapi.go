@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// OpenAPI aggregation
+//
+// With OPENAPI_AGGREGATION=on the gateway fetches the /openapi.json documents
+// of the services in OPENAPI_UPSTREAMS ("notification-service" or
+// "notification-service=/prefix,..."; the prefix defaults to /<service>) every
+// OPENAPI_REFRESH_SEC seconds and serves one combined document at
+// GET /openapi.json:
+//
+//   - upstream paths are moved under the service's prefix and tagged with the
+//     service name; operation IDs and component names get the service name
+//     too, so documents can't collide
+//   - servers is the gateway (OPENAPI_SERVER_URL)
+//   - the gateway's own routes are listed under the api-gateway tag
+//
+// So that the document is true, the documented upstream operations (and only
+// those) are forwarded: a request under a prefix that matches an operation
+// goes to the upstream with the tenant header and request signature, like the
+// gateway's own internal calls. Services without a document (the user service
+// has none) are left out, and a failed refresh keeps the last document.
+
+const (
+	openAPIAggregationOff = "off"
+	openAPIAggregationOn  = "on"
+)
+
+// openAPIMethods are the operation keys of an OpenAPI path item
+var openAPIMethods = []string{"get", "put", "post", "patch", "delete", "head", "options"}
+
+// specUpstream is a service whose document is aggregated
+type specUpstream struct {
+	name      string
+	prefix    string
+	baseURL   func() string
+	transport func() http.RoundTripper
+}
+
+// upstreamSpec is the last document fetched from an upstream and the router
+// forwarding its operations
+type upstreamSpec struct {
+	document map[string]interface{}
+	router   *mux.Router
+}
+
+var (
+	openAPIAggregation string
+	openAPIRefresh     time.Duration
+	openAPIServerURL   string
+	specUpstreams      []specUpstream
+
+	specsMu sync.RWMutex
+	specs   = make(map[string]*upstreamSpec)
+)
+
+// knownSpecUpstreams are the services the gateway knows how to reach
+var knownSpecUpstreams = map[string]specUpstream{
+	"notification-service": {
+		baseURL:   func() string { return notificationServiceURL },
+		transport: func() http.RoundTripper { return notificationServiceTransport },
+	},
+	"user-service": {
+		baseURL:   func() string { return userServiceURL },
+		transport: func() http.RoundTripper { return userServiceTransport },
+	},
+}
+
+func init() {
+	openAPIAggregation = getEnvString("OPENAPI_AGGREGATION", openAPIAggregationOff)
+	openAPIRefresh = time.Duration(getEnvInt("OPENAPI_REFRESH_SEC", 60)) * time.Second
+	openAPIServerURL = getEnvString("OPENAPI_SERVER_URL", "/")
+
+	for _, entry := range strings.Split(getEnvString("OPENAPI_UPSTREAMS", "notification-service"), ",") {
+		name, prefix, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		upstream, ok := knownSpecUpstreams[name]
+		if !ok {
+			continue
+		}
+		if prefix == "" {
+			prefix = "/" + name
+		}
+		upstream.name = name
+		upstream.prefix = "/" + strings.Trim(prefix, "/")
+		specUpstreams = append(specUpstreams, upstream)
+	}
+}
+
+// registerOpenAPIRoutes adds /openapi.json and the forwarded prefixes to the
+// router and starts refreshing the upstream documents
+func registerOpenAPIRoutes(routes *routeRegistry) {
+	if openAPIAggregation != openAPIAggregationOn {
+		return
+	}
+
+	routes.handleFunc("/openapi.json", openAPIHandler(routes.router), "GET")
+	for _, upstream := range specUpstreams {
+		routes.handlePrefix(upstream.prefix+"/", forwardSpecOperation(upstream))
+	}
+
+	background.Supervise("openapi_aggregation", func(ctx context.Context) error {
+		ticker := time.NewTicker(openAPIRefresh)
+		defer ticker.Stop()
+		for {
+			for _, upstream := range specUpstreams {
+				jobCtx, endJob := logger.StartJob(ctx, "refresh_openapi_spec")
+				logger.AddSpanAttribute(jobCtx, "upstream", upstream.name)
+				endJob(refreshUpstreamSpec(jobCtx, upstream))
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// refreshUpstreamSpec fetches an upstream's document and rebuilds its router
+func refreshUpstreamSpec(ctx context.Context, upstream specUpstream) error {
+	ctx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+	defer cancel()
+
+	document, err := fetchUpstreamSpec(ctx, upstream)
+	if err != nil {
+		logger.Warn(ctx, "Failed to fetch upstream OpenAPI document", map[string]interface{}{
+			"upstream": upstream.name,
+			"error":    err.Error(),
+		})
+		return err
+	}
+
+	router := mux.NewRouter()
+	router.NotFoundHandler = unmatchedHandler(http.StatusNotFound)
+	router.MethodNotAllowedHandler = unmatchedHandler(http.StatusMethodNotAllowed)
+	paths, _ := document["paths"].(map[string]interface{})
+	for path, item := range paths {
+		operations, _ := item.(map[string]interface{})
+		for _, method := range openAPIMethods {
+			if _, ok := operations[method]; ok {
+				route := upstream.prefix + path
+				router.Handle(route, logger.HTTPMiddleware(route)(proxySpecOperation(upstream))).Methods(strings.ToUpper(method))
+			}
+		}
+	}
+
+	specsMu.Lock()
+	specs[upstream.name] = &upstreamSpec{document: document, router: router}
+	specsMu.Unlock()
+	return nil
+}
+
+// fetchUpstreamSpec downloads and decodes an upstream's /openapi.json
+func fetchUpstreamSpec(ctx context.Context, upstream specUpstream) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", upstream.baseURL()+"/openapi.json", nil)
+	if err != nil {
+		return nil, err
+	}
+	signRequest(req, nil)
+
+	client := &http.Client{Timeout: upstreamTimeout, Transport: upstream.transport()}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var document map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	if _, ok := document["paths"].(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("document has no paths")
+	}
+	return document, nil
+}
+
+// forwardSpecOperation routes a request under an upstream's prefix through the
+// router built from its document
+func forwardSpecOperation(upstream specUpstream) http.Handler {
+	notFound := unmatchedHandler(http.StatusNotFound)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		specsMu.RLock()
+		spec := specs[upstream.name]
+		specsMu.RUnlock()
+		if spec == nil {
+			notFound(w, r)
+			return
+		}
+		spec.router.ServeHTTP(w, r)
+	})
+}
+
+// proxySpecOperation forwards a documented operation to its upstream
+func proxySpecOperation(upstream specUpstream) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeProxyError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		target := upstream.baseURL() + strings.TrimPrefix(r.URL.EscapedPath(), upstream.prefix)
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		req, err := http.NewRequestWithContext(ctx, r.Method, target, bytes.NewReader(body))
+		if err != nil {
+			logger.Error(ctx, "Failed to create upstream request", err)
+			writeProxyError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		for _, header := range []string{"Content-Type", "Accept"} {
+			if value := r.Header.Get(header); value != "" {
+				req.Header.Set(header, value)
+			}
+		}
+		propagateTenant(ctx, req)
+		signRequest(req, body)
+
+		client := &http.Client{Timeout: upstreamTimeout, Transport: upstream.transport()}
+		resp, err := client.Do(req)
+		if err != nil {
+			if abortIfClientGone(ctx) {
+				return
+			}
+			logger.Error(ctx, "Upstream request failed", err, map[string]interface{}{
+				"upstream": upstream.name,
+			})
+			writeProxyError(w, http.StatusServiceUnavailable, upstream.name+" unavailable")
+			return
+		}
+		defer resp.Body.Close()
+
+		for _, header := range []string{"Content-Type", "Retry-After"} {
+			if value := resp.Header.Get(header); value != "" {
+				w.Header().Set(header, value)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}
+}
+
+// combinedSpec merges the upstream documents and the gateway's own routes
+func combinedSpec(router *mux.Router) map[string]interface{} {
+	paths := make(map[string]interface{})
+	components := make(map[string]map[string]interface{})
+	tags := []interface{}{
+		map[string]interface{}{"name": "api-gateway", "description": "Served by the gateway"},
+	}
+
+	specsMu.RLock()
+	for _, upstream := range specUpstreams {
+		spec := specs[upstream.name]
+		if spec == nil {
+			continue
+		}
+		componentPrefix := componentName(upstream.name)
+		document := renameComponentRefs(spec.document, componentPrefix).(map[string]interface{})
+
+		description := "Forwarded to " + upstream.name
+		if info, ok := document["info"].(map[string]interface{}); ok {
+			description += fmt.Sprintf(" (%v %v)", info["title"], info["version"])
+		}
+		tags = append(tags, map[string]interface{}{"name": upstream.name, "description": description})
+
+		upstreamPaths, _ := document["paths"].(map[string]interface{})
+		for path, item := range upstreamPaths {
+			operations, _ := item.(map[string]interface{})
+			for _, method := range openAPIMethods {
+				operation, ok := operations[method].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				operation["tags"] = []interface{}{upstream.name}
+				if id, ok := operation["operationId"].(string); ok {
+					operation["operationId"] = componentPrefix + "_" + id
+				}
+			}
+			paths[upstream.prefix+path] = item
+		}
+
+		upstreamComponents, _ := document["components"].(map[string]interface{})
+		for kind, entries := range upstreamComponents {
+			named, _ := entries.(map[string]interface{})
+			if components[kind] == nil {
+				components[kind] = make(map[string]interface{})
+			}
+			for name, value := range named {
+				components[kind][componentPrefix+name] = value
+			}
+		}
+	}
+	specsMu.RUnlock()
+
+	// The gateway's own routes, without schemas
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || strings.HasPrefix(path, "/admin") || path == "/openapi.json" {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		for _, method := range methods {
+			item[strings.ToLower(method)] = map[string]interface{}{
+				"tags":      []interface{}{"api-gateway"},
+				"responses": map[string]interface{}{"default": map[string]interface{}{"description": "See the gateway README"}},
+			}
+		}
+		return nil
+	})
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Faidon Laboratory API",
+			"version":     getEnvString("SERVICE_VERSION", "1.0.0"),
+			"description": "Combined by the API gateway from the documents of its upstream services",
+		},
+		"servers":    []interface{}{map[string]interface{}{"url": openAPIServerURL}},
+		"tags":       tags,
+		"paths":      paths,
+		"components": components,
+	}
+}
+
+// renameComponentRefs returns a copy of a decoded document with every
+// "#/components/<kind>/<name>" reference prefixed
+func renameComponentRefs(value interface{}, prefix string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if ref, ok := item.(string); ok && key == "$ref" && strings.HasPrefix(ref, "#/components/") {
+				if slash := strings.LastIndex(ref, "/"); slash >= 0 {
+					ref = ref[:slash+1] + prefix + ref[slash+1:]
+				}
+				copied[key] = ref
+				continue
+			}
+			copied[key] = renameComponentRefs(item, prefix)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = renameComponentRefs(item, prefix)
+		}
+		return copied
+	default:
+		return value
+	}
+}
+
+// componentName turns a service name into a component name prefix,
+// e.g. notification-service becomes NotificationService
+func componentName(service string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(service, "-") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
+
+// Combined OpenAPI document endpoint
+func openAPIHandler(router *mux.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, combinedSpec(router))
+	}
+}
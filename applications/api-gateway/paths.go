@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Path normalization
+//
+// Request paths are normalized before routing: duplicate slashes are
+// collapsed, "." and ".." segments resolved and the trailing slash dropped, so
+// /api//users/ reaches /api/users. PATH_NORMALIZATION picks what happens to a
+// path that changes:
+//
+//	rewrite   route the normalized path directly (default)
+//	redirect  answer 308 with the normalized path; unlike mux's own 301 the
+//	          method and body are kept, so POSTs survive
+//	off       leave paths to mux, which redirects unclean paths with a 301 and
+//	          treats /api/users/ as a different route
+//
+// Percent-encoded characters are decoded once before matching. An encoded
+// slash (%2F) would either split a segment or smuggle a slash into an ID, so
+// paths containing one are rejected with 400.
+
+const (
+	pathNormalizationRewrite  = "rewrite"
+	pathNormalizationRedirect = "redirect"
+	pathNormalizationOff      = "off"
+)
+
+var pathNormalization string
+
+func init() {
+	pathNormalization = getEnvString("PATH_NORMALIZATION", pathNormalizationRewrite)
+	switch pathNormalization {
+	case pathNormalizationRewrite, pathNormalizationRedirect, pathNormalizationOff:
+	default:
+		configWarning("Unknown PATH_NORMALIZATION %q, using %s", pathNormalization, pathNormalizationRewrite)
+		pathNormalization = pathNormalizationRewrite
+	}
+}
+
+// normalizePath returns the canonical form of a request path
+func normalizePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	// path.Clean also drops the trailing slash
+	return path.Clean(p)
+}
+
+// withPathNormalization applies the path normalization policy before routing
+func withPathNormalization(next http.Handler) http.Handler {
+	if pathNormalization == pathNormalizationOff {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(strings.ToLower(r.URL.RawPath), "%2f") {
+			ctx, endSpan := logger.StartSpan(r.Context(), "rejected_path")
+			defer endSpan()
+
+			start := time.Now()
+			writeProblem(w, http.StatusBadRequest, "Encoded slashes are not allowed in paths", r)
+			logger.CountRequest(ctx, unmatchedRoute, 400)
+			logger.RecordDuration(ctx, unmatchedRoute, time.Since(start))
+			return
+		}
+
+		normalized := normalizePath(r.URL.Path)
+		if normalized == r.URL.Path {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		target := *r.URL
+		target.Path = normalized
+		target.RawPath = ""
+		if pathNormalization == pathNormalizationRedirect {
+			http.Redirect(w, r, target.RequestURI(), http.StatusPermanentRedirect)
+			return
+		}
+
+		rewritten := r.WithContext(r.Context())
+		rewritten.URL = &target
+		next.ServeHTTP(w, rewritten)
+	})
+}
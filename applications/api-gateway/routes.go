@@ -0,0 +1,341 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/faidon-laboratory/go-logging"
+	service "github.com/faidon-laboratory/go-service"
+	"github.com/gorilla/mux"
+)
+
+// Route registry
+//
+// Routes are registered through a routeRegistry wrapping the mux router
+// instead of on the router directly. It records each route with its
+// listener, methods, handler, middleware and auth policy, and rejects a
+// registration that another route would shadow: the same path template
+// (whatever its variables are named) and method on the same listener, or a
+// path under a prefix route. mux silently serves the first match, so such a
+// mistake would otherwise only show as a handler that never runs; the
+// gateway refuses to start instead. Every handler is wrapped in the logging
+// library's HTTPMiddleware, which traces, counts and logs it under the
+// route's path template, and within it in RecoverMiddleware, which turns a
+// panic into a logged 500 that fails the route's span, and shedLoad, which
+// turns the route's requests away under overload by the route's priority
+// (see loadshed.go).
+//
+// A route measured by SLIs is registered through sli(), e.g.
+//
+//	routes.sli(logging.Latency(300*time.Millisecond), logging.Availability()).
+//		handleFunc("/api/users/{id}", getUserHandler, "GET")
+//
+// and the telemetry middleware counts its requests against them in
+// sli_requests_total, so which endpoint tracks which SLI is declared in one
+// place instead of in comments next to the handlers.
+//
+// GET /admin/routes lists the registered routes in match order.
+
+const (
+	listenerPublic = "public"
+	listenerAdmin  = "admin"
+
+	// routeAuthAdmin marks routes behind adminMiddleware
+	routeAuthAdmin = "admin"
+)
+
+// registeredRoute is one route as listed by /admin/routes
+type registeredRoute struct {
+	Listener string   `json:"listener"`
+	Path     string   `json:"path"`
+	Prefix   bool     `json:"prefix,omitempty"`
+	Methods  []string `json:"methods"`
+	Handler  string   `json:"handler"`
+	// Middleware is filled in when listing, as middleware can be added after
+	// the route
+	Middleware []string `json:"middleware"`
+	Auth       []string `json:"auth"`
+	SLIs       []string `json:"slis,omitempty"`
+	Priority   string   `json:"priority"`
+
+	group *routeRegistry
+	key   string
+}
+
+// routeTable holds the routes of every listener
+var routeTable struct {
+	mu     sync.Mutex
+	routes []*registeredRoute
+	errs   []error
+}
+
+// routeRegistry registers routes on a router or subrouter
+type routeRegistry struct {
+	router     *mux.Router
+	listener   string
+	prefix     string
+	auth       string
+	parent     *routeRegistry
+	middleware []string
+	// slis are the SLIs of the routes registered through the registry
+	slis []logging.SLI
+	// priority is the load-shedding priority of its routes (see
+	// loadshed.go), empty for normal
+	priority string
+}
+
+// newRouteRegistry wraps the root router of a listener
+func newRouteRegistry(router *mux.Router, listener string) *routeRegistry {
+	return &routeRegistry{router: router, listener: listener}
+}
+
+// use adds a named middleware to the registry's routes
+func (g *routeRegistry) use(name string, middleware mux.MiddlewareFunc) {
+	g.router.Use(middleware)
+	routeTable.mu.Lock()
+	g.middleware = append(g.middleware, name)
+	routeTable.mu.Unlock()
+}
+
+// subrouter returns a registry for the routes under prefix; auth names the
+// policy its middleware enforces, empty to keep the parent's
+func (g *routeRegistry) subrouter(prefix, auth string) *routeRegistry {
+	if auth == "" {
+		auth = g.auth
+	}
+	return &routeRegistry{
+		router:   g.router.PathPrefix(prefix).Subrouter(),
+		listener: g.listener,
+		prefix:   g.prefix + prefix,
+		auth:     auth,
+		parent:   g,
+		priority: g.priority,
+	}
+}
+
+// sli returns a registry for routes measured by slis; it shares the
+// router, so add middleware to the registry it came from
+func (g *routeRegistry) sli(slis ...logging.SLI) *routeRegistry {
+	return &routeRegistry{
+		router:   g.router,
+		listener: g.listener,
+		prefix:   g.prefix,
+		auth:     g.auth,
+		parent:   g,
+		slis:     slis,
+		priority: g.priority,
+	}
+}
+
+// withPriority returns a registry for routes shed under load at priority;
+// like sli() it shares the router
+func (g *routeRegistry) withPriority(priority string) *routeRegistry {
+	return &routeRegistry{
+		router:   g.router,
+		listener: g.listener,
+		prefix:   g.prefix,
+		auth:     g.auth,
+		parent:   g,
+		slis:     g.slis,
+		priority: priority,
+	}
+}
+
+// routePriority returns the load-shedding priority of the registry's routes
+func (g *routeRegistry) routePriority() string {
+	if g.priority == "" {
+		return priorityNormal
+	}
+	return g.priority
+}
+
+// handleFunc registers a handler function for the methods, any method if none
+func (g *routeRegistry) handleFunc(path string, handler http.HandlerFunc, methods ...string) {
+	g.handle(path, handler, methods...)
+}
+
+// handle registers a handler for the methods, any method if none
+func (g *routeRegistry) handle(path string, handler http.Handler, methods ...string) {
+	if g.register(path, false, handler, methods) {
+		handler = shedLoad(g.routePriority(), g.prefix+path)(handler)
+		route := g.router.Handle(path, logger.HTTPMiddleware(g.prefix+path, g.slis...)(logger.RecoverMiddleware()(handler)))
+		if len(methods) > 0 {
+			route.Methods(methods...)
+		}
+	}
+}
+
+// handlePrefix registers a handler for every path under prefix
+func (g *routeRegistry) handlePrefix(prefix string, handler http.Handler) {
+	if g.register(prefix, true, handler, nil) {
+		handler = shedLoad(g.routePriority(), g.prefix+prefix)(handler)
+		g.router.PathPrefix(prefix).Handler(logger.HTTPMiddleware(g.prefix+prefix, g.slis...)(logger.RecoverMiddleware()(handler)))
+	}
+}
+
+// routeVariable matches the variables of a path template
+var routeVariable = regexp.MustCompile(`\{[^}]*\}`)
+
+// register records a route, or the conflict that keeps it from being added
+func (g *routeRegistry) register(path string, prefix bool, handler http.Handler, methods []string) bool {
+	route := &registeredRoute{
+		Listener: g.listener,
+		Path:     g.prefix + path,
+		Prefix:   prefix,
+		Methods:  methods,
+		Handler:  handlerName(handler),
+		group:    g,
+		SLIs:     logging.SLIStrings(g.slis),
+		Priority: g.routePriority(),
+		// /users/{id} and /users/{user_id} match the same requests
+		key: routeVariable.ReplaceAllString(g.prefix+path, "{}"),
+	}
+	if len(route.Methods) == 0 {
+		route.Methods = []string{"*"}
+	}
+
+	routeTable.mu.Lock()
+	defer routeTable.mu.Unlock()
+	for _, existing := range routeTable.routes {
+		if existing.Listener != route.Listener || !routesOverlap(existing, route) {
+			continue
+		}
+		routeTable.errs = append(routeTable.errs, fmt.Errorf("%s %s (%s) on the %s listener conflicts with %s %s (%s)",
+			strings.Join(route.Methods, ","), route.Path, route.Handler, route.Listener,
+			strings.Join(existing.Methods, ","), existing.Path, existing.Handler))
+		return false
+	}
+	routeTable.routes = append(routeTable.routes, route)
+	return true
+}
+
+// routesOverlap reports whether a request could match both routes
+func routesOverlap(a, b *registeredRoute) bool {
+	var pathsOverlap bool
+	switch {
+	case a.Prefix && b.Prefix:
+		pathsOverlap = strings.HasPrefix(a.key, b.key) || strings.HasPrefix(b.key, a.key)
+	case a.Prefix:
+		pathsOverlap = strings.HasPrefix(b.key, a.key)
+	case b.Prefix:
+		pathsOverlap = strings.HasPrefix(a.key, b.key)
+	default:
+		pathsOverlap = a.key == b.key
+	}
+	if !pathsOverlap {
+		return false
+	}
+	for _, methodA := range a.Methods {
+		for _, methodB := range b.Methods {
+			if methodA == "*" || methodB == "*" || methodA == methodB {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// routeRegistrationError returns the conflicts found while registering routes
+func routeRegistrationError() error {
+	routeTable.mu.Lock()
+	defer routeTable.mu.Unlock()
+	return errors.Join(routeTable.errs...)
+}
+
+// handlerName returns the function name of a handler, e.g. getUserHandler
+func handlerName(handler http.Handler) string {
+	value := reflect.ValueOf(handler)
+	if value.Kind() != reflect.Func {
+		return fmt.Sprintf("%T", handler)
+	}
+	name := runtime.FuncForPC(value.Pointer()).Name()
+	// Handlers built by a function are named after it
+	name = closureSuffix.ReplaceAllString(name, "")
+	return strings.TrimPrefix(name, "main.")
+}
+
+// closureSuffix matches the name suffix of a function literal
+var closureSuffix = regexp.MustCompile(`(\.func\d+)+$`)
+
+// routeAuth lists the ways a caller can authenticate for a route
+func routeAuth(route *registeredRoute) []string {
+	auth := []string{service.AdminAuthNone}
+	for g := route.group; g != nil; g = g.parent {
+		if g.auth != routeAuthAdmin {
+			continue
+		}
+		auth = nil
+		if adminConfig.AcceptsTokens() {
+			auth = append(auth, service.AdminAuthToken)
+		}
+		if adminConfig.ClientCA != "" && route.Listener == listenerAdmin {
+			auth = append(auth, service.AdminAuthClient)
+		}
+		if adminConfig.Open {
+			// Opened with ADMIN_AUTH=none (local development)
+			auth = []string{service.AdminAuthNone}
+		} else if auth == nil {
+			// Nothing is accepted until credentials are configured
+			auth = []string{}
+		}
+		break
+	}
+	return auth
+}
+
+// listRoutes returns the registered routes in match order
+func listRoutes() []registeredRoute {
+	routeTable.mu.Lock()
+	defer routeTable.mu.Unlock()
+
+	routes := make([]registeredRoute, 0, len(routeTable.routes))
+	for _, route := range routeTable.routes {
+		listed := *route
+		// Outer registries' middleware runs first
+		var chain [][]string
+		for g := route.group; g != nil; g = g.parent {
+			chain = append([][]string{g.middleware}, chain...)
+		}
+		listed.Middleware = []string{}
+		for _, names := range chain {
+			listed.Middleware = append(listed.Middleware, names...)
+		}
+		// Added around each handler by handle and handlePrefix
+		listed.Middleware = append(listed.Middleware, "telemetry", "recover")
+		if shedsLoad(route.Priority) {
+			listed.Middleware = append(listed.Middleware, "load_shed")
+		}
+		listed.Auth = routeAuth(route)
+		routes = append(routes, listed)
+	}
+	return routes
+}
+
+// routeList is the body of GET /admin/routes
+type routeList struct {
+	OK                bool              `json:"ok"`
+	Routes            []registeredRoute `json:"routes"`
+	Wrappers          []string          `json:"wrappers"`
+	UpstreamTimeoutMs int64             `json:"upstream_timeout_ms"`
+}
+
+// Route listing endpoint
+func adminRoutesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	logger.AddSpanAttribute(ctx, "admin.identity", service.AdminIdentity(ctx))
+
+	writeJSON(w, http.StatusOK, routeList{
+		OK:     true,
+		Routes: listRoutes(),
+		// Applied to every route of the public listener, outside the router
+		Wrappers:          []string{"path_normalization", "standard_methods"},
+		UpstreamTimeoutMs: upstreamTimeout.Milliseconds(),
+	})
+}
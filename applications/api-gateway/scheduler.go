@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Recurring workflows
+//
+// Workflows can be registered with a cron expression through
+// POST /api/process/schedules, or at startup with WORKFLOW_SCHEDULES
+// ("workflow_id=cron;..."). The scheduler checks the schedules every second
+// and hands due runs to the async workflow workers, but only on the replica
+// that holds the scheduler lease (see leader.go). Schedules are kept in
+// memory, so each replica needs the same set; register them through
+// WORKFLOW_SCHEDULES when running several replicas. Cron times follow the
+// service clock (see clock.go).
+
+// Schedule is a workflow that runs on a cron schedule
+type Schedule struct {
+	ID         string          `json:"id"`
+	WorkflowID string          `json:"workflow_id"`
+	Cron       string          `json:"cron"`
+	UserID     string          `json:"user_id,omitempty"`
+	Priority   string          `json:"priority,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	Paused     bool            `json:"paused"`
+	CreatedAt  time.Time       `json:"created_at"`
+	NextRunAt  *time.Time      `json:"next_run_at,omitempty"`
+	LastRunAt  *time.Time      `json:"last_run_at,omitempty"`
+	LastStatus string          `json:"last_status,omitempty"`
+	RunCount   int             `json:"run_count"`
+
+	cron *cronSchedule
+}
+
+// Outcomes of a scheduled run
+const (
+	runStatusSucceeded = "succeeded"
+	runStatusFailed    = "failed"
+	runStatusDropped   = "dropped"
+)
+
+// scheduleStore keeps workflow schedules in memory
+type scheduleStore struct {
+	mu        sync.RWMutex
+	schedules map[string]*Schedule
+	nextID    int
+}
+
+var schedules = &scheduleStore{schedules: make(map[string]*Schedule)}
+
+// add parses the schedule's cron expression and stores it
+func (s *scheduleStore) add(schedule Schedule) (Schedule, error) {
+	parsed, err := parseCron(schedule.Cron)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	now := clock.Now().UTC()
+	next := parsed.next(now)
+	if next.IsZero() {
+		return Schedule{}, fmt.Errorf("cron expression %q never fires", schedule.Cron)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	schedule.ID = fmt.Sprintf("sched_%d", s.nextID)
+	schedule.CreatedAt = now
+	schedule.NextRunAt = &next
+	schedule.cron = parsed
+
+	s.schedules[schedule.ID] = &schedule
+	return schedule, nil
+}
+
+// list returns all schedules ordered by creation
+func (s *scheduleStore) list() []Schedule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		result = append(result, *schedule)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt) ||
+			(result[i].CreatedAt.Equal(result[j].CreatedAt) && result[i].ID < result[j].ID)
+	})
+	return result
+}
+
+// setPaused pauses or resumes a schedule, returning false if it doesn't exist
+func (s *scheduleStore) setPaused(id string, paused bool) (Schedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, false
+	}
+	schedule.Paused = paused
+	return *schedule, true
+}
+
+// due returns runs for the schedules due at now and moves them to their next
+// time. Paused schedules and replicas that aren't the leader skip the run but
+// still advance, so nothing piles up to fire at once later.
+func (s *scheduleStore) due(now time.Time, leader bool) []*workflowJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []*workflowJob
+	for _, schedule := range s.schedules {
+		if schedule.NextRunAt == nil || schedule.NextRunAt.After(now) {
+			continue
+		}
+
+		if next := schedule.cron.next(now); next.IsZero() {
+			schedule.NextRunAt = nil
+		} else {
+			schedule.NextRunAt = &next
+		}
+
+		if schedule.Paused || !leader {
+			continue
+		}
+		jobs = append(jobs, &workflowJob{
+			scheduleID: schedule.ID,
+			enqueuedAt: time.Now(),
+			run: &workflowRun{
+				WorkflowID: schedule.WorkflowID,
+				UserID:     schedule.UserID,
+				Priority:   schedule.Priority,
+				Message:    schedule.Message,
+				Data:       schedule.Data,
+			},
+		})
+	}
+	return jobs
+}
+
+// recordRun stores the outcome of a scheduled run
+func (s *scheduleStore) recordRun(id string, at time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return
+	}
+	schedule.LastRunAt = &at
+	schedule.RunCount++
+	schedule.LastStatus = runStatusSucceeded
+	if err != nil {
+		schedule.LastStatus = runStatusFailed
+	}
+}
+
+// markDropped records a run that couldn't be queued
+func (s *scheduleStore) markDropped(id string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if schedule, ok := s.schedules[id]; ok {
+		schedule.LastRunAt = &at
+		schedule.LastStatus = runStatusDropped
+	}
+}
+
+// loadSchedules registers the schedules configured in "workflow_id=cron;..."
+func loadSchedules(ctx context.Context, spec string) {
+	for _, entry := range strings.Split(spec, ";") {
+		workflowID, expr, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found {
+			continue
+		}
+		schedule, err := schedules.add(Schedule{
+			WorkflowID: strings.TrimSpace(workflowID),
+			Cron:       strings.TrimSpace(expr),
+		})
+		if err != nil {
+			logger.Error(ctx, "Ignoring invalid workflow schedule", err, map[string]interface{}{
+				"workflow_id": workflowID,
+			})
+			continue
+		}
+		logger.Info(ctx, "Workflow schedule registered", map[string]interface{}{
+			"schedule_id": schedule.ID,
+			"workflow_id": schedule.WorkflowID,
+			"cron":        schedule.Cron,
+		})
+	}
+}
+
+// runScheduler enqueues due scheduled runs until ctx is cancelled
+func runScheduler(ctx context.Context) {
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C():
+			for _, job := range schedules.due(now.UTC(), schedulerLeader.IsLeader()) {
+				if !enqueueWorkflow(job) {
+					schedules.markDropped(job.scheduleID, now.UTC())
+					logger.Warn(ctx, "Workflow queue full, dropping scheduled run", map[string]interface{}{
+						"schedule_id": job.scheduleID,
+						"workflow_id": job.run.WorkflowID,
+					})
+				}
+			}
+		}
+	}
+}
+
+// scheduleResponse answers a created, paused or resumed schedule
+type scheduleResponse struct {
+	OK       bool     `json:"ok"`
+	Schedule Schedule `json:"schedule"`
+}
+
+// scheduleList is the body of GET /api/process/schedules
+type scheduleList struct {
+	OK         bool       `json:"ok"`
+	Leader     bool       `json:"leader"`
+	Schedules  []Schedule `json:"schedules"`
+	TotalCount int        `json:"total_count"`
+}
+
+// Create schedule endpoint
+func createScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req Schedule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error(ctx, "Failed to parse schedule request", err)
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.WorkflowID == "" {
+		writeError(w, http.StatusUnprocessableEntity, "workflow_id is required")
+		return
+	}
+
+	schedule, err := schedules.add(Schedule{
+		WorkflowID: req.WorkflowID,
+		Cron:       req.Cron,
+		UserID:     req.UserID,
+		Priority:   req.Priority,
+		Message:    req.Message,
+		Data:       req.Data,
+		Paused:     req.Paused,
+	})
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	logger.Info(ctx, "Workflow schedule registered", map[string]interface{}{
+		"schedule_id": schedule.ID,
+		"workflow_id": schedule.WorkflowID,
+		"cron":        schedule.Cron,
+	})
+
+	writeJSON(w, http.StatusCreated, scheduleResponse{
+		OK:       true,
+		Schedule: schedule,
+	})
+}
+
+// List schedules endpoint
+func listSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	result := schedules.list()
+
+	writeJSON(w, http.StatusOK, scheduleList{
+		OK:         true,
+		Leader:     schedulerLeader.IsLeader(),
+		Schedules:  result,
+		TotalCount: len(result),
+	})
+}
+
+// Pause and resume schedule endpoints
+func pauseScheduleHandler(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id := mux.Vars(r)["id"]
+
+		schedule, ok := schedules.setPaused(id, paused)
+		if !ok {
+			writeError(w, http.StatusNotFound, "Schedule not found")
+			return
+		}
+
+		logger.Info(ctx, "Workflow schedule updated", map[string]interface{}{
+			"schedule_id": id,
+			"paused":      paused,
+		})
+
+		writeJSON(w, http.StatusOK, scheduleResponse{
+			OK:       true,
+			Schedule: schedule,
+		})
+	}
+}
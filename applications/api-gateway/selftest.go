@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Startup self-test
+//
+// `api-gateway --selftest` checks the wiring and exits instead of serving
+// traffic: the configuration (no setting fell back to its default because it
+// was invalid), the user and notification services (GET /healthz answers
+// 200; the user service is skipped with USER_SERVICE_MODE=memory) and
+// telemetry (a test log line, span and metric reach Alloy). Each check is
+// logged; the exit code is 1 if any failed, so the same image can run it as
+// an init container.
+
+var selfTestMode = flag.Bool("selftest", false, "check configuration, dependencies and telemetry, then exit")
+
+// selfTestCheck is one check of the self-test
+type selfTestCheck struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// runSelfTest runs the checks in order and returns the exit code
+func runSelfTest(checks []selfTestCheck) int {
+	ctx := context.Background()
+	failed := 0
+	for _, check := range checks {
+		start := time.Now()
+		err := check.run(ctx)
+		fields := map[string]interface{}{
+			"check":       check.name,
+			"duration_ms": time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			failed++
+			logger.Error(ctx, "Self-test check failed", err, fields)
+		} else {
+			logger.Info(ctx, "Self-test check passed", fields)
+		}
+	}
+
+	logger.Info(ctx, "Self-test finished", map[string]interface{}{
+		"checks": len(checks),
+		"failed": failed,
+	})
+	logger.Shutdown(ctx)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// gatewaySelfTestChecks are the checks of the gateway
+func gatewaySelfTestChecks() []selfTestCheck {
+	checks := []selfTestCheck{{name: "config", run: checkConfig}}
+	// The in-memory store doesn't need the user service
+	if userServiceMode != userServiceMemory {
+		checks = append(checks, selfTestCheck{name: "user-service", run: func(ctx context.Context) error { return checkHealth(ctx, userServiceURL) }})
+	}
+	return append(checks,
+		selfTestCheck{name: "notification-service", run: func(ctx context.Context) error { return checkHealth(ctx, notificationServiceURL) }},
+		selfTestCheck{name: "telemetry", run: logger.SelfTest},
+	)
+}
+
+// checkConfig fails if settings were invalid or upstream URLs are unusable
+func checkConfig(ctx context.Context) error {
+	var errs []error
+	for _, warning := range config.Warnings() {
+		errs = append(errs, errors.New(warning))
+	}
+	for _, setting := range [][2]string{{"USER_SERVICE_URL", userServiceURL}, {"NOTIFICATION_SERVICE_URL", notificationServiceURL}} {
+		if parsed, err := url.Parse(setting[1]); err != nil || parsed.Host == "" || !strings.HasPrefix(parsed.Scheme, "http") {
+			errs = append(errs, fmt.Errorf("%s %q is not an http(s) URL", setting[0], setting[1]))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkHealth fails unless the service at baseURL answers its health check
+func checkHealth(ctx context.Context, baseURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(baseURL, "/")+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned status %d", req.URL, resp.StatusCode)
+	}
+	return nil
+}
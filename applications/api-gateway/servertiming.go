@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server-Timing
+//
+// Responses carry a Server-Timing header with the time the gateway spent in
+// each phase of the request, so browser devtools and curl -v show where the
+// latency went:
+//
+//	auth                  checking admin credentials
+//	user-service          calls to the user service, until the response headers
+//	notification-service  calls to the notification service, likewise
+//	serialization         encoding the JSON response
+//	total                 the whole request, up to the response headers
+//
+// Phases that didn't happen are left out and repeated calls add up. Debug
+// requests (debug.go) add their span timings in another Server-Timing header.
+// SERVER_TIMING=false turns the header off.
+
+const (
+	phaseAuth                = "auth"
+	phaseUserService         = "user-service"
+	phaseNotificationService = "notification-service"
+	phaseSerialization       = "serialization"
+)
+
+var serverTimingEnabled bool
+
+func init() {
+	serverTimingEnabled = getEnvString("SERVER_TIMING", "true") == "true"
+}
+
+type serverTimingKey struct{}
+
+// phaseTimings adds up the time one request spent in each phase
+type phaseTimings struct {
+	mu        sync.Mutex
+	names     []string
+	durations map[string]time.Duration
+}
+
+func (p *phaseTimings) add(phase string, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, seen := p.durations[phase]; !seen {
+		p.names = append(p.names, phase)
+	}
+	p.durations[phase] += d
+}
+
+// header formats the phases, in the order they first happened, and the total
+func (p *phaseTimings) header(total time.Duration) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entries := make([]string, 0, len(p.names)+1)
+	for _, phase := range p.names {
+		entries = append(entries, fmt.Sprintf("%s;dur=%.1f", phase, milliseconds(p.durations[phase])))
+	}
+	entries = append(entries, fmt.Sprintf("total;dur=%.1f", milliseconds(total)))
+	return strings.Join(entries, ", ")
+}
+
+// recordPhase adds time spent in a phase to the current request's timings
+func recordPhase(ctx context.Context, phase string, d time.Duration) {
+	if timings, ok := ctx.Value(serverTimingKey{}).(*phaseTimings); ok {
+		timings.add(phase, d)
+	}
+}
+
+// timingWriter adds the Server-Timing header when the response headers go out
+type timingWriter struct {
+	http.ResponseWriter
+	timings     *phaseTimings
+	start       time.Time
+	wroteHeader bool
+}
+
+func (tw *timingWriter) WriteHeader(status int) {
+	if !tw.wroteHeader {
+		tw.wroteHeader = true
+		tw.Header().Add("Server-Timing", tw.timings.header(time.Since(tw.start)))
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *timingWriter) Write(data []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(data)
+}
+
+func (tw *timingWriter) Flush() {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := tw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (tw *timingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := tw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+func (tw *timingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// phaseRecorder finds the timings of the request a response writer belongs to
+func phaseRecorder(w http.ResponseWriter) *phaseTimings {
+	for {
+		switch writer := w.(type) {
+		case *timingWriter:
+			return writer.timings
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = writer.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// serverTimingMiddleware times the phases of every request
+func serverTimingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !serverTimingEnabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		timings := &phaseTimings{durations: make(map[string]time.Duration)}
+		tw := &timingWriter{ResponseWriter: w, timings: timings, start: time.Now()}
+		next.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), serverTimingKey{}, timings)))
+	})
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// phaseTransport times the calls made through it as one phase of the
+// calling request
+type phaseTransport struct {
+	base  http.RoundTripper
+	phase string
+}
+
+// withPhaseTiming wraps a transport so its calls show up in Server-Timing
+func withPhaseTiming(phase string, base http.RoundTripper) http.RoundTripper {
+	if !serverTimingEnabled {
+		return base
+	}
+	return &phaseTransport{base: base, phase: phase}
+}
+
+func (t *phaseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	recordPhase(req.Context(), t.phase, time.Since(start))
+	return resp, err
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Request signing for east-west traffic
+//
+// When INTERNAL_SIGNING_SECRET is set, every call the gateway makes to an
+// internal service carries an X-Signature header of the form
+// "t=<unix seconds>,v1=<hex hmac-sha256>". The HMAC covers the timestamp and
+// the raw request body, so the receiver can reject unsigned, tampered or
+// replayed requests without a service mesh.
+//
+// With INTERNAL_SIGNING_KEY_ID set the header names the key as well,
+// "t=<unix seconds>,kid=<key ID>,v1=<hex hmac-sha256>", so receivers holding
+// several keys during a rotation know which one to check.
+
+const signatureHeader = "X-Signature"
+
+var (
+	signingSecret []byte
+	signingKeyID  string
+)
+
+func init() {
+	signingSecret = []byte(getEnvString("INTERNAL_SIGNING_SECRET", ""))
+	signingKeyID = getEnvString("INTERNAL_SIGNING_KEY_ID", "")
+}
+
+// signRequest adds the X-Signature header to an outgoing internal request.
+// It is a no-op when signing is not configured.
+func signRequest(req *http.Request, body []byte) {
+	if len(signingSecret) == 0 {
+		return
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	header := "t=" + timestamp
+	if signingKeyID != "" {
+		header += ",kid=" + signingKeyID
+	}
+	req.Header.Set(signatureHeader, header+",v1="+computeSignature(signingSecret, timestamp, body))
+}
+
+// computeSignature returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>"
+func computeSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
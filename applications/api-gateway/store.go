@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Keyed blob store
+//
+// State that has to be shared by the gateway replicas, such as the responses
+// kept for Idempotency-Key replays (idempotency.go), lives in a blobStore:
+// byte values by key, each with its own TTL, plus counters for quotas.
+// STORE_BACKEND picks the implementation:
+//
+//	memory  a map in the process (default); every replica keeps its own
+//	redis   the Redis server at REDIS_URL (redis://[:password@]host:6379/0),
+//	        shared by every replica
+//
+// Each feature gets its own namespace, prefixed to its keys as
+// "api-gateway:<namespace>:", so features can't read each other's keys.
+// Redis calls time out after STORE_TIMEOUT_MS. Operations are counted in
+// store_operations_total by namespace, operation and outcome (hit, miss,
+// stored, exists, deleted or error) and timed in
+// store_operation_duration_seconds. Callers treat a store error as a missing value, so an unreachable Redis
+// turns features off rather than failing requests.
+
+const (
+	storeBackendMemory = "memory"
+	storeBackendRedis  = "redis"
+
+	storeKeyPrefix = "api-gateway:"
+)
+
+// blobStore keeps values by key, each for its own TTL
+type blobStore interface {
+	// Get returns the value of a key, and false if it is missing or expired
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores a value for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// SetNX stores a value for ttl unless the key exists, reporting whether
+	// it did
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// Incr adds delta to the counter at key, created with ttl, and returns
+	// the new value
+	Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// Delete removes a key
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	storeTimeout = time.Duration(getEnvInt("STORE_TIMEOUT_MS", 200)) * time.Millisecond
+	redisClient  *redis.Client
+	// storeBackend is shared by the namespaces of newBlobStore. It is set up
+	// before the init functions, which create the namespaces.
+	storeBackendName, storeBackend = configuredStore()
+)
+
+// configuredStore returns the backend selected by STORE_BACKEND and its name
+func configuredStore() (string, blobStore) {
+	name := getEnvString("STORE_BACKEND", storeBackendMemory)
+	switch name {
+	case storeBackendRedis:
+		options, err := redis.ParseURL(getEnvString("REDIS_URL", "redis://localhost:6379/0"))
+		if err != nil {
+			configWarning("Invalid REDIS_URL, using the memory store: %v", err)
+			break
+		}
+		redisClient = redis.NewClient(options)
+		return storeBackendRedis, &redisStore{client: redisClient}
+	case storeBackendMemory:
+	default:
+		configWarning("Invalid STORE_BACKEND %q, expected memory or redis; using memory", name)
+	}
+	return storeBackendMemory, newMemoryStore()
+}
+
+// newBlobStore returns the store of a feature's namespace
+func newBlobStore(namespace string) blobStore {
+	return &instrumentedStore{
+		next:      storeBackend,
+		namespace: namespace,
+		prefix:    storeKeyPrefix + namespace + ":",
+	}
+}
+
+// closeStore closes the connection to Redis, if any
+func closeStore() error {
+	if redisClient == nil {
+		return nil
+	}
+	return redisClient.Close()
+}
+
+// memoryStore keeps the values in the process
+type memoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// memorySweepInterval is how often writes drop the expired entries
+const memorySweepInterval = time.Minute
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[string]memoryEntry), lastSweep: time.Now()}
+}
+
+// get returns a live entry; the caller holds the lock
+func (s *memoryStore) get(key string, now time.Time) (memoryEntry, bool) {
+	entry, ok := s.entries[key]
+	if ok && !now.Before(entry.expires) {
+		delete(s.entries, key)
+		return memoryEntry{}, false
+	}
+	return entry, ok
+}
+
+// put stores an entry, sweeping expired ones now and then; the caller holds
+// the lock
+func (s *memoryStore) put(key string, value []byte, ttl time.Duration, now time.Time) {
+	if now.Sub(s.lastSweep) >= memorySweepInterval {
+		for k, entry := range s.entries {
+			if !now.Before(entry.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.entries[key] = memoryEntry{value: append([]byte(nil), value...), expires: now.Add(ttl)}
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.get(key, time.Now())
+	if !ok {
+		return nil, false, nil
+	}
+	return append([]byte(nil), entry.value...), true, nil
+}
+
+func (s *memoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.put(key, value, ttl, time.Now())
+	return nil
+}
+
+func (s *memoryStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := s.get(key, now); ok {
+		return false, nil
+	}
+	s.put(key, value, ttl, now)
+	return true, nil
+}
+
+func (s *memoryStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := s.get(key, now)
+	if !ok {
+		s.put(key, []byte(strconv.FormatInt(delta, 10)), ttl, now)
+		return delta, nil
+	}
+	current, err := strconv.ParseInt(string(entry.value), 10, 64)
+	if err != nil {
+		return 0, errors.New("value is not a counter")
+	}
+	// Keep the expiry of the first increment, as Redis does
+	entry.value = []byte(strconv.FormatInt(current+delta, 10))
+	s.entries[key] = entry
+	return current + delta, nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// redisStore keeps the values in Redis
+type redisStore struct {
+	client *redis.Client
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (s *redisStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (s *redisStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	value, err := s.client.IncrBy(ctx, key, delta).Result()
+	if err != nil {
+		return 0, err
+	}
+	// The first increment created the key
+	if value == delta {
+		if err := s.client.Expire(ctx, key, ttl).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return value, nil
+}
+
+func (s *redisStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, key).Err()
+}
+
+// instrumentedStore prefixes a namespace's keys, bounds each call with
+// STORE_TIMEOUT_MS and records its metrics
+type instrumentedStore struct {
+	next      blobStore
+	namespace string
+	prefix    string
+}
+
+// observe records an operation that started at start
+func (s *instrumentedStore) observe(ctx context.Context, operation, outcome string, start time.Time) {
+	recordStoreOperation(ctx, s.namespace, operation, outcome, time.Since(start))
+}
+
+func (s *instrumentedStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	value, ok, err := s.next.Get(ctx, s.prefix+key)
+	outcome := "hit"
+	switch {
+	case err != nil:
+		outcome = "error"
+	case !ok:
+		outcome = "miss"
+	}
+	s.observe(ctx, "get", outcome, start)
+	return value, ok, err
+}
+
+func (s *instrumentedStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := s.next.Set(ctx, s.prefix+key, value, ttl)
+	outcome := "stored"
+	if err != nil {
+		outcome = "error"
+	}
+	s.observe(ctx, "set", outcome, start)
+	return err
+}
+
+func (s *instrumentedStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	stored, err := s.next.SetNX(ctx, s.prefix+key, value, ttl)
+	outcome := "stored"
+	switch {
+	case err != nil:
+		outcome = "error"
+	case !stored:
+		outcome = "exists"
+	}
+	s.observe(ctx, "setnx", outcome, start)
+	return stored, err
+}
+
+func (s *instrumentedStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	value, err := s.next.Incr(ctx, s.prefix+key, delta, ttl)
+	outcome := "stored"
+	if err != nil {
+		outcome = "error"
+	}
+	s.observe(ctx, "incr", outcome, start)
+	return value, err
+}
+
+func (s *instrumentedStore) Delete(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := s.next.Delete(ctx, s.prefix+key)
+	outcome := "deleted"
+	if err != nil {
+		outcome = "error"
+	}
+	s.observe(ctx, "delete", outcome, start)
+	return err
+}
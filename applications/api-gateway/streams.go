@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	service "github.com/faidon-laboratory/go-service"
+)
+
+// Streaming endpoints
+//
+// Server-sent event endpoints register every open connection with a
+// streamHub instead of running their own goroutines per client. A broadcast
+// encodes the event once and queues it on each connection's buffer of
+// STREAM_BUFFER_SIZE events; the connection's handler writes and flushes
+// from there. A client whose buffer is full is too slow to keep up and is
+// evicted (after a final "close" event when there is room for it) rather
+// than holding up the others. Idle connections get a comment line every
+// STREAM_HEARTBEAT_SEC seconds so proxies don't time them out, and a hub
+// refuses more than STREAM_MAX_CONNECTIONS connections with 503.
+//
+// On shutdown every connection gets a "close" event and is ended before the
+// server waits for open requests, so streams don't hold up the deploy.
+// Connections are counted in the stream_connections gauge and their ends in
+// stream_disconnects_total by reason (client_closed, slow_client or
+// shutdown). An open stream holds one of its client's CLIENT_MAX_CONCURRENT
+// slots. GET /admin/streams lists the open connections.
+
+const (
+	streamCloseSlowClient   = "slow_client"
+	streamCloseShutdown     = "shutdown"
+	streamCloseClientClosed = "client_closed"
+)
+
+var (
+	streamBufferSize     int
+	streamHeartbeat      time.Duration
+	streamMaxConnections int
+
+	// streamHubs are the hubs of every streaming endpoint
+	streamHubs   []*streamHub
+	streamHubsMu sync.Mutex
+
+	workflowEvents *streamHub
+)
+
+func init() {
+	streamBufferSize = max(getEnvInt("STREAM_BUFFER_SIZE", 64), 1)
+	streamHeartbeat = time.Duration(max(getEnvInt("STREAM_HEARTBEAT_SEC", 15), 1)) * time.Second
+	streamMaxConnections = getEnvInt("STREAM_MAX_CONNECTIONS", 1000)
+
+	workflowEvents = newStreamHub("workflow_events")
+}
+
+// streamHub is the connection registry of one streaming endpoint
+type streamHub struct {
+	name string
+
+	mu      sync.Mutex
+	conns   map[*streamConn]struct{}
+	closed  bool
+	nextID  uint64
+	eventID uint64
+}
+
+// streamConn is one open stream
+type streamConn struct {
+	id          uint64
+	client      string
+	filter      string
+	connectedAt time.Time
+	sent        atomic.Int64
+
+	send chan []byte
+	// done is closed when the hub ends the connection, reason says why
+	done   chan struct{}
+	reason string
+}
+
+// streamConnInfo is a connection as listed by /admin/streams
+type streamConnInfo struct {
+	ID          uint64    `json:"id"`
+	Client      string    `json:"client"`
+	Filter      string    `json:"filter,omitempty"`
+	ConnectedAt time.Time `json:"connected_at"`
+	Buffered    int       `json:"buffered"`
+	Sent        int64     `json:"sent"`
+}
+
+// newStreamHub creates and registers the hub of a streaming endpoint
+func newStreamHub(name string) *streamHub {
+	hub := &streamHub{name: name, conns: make(map[*streamConn]struct{})}
+	streamHubsMu.Lock()
+	streamHubs = append(streamHubs, hub)
+	streamHubsMu.Unlock()
+	return hub
+}
+
+// register adds a connection, returning false when the hub is full or closed
+func (h *streamHub) register(client, filter string) (*streamConn, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed || (streamMaxConnections > 0 && len(h.conns) >= streamMaxConnections) {
+		return nil, false
+	}
+	h.nextID++
+	conn := &streamConn{
+		id:          h.nextID,
+		client:      client,
+		filter:      filter,
+		connectedAt: time.Now().UTC(),
+		send:        make(chan []byte, streamBufferSize),
+		done:        make(chan struct{}),
+	}
+	h.conns[conn] = struct{}{}
+	recordStreamConnections(context.Background(), h.name, 1)
+	return conn, true
+}
+
+// unregister removes a connection the client closed
+func (h *streamHub) unregister(conn *streamConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.conns[conn]; ok {
+		h.drop(conn, streamCloseClientClosed)
+	}
+}
+
+// drop ends a connection; h.mu must be held
+func (h *streamHub) drop(conn *streamConn, reason string) {
+	delete(h.conns, conn)
+	conn.reason = reason
+	close(conn.done)
+	recordStreamConnections(context.Background(), h.name, -1)
+	recordStreamDisconnect(context.Background(), h.name, reason)
+}
+
+// broadcast sends an event to every connection whose filter is empty or
+// equal to key, evicting the connections that can't take it
+func (h *streamHub) broadcast(event, key string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		logger.Warn(context.Background(), "Failed to encode stream event", map[string]interface{}{
+			"stream": h.name,
+			"event":  event,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.eventID++
+	frame := []byte(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", h.eventID, event, payload))
+	for conn := range h.conns {
+		if conn.filter != "" && conn.filter != key {
+			continue
+		}
+		select {
+		case conn.send <- frame:
+		default:
+			logger.Warn(context.Background(), "Evicting slow stream client", map[string]interface{}{
+				"stream":        h.name,
+				"connection_id": conn.id,
+				"client":        conn.client,
+				"buffered":      len(conn.send),
+			})
+			h.drop(conn, streamCloseSlowClient)
+		}
+	}
+}
+
+// close ends every connection and refuses new ones
+func (h *streamHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for conn := range h.conns {
+		h.drop(conn, streamCloseShutdown)
+	}
+}
+
+// connections lists the open connections by ID
+func (h *streamHub) connections() []streamConnInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	infos := make([]streamConnInfo, 0, len(h.conns))
+	for conn := range h.conns {
+		infos = append(infos, streamConnInfo{
+			ID:          conn.id,
+			Client:      conn.client,
+			Filter:      conn.filter,
+			ConnectedAt: conn.connectedAt,
+			Buffered:    len(conn.send),
+			Sent:        conn.sent.Load(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// serve streams the hub's events to one client until either side closes
+func (h *streamHub) serve(w http.ResponseWriter, r *http.Request, filter string) {
+	ctx := r.Context()
+
+	conn, ok := h.register(clientKey(r), filter)
+	if !ok {
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusServiceUnavailable, "Stream is not accepting connections")
+		return
+	}
+	defer h.unregister(conn)
+	logger.AddSpanAttribute(ctx, "stream.connection_id", strconv.FormatUint(conn.id, 10))
+
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		logger.Warn(ctx, "Response writer does not support streaming", map[string]interface{}{
+			"stream": h.name,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var frame []byte
+		select {
+		case frame = <-conn.send:
+			conn.sent.Add(1)
+		case <-heartbeat.C:
+			frame = []byte(": ping\n\n")
+		case <-conn.done:
+			// Events queued before the eviction or shutdown are lost; tell
+			// the client why the stream ends so it can reconnect
+			fmt.Fprintf(w, "event: close\ndata: {\"reason\":%q}\n\n", conn.reason)
+			controller.Flush()
+			return
+		case <-ctx.Done():
+			return
+		}
+		if _, err := w.Write(frame); err != nil {
+			return
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// closeStreams ends the connections of every streaming endpoint
+func closeStreams() {
+	streamHubsMu.Lock()
+	defer streamHubsMu.Unlock()
+
+	for _, hub := range streamHubs {
+		hub.close()
+	}
+}
+
+// workflowEventsHandler streams the runs recorded in the workflow history as
+// "execution" events, optionally only those of ?workflow_id=
+func workflowEventsHandler(w http.ResponseWriter, r *http.Request) {
+	workflowEvents.serve(w, r, r.URL.Query().Get("workflow_id"))
+}
+
+// streamList is the body of GET /admin/streams: the connections of every
+// streaming endpoint by name
+type streamList struct {
+	OK             bool                        `json:"ok"`
+	BufferSize     int                         `json:"buffer_size"`
+	MaxConnections int                         `json:"max_connections"`
+	Streams        map[string][]streamConnInfo `json:"streams"`
+}
+
+// adminStreamsHandler lists the open connections of every streaming endpoint
+func adminStreamsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	logger.AddSpanAttribute(ctx, "admin.identity", service.AdminIdentity(ctx))
+
+	streamHubsMu.Lock()
+	streams := make(map[string][]streamConnInfo, len(streamHubs))
+	for _, hub := range streamHubs {
+		streams[hub.name] = hub.connections()
+	}
+	streamHubsMu.Unlock()
+
+	writeJSON(w, http.StatusOK, streamList{
+		OK:             true,
+		BufferSize:     streamBufferSize,
+		MaxConnections: streamMaxConnections,
+		Streams:        streams,
+	})
+}
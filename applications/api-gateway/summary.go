@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"api-gateway/clients/userservice"
+	"api-gateway/models"
+	"api-gateway/notificationclient"
+	"github.com/gorilla/mux"
+)
+
+// User notification summary
+//
+// GET /api/users/{id}/summary fans out to the user service (profile) and the
+// notification service (recent notifications and unread count) concurrently
+// through their clients and composes a single response. Each branch gets its own child span so the
+// fan-out is visible in Tempo. If one branch fails the response is still
+// returned with the available parts, "partial": true and the per-part errors.
+// Summaries of known users are counted in sli_requests_total under
+// user_summary_complete, good only when no part is missing.
+
+// summaryCompleteSLI is the SLI of summaries returned with every part
+const summaryCompleteSLI = "user_summary_complete"
+
+// errSummaryFetchIncomplete is the error of a fetch that didn't return
+var errSummaryFetchIncomplete = errors.New("summary fetch did not complete")
+
+// Get user summary - aggregation endpoint
+func getUserSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	start := time.Now()
+	userID := mux.Vars(r)["id"]
+
+	logger.Info(ctx, "Building user summary", map[string]interface{}{
+		"user_id": userID,
+	})
+
+	// A fetch counts as failed until it returns, so one that panics leaves
+	// its part out of the summary
+	var profile *userservice.Profile
+	profileErr := errSummaryFetchIncomplete
+	var inbox *notificationclient.UserNotifications
+	inboxErr := errSummaryFetchIncomplete
+	var inboxStatus int
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// A panicking fetch fails the request's span instead of the process
+	logger.Go(ctx, func(ctx context.Context) {
+		defer wg.Done()
+		spanCtx, endSpan := logger.StartSpan(ctx, "summary_fetch_profile")
+		defer endSpan()
+		profile, profileErr = userService.GetProfile(spanCtx, userID)
+		if profileErr != nil && !errors.Is(profileErr, userservice.ErrNotFound) {
+			logger.Error(spanCtx, "Failed to fetch user profile for summary", profileErr, map[string]interface{}{
+				"user_id": userID,
+			})
+		}
+	})
+
+	logger.Go(ctx, func(ctx context.Context) {
+		defer wg.Done()
+		spanCtx, endSpan := logger.StartSpan(ctx, "summary_fetch_notifications")
+		defer endSpan()
+		limit := 5
+		resp, err := notificationService().ListUserNotifications(spanCtx, userID, &notificationclient.ListUserNotificationsParams{Limit: &limit})
+		inboxErr = nil
+		switch {
+		case err != nil:
+			inboxErr = err
+		case resp.JSON200 == nil:
+			inboxStatus = resp.StatusCode
+			inboxErr = fmt.Errorf("notification service returned status %d", resp.StatusCode)
+		default:
+			inbox = resp.JSON200
+		}
+		if inboxErr != nil {
+			logger.Error(spanCtx, "Failed to fetch notifications for summary", inboxErr, map[string]interface{}{
+				"user_id":     userID,
+				"status_code": inboxStatus,
+			})
+		}
+	})
+
+	wg.Wait()
+
+	if abortIfClientGone(ctx) {
+		return
+	}
+
+	// An unknown user is a 404 regardless of the notification side
+	if errors.Is(profileErr, userservice.ErrNotFound) {
+		writeProxyError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if profileErr != nil && inboxErr != nil {
+		logger.CountSLI(ctx, summaryCompleteSLI, false)
+		writeProxyError(w, http.StatusBadGateway, "User and notification services unavailable")
+		return
+	}
+
+	summary := models.UserSummary{
+		UserID:      userID,
+		Partial:     profileErr != nil || inboxErr != nil,
+		GeneratedAt: responseTime(time.Now()),
+	}
+	partErrors := map[string]string{}
+
+	if profileErr == nil {
+		summary.Profile = profile
+	} else {
+		partErrors["profile"] = "User service unavailable"
+	}
+
+	if inboxErr == nil {
+		summary.RecentNotifications = inbox.Notifications
+		summary.UnreadCount = &inbox.UnreadCount
+	} else {
+		partErrors["notifications"] = "Notification service unavailable"
+	}
+
+	if len(partErrors) > 0 {
+		summary.Errors = partErrors
+		logger.Warn(ctx, "Returning partial user summary", map[string]interface{}{
+			"user_id":      userID,
+			"failed_parts": len(partErrors),
+		})
+	}
+
+	logger.CountSLI(ctx, summaryCompleteSLI, !summary.Partial)
+	writeJSON(w, http.StatusOK, summary)
+
+	logger.Info(ctx, "User summary built", map[string]interface{}{
+		"user_id":     userID,
+		"partial":     summary.Partial,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+}
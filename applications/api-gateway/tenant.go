@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/faidon-laboratory/go-logging"
+)
+
+// Tenant propagation
+//
+// Clients identify their tenant with the X-Tenant-ID header. The gateway keeps
+// it in the request context, as the tenant field of the request's log lines,
+// and forwards it on internal calls so downstream services (e.g.
+// notification-service's per-tenant providers) can act on it.
+
+const tenantHeader = "X-Tenant-ID"
+
+type tenantContextKey struct{}
+
+// tenantMiddleware stores the incoming tenant ID in the request context
+func tenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tenantID := r.Header.Get(tenantHeader); tenantID != "" {
+			ctx := context.WithValue(r.Context(), tenantContextKey{}, tenantID)
+			// Every line logged for the request names its tenant
+			ctx = logging.ContextWithFields(ctx, map[string]interface{}{"tenant": tenantID})
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tenantFromContext returns the tenant ID of the current request, if any
+func tenantFromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenantID
+}
+
+// propagateTenant forwards the tenant ID of the current request to an internal call
+func propagateTenant(ctx context.Context, req *http.Request) {
+	if tenantID := tenantFromContext(ctx); tenantID != "" {
+		req.Header.Set(tenantHeader, tenantID)
+	}
+}
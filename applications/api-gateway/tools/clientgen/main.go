@@ -0,0 +1,457 @@
+// Command clientgen generates a Go client from an OpenAPI 3 document.
+//
+// It covers what the lab's services use: object schemas under
+// components/schemas, operations with an operationId, path and query
+// parameters, JSON request bodies and the JSON bodies of the 200 and 201
+// responses.
+// Everything else in the document is ignored.
+//
+//	go run ./tools/clientgen -spec ../notification-service/openapi.json -package notificationclient -out notificationclient/client.gen.go
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type document struct {
+	Info struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	} `json:"info"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string      `json:"operationId"`
+	Summary     string      `json:"summary"`
+	Parameters  []parameter `json:"parameters"`
+	RequestBody *struct {
+		Content map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required"`
+	Description string  `json:"description"`
+	Schema      *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Description          string             `json:"description"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*schema `json:"properties"`
+	Items                *schema            `json:"items"`
+	AdditionalProperties *schema            `json:"additionalProperties"`
+}
+
+// imports are the packages the generated code may use
+var imports = []string{"bytes", "context", "encoding/json", "fmt", "io", "net/http", "net/url", "strconv", "strings", "time"}
+
+// httpMethods are the operation keys of a path item, in output order
+var httpMethods = []string{"get", "put", "post", "patch", "delete"}
+
+// successStatuses are the responses whose JSON body is decoded
+var successStatuses = []string{"200", "201"}
+
+// statusConstants name the success statuses in the generated code
+var statusConstants = map[string]string{"200": "http.StatusOK", "201": "http.StatusCreated"}
+
+// initialisms are written in upper case in Go names
+var initialisms = map[string]bool{"id": true, "ok": true, "url": true, "http": true, "api": true, "json": true, "uri": true}
+
+func main() {
+	specPath := flag.String("spec", "", "OpenAPI document (JSON)")
+	pkg := flag.String("package", "", "package name of the generated file")
+	out := flag.String("out", "", "output file")
+	flag.Parse()
+	if *specPath == "" || *pkg == "" || *out == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(*specPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		log.Fatalf("parsing %s: %v", *specPath, err)
+	}
+
+	g := &generator{doc: &doc}
+	g.types()
+	g.printf("%s", clientCode)
+	g.operations()
+	code := g.buf.String()
+
+	var file bytes.Buffer
+	sum := sha256.Sum256(data)
+	fmt.Fprintf(&file, "// Code generated by clientgen from %s; DO NOT EDIT.\n", filepath.Base(*specPath))
+	fmt.Fprintf(&file, "// %s %s, sha256 %s\n\n", doc.Info.Title, doc.Info.Version, hex.EncodeToString(sum[:8]))
+	fmt.Fprintf(&file, "package %s\n\nimport (\n", *pkg)
+	for _, imp := range imports {
+		if strings.Contains(code, imp[strings.LastIndex(imp, "/")+1:]+".") {
+			fmt.Fprintf(&file, "%q\n", imp)
+		}
+	}
+	fmt.Fprintf(&file, ")\n\n%s", code)
+
+	src, err := format.Source(file.Bytes())
+	if err != nil {
+		log.Fatalf("formatting generated code: %v", err)
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type generator struct {
+	doc *document
+	buf bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// types writes a struct per component schema
+func (g *generator) types() {
+	for _, name := range sortedKeys(g.doc.Components.Schemas) {
+		s := g.doc.Components.Schemas[name]
+		if s.Type != "object" {
+			log.Fatalf("schema %s: only object schemas are supported", name)
+		}
+		if s.Description != "" {
+			g.printf("// %s %s\n", name, lowerFirst(s.Description))
+		} else {
+			g.printf("// %s is the %s schema\n", name, name)
+		}
+		g.printf("type %s struct {\n", name)
+		for _, field := range sortedKeys(s.Properties) {
+			property := s.Properties[field]
+			required := contains(s.Required, field)
+			if property.Description != "" {
+				g.printf("// %s\n", property.Description)
+			}
+			tag := field
+			if !required {
+				tag += ",omitempty"
+			}
+			g.printf("%s %s `json:%q`\n", goName(field), g.goType(property, required), tag)
+		}
+		g.printf("}\n\n")
+	}
+}
+
+// goType returns the Go type of a schema. Optional times and objects are
+// pointers so they can be left out.
+func (g *generator) goType(s *schema, required bool) string {
+	pointer := ""
+	if !required {
+		pointer = "*"
+	}
+	if s.Ref != "" {
+		return pointer + refName(s.Ref)
+	}
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			return pointer + "time.Time"
+		}
+		return "string"
+	case "integer":
+		if s.Format == "int64" {
+			return "int64"
+		}
+		return "int"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		if s.Items == nil {
+			return "[]interface{}"
+		}
+		return "[]" + g.goType(s.Items, true)
+	case "object":
+		if s.AdditionalProperties != nil {
+			return "map[string]" + g.goType(s.AdditionalProperties, true)
+		}
+		return "map[string]interface{}"
+	}
+	return "interface{}"
+}
+
+// operations writes a response type and a method per operation
+func (g *generator) operations() {
+	for _, path := range sortedKeys(g.doc.Paths) {
+		for _, method := range httpMethods {
+			op, ok := g.doc.Paths[path][method]
+			if !ok || op.OperationID == "" {
+				continue
+			}
+			g.operation(path, strings.ToUpper(method), op)
+		}
+	}
+}
+
+func (g *generator) operation(path, method string, op *operation) {
+	name := upperFirst(op.OperationID)
+
+	var pathParams, queryParams []parameter
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			pathParams = append(pathParams, p)
+		case "query":
+			queryParams = append(queryParams, p)
+		}
+	}
+
+	var bodyType string
+	if op.RequestBody != nil {
+		if content, ok := op.RequestBody.Content["application/json"]; ok {
+			bodyType = g.goType(content.Schema, true)
+		}
+	}
+	resultTypes := make(map[string]string)
+	for _, status := range successStatuses {
+		if content, ok := op.Responses[status].Content["application/json"]; ok {
+			resultTypes[status] = g.goType(content.Schema, true)
+		}
+	}
+
+	if len(queryParams) > 0 {
+		g.printf("// %sParams are the query parameters of %s\n", name, name)
+		g.printf("type %sParams struct {\n", name)
+		for _, p := range queryParams {
+			if p.Description != "" {
+				g.printf("// %s\n", p.Description)
+			}
+			g.printf("%s *%s\n", goName(p.Name), g.goType(p.Schema, true))
+		}
+		g.printf("}\n\n")
+	}
+
+	g.printf("// %sResponse is the response of %s\n", name, name)
+	g.printf("type %sResponse struct {\nStatusCode int\nHeader http.Header\nBody []byte\n", name)
+	for _, status := range successStatuses {
+		if resultType, ok := resultTypes[status]; ok {
+			g.printf("// JSON%s is the decoded body of a %s response\nJSON%s *%s\n", status, status, status, resultType)
+		}
+	}
+	g.printf("}\n\n")
+
+	args := []string{"ctx context.Context"}
+	for _, p := range pathParams {
+		args = append(args, lowerFirst(goName(p.Name))+" string")
+	}
+	if len(queryParams) > 0 {
+		args = append(args, "params *"+name+"Params")
+	}
+	if bodyType != "" {
+		args = append(args, "body "+bodyType)
+	}
+
+	g.printf("// %s calls %s %s", name, method, path)
+	if op.Summary != "" {
+		g.printf(": %s", lowerFirst(strings.TrimSuffix(op.Summary, ".")))
+	}
+	g.printf("\n")
+	g.printf("func (c *Client) %s(%s) (*%sResponse, error) {\n", name, strings.Join(args, ", "), name)
+
+	target := fmt.Sprintf("%q", path)
+	for _, p := range pathParams {
+		target = fmt.Sprintf("strings.Replace(%s, %q, url.PathEscape(%s), 1)", target, "{"+p.Name+"}", lowerFirst(goName(p.Name)))
+	}
+	g.printf("path := %s\n", target)
+
+	if len(queryParams) > 0 {
+		g.printf("query := url.Values{}\nif params != nil {\n")
+		for _, p := range queryParams {
+			field := "params." + goName(p.Name)
+			g.printf("if %s != nil {\nquery.Set(%q, %s)\n}\n", field, p.Name, formatValue(g.goType(p.Schema, true), "*"+field))
+		}
+		g.printf("}\n")
+	} else {
+		g.printf("var query url.Values\n")
+	}
+
+	bodyArg := "nil"
+	if bodyType != "" {
+		bodyArg = "body"
+	}
+	g.printf("resp, data, err := c.do(ctx, %q, path, query, %s)\nif err != nil {\nreturn nil, err\n}\n", method, bodyArg)
+	g.printf("result := &%sResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: data}\n", name)
+	for _, status := range successStatuses {
+		resultType, ok := resultTypes[status]
+		if !ok {
+			continue
+		}
+		g.printf("if resp.StatusCode == %s && isJSON(resp.Header) {\n", statusConstants[status])
+		g.printf("var decoded %s\nif err := json.Unmarshal(data, &decoded); err != nil {\nreturn result, fmt.Errorf(\"decoding %s response: %%w\", err)\n}\n", resultType, op.OperationID)
+		g.printf("result.JSON%s = &decoded\n}\n", status)
+	}
+	g.printf("return result, nil\n}\n\n")
+}
+
+// formatValue converts a query parameter value to a string
+func formatValue(goType, expr string) string {
+	switch goType {
+	case "string":
+		return expr
+	case "int":
+		return "strconv.Itoa(" + expr + ")"
+	case "int64":
+		return "strconv.FormatInt(" + expr + ", 10)"
+	case "bool":
+		return "strconv.FormatBool(" + expr + ")"
+	}
+	return "fmt.Sprint(" + expr + ")"
+}
+
+// goName turns a snake_case JSON name into an exported Go name
+func goName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' }) {
+		if initialisms[part] {
+			b.WriteString(strings.ToUpper(part))
+		} else {
+			b.WriteString(upperFirst(part))
+		}
+	}
+	return b.String()
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func lowerFirst(s string) string {
+	if s == "" || strings.ToUpper(s) == s {
+		return strings.ToLower(s)
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// clientCode is the part of the client that doesn't depend on the document
+const clientCode = `// RequestEditorFn changes a request before it is sent, e.g. to add
+// authentication. body is the encoded request body, nil if there is none.
+type RequestEditorFn func(ctx context.Context, req *http.Request, body []byte) error
+
+// Client calls the service at Server
+type Client struct {
+	Server         string
+	HTTPClient     *http.Client
+	RequestEditors []RequestEditorFn
+}
+
+// NewClient returns a client for the service at server, e.g.
+// "http://notification-service:80"
+func NewClient(server string, httpClient *http.Client, editors ...RequestEditorFn) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{Server: strings.TrimRight(server, "/"), HTTPClient: httpClient, RequestEditors: editors}
+}
+
+// do sends a request and reads the whole response
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, []byte, error) {
+	target := c.Server + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var encoded []byte
+	var reader io.Reader
+	if body != nil {
+		var err error
+		if encoded, err = json.Marshal(body); err != nil {
+			return nil, nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	for _, edit := range c.RequestEditors {
+		if err := edit(ctx, req, encoded); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp, nil, err
+	}
+	return resp, data, nil
+}
+
+func isJSON(header http.Header) bool {
+	return strings.HasPrefix(header.Get("Content-Type"), "application/json")
+}
+
+`
@@ -0,0 +1,320 @@
+// Command report summarizes a load test from the services' request metrics.
+//
+// It queries a Prometheus-compatible API (Mimir's is under /prometheus) for
+// the http_requests_total and http_request_duration_seconds series the shared
+// logger exports, over the window that ends at -end, and writes per-endpoint
+// throughput, P50/P95/P99 latency, error rate and SLO compliance as markdown
+// or JSON:
+//
+//	go run ./tools/report -prometheus http://localhost:9009/prometheus -window 15m -out report.md
+//
+// An endpoint meets its SLO when its share of non-5xx responses reaches
+// -slo-availability and its P95 latency stays within -slo-p95. The services'
+// own /metrics endpoints can't be used instead: the HTTP request metrics are
+// only exported over OTLP.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// endpointStats is the report line of one endpoint of a service
+type endpointStats struct {
+	Service     string   `json:"service"`
+	Endpoint    string   `json:"endpoint"`
+	Requests    float64  `json:"requests"`
+	Throughput  float64  `json:"throughput_rps"`
+	Errors      float64  `json:"errors"`
+	ErrorRate   float64  `json:"error_rate"`
+	P50Ms       *float64 `json:"p50_ms"`
+	P95Ms       *float64 `json:"p95_ms"`
+	P99Ms       *float64 `json:"p99_ms"`
+	Available   float64  `json:"availability"`
+	SLOMet      bool     `json:"slo_met"`
+	SLOFailures []string `json:"slo_failures,omitempty"`
+}
+
+// report is the JSON output
+type report struct {
+	Source          string          `json:"source"`
+	Start           time.Time       `json:"start"`
+	End             time.Time       `json:"end"`
+	SLOAvailability float64         `json:"slo_availability"`
+	SLOP95Ms        float64         `json:"slo_p95_ms"`
+	Endpoints       []endpointStats `json:"endpoints"`
+}
+
+func main() {
+	prometheusURL := flag.String("prometheus", "", "base URL of the Prometheus-compatible API, e.g. http://mimir:8080/prometheus")
+	window := flag.Duration("window", 15*time.Minute, "length of the load test")
+	endFlag := flag.String("end", "", "end of the load test (RFC 3339), now if empty")
+	services := flag.String("services", "api-gateway,notification-service", "comma-separated services to report on")
+	sloAvailability := flag.Float64("slo-availability", 0.99, "share of non-5xx responses an endpoint must reach")
+	sloP95 := flag.Duration("slo-p95", 500*time.Millisecond, "P95 latency an endpoint must stay within")
+	format := flag.String("format", "markdown", "output format: markdown or json")
+	out := flag.String("out", "", "output file, stdout if empty")
+	flag.Parse()
+
+	if *prometheusURL == "" {
+		log.Fatal("-prometheus is required")
+	}
+	if *format != "markdown" && *format != "json" {
+		log.Fatalf("unknown -format %q, expected markdown or json", *format)
+	}
+	end := time.Now().UTC()
+	if *endFlag != "" {
+		parsed, err := time.Parse(time.RFC3339, *endFlag)
+		if err != nil {
+			log.Fatalf("invalid -end: %v", err)
+		}
+		end = parsed.UTC()
+	}
+
+	client := &promClient{baseURL: strings.TrimRight(*prometheusURL, "/"), http: &http.Client{Timeout: 30 * time.Second}}
+	stats, err := collect(context.Background(), client, strings.Split(*services, ","), *window, end)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i := range stats {
+		evaluateSLO(&stats[i], *sloAvailability, *sloP95)
+	}
+
+	r := report{
+		Source:          *prometheusURL,
+		Start:           end.Add(-*window),
+		End:             end,
+		SLOAvailability: *sloAvailability,
+		SLOP95Ms:        float64(sloP95.Milliseconds()),
+		Endpoints:       stats,
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r)
+	} else {
+		err = writeMarkdown(w, r)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// collect queries the request metrics of the services over the window
+func collect(ctx context.Context, client *promClient, services []string, window time.Duration, end time.Time) ([]endpointStats, error) {
+	var quoted []string
+	for _, service := range services {
+		if service = strings.TrimSpace(service); service != "" {
+			quoted = append(quoted, regexpQuote(service))
+		}
+	}
+	selector := fmt.Sprintf(`service=~"%s"`, strings.Join(quoted, "|"))
+	rng := fmt.Sprintf("[%ds]", int(window.Seconds()))
+
+	byKey := map[[2]string]*endpointStats{}
+	get := func(labels map[string]string) *endpointStats {
+		key := [2]string{labels["service"], labels["endpoint"]}
+		if byKey[key] == nil {
+			byKey[key] = &endpointStats{Service: key[0], Endpoint: key[1]}
+		}
+		return byKey[key]
+	}
+
+	requests, err := client.query(ctx, fmt.Sprintf(`sum by (service, endpoint) (increase(http_requests_total{%s}%s))`, selector, rng), end)
+	if err != nil {
+		return nil, fmt.Errorf("querying requests: %w", err)
+	}
+	for _, sample := range requests {
+		s := get(sample.labels)
+		s.Requests = sample.value
+		s.Throughput = sample.value / window.Seconds()
+	}
+
+	errors, err := client.query(ctx, fmt.Sprintf(`sum by (service, endpoint) (increase(http_requests_total{%s,status_code=~"5.."}%s))`, selector, rng), end)
+	if err != nil {
+		return nil, fmt.Errorf("querying errors: %w", err)
+	}
+	for _, sample := range errors {
+		get(sample.labels).Errors = sample.value
+	}
+
+	for _, q := range []struct {
+		quantile float64
+		set      func(*endpointStats, *float64)
+	}{
+		{0.50, func(s *endpointStats, v *float64) { s.P50Ms = v }},
+		{0.95, func(s *endpointStats, v *float64) { s.P95Ms = v }},
+		{0.99, func(s *endpointStats, v *float64) { s.P99Ms = v }},
+	} {
+		samples, err := client.query(ctx, fmt.Sprintf(`histogram_quantile(%g, sum by (service, endpoint, le) (rate(http_request_duration_seconds_bucket{%s}%s)))`, q.quantile, selector, rng), end)
+		if err != nil {
+			return nil, fmt.Errorf("querying P%g: %w", q.quantile*100, err)
+		}
+		for _, sample := range samples {
+			if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+				continue
+			}
+			ms := sample.value * 1000
+			q.set(get(sample.labels), &ms)
+		}
+	}
+
+	stats := make([]endpointStats, 0, len(byKey))
+	for _, s := range byKey {
+		if s.Requests > 0 {
+			s.ErrorRate = s.Errors / s.Requests
+		}
+		s.Available = 1 - s.ErrorRate
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Service != stats[j].Service {
+			return stats[i].Service < stats[j].Service
+		}
+		return stats[i].Endpoint < stats[j].Endpoint
+	})
+	return stats, nil
+}
+
+// evaluateSLO records whether an endpoint met the availability and latency
+// objectives
+func evaluateSLO(s *endpointStats, availability float64, p95 time.Duration) {
+	if s.Requests > 0 && s.Available < availability {
+		s.SLOFailures = append(s.SLOFailures, fmt.Sprintf("availability %.2f%% < %.2f%%", s.Available*100, availability*100))
+	}
+	if s.P95Ms != nil && *s.P95Ms > float64(p95.Milliseconds()) {
+		s.SLOFailures = append(s.SLOFailures, fmt.Sprintf("P95 %.0fms > %dms", *s.P95Ms, p95.Milliseconds()))
+	}
+	s.SLOMet = len(s.SLOFailures) == 0
+}
+
+// writeMarkdown writes the report as a markdown table
+func writeMarkdown(w io.Writer, r report) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Load test report\n\n")
+	fmt.Fprintf(&b, "- Window: %s to %s (%s)\n", r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339), r.End.Sub(r.Start))
+	fmt.Fprintf(&b, "- Source: %s\n", r.Source)
+	fmt.Fprintf(&b, "- SLO: %.2f%% non-5xx responses, P95 within %.0fms\n\n", r.SLOAvailability*100, r.SLOP95Ms)
+
+	if len(r.Endpoints) == 0 {
+		b.WriteString("No requests were recorded in the window.\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	met := 0
+	b.WriteString("| Service | Endpoint | Requests | Throughput (req/s) | Error rate | P50 | P95 | P99 | SLO |\n")
+	b.WriteString("|---|---|---:|---:|---:|---:|---:|---:|---|\n")
+	for _, s := range r.Endpoints {
+		slo := "✅"
+		if s.SLOMet {
+			met++
+		} else {
+			slo = "❌ " + strings.Join(s.SLOFailures, ", ")
+		}
+		fmt.Fprintf(&b, "| %s | `%s` | %.0f | %.2f | %.2f%% | %s | %s | %s | %s |\n",
+			s.Service, s.Endpoint, s.Requests, s.Throughput, s.ErrorRate*100,
+			formatMs(s.P50Ms), formatMs(s.P95Ms), formatMs(s.P99Ms), slo)
+	}
+	fmt.Fprintf(&b, "\n%d of %d endpoints met the SLO.\n", met, len(r.Endpoints))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatMs formats a latency, "-" when there's no data
+func formatMs(ms *float64) string {
+	if ms == nil {
+		return "-"
+	}
+	return strconv.FormatFloat(*ms, 'f', 1, 64) + "ms"
+}
+
+// regexpQuote escapes a label value for a PromQL regex matcher
+func regexpQuote(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`.+*?()|[]{}^$\`, r) {
+			b.WriteString(`\\`)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// promClient runs instant queries on a Prometheus-compatible API
+type promClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+// sample is one series of an instant vector
+type sample struct {
+	labels map[string]string
+	value  float64
+}
+
+// query runs an instant query at t
+func (c *promClient) query(ctx context.Context, promql string, t time.Time) ([]sample, error) {
+	params := url.Values{"query": {promql}, "time": {strconv.FormatInt(t.Unix(), 10)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v1/query?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string `json:"resultType"`
+			Result     []struct {
+				Metric map[string]string `json:"metric"`
+				Value  [2]interface{}    `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding response (status %d): %w", resp.StatusCode, err)
+	}
+	if body.Status != "success" {
+		return nil, fmt.Errorf("query failed (status %d): %s", resp.StatusCode, body.Error)
+	}
+
+	samples := make([]sample, 0, len(body.Data.Result))
+	for _, result := range body.Data.Result {
+		text, _ := result.Value[1].(string)
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sample value %q", text)
+		}
+		samples = append(samples, sample{labels: result.Metric, value: value})
+	}
+	return samples, nil
+}
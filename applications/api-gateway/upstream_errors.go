@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"api-gateway/models"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Upstream error responses
+//
+// When an upstream answers with an error the gateway replies with an RFC 9457
+// problem+json body. What it says about the upstream's error depends on the
+// upstream's policy in UPSTREAM_ERROR_POLICY:
+//
+//	generic      only the gateway's own message ("User service error")
+//	passthrough  also the upstream status and a sanitized copy of its error:
+//	             the message fields of a JSON body (error, message, detail,
+//	             title, code and request IDs), or the start of a plain-text
+//	             body; stack traces, HTML pages and other fields are dropped
+//
+// The setting is a default policy, per-upstream overrides or both, e.g.
+// "generic,notification-service=passthrough". The production profile uses
+// generic, development and staging passthrough. Either way the response
+// carries a correlation_id (the trace ID, also in the X-Correlation-ID header)
+// and the sanitized upstream error is logged with it.
+
+const (
+	upstreamErrorsGeneric     = "generic"
+	upstreamErrorsPassthrough = "passthrough"
+
+	correlationHeader = "X-Correlation-ID"
+
+	// upstreamErrorMaxText caps each string copied from an upstream error
+	upstreamErrorMaxText = 500
+)
+
+// upstreamErrorFields are the fields of a JSON error body that may be passed on
+var upstreamErrorFields = []string{"error", "message", "detail", "title", "code", "request_id", "trace_id", "correlation_id"}
+
+var (
+	upstreamErrorDefault  string
+	upstreamErrorPolicies map[string]string
+)
+
+func init() {
+	upstreamErrorDefault = upstreamErrorsPassthrough
+	upstreamErrorPolicies = make(map[string]string)
+	for _, entry := range strings.Split(getEnvString("UPSTREAM_ERROR_POLICY", upstreamErrorsPassthrough), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		upstream, policy, found := strings.Cut(entry, "=")
+		if !found {
+			upstream, policy = "", upstream
+		}
+		if policy != upstreamErrorsGeneric && policy != upstreamErrorsPassthrough {
+			configWarning("Ignoring UPSTREAM_ERROR_POLICY entry %q, expected generic or passthrough", entry)
+			continue
+		}
+		if upstream == "" {
+			upstreamErrorDefault = policy
+		} else {
+			upstreamErrorPolicies[upstream] = policy
+		}
+	}
+}
+
+// upstreamErrorPolicy returns the policy for an upstream
+func upstreamErrorPolicy(upstream string) string {
+	if policy, ok := upstreamErrorPolicies[upstream]; ok {
+		return policy
+	}
+	return upstreamErrorDefault
+}
+
+// correlationID identifies a request in the logs: its trace ID, or a random
+// ID when it has no trace
+func correlationID(ctx context.Context) string {
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		return spanContext.TraceID().String()
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// sanitizeUpstreamError extracts the parts of an upstream error body that are
+// safe to show a client, or nil if there are none
+func sanitizeUpstreamError(header http.Header, body []byte) map[string]interface{} {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			return nil
+		}
+		sanitized := make(map[string]interface{})
+		for _, field := range upstreamErrorFields {
+			switch value := decoded[field].(type) {
+			case string:
+				sanitized[field] = truncateText(value)
+			case float64, bool:
+				sanitized[field] = value
+			}
+		}
+		if len(sanitized) == 0 {
+			return nil
+		}
+		return sanitized
+	case mediaType == "text/plain":
+		text := strings.TrimSpace(strings.ToValidUTF8(string(body), ""))
+		if text == "" {
+			return nil
+		}
+		return map[string]interface{}{"error": truncateText(text)}
+	default:
+		return nil
+	}
+}
+
+func truncateText(text string) string {
+	if len(text) <= upstreamErrorMaxText {
+		return text
+	}
+	return strings.ToValidUTF8(text[:upstreamErrorMaxText], "") + "..."
+}
+
+// writeUpstreamError answers a request whose upstream call failed with the
+// given status, following the upstream's error policy
+func writeUpstreamError(ctx context.Context, w http.ResponseWriter, r *http.Request, upstream string, status int, message string, upstreamStatus int, header http.Header, body []byte) {
+	id := correlationID(ctx)
+	details := sanitizeUpstreamError(header, body)
+
+	logger.Warn(ctx, "Upstream returned an error", map[string]interface{}{
+		"upstream":        upstream,
+		"upstream_status": upstreamStatus,
+		"upstream_error":  details,
+		"status_code":     status,
+		"correlation_id":  id,
+	})
+
+	problem := models.Problem{
+		Type:          "about:blank",
+		Title:         http.StatusText(status),
+		Status:        status,
+		Detail:        message,
+		Instance:      r.URL.Path,
+		CorrelationID: id,
+	}
+	if upstreamErrorPolicy(upstream) == upstreamErrorsPassthrough {
+		problem.Upstream = upstream
+		problem.UpstreamStatus = upstreamStatus
+		problem.UpstreamError = details
+	}
+
+	w.Header().Set(correlationHeader, id)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem)
+}
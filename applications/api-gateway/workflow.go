@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"api-gateway/models"
+)
+
+// Workflow steps
+//
+// POST /api/process runs a workflow as an ordered list of steps taken from a
+// step registry. Steps register themselves from an init() function with an
+// order value, so a demo step (payment, fraud check, ...) is added by dropping
+// a new file into the package without touching the handler. The built-in steps
+// live in workflow_steps.go.
+
+// workflowStep is a single stage of a workflow run
+type workflowStep interface {
+	Name() string
+	Run(ctx context.Context, run *workflowRun) error
+}
+
+// Orders of the built-in steps; leave gaps so new steps can be slotted between
+const (
+	stepOrderValidate    = 100
+	stepOrderUserService = 200
+	stepOrderNotify      = 300
+	stepOrderFinalize    = 900
+)
+
+// registeredStep is a step and its position in the workflow
+type registeredStep struct {
+	order int
+	step  workflowStep
+}
+
+var workflowSteps []registeredStep
+
+// registerWorkflowStep adds a step to the registry. It is meant to be called
+// from init(), before the server starts.
+func registerWorkflowStep(order int, step workflowStep) {
+	workflowSteps = append(workflowSteps, registeredStep{order: order, step: step})
+	sort.SliceStable(workflowSteps, func(i, j int) bool {
+		return workflowSteps[i].order < workflowSteps[j].order
+	})
+}
+
+// workflowRun carries the input of a workflow and the output of its steps
+type workflowRun struct {
+	WorkflowID string
+	UserID     string
+	Priority   string
+	Message    string
+	Data       json.RawMessage
+
+	// Records and RecordBytes count the records of a streamed payload
+	Records     int64
+	RecordBytes int64
+
+	// Results collects the values steps want returned to the caller
+	Results map[string]interface{}
+	Steps   []stepResult
+}
+
+// stepResult is the outcome of one step of a run
+type stepResult = models.StepResult
+
+// errStepSkipped is returned by steps that don't apply to a run
+var errStepSkipped = errors.New("step skipped")
+
+// workflowError fails a run with a specific HTTP status and client message
+type workflowError struct {
+	status  int
+	message string
+	err     error
+}
+
+func (e *workflowError) Error() string {
+	if e.err != nil {
+		return e.message + ": " + e.err.Error()
+	}
+	return e.message
+}
+
+func (e *workflowError) Unwrap() error { return e.err }
+
+// runWorkflow executes the registered steps in order, stopping at the first
+// failing step. Each step gets its own span.
+func runWorkflow(ctx context.Context, run *workflowRun) error {
+	if run.Results == nil {
+		run.Results = make(map[string]interface{})
+	}
+
+	for _, registered := range workflowSteps {
+		step := registered.step
+		stepCtx, endSpan := logger.StartSpan(ctx, "workflow_step_"+step.Name())
+		start := time.Now()
+
+		err := step.Run(stepCtx, run)
+
+		result := stepResult{Name: step.Name(), DurationMs: time.Since(start).Milliseconds()}
+		switch {
+		case errors.Is(err, errStepSkipped):
+			result.Skipped = true
+			err = nil
+		case err != nil:
+			_, result.Error = workflowErrorStatus(err)
+			logger.Error(stepCtx, "Workflow step failed", err, map[string]interface{}{
+				"workflow_id": run.WorkflowID,
+				"step":        step.Name(),
+			})
+		}
+		run.Steps = append(run.Steps, result)
+		endSpan()
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workflowErrorStatus returns the HTTP status and client message for a failed run
+func workflowErrorStatus(err error) (int, string) {
+	var wfErr *workflowError
+	if errors.As(err, &wfErr) {
+		return wfErr.status, wfErr.message
+	}
+	return http.StatusInternalServerError, "Workflow processing failed"
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Async workflow workers
+//
+// Workflows that don't run on behalf of a waiting client (scheduled runs) are
+// handed to a fixed pool of workers through a bounded queue
+// (WORKFLOW_WORKERS, WORKFLOW_QUEUE_SIZE). Each run is a background job with
+// its own root span (logger.StartJob).
+
+// workflowJob is a workflow run waiting for a worker
+type workflowJob struct {
+	scheduleID string
+	run        *workflowRun
+	enqueuedAt time.Time
+}
+
+var workflowQueue chan *workflowJob
+
+func init() {
+	workflowQueue = make(chan *workflowJob, getEnvInt("WORKFLOW_QUEUE_SIZE", 100))
+}
+
+// startWorkflowWorkers starts the async workflow worker pool
+func startWorkflowWorkers(count int) {
+	for i := 0; i < count; i++ {
+		id := i
+		background.Supervise("workflow_worker", func(ctx context.Context) error {
+			workflowWorker(ctx, id)
+			return nil
+		})
+	}
+}
+
+// enqueueWorkflow queues a run, returning false if the queue is full
+func enqueueWorkflow(job *workflowJob) bool {
+	select {
+	case workflowQueue <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// workflowWorker runs queued workflows until stopped. Runs still queued at
+// shutdown are dropped.
+func workflowWorker(stop context.Context, id int) {
+	for {
+		var job *workflowJob
+		select {
+		case <-stop.Done():
+			return
+		case job = <-workflowQueue:
+		}
+
+		ctx, endJob := logger.StartJob(context.Background(), "run_scheduled_workflow")
+		logger.AddSpanAttribute(ctx, "workflow_id", job.run.WorkflowID)
+		logger.AddSpanAttribute(ctx, "schedule_id", job.scheduleID)
+		logger.AddSpanAttribute(ctx, "worker_id", strconv.Itoa(id))
+
+		start := time.Now()
+		err := runWorkflow(ctx, job.run)
+		if err != nil {
+			logger.Error(ctx, "Scheduled workflow failed", err, map[string]interface{}{
+				"workflow_id": job.run.WorkflowID,
+				"schedule_id": job.scheduleID,
+				"worker_id":   id,
+			})
+		} else {
+			logger.Info(ctx, "Scheduled workflow completed", map[string]interface{}{
+				"workflow_id":   job.run.WorkflowID,
+				"schedule_id":   job.scheduleID,
+				"worker_id":     id,
+				"queue_wait_ms": start.Sub(job.enqueuedAt).Milliseconds(),
+				"duration_ms":   time.Since(start).Milliseconds(),
+			})
+		}
+		recordExecution(ctx, runSourceSchedule, job.scheduleID, job.run, err, start)
+		schedules.recordRun(job.scheduleID, clock.Now().UTC(), err)
+		endJob(err)
+	}
+}
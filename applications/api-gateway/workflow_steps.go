@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"api-gateway/clients/userservice"
+)
+
+// Built-in workflow steps
+//
+// validate -> call user service -> notify -> finalize. The user service and
+// notification steps are skipped when the request has no user_id, so plain
+// workflow submissions behave as before.
+
+func init() {
+	registerWorkflowStep(stepOrderValidate, validateStep{})
+	registerWorkflowStep(stepOrderUserService, userServiceStep{})
+	registerWorkflowStep(stepOrderNotify, notifyStep{})
+	registerWorkflowStep(stepOrderFinalize, finalizeStep{})
+}
+
+// validateStep checks the workflow input
+type validateStep struct{}
+
+func (validateStep) Name() string { return "validate" }
+
+func (validateStep) Run(ctx context.Context, run *workflowRun) error {
+	if run.WorkflowID == "" {
+		return &workflowError{status: http.StatusBadRequest, message: "workflow_id is required"}
+	}
+	switch run.Priority {
+	case "", "low", "normal", "high", "urgent":
+	default:
+		return &workflowError{
+			status:  http.StatusBadRequest,
+			message: fmt.Sprintf("invalid priority %q", run.Priority),
+		}
+	}
+	return nil
+}
+
+// userServiceStep runs the user's action on the user service
+type userServiceStep struct{}
+
+func (userServiceStep) Name() string { return "call_user_service" }
+
+func (userServiceStep) Run(ctx context.Context, run *workflowRun) error {
+	if run.UserID == "" {
+		return errStepSkipped
+	}
+	result, err := userService.Work(ctx, run.UserID, "workflow")
+	if err != nil {
+		return &workflowError{status: http.StatusInternalServerError, message: "User service unavailable", err: err}
+	}
+	run.Results["user_service_result"] = result
+	return nil
+}
+
+// notifyStep tells the user the workflow ran
+type notifyStep struct{}
+
+func (notifyStep) Name() string { return "notify" }
+
+func (notifyStep) Run(ctx context.Context, run *workflowRun) error {
+	if run.UserID == "" {
+		return errStepSkipped
+	}
+	message := run.Message
+	if message == "" {
+		message = "Workflow " + run.WorkflowID + " processed"
+	}
+	var greeting string
+	if userServiceResult, ok := run.Results["user_service_result"].(*userservice.WorkResult); ok {
+		greeting = userServiceResult.Greeting
+	}
+	result, err := notifyUser(ctx, run.UserID, message, greeting)
+	if err != nil {
+		return &workflowError{status: http.StatusInternalServerError, message: "Notification service unavailable", err: err}
+	}
+	run.Results["notification_result"] = result
+	return nil
+}
+
+// finalizeStep simulates the workflow's own processing, including failures
+type finalizeStep struct{}
+
+func (finalizeStep) Name() string { return "finalize" }
+
+func (finalizeStep) Run(ctx context.Context, run *workflowRun) error {
+	if rand.Float64() < failRate {
+		return fmt.Errorf("simulated workflow failure")
+	}
+
+	processingTime := time.Duration(50+rand.Intn(100)) * time.Millisecond
+	timer := time.NewTimer(processingTime)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	run.Results["processing_ms"] = processingTime.Milliseconds()
+	if run.Records > 0 {
+		run.Results["records_processed"] = run.Records
+		run.Results["record_bytes"] = run.RecordBytes
+	}
+	return nil
+}
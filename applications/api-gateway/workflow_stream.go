@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+)
+
+// Workflow payloads
+//
+// /api/process accepts three body formats:
+//
+//	application/json     - a single workflow object, decoded in memory
+//	application/x-ndjson - the first line is the workflow object, every further
+//	                       line is one data record
+//	multipart/form-data  - a "workflow" part with the workflow object and any
+//	                       number of "data" parts with NDJSON records
+//
+// Streamed records are validated and counted one at a time and never held in
+// memory together, so memory use is bounded by the largest record
+// (WORKFLOW_MAX_RECORD_BYTES). Bodies above WORKFLOW_MAX_BODY_BYTES are
+// rejected with 413 whatever their format.
+
+var (
+	maxWorkflowBodyBytes   int64
+	maxWorkflowRecordBytes int
+
+	errPayloadTooLarge = errors.New("payload too large")
+)
+
+func init() {
+	maxWorkflowBodyBytes = int64(getEnvInt("WORKFLOW_MAX_BODY_BYTES", 10<<20))
+	maxWorkflowRecordBytes = getEnvInt("WORKFLOW_MAX_RECORD_BYTES", 1<<20)
+}
+
+// workflowRequest is the workflow object of a /api/process body
+type workflowRequest struct {
+	WorkflowID string          `json:"workflow_id"`
+	UserID     string          `json:"user_id"`
+	Priority   string          `json:"priority"`
+	Message    string          `json:"message"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// decodeWorkflowRequest reads a /api/process body in any supported format.
+// Oversized bodies and records are reported as errPayloadTooLarge.
+func decodeWorkflowRequest(w http.ResponseWriter, r *http.Request) (*workflowRun, error) {
+	body := http.MaxBytesReader(w, r.Body, maxWorkflowBodyBytes)
+	run := &workflowRun{}
+
+	var err error
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-ndjson":
+		err = decodeNDJSONWorkflow(body, run)
+	case "multipart/form-data":
+		err = decodeMultipartWorkflow(body, params["boundary"], run)
+	default:
+		var req workflowRequest
+		if err = json.NewDecoder(body).Decode(&req); err == nil {
+			run.apply(req)
+		}
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return nil, fmt.Errorf("%w: body exceeds %d bytes", errPayloadTooLarge, maxWorkflowBodyBytes)
+	case errors.Is(err, bufio.ErrTooLong):
+		return nil, fmt.Errorf("%w: a record exceeds %d bytes", errPayloadTooLarge, maxWorkflowRecordBytes)
+	}
+	return run, err
+}
+
+// apply copies the workflow object into the run
+func (run *workflowRun) apply(req workflowRequest) {
+	run.WorkflowID = req.WorkflowID
+	run.UserID = req.UserID
+	run.Priority = req.Priority
+	run.Message = req.Message
+	run.Data = req.Data
+}
+
+// decodeNDJSONWorkflow reads the workflow object from the first line and
+// streams the remaining lines as records
+func decodeNDJSONWorkflow(body io.Reader, run *workflowRun) error {
+	scanner := newRecordScanner(body)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var req workflowRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			return fmt.Errorf("invalid workflow line: %w", err)
+		}
+		run.apply(req)
+		return consumeRecords(scanner, run)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("empty workflow stream")
+}
+
+// decodeMultipartWorkflow reads the "workflow" part and streams the records of
+// the "data" parts
+func decodeMultipartWorkflow(body io.Reader, boundary string, run *workflowRun) error {
+	if boundary == "" {
+		return errors.New("multipart body without boundary")
+	}
+
+	reader := multipart.NewReader(body, boundary)
+	seenWorkflow := false
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch part.FormName() {
+		case "workflow":
+			var req workflowRequest
+			if err := json.NewDecoder(part).Decode(&req); err != nil {
+				return fmt.Errorf("invalid workflow part: %w", err)
+			}
+			run.apply(req)
+			seenWorkflow = true
+		case "data":
+			if err := consumeRecords(newRecordScanner(part), run); err != nil {
+				return err
+			}
+		default:
+			// Drain unknown parts so they still count against the body limit
+			if _, err := io.Copy(io.Discard, part); err != nil {
+				return err
+			}
+		}
+		part.Close()
+	}
+
+	if !seenWorkflow {
+		return errors.New("multipart body without a workflow part")
+	}
+	return nil
+}
+
+// newRecordScanner splits a stream into lines of at most
+// WORKFLOW_MAX_RECORD_BYTES
+func newRecordScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, min(64<<10, maxWorkflowRecordBytes)), maxWorkflowRecordBytes)
+	return scanner
+}
+
+// consumeRecords validates and counts the remaining lines of a stream
+func consumeRecords(scanner *bufio.Scanner, run *workflowRun) error {
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			// A read error hands over the partial line before Scan stops
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("record %d is not valid JSON", run.Records+1)
+		}
+		run.Records++
+		run.RecordBytes += int64(len(line))
+	}
+	return scanner.Err()
+}
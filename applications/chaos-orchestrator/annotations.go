@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"chaos-orchestrator/models"
+)
+
+// Grafana annotations
+//
+// With GRAFANA_URL set, every injected fault becomes a region annotation
+// tagged "chaos", the scenario's name and the target, starting when the fault
+// was injected and ending when it was cleared, so dashboards show the
+// injected faults over the panels they affect. GRAFANA_TOKEN is a service
+// account token with the annotations:write permission. Annotation failures are
+// logged and don't stop the run.
+
+// annotator writes annotations to Grafana's HTTP API
+type annotator struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// newAnnotator returns the annotator of GRAFANA_URL, nil if unset
+func newAnnotator() *annotator {
+	url := getEnvString("GRAFANA_URL", "")
+	if url == "" {
+		return nil
+	}
+	return &annotator{
+		url:    url,
+		token:  getEnvString("GRAFANA_TOKEN", ""),
+		client: logger.HTTPClient("grafana", 5*time.Second),
+	}
+}
+
+// start creates an annotation beginning at t and returns its ID
+func (a *annotator) start(ctx context.Context, t time.Time, text string, tags []string) (int64, error) {
+	var created models.AnnotationCreated
+	err := a.send(ctx, "POST", "/api/annotations", models.Annotation{
+		Time: t.UnixMilli(),
+		Tags: tags,
+		Text: text,
+	}, &created)
+	return created.ID, err
+}
+
+// end closes the region of an annotation at t
+func (a *annotator) end(ctx context.Context, id int64, t time.Time) error {
+	return a.send(ctx, "PATCH", "/api/annotations/"+strconv.FormatInt(id, 10), models.AnnotationEnd{
+		TimeEnd: t.UnixMilli(),
+	}, nil)
+}
+
+func (a *annotator) send(ctx context.Context, method, path string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.url+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("grafana %s %s returned status %d", method, path, resp.StatusCode)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
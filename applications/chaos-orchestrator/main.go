@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"chaos-orchestrator/models"
+	"github.com/faidon-laboratory/go-logging"
+)
+
+// Chaos orchestrator
+//
+// Runs a declarative chaos scenario (see scenario.go) against the services'
+// /admin/chaos APIs: each fault is injected at its offset from the start of
+// the run and cleared when it runs out. Every action is logged, traced,
+// counted in chaos_actions_total by action, target and outcome, and
+// annotated in Grafana (see annotations.go), so dashboards line up with the
+// faults that caused what they show.
+//
+//	chaos-orchestrator -scenario scenarios/notification-degradation.json
+//	chaos-orchestrator -scenario ... -dry-run   # print the plan and exit
+//
+// On SIGINT or SIGTERM the faults still active are cleared before exiting.
+// The exit status is 1 if any action failed.
+
+var (
+	scenarioFile = flag.String("scenario", getEnvString("SCENARIO_FILE", "scenario.json"), "scenario file to run")
+	dryRun       = flag.Bool("dry-run", false, "print the plan and exit")
+
+	logger *logging.Logger
+)
+
+func init() {
+	logger = logging.New(logging.Config{
+		ServiceName: getEnvString("SERVICE_NAME", "chaos-orchestrator"),
+		Version:     getEnvString("SERVICE_VERSION", "1.0.0"),
+		Environment: getEnvString("ENVIRONMENT", "development"),
+		AlloyURL:    getEnvString("ALLOY_URL", "grafana-alloy.monitoring.svc.cluster.local:4318"),
+		Protocol:    getEnvString("ALLOY_PROTOCOL", "http"),
+		LogLevel:    getEnvString("LOG_LEVEL", "info"),
+		Format:      getEnvString("LOG_FORMAT", logging.FormatJSON),
+		Caller:      getEnvString("LOG_CALLER", "false") == "true",
+		StackTraces: getEnvString("LOG_STACK_TRACES", "false") == "true",
+	})
+}
+
+// getEnvString returns an environment variable, or defaultValue if unset
+func getEnvString(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// Step kinds
+const (
+	stepInject = "inject"
+	stepClear  = "clear"
+)
+
+// step is an inject or a clear of one action, at an offset from the start
+type step struct {
+	offset time.Duration
+	kind   string
+	action *action
+}
+
+// plan returns the steps of a scenario in order; a clear comes before an
+// inject at the same offset, so back-to-back faults on a target don't collide
+func plan(s *scenario) []step {
+	var steps []step
+	for i := range s.Actions {
+		a := &s.Actions[i]
+		steps = append(steps,
+			step{offset: time.Duration(a.At), kind: stepInject, action: a},
+			step{offset: time.Duration(a.At + a.For), kind: stepClear, action: a},
+		)
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		if steps[i].offset != steps[j].offset {
+			return steps[i].offset < steps[j].offset
+		}
+		return steps[i].kind == stepClear && steps[j].kind == stepInject
+	})
+	return steps
+}
+
+// runner executes a scenario
+type runner struct {
+	scenario  *scenario
+	clients   map[string]*http.Client
+	annotator *annotator
+	actions   *logging.Counter
+	// annotations holds the open annotation of each target with a fault
+	annotations map[string]int64
+	// active are the targets with a fault injected and not yet cleared
+	active   map[string]bool
+	failures int
+}
+
+func newRunner(s *scenario) *runner {
+	clients := make(map[string]*http.Client, len(s.Targets))
+	for name := range s.Targets {
+		clients[name] = logger.HTTPClient(name, 10*time.Second)
+	}
+	return &runner{
+		scenario:    s,
+		clients:     clients,
+		annotator:   newAnnotator(),
+		actions:     logger.Counter("chaos_actions_total"),
+		annotations: make(map[string]int64),
+		active:      make(map[string]bool),
+	}
+}
+
+// run executes the steps until done or stop is cancelled, then clears the
+// faults still active
+func (r *runner) run(ctx, stop context.Context) {
+	started := time.Now()
+	for _, st := range plan(r.scenario) {
+		timer := time.NewTimer(time.Until(started.Add(st.offset)))
+		select {
+		case <-timer.C:
+		case <-stop.Done():
+			timer.Stop()
+			logger.Warn(ctx, "Scenario interrupted, clearing active faults", map[string]interface{}{
+				"scenario": r.scenario.Name,
+				"elapsed":  time.Since(started).Round(time.Second).String(),
+			})
+			for _, name := range r.activeTargets() {
+				r.clear(ctx, name, "interrupted")
+			}
+			return
+		}
+
+		switch st.kind {
+		case stepInject:
+			r.inject(ctx, st.action)
+		case stepClear:
+			if r.active[st.action.Target] {
+				r.clear(ctx, st.action.Target, st.action.Note)
+			}
+		}
+	}
+}
+
+// activeTargets lists the targets with a fault, sorted
+func (r *runner) activeTargets() []string {
+	var names []string
+	for name := range r.active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// inject sends an action's fault to its target
+func (r *runner) inject(ctx context.Context, a *action) {
+	ctx, endSpan := logger.StartSpan(ctx, "chaos_inject", logging.SpanAttributes(
+		logging.String("chaos.target", a.Target),
+		logging.String("chaos.fault", a.Fault.describe()),
+	))
+	defer endSpan()
+
+	body := models.ChaosChange{
+		FailRate:  a.Fault.FailRate,
+		LatencyMs: a.Fault.LatencyMs,
+		Duration:  time.Duration(a.For).String(),
+	}
+	fields := map[string]interface{}{
+		"scenario": r.scenario.Name,
+		"target":   a.Target,
+		"fault":    a.Fault.describe(),
+		"for":      time.Duration(a.For).String(),
+		"note":     a.Note,
+	}
+
+	if err := r.call(ctx, a.Target, http.MethodPut, body); err != nil {
+		r.failures++
+		r.actions.Inc(ctx, logging.Labels{"action": stepInject, "target": a.Target, "outcome": "error"})
+		logger.Error(ctx, "Fault injection failed", err, fields)
+		return
+	}
+	r.active[a.Target] = true
+	r.actions.Inc(ctx, logging.Labels{"action": stepInject, "target": a.Target, "outcome": "success"})
+	logger.Warn(ctx, "Fault injected", fields)
+
+	if r.annotator != nil {
+		text := fmt.Sprintf("Chaos: %s on %s for %s", a.Fault.describe(), a.Target, time.Duration(a.For))
+		if a.Note != "" {
+			text += " (" + a.Note + ")"
+		}
+		id, err := r.annotator.start(ctx, time.Now(), text, []string{"chaos", r.scenario.Name, a.Target})
+		if err != nil {
+			logger.Error(ctx, "Failed to annotate fault", err, fields)
+			return
+		}
+		r.annotations[a.Target] = id
+	}
+}
+
+// clear removes the fault of a target
+func (r *runner) clear(ctx context.Context, name, note string) {
+	ctx, endSpan := logger.StartSpan(ctx, "chaos_clear", logging.SpanAttributes(
+		logging.String("chaos.target", name),
+	))
+	defer endSpan()
+
+	fields := map[string]interface{}{
+		"scenario": r.scenario.Name,
+		"target":   name,
+		"note":     note,
+	}
+	if err := r.call(ctx, name, http.MethodDelete, nil); err != nil {
+		// The service still clears it when its duration runs out
+		r.failures++
+		r.actions.Inc(ctx, logging.Labels{"action": stepClear, "target": name, "outcome": "error"})
+		logger.Error(ctx, "Fault clearing failed", err, fields)
+	} else {
+		r.actions.Inc(ctx, logging.Labels{"action": stepClear, "target": name, "outcome": "success"})
+		logger.Info(ctx, "Fault cleared", fields)
+	}
+	delete(r.active, name)
+
+	if id, ok := r.annotations[name]; ok {
+		delete(r.annotations, name)
+		if err := r.annotator.end(ctx, id, time.Now()); err != nil {
+			logger.Error(ctx, "Failed to close fault annotation", err, fields)
+		}
+	}
+}
+
+// call sends a request to a target's /admin/chaos
+func (r *runner) call(ctx context.Context, name, method string, body interface{}) error {
+	t := r.scenario.Targets[name]
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(t.URL, "/")+"/admin/chaos", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.TokenEnv != "" {
+		req.Header.Set("Authorization", "Bearer "+os.Getenv(t.TokenEnv))
+	}
+
+	resp, err := r.clients[name].Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s/admin/chaos returned status %d", method, t.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// printPlan writes the steps of a scenario to stdout
+func printPlan(s *scenario) {
+	fmt.Printf("Scenario %s: %s\n", s.Name, s.Description)
+	for _, st := range plan(s) {
+		line := fmt.Sprintf("  T+%-8s %-6s %s", st.offset, st.kind, st.action.Target)
+		if st.kind == stepInject {
+			line += fmt.Sprintf(" %s for %s", st.action.Fault.describe(), time.Duration(st.action.For))
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("Length: %s\n", s.length())
+}
+
+func main() {
+	flag.Parse()
+
+	s, err := loadScenario(*scenarioFile)
+	if err != nil {
+		logger.Error(context.Background(), "Invalid scenario", err)
+		logger.Shutdown(context.Background())
+		os.Exit(1)
+	}
+	if *dryRun {
+		printPlan(s)
+		logger.Shutdown(context.Background())
+		return
+	}
+
+	stop, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	ctx, endJob := logger.StartJob(context.Background(), "chaos_scenario")
+	logger.AddSpanAttribute(ctx, "chaos.scenario", s.Name)
+	logger.Info(ctx, "Chaos scenario started", map[string]interface{}{
+		"scenario": s.Name,
+		"actions":  len(s.Actions),
+		"length":   s.length().String(),
+		"annotate": getEnvString("GRAFANA_URL", "") != "",
+	})
+
+	r := newRunner(s)
+	r.run(ctx, stop)
+
+	var runErr error
+	if r.failures > 0 {
+		runErr = fmt.Errorf("%d chaos actions failed", r.failures)
+	}
+	logger.Info(ctx, "Chaos scenario finished", map[string]interface{}{
+		"scenario":    s.Name,
+		"failures":    r.failures,
+		"interrupted": stop.Err() != nil,
+	})
+	endJob(runErr)
+
+	if err := logger.Shutdown(context.Background()); err != nil {
+		fmt.Fprintf(os.Stderr, "Telemetry flush failed: %v\n", err)
+	}
+	if runErr != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,31 @@
+// Package models holds the bodies the orchestrator sends: faults to the
+// services' admin API and annotations to Grafana.
+package models
+
+// ChaosChange is the body of PUT /admin/chaos, the notification service's
+// models.ChaosChange. Fields left out keep the service's configured behavior.
+type ChaosChange struct {
+	FailRate  *float64 `json:"fail_rate,omitempty"`
+	LatencyMs int      `json:"latency_ms,omitempty"`
+	// Duration is how long the fault lasts, e.g. "5m"
+	Duration string `json:"duration"`
+}
+
+// Annotation is the body of POST /api/annotations; Time is in unix
+// milliseconds
+type Annotation struct {
+	Time int64    `json:"time"`
+	Tags []string `json:"tags"`
+	Text string   `json:"text"`
+}
+
+// AnnotationCreated is Grafana's answer to a created annotation
+type AnnotationCreated struct {
+	ID int64 `json:"id"`
+}
+
+// AnnotationEnd is the body of PATCH /api/annotations/{id}, closing the
+// annotation's region; TimeEnd is in unix milliseconds
+type AnnotationEnd struct {
+	TimeEnd int64 `json:"timeEnd"`
+}
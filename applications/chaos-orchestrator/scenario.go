@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Scenarios
+//
+// A scenario is a JSON file naming the services it touches and the faults to
+// inject into them, each at an offset from the start of the run and for a
+// while:
+//
+//	{
+//	  "name": "notification-degradation",
+//	  "targets": {
+//	    "notification-service": {"url": "http://notification-service:8000", "token_env": "NOTIFICATION_ADMIN_TOKEN"}
+//	  },
+//	  "actions": [
+//	    {"at": "2m", "target": "notification-service", "fault": {"fail_rate": 0.3}, "for": "5m"}
+//	  ]
+//	}
+//
+// A fault is sent to the target's PUT /admin/chaos with its duration, so the
+// service clears it by itself if the orchestrator dies, and cleared with
+// DELETE /admin/chaos when it runs out. A target holds one fault at a time:
+// actions on the same target must not overlap.
+
+// duration is a time.Duration written as "90s" in JSON
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// target is a service with an /admin/chaos API
+type target struct {
+	URL string `json:"url"`
+	// TokenEnv names the environment variable holding the target's admin
+	// bearer token, if it needs one
+	TokenEnv string `json:"token_env"`
+}
+
+// fault is the body of PUT /admin/chaos, without the duration
+type fault struct {
+	FailRate  *float64 `json:"fail_rate,omitempty"`
+	LatencyMs int      `json:"latency_ms,omitempty"`
+}
+
+// action injects a fault into a target at an offset, for a while
+type action struct {
+	At     duration `json:"at"`
+	Target string   `json:"target"`
+	Fault  fault    `json:"fault"`
+	For    duration `json:"for"`
+	// Note describes the action in logs and annotations
+	Note string `json:"note"`
+}
+
+// scenario is a declarative chaos scenario
+type scenario struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Targets     map[string]target `json:"targets"`
+	Actions     []action          `json:"actions"`
+}
+
+// loadScenario reads and validates a scenario file
+func loadScenario(path string) (*scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s scenario
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// validate checks the scenario and sorts its actions by start
+func (s *scenario) validate() error {
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(s.Actions) == 0 {
+		return errors.New("no actions")
+	}
+	for name, t := range s.Targets {
+		if t.URL == "" {
+			return fmt.Errorf("target %s has no url", name)
+		}
+	}
+
+	sort.SliceStable(s.Actions, func(i, j int) bool { return s.Actions[i].At < s.Actions[j].At })
+	busyUntil := make(map[string]duration)
+	for i, a := range s.Actions {
+		switch {
+		case a.At < 0:
+			return fmt.Errorf("action %d starts before the run", i+1)
+		case a.For <= 0:
+			return fmt.Errorf("action %d needs a positive \"for\"", i+1)
+		case a.Fault.FailRate == nil && a.Fault.LatencyMs == 0:
+			return fmt.Errorf("action %d injects nothing; set fail_rate or latency_ms", i+1)
+		case a.Fault.FailRate != nil && (*a.Fault.FailRate < 0 || *a.Fault.FailRate > 1):
+			return fmt.Errorf("action %d: fail_rate must be between 0 and 1", i+1)
+		case a.Fault.LatencyMs < 0:
+			return fmt.Errorf("action %d: latency_ms must not be negative", i+1)
+		}
+		if _, ok := s.Targets[a.Target]; !ok {
+			return fmt.Errorf("action %d: unknown target %q", i+1, a.Target)
+		}
+		if a.At < busyUntil[a.Target] {
+			return fmt.Errorf("action %d overlaps the previous fault on %s", i+1, a.Target)
+		}
+		busyUntil[a.Target] = a.At + a.For
+	}
+	return nil
+}
+
+// length is the time from the start of a run to the end of its last fault
+func (s *scenario) length() time.Duration {
+	var end duration
+	for _, a := range s.Actions {
+		end = max(end, a.At+a.For)
+	}
+	return time.Duration(end)
+}
+
+// describe summarises a fault, e.g. "fail_rate=0.3 latency_ms=2000"
+func (f fault) describe() string {
+	var text string
+	if f.FailRate != nil {
+		text = fmt.Sprintf("fail_rate=%g", *f.FailRate)
+	}
+	if f.LatencyMs > 0 {
+		if text != "" {
+			text += " "
+		}
+		text += fmt.Sprintf("latency_ms=%d", f.LatencyMs)
+	}
+	return text
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	service "github.com/faidon-laboratory/go-service"
+	"github.com/gorilla/mux"
+	"notification-service/models"
+)
+
+// Admin API
+//
+// Operational endpoints under /admin, authenticated separately from the
+// public API by a bearer token (ADMIN_TOKEN, ADMIN_TOKENS) or, on the admin
+// listener (ADMIN_PORT), a client certificate (ADMIN_CLIENT_CA); see
+// service.Admin. Without credentials configured every admin request is
+// rejected unless ADMIN_AUTH=none. Every admin request, allowed or not, is
+// written to the audit log.
+//
+// GET /admin/goroutines lists the background goroutines started through the
+// service group (the delivery workers) with per-name counters of starts,
+// panics and failures, plus the total number of goroutines in the process.
+// Request signing doesn't apply to these endpoints.
+
+// adminConfig holds the admin listener settings and credentials
+var adminConfig = service.LoadAdmin(config)
+
+// adminMiddleware authenticates admin requests and writes the audit log
+func adminMiddleware(next http.Handler) http.Handler {
+	return adminConfig.Middleware(service.AdminHooks{
+		Logger: logger,
+		Reject: rejectAdminRequest,
+	})(next)
+}
+
+// rejectAdminRequest answers an admin request without valid credentials
+func rejectAdminRequest(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "admin_unauthorized")
+	defer endSpan()
+
+	start := time.Now()
+	route := r.URL.Path
+	if current := mux.CurrentRoute(r); current != nil {
+		route, _ = current.GetPathTemplate()
+	}
+
+	writeError(w, http.StatusUnauthorized, "Admin credentials required")
+	logger.CountRequest(ctx, route, 401)
+	logger.RecordDuration(ctx, route, time.Since(start))
+}
+
+// registerAdminRoutes adds the admin endpoints to a router
+func registerAdminRoutes(r *mux.Router) {
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(adminMiddleware)
+	admin.HandleFunc("/goroutines", adminGoroutinesHandler).Methods("GET")
+	admin.HandleFunc("/clock", adminClockHandler).Methods("GET", "POST")
+	admin.HandleFunc("/scaling", adminScalingHandler).Methods("GET")
+	admin.HandleFunc("/projections/rebuild", adminRebuildProjectionsHandler).Methods("POST")
+	admin.HandleFunc("/migrations", adminMigrationsHandler).Methods("GET")
+	admin.HandleFunc("/import", adminImportHandler).Methods("POST")
+	admin.HandleFunc("/chaos", adminChaosHandler).Methods("GET", "PUT", "DELETE")
+}
+
+// newAdminServer returns the admin listener, or nil when ADMIN_PORT is unset
+func newAdminServer() (*http.Server, error) {
+	r := mux.NewRouter()
+	r.Use(logger.RecoverMiddleware())
+	registerAdminRoutes(r)
+	return adminConfig.NewServer(r)
+}
+
+// serveAdmin runs the admin listener until it is shut down
+func serveAdmin(server *http.Server) {
+	if err := adminConfig.Serve(server); err != nil {
+		logger.Error(context.Background(), "Admin server failed to start", err)
+		os.Exit(1)
+	}
+}
+
+// Goroutine registry endpoint
+func adminGoroutinesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "admin_goroutines")
+	defer endSpan()
+
+	start := time.Now()
+	logger.AddSpanAttribute(ctx, "admin.identity", service.AdminIdentity(ctx))
+
+	writeJSON(w, http.StatusOK, models.Goroutines{
+		OK:                true,
+		Goroutines:        background.Tasks(),
+		Stages:            background.Stages(),
+		ProcessGoroutines: runtime.NumGoroutine(),
+	})
+	logger.CountRequest(ctx, "/admin/goroutines", 200)
+	logger.RecordDuration(ctx, "/admin/goroutines", time.Since(start))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Channel latency profiles
+//
+// The email, SMS and Slack providers are simulated, each with its own
+// latency range and failure rate so dashboards split by channel show
+// different behavior. CHANNEL_PROFILES sets them as
+// "channel=min_ms-max_ms:failure_factor,...": a send takes a random time in
+// [min_ms, max_ms) and fails with probability FAIL_RATE × failure_factor
+// (at most 1), so FAIL_RATE=0 still turns every injected failure off. The
+// default profiles are:
+//
+//	email  150-400 ms, FAIL_RATE × 1    the baseline
+//	sms    800-2500 ms, FAIL_RATE × 0.2  slow but reliable
+//	slack  30-120 ms, FAIL_RATE × 5     fast but flaky, throttles (429)
+//
+// Channels without a profile take 100-300 ms and fail at FAIL_RATE. Push has
+// its own provider adapters (see push.go). /admin/chaos can override
+// FAIL_RATE and add latency at runtime (see chaos.go).
+
+const defaultChannelProfiles = "email=150-400:1,sms=800-2500:0.2,slack=30-120:5"
+
+// channelProfile is the simulated behavior of a channel's provider
+type channelProfile struct {
+	minLatencyMs  int
+	maxLatencyMs  int
+	failureFactor float64
+	// failureStatus is the provider response code of a failed send
+	failureStatus int
+}
+
+// fallbackChannelProfile is used for channels without a profile
+var fallbackChannelProfile = channelProfile{
+	minLatencyMs:  100,
+	maxLatencyMs:  300,
+	failureFactor: 1,
+	failureStatus: http.StatusServiceUnavailable,
+}
+
+// channelfailureStatuses are the failure codes of providers that don't just
+// go unavailable
+var channelfailureStatuses = map[string]int{
+	"slack": http.StatusTooManyRequests,
+}
+
+var channelProfiles map[string]channelProfile
+
+func init() {
+	channelProfiles = parseChannelProfiles(getEnvString("CHANNEL_PROFILES", defaultChannelProfiles))
+}
+
+// parseChannelProfiles parses "channel=min_ms-max_ms:failure_factor,..."
+func parseChannelProfiles(spec string) map[string]channelProfile {
+	profiles := make(map[string]channelProfile)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		channel, value, found := strings.Cut(entry, "=")
+		latency, factor, _ := strings.Cut(value, ":")
+		minValue, maxValue, _ := strings.Cut(latency, "-")
+		minMs, minErr := strconv.Atoi(strings.TrimSpace(minValue))
+		maxMs, maxErr := strconv.Atoi(strings.TrimSpace(maxValue))
+		failureFactor := 1.0
+		var factorErr error
+		if factor != "" {
+			failureFactor, factorErr = strconv.ParseFloat(strings.TrimSpace(factor), 64)
+		}
+		if !found || minErr != nil || maxErr != nil || factorErr != nil || minMs < 0 || maxMs <= minMs || failureFactor < 0 {
+			configWarning("Invalid CHANNEL_PROFILES entry %q, expected channel=min_ms-max_ms:failure_factor", entry)
+			continue
+		}
+
+		channel = strings.TrimSpace(channel)
+		status, ok := channelfailureStatuses[channel]
+		if !ok {
+			status = http.StatusServiceUnavailable
+		}
+		profiles[channel] = channelProfile{
+			minLatencyMs:  minMs,
+			maxLatencyMs:  maxMs,
+			failureFactor: failureFactor,
+			failureStatus: status,
+		}
+	}
+	return profiles
+}
+
+// profileOf returns the profile of a channel
+func profileOf(channel string) channelProfile {
+	if profile, ok := channelProfiles[channel]; ok {
+		return profile
+	}
+	return fallbackChannelProfile
+}
+
+// latency returns a random send duration, plus any injected latency
+func (p channelProfile) latency() time.Duration {
+	return time.Duration(p.minLatencyMs+rand.Intn(p.maxLatencyMs-p.minLatencyMs))*time.Millisecond + chaosLatency()
+}
+
+// fails tells whether a send fails, returning the provider's response code
+func (p channelProfile) fails() (int, bool) {
+	if rand.Float64() < min(currentFailRate()*p.failureFactor, 1) {
+		return p.failureStatus, true
+	}
+	return http.StatusOK, false
+}
+
+// profilesSummary lists the channel profiles, for the startup log
+func profilesSummary() string {
+	var entries []string
+	for channel, p := range channelProfiles {
+		entries = append(entries, channel+"="+strconv.Itoa(p.minLatencyMs)+"-"+strconv.Itoa(p.maxLatencyMs)+
+			":"+strconv.FormatFloat(p.failureFactor, 'g', -1, 64))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
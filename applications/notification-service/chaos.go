@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	service "github.com/faidon-laboratory/go-service"
+	"notification-service/models"
+)
+
+// Fault injection
+//
+// /admin/chaos changes the simulated failures of a running service, for
+// chaos scenarios (see applications/chaos-orchestrator):
+//
+//	GET    /admin/chaos  the active fault and the configured FAIL_RATE
+//	PUT    /admin/chaos  {"fail_rate": 0.3, "latency_ms": 2000, "duration": "5m"}
+//	DELETE /admin/chaos  back to the configuration
+//
+// fail_rate replaces FAIL_RATE everywhere it applies (handlers, channel
+// profiles, push providers); latency_ms is added to every provider send.
+// Fields left out keep their configured behavior. A fault with a duration
+// clears itself when it runs out, so it ends even if whoever set it doesn't
+// come back. Durations are on real time, not the fake clock. Like the other
+// admin endpoints it rejects every request until ADMIN_TOKEN (or another admin
+// credential) is set.
+
+var (
+	chaosMu sync.RWMutex
+	// chaos is the active fault, nil if none
+	chaos *models.ChaosFault
+)
+
+// activeFault returns the active fault, clearing it once it has expired
+func activeFault() *models.ChaosFault {
+	chaosMu.RLock()
+	fault := chaos
+	chaosMu.RUnlock()
+	if fault == nil || fault.ExpiresAt == nil || time.Now().Before(*fault.ExpiresAt) {
+		return fault
+	}
+
+	chaosMu.Lock()
+	defer chaosMu.Unlock()
+	if chaos == fault {
+		chaos = nil
+	}
+	return nil
+}
+
+// currentFailRate returns the failure rate in effect
+func currentFailRate() float64 {
+	if fault := activeFault(); fault != nil && fault.FailRate != nil {
+		return *fault.FailRate
+	}
+	return failRate
+}
+
+// chaosLatency returns the latency added to provider sends
+func chaosLatency() time.Duration {
+	if fault := activeFault(); fault != nil {
+		return time.Duration(fault.LatencyMs) * time.Millisecond
+	}
+	return 0
+}
+
+// Fault injection endpoint
+func adminChaosHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "admin_chaos")
+	defer endSpan()
+
+	start := time.Now()
+	logger.AddSpanAttribute(ctx, "admin.identity", service.AdminIdentity(ctx))
+
+	switch r.Method {
+	case http.MethodPut:
+		var change models.ChaosChange
+		var duration time.Duration
+		err := json.NewDecoder(r.Body).Decode(&change)
+		if err == nil && change.Duration != "" {
+			duration, err = time.ParseDuration(change.Duration)
+		}
+		if err != nil || duration < 0 || change.LatencyMs < 0 ||
+			(change.FailRate != nil && (*change.FailRate < 0 || *change.FailRate > 1)) {
+			writeError(w, http.StatusBadRequest, `Expected {"fail_rate": 0-1, "latency_ms": >=0, "duration": "<duration>"}`)
+			logger.CountRequest(ctx, "/admin/chaos", 400)
+			logger.RecordDuration(ctx, "/admin/chaos", time.Since(start))
+			return
+		}
+
+		fault := &models.ChaosFault{FailRate: change.FailRate, LatencyMs: change.LatencyMs}
+		if duration > 0 {
+			expiresAt := time.Now().Add(duration).UTC()
+			fault.ExpiresAt = &expiresAt
+		}
+		chaosMu.Lock()
+		chaos = fault
+		chaosMu.Unlock()
+
+		fields := map[string]interface{}{
+			"latency_ms": fault.LatencyMs,
+			"duration":   change.Duration,
+			"identity":   service.AdminIdentity(ctx),
+		}
+		if fault.FailRate != nil {
+			fields["fail_rate"] = *fault.FailRate
+		}
+		logger.Warn(ctx, "Fault injected", fields)
+
+	case http.MethodDelete:
+		chaosMu.Lock()
+		cleared := chaos != nil
+		chaos = nil
+		chaosMu.Unlock()
+
+		if cleared {
+			logger.Info(ctx, "Fault cleared", map[string]interface{}{
+				"identity": service.AdminIdentity(ctx),
+			})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, models.ChaosStatus{
+		OK:                 true,
+		Fault:              activeFault(),
+		FailRate:           currentFailRate(),
+		ConfiguredFailRate: failRate,
+		AddedLatencyMs:     chaosLatency().Milliseconds(),
+	})
+	logger.CountRequest(ctx, "/admin/chaos", 200)
+	logger.RecordDuration(ctx, "/admin/chaos", time.Since(start))
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/faidon-laboratory/go-logging"
+)
+
+// Delivery workers
+//
+// Sends are handed to a fixed pool of delivery workers through a bounded
+// queue. Each provider has a configurable quota (PROVIDER_RATE_LIMITS, sends
+// per minute, e.g. "slack=60,sms=30"); workers reserve a slot on the
+// provider's pacer before delivering, so excess sends wait in line instead of
+// being blasted at the provider and failing. A job whose slot is still to come
+// waits off the worker and is queued again when the slot comes, so it doesn't
+// hold up jobs for other providers; a caller giving up in the meantime gives
+// the slot back. A job's outbox entry is removed once the worker is done with
+// it (see outbox.go).
+
+// deliveryJob is a single notification waiting to be delivered
+type deliveryJob struct {
+	ctx            context.Context
+	notificationID string
+	part           int
+	userID         string
+	tenantID       string
+	channel        string
+	priority       string
+	provider       string
+	message        string
+	enqueuedAt     time.Time
+	result         chan deliveryResult
+
+	// slot is the send slot reserved on the provider's pacer, zero until then
+	slot         time.Time
+	throttleWait time.Duration
+}
+
+// deliveryResult is reported back to the handler waiting for a job
+type deliveryResult struct {
+	throttleWait time.Duration
+	duration     time.Duration
+	err          error
+}
+
+// providerPacer spaces sends to a provider evenly over time
+type providerPacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+	// released are slots given back before next, earliest first
+	released []time.Time
+}
+
+var (
+	deliveryQueue  chan *deliveryJob
+	providerPacers map[string]*providerPacer
+)
+
+func init() {
+	deliveryQueue = make(chan *deliveryJob, getEnvInt("DELIVERY_QUEUE_SIZE", 1000))
+	providerPacers = parseProviderRateLimits(getEnvString("PROVIDER_RATE_LIMITS", ""))
+}
+
+// parseProviderRateLimits parses "provider=sends_per_minute,..." into pacers
+func parseProviderRateLimits(spec string) map[string]*providerPacer {
+	pacers := make(map[string]*providerPacer)
+	for _, entry := range strings.Split(spec, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found {
+			continue
+		}
+		perMinute, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || perMinute <= 0 {
+			continue
+		}
+		pacers[strings.TrimSpace(name)] = &providerPacer{interval: time.Minute / time.Duration(perMinute)}
+	}
+	return pacers
+}
+
+// reserve books the next free send slot and returns it
+func (p *providerPacer) reserve(now time.Time) time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Slots given back are taken first; the ones gone by are lost
+	for len(p.released) > 0 {
+		slot := p.released[0]
+		p.released = p.released[1:]
+		if !slot.Before(now) {
+			return slot
+		}
+	}
+
+	if p.next.Before(now) {
+		p.next = now
+	}
+	slot := p.next
+	p.next = p.next.Add(p.interval)
+	return slot
+}
+
+// cancel gives back a slot booked by reserve
+func (p *providerPacer) cancel(slot time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if slot.Add(p.interval).Equal(p.next) {
+		p.next = slot
+		return
+	}
+	i, _ := slices.BinarySearchFunc(p.released, slot, time.Time.Compare)
+	p.released = slices.Insert(p.released, i, slot)
+}
+
+// startDeliveryWorkers starts the delivery worker pool
+func startDeliveryWorkers(count int) {
+	deliveryWorkerCount = count
+	for i := 0; i < count; i++ {
+		id := i
+		background.Supervise("delivery_worker", func(ctx context.Context) error {
+			deliveryWorker(ctx, id)
+			return nil
+		})
+	}
+}
+
+// enqueueDelivery queues a job, returning false if the queue is full
+func enqueueDelivery(job *deliveryJob) bool {
+	select {
+	case deliveryQueue <- job:
+		deliveryStats.arrived(time.Now())
+		notifications.record(job.notificationID, TimelineEvent{Event: statusQueued, Part: job.part})
+		return true
+	default:
+		return false
+	}
+}
+
+// waitDeliveries waits for all jobs of a send and combines their results.
+// The send fails if any part fails.
+func waitDeliveries(jobs []*deliveryJob) deliveryResult {
+	var combined deliveryResult
+	for _, job := range jobs {
+		result := <-job.result
+		combined.throttleWait = max(combined.throttleWait, result.throttleWait)
+		combined.duration += result.duration
+		if combined.err == nil {
+			combined.err = result.err
+		}
+	}
+	return combined
+}
+
+// deliveryWorker delivers queued jobs until stopped
+func deliveryWorker(stop context.Context, id int) {
+	for {
+		var job *deliveryJob
+		select {
+		case <-stop.Done():
+			return
+		case job = <-deliveryQueue:
+		}
+
+		// The caller may have given up while the job was queued
+		if err := job.ctx.Err(); err != nil {
+			abandonDelivery(job, &id, err)
+			continue
+		}
+
+		// A job early for its provider slot waits off the worker
+		if throttleDelivery(job, id) {
+			continue
+		}
+
+		runDelivery(job, id)
+	}
+}
+
+// runDelivery delivers a job and reports its result. A panic fails the job
+// before it restarts the worker, so its caller isn't left waiting.
+func runDelivery(job *deliveryJob, workerID int) {
+	deliveriesInFlight.Add(1)
+	started := time.Now()
+	defer func() {
+		deliveriesInFlight.Add(-1)
+		if recovered := recover(); recovered != nil {
+			err := fmt.Errorf("delivery worker panicked: %v", recovered)
+			notifications.record(job.notificationID, TimelineEvent{
+				Event:    statusFailed,
+				Part:     job.part,
+				WorkerID: &workerID,
+				Error:    err.Error(),
+			})
+			outbox.complete(job.notificationID, job.part)
+			job.result <- deliveryResult{throttleWait: job.throttleWait, duration: time.Since(started), err: err}
+			panic(recovered)
+		}
+	}()
+
+	result := deliver(job, workerID)
+	deliveryStats.completed(time.Now(), time.Since(started))
+	outbox.complete(job.notificationID, job.part)
+	job.result <- result
+}
+
+// abandonDelivery ends a job whose caller has given up
+func abandonDelivery(job *deliveryJob, workerID *int, err error) {
+	notifications.record(job.notificationID, TimelineEvent{
+		Event:    statusCancelled,
+		Part:     job.part,
+		WorkerID: workerID,
+		Error:    err.Error(),
+	})
+	outbox.complete(job.notificationID, job.part)
+	job.result <- deliveryResult{throttleWait: job.throttleWait, err: err}
+}
+
+// throttleDelivery reserves the job's send slot on its provider's pacer. If
+// the slot is still to come it returns true and queues the job again when the
+// slot comes, freeing the worker meanwhile.
+func throttleDelivery(job *deliveryJob, workerID int) bool {
+	pacer, ok := providerPacers[job.provider]
+	if !ok || !job.slot.IsZero() {
+		return false
+	}
+
+	now := time.Now()
+	job.slot = pacer.reserve(now)
+	job.throttleWait = job.slot.Sub(now)
+	recordThrottleWait(job.ctx, job.provider, job.throttleWait)
+	if job.throttleWait <= 0 {
+		return false
+	}
+
+	logger.Debug(job.ctx, "Waiting for provider quota", map[string]interface{}{
+		"provider":  job.provider,
+		"worker_id": workerID,
+		"wait_ms":   job.throttleWait.Milliseconds(),
+	})
+	notifications.record(job.notificationID, TimelineEvent{
+		Event:      eventThrottled,
+		Part:       job.part,
+		WorkerID:   &workerID,
+		Provider:   job.provider,
+		DurationMs: job.throttleWait.Milliseconds(),
+	})
+
+	err := background.Go("delivery_throttle", func(stop context.Context) error {
+		timer := time.NewTimer(job.throttleWait)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			select {
+			case deliveryQueue <- job:
+				return nil
+			case <-job.ctx.Done():
+			case <-stop.Done():
+			}
+		case <-job.ctx.Done():
+			pacer.cancel(job.slot)
+		case <-stop.Done():
+			pacer.cancel(job.slot)
+		}
+
+		if err := job.ctx.Err(); err != nil {
+			abandonDelivery(job, nil, err)
+			return nil
+		}
+		// Shutting down; the outbox entry is delivered on the next run
+		job.result <- deliveryResult{throttleWait: job.throttleWait, err: stop.Err()}
+		return nil
+	})
+	if err != nil {
+		// Shutting down; the outbox entry is delivered on the next run
+		pacer.cancel(job.slot)
+		job.result <- deliveryResult{err: err}
+	}
+	return true
+}
+
+// deliver sends a single notification once its provider slot has come
+func deliver(job *deliveryJob, workerID int) deliveryResult {
+	// Taken from the delivery queue, under the span that queued it
+	ctx, endSpan := logger.StartSpan(job.ctx, "deliver_notification",
+		logging.ConsumerSpan(),
+		logging.SpanAttributes(
+			logging.String("provider", job.provider),
+			logging.String("worker_id", strconv.Itoa(workerID)),
+		),
+	)
+	defer endSpan()
+
+	result := deliveryResult{throttleWait: job.throttleWait}
+
+	notifications.record(job.notificationID, TimelineEvent{
+		Event:      statusSending,
+		Part:       job.part,
+		WorkerID:   &workerID,
+		DurationMs: time.Since(job.enqueuedAt).Milliseconds(),
+	})
+
+	// Push fans out to the user's devices and records its own attempts
+	if job.channel == channelPush {
+		sendStart := time.Now()
+		_, result.err = sendPush(ctx, job, workerID)
+		result.duration = time.Since(sendStart)
+		return result
+	}
+
+	// Simulate the channel's provider (see channels.go)
+	profile := profileOf(job.channel)
+	result.duration = profile.latency()
+	timer := time.NewTimer(result.duration)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		// The caller went away; abandon the send
+		timer.Stop()
+		result.err = ctx.Err()
+		return result
+	}
+
+	responseCode, failed := profile.fails()
+	if failed {
+		result.err = fmt.Errorf("simulated %s provider failure (status %d)", job.channel, responseCode)
+	}
+
+	attempt := TimelineEvent{
+		Event:                eventAttempt,
+		Part:                 job.part,
+		WorkerID:             &workerID,
+		Provider:             job.provider,
+		ProviderResponseCode: responseCode,
+		DurationMs:           result.duration.Milliseconds(),
+	}
+	if result.err != nil {
+		attempt.Error = result.err.Error()
+	}
+	notifications.record(job.notificationID, attempt)
+
+	return result
+}
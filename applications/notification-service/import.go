@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	service "github.com/faidon-laboratory/go-service"
+	"notification-service/models"
+)
+
+// Notification history import
+//
+// POST /admin/import takes NDJSON, one historical notification record per
+// line in the shape GET /notifications/{id}/timeline and the storage backend
+// use, e.g. to seed a demo with realistic history or to move records saved
+// from a memory-backed instance into a bbolt-backed one:
+//
+//	{"user_id": "42", "channel": "email", "status": "sent", "message": "Hi",
+//	 "created_at": "2026-01-05T09:00:00Z", "updated_at": "2026-01-05T09:00:02Z"}
+//
+// The body is read line by line, never whole. Each record is validated on
+// its own: it needs a user, a channel, a final status (sent, failed or
+// cancelled; nothing is delivered) and a creation time not after its update
+// time or now. Valid records get new IDs, in the order given, and are stored
+// IMPORT_BATCH_SIZE at a time, each batch in one storage transaction, so live
+// sends interleave with a large import. A record without a timeline gets one
+// made of its creation and final status, and one without parts counts one.
+// Records take their place among the stored ones by creation time, so lists
+// show them at their age, and past NOTIFICATION_RETENTION the oldest records
+// are evicted as usual, imported ones included.
+//
+// Progress is logged every IMPORT_PROGRESS_LINES lines. The response is a
+// summary: lines read, records imported, rejected and evicted, the ID range
+// assigned and the first IMPORT_MAX_ERRORS rejections with their line
+// numbers. ?dry_run=true validates without storing anything.
+
+// importMaxLineBytes bounds one NDJSON line
+const importMaxLineBytes = 1 << 20
+
+var (
+	importBatchSize     = getEnvInt("IMPORT_BATCH_SIZE", 500)
+	importProgressLines = getEnvInt("IMPORT_PROGRESS_LINES", 10000)
+	importMaxErrors     = getEnvInt("IMPORT_MAX_ERRORS", 100)
+)
+
+// validateImported checks a historical record and fills in its timeline
+func validateImported(n *Notification, now time.Time) error {
+	switch {
+	case n.UserID == "":
+		return errors.New("user_id is required")
+	case n.Channel == "":
+		return errors.New("channel is required")
+	case n.CreatedAt.IsZero():
+		return errors.New("created_at is required")
+	}
+	switch n.Status {
+	case statusSent, statusFailed, statusCancelled:
+	default:
+		return fmt.Errorf("status %q is not final, expected sent, failed or cancelled", n.Status)
+	}
+	if n.UpdatedAt.IsZero() {
+		n.UpdatedAt = n.CreatedAt
+	}
+	if n.UpdatedAt.Before(n.CreatedAt) {
+		return errors.New("updated_at is before created_at")
+	}
+	if n.UpdatedAt.After(now) {
+		return errors.New("updated_at is in the future")
+	}
+	if n.ReadAt != nil && n.ReadAt.Before(n.CreatedAt) {
+		return errors.New("read_at is before created_at")
+	}
+
+	n.CreatedAt = n.CreatedAt.UTC()
+	n.UpdatedAt = n.UpdatedAt.UTC()
+	if n.Parts == 0 {
+		n.Parts = 1
+	}
+	if len(n.Timeline) == 0 {
+		n.Timeline = []TimelineEvent{
+			{Timestamp: n.CreatedAt, Event: statusReceived},
+			{Timestamp: n.UpdatedAt, Event: n.Status, Provider: n.Provider, DurationMs: n.UpdatedAt.Sub(n.CreatedAt).Milliseconds()},
+		}
+	}
+	return nil
+}
+
+// importBatch adds validated records with new IDs and returns the first and
+// last ID assigned and how many records were evicted to make room
+func (s *notificationStore) importBatch(batch []Notification) (firstID, lastID string, evicted int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]storedRecord, len(batch))
+	for i := range batch {
+		s.nextID++
+		n := batch[i]
+		n.ID = fmt.Sprintf("notif_%d", s.nextID)
+		s.items[n.ID] = &n
+		s.order = s.insertByCreation(s.order, &n)
+		s.project(&n)
+		records[i] = storedRecord{bucket: bucketNotifications, key: n.ID, record: n}
+	}
+	persistAll(records...)
+	for len(s.order) > s.limit {
+		s.evictOldest()
+		evicted++
+	}
+	return records[0].key, records[len(records)-1].key, evicted
+}
+
+// Notification history import endpoint
+func adminImportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "admin_import")
+	defer endSpan()
+
+	start := time.Now()
+	logger.AddSpanAttribute(ctx, "admin.identity", service.AdminIdentity(ctx))
+
+	summary := models.ImportSummary{DryRun: r.URL.Query().Get("dry_run") == "true", Errors: []models.ImportError{}}
+	reject := func(line int, err error) {
+		summary.Rejected++
+		if len(summary.Errors) < importMaxErrors {
+			summary.Errors = append(summary.Errors, models.ImportError{Line: line, Error: err.Error()})
+		}
+	}
+
+	var batch []Notification
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if !summary.DryRun {
+			first, last, evicted := notifications.importBatch(batch)
+			if summary.FirstID == "" {
+				summary.FirstID = first
+			}
+			summary.LastID = last
+			summary.Evicted += evicted
+		}
+		summary.Imported += len(batch)
+		batch = batch[:0]
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), importMaxLineBytes)
+	now := clock.Now().UTC()
+	for scanner.Scan() {
+		summary.Lines++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) > 0 {
+			var n Notification
+			decoder := json.NewDecoder(bytes.NewReader(line))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&n); err != nil {
+				reject(summary.Lines, fmt.Errorf("invalid JSON: %w", err))
+			} else if err := validateImported(&n, now); err != nil {
+				reject(summary.Lines, err)
+			} else {
+				batch = append(batch, n)
+				if len(batch) >= importBatchSize {
+					flush()
+				}
+			}
+		}
+
+		if importProgressLines > 0 && summary.Lines%importProgressLines == 0 {
+			logger.Info(ctx, "Import progress", map[string]interface{}{
+				"lines":    summary.Lines,
+				"imported": summary.Imported + len(batch),
+				"rejected": summary.Rejected,
+			})
+		}
+	}
+	// Keep what was read before a broken line
+	flush()
+
+	status := http.StatusOK
+	body := models.ImportResponse{OK: true, Summary: summary}
+	if err := scanner.Err(); err != nil {
+		status = http.StatusBadRequest
+		if errors.Is(err, bufio.ErrTooLong) {
+			err = fmt.Errorf("line %d is longer than %d bytes", summary.Lines+1, importMaxLineBytes)
+		}
+		body = models.ImportResponse{OK: false, Error: err.Error(), Summary: summary}
+		logger.Warn(ctx, "Import stopped early", map[string]interface{}{
+			"lines": summary.Lines,
+			"error": err.Error(),
+		})
+	}
+
+	logger.Info(ctx, "Imported notification history", map[string]interface{}{
+		"lines":       summary.Lines,
+		"imported":    summary.Imported,
+		"rejected":    summary.Rejected,
+		"evicted":     summary.Evicted,
+		"dry_run":     summary.DryRun,
+		"first_id":    summary.FirstID,
+		"last_id":     summary.LastID,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+
+	writeJSON(w, status, body)
+	logger.CountRequest(ctx, "/admin/import", status)
+	logger.RecordDuration(ctx, "/admin/import", time.Since(start))
+}
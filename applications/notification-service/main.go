@@ -3,15 +3,21 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/faidon-laboratory/go-logging"
+	"github.com/faidon-laboratory/go-service"
 	"github.com/gorilla/mux"
+	"notification-service/models"
 )
 
 // Configuration from environment variables
@@ -21,6 +27,7 @@ var (
 	greeting   string
 	startTime  time.Time
 	logger     *logging.Logger
+	background *service.Group
 )
 
 func init() {
@@ -28,7 +35,7 @@ func init() {
 	failRate = getEnvFloat("FAIL_RATE", 0.02)
 	readyDelay = getEnvInt("READINESS_DELAY_SEC", 10)
 	greeting = getEnvString("GREETING", "hello")
-	startTime = time.Now()
+	startTime = clock.Now()
 
 	// Seed random number generator
 	rand.Seed(time.Now().UnixNano())
@@ -39,81 +46,85 @@ func init() {
 		Version:     getEnvString("SERVICE_VERSION", "1.0.0"),
 		Environment: getEnvString("ENVIRONMENT", "development"),
 		AlloyURL:    getEnvString("ALLOY_URL", "grafana-alloy.monitoring.svc.cluster.local:4318"),
+		Protocol:    getEnvString("ALLOY_PROTOCOL", "http"),
+
+		TLS:           getEnvString("ALLOY_TLS", "false") == "true",
+		TLSCACert:     getEnvString("ALLOY_CA_CERT", ""),
+		TLSClientCert: getEnvString("ALLOY_CLIENT_CERT", ""),
+		TLSClientKey:  getEnvString("ALLOY_CLIENT_KEY", ""),
+		Headers:       logging.ParseHeaders(getEnvString("ALLOY_HEADERS", "")),
+
+		LogLevel:           getEnvString("LOG_LEVEL", "debug"),
+		Format:             getEnvString("LOG_FORMAT", logging.FormatJSON),
+		Caller:             getEnvString("LOG_CALLER", "false") == "true",
+		StackTraces:        getEnvString("LOG_STACK_TRACES", "false") == "true",
+		TraceSampleRatio:   getEnvFloat("TRACE_SAMPLE_RATIO", 1),
+		FlushTimeout:       time.Duration(getEnvInt("TELEMETRY_FLUSH_TIMEOUT_SEC", 5)) * time.Second,
+		ExportInterval:     time.Duration(getEnvInt("METRICS_EXPORT_INTERVAL_SEC", 60)) * time.Second,
+		Propagators:        strings.Split(getEnvString("TRACE_PROPAGATORS", "tracecontext,baggage"), ","),
+		Exemplars:          getEnvString("METRICS_EXEMPLARS", "trace_based"),
+		RuntimeMetrics:     getEnvString("RUNTIME_METRICS", "true") == "true",
+		PrometheusExporter: prometheusEnabled(),
+		LogExport:          getEnvString("OTLP_LOGS", "false") == "true",
+		Sinks:              logging.ParseSinks(getEnvString("LOG_SINKS", "")),
+
+		AsyncLogBuffer: getEnvInt("ASYNC_LOG_BUFFER", 0),
+		LogSampling: &logging.LogSampling{
+			Initial:    getEnvInt("LOG_SAMPLING_INITIAL", 0),
+			Thereafter: getEnvInt("LOG_SAMPLING_THEREAFTER", 100),
+		},
+		DedupWindow: time.Duration(getEnvInt("LOG_DEDUP_WINDOW_SEC", 0)) * time.Second,
+		Batching: logging.Batching{
+			MaxQueueSize:       getEnvInt("TELEMETRY_MAX_QUEUE_SIZE", 0),
+			MaxExportBatchSize: getEnvInt("TELEMETRY_MAX_BATCH_SIZE", 0),
+			BatchTimeout:       time.Duration(getEnvInt("TELEMETRY_BATCH_TIMEOUT_MS", 0)) * time.Millisecond,
+			ExportTimeout:      time.Duration(getEnvInt("TELEMETRY_EXPORT_TIMEOUT_SEC", 0)) * time.Second,
+		},
+		Routes: logging.QuietRoutes(getEnvFloat("QUIET_ROUTES_TRACE_RATIO", 0), strings.Split(getEnvString("QUIET_ROUTES", ""), ",")...),
+		ExportRetry: logging.ExportRetry{
+			InitialInterval: time.Duration(getEnvInt("TELEMETRY_RETRY_INITIAL_MS", 0)) * time.Millisecond,
+			MaxInterval:     time.Duration(getEnvInt("TELEMETRY_RETRY_MAX_INTERVAL_SEC", 0)) * time.Second,
+			MaxElapsedTime:  time.Duration(getEnvInt("TELEMETRY_RETRY_MAX_ELAPSED_SEC", 0)) * time.Second,
+			BufferSize:      getEnvInt("TELEMETRY_EXPORT_BUFFER", 0),
+		},
 	})
+
+	// Background goroutines (delivery workers)
+	background = service.NewGroup(logger)
 }
 
-// Helper functions for environment variables
+// Helper functions for environment variables (see config.go for profiles)
 func getEnvString(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
+	return config.String(key, defaultValue)
 }
 
 func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
-	}
-	return defaultValue
+	return config.Int(key, defaultValue)
 }
 
 func getEnvFloat(key string, defaultValue float64) float64 {
-	if value := os.Getenv(key); value != "" {
-		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
-			return floatValue
-		}
-	}
-	return defaultValue
+	return config.Float(key, defaultValue)
 }
 
-// Health endpoint
-func healthzHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, endSpan := logger.StartSpan(r.Context(), "healthz")
-	defer endSpan()
-
-	start := time.Now()
-
+// Health probe, served through probeCache (see probes.go)
+func checkHealthz(ctx context.Context) (int, string) {
 	logger.Info(ctx, "Health check requested")
-
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("ok"))
-
-	// Record metrics
-	logger.CountRequest(ctx, "/healthz", 200)
-	logger.RecordDuration(ctx, "/healthz", time.Since(start))
+	return http.StatusOK, "ok"
 }
 
-// Readiness endpoint
-func readyzHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, endSpan := logger.StartSpan(r.Context(), "readyz")
-	defer endSpan()
-
-	start := time.Now()
-
-	elapsed := time.Since(startTime)
+// Readiness probe, served through probeCache (see probes.go)
+func checkReadyz(ctx context.Context) (int, string) {
+	elapsed := clock.Now().Sub(startTime)
 	if elapsed < time.Duration(readyDelay)*time.Second {
 		logger.Warn(ctx, "Service not ready yet", map[string]interface{}{
 			"elapsed_seconds":     elapsed.Seconds(),
 			"ready_delay_seconds": readyDelay,
 		})
-
-		w.WriteHeader(http.StatusServiceUnavailable)
-		w.Write([]byte("not ready"))
-
-		logger.CountRequest(ctx, "/readyz", 503)
-		logger.RecordDuration(ctx, "/readyz", time.Since(start))
-		return
+		return http.StatusServiceUnavailable, "not ready"
 	}
 
 	logger.Info(ctx, "Service is ready")
-
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("ready"))
-
-	logger.CountRequest(ctx, "/readyz", 200)
-	logger.RecordDuration(ctx, "/readyz", time.Since(start))
+	return http.StatusOK, "ready"
 }
 
 // Send notification endpoint
@@ -124,89 +135,245 @@ func sendNotificationHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
 	// Parse request body
-	var req struct {
-		UserID   string `json:"user_id"`
-		Message  string `json:"message"`
-		Channel  string `json:"channel"`
-		Priority string `json:"priority"`
-	}
-
+	var req models.SendRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		logger.Error(ctx, "Failed to parse notification request", err, map[string]interface{}{
 			"method":   r.Method,
 			"endpoint": "/notifications/send",
 		})
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    false,
-			"error": "Invalid request body",
-		})
+		writeError(w, http.StatusBadRequest, "Invalid request body")
 
 		logger.CountRequest(ctx, "/notifications/send", 400)
 		logger.RecordDuration(ctx, "/notifications/send", time.Since(start))
 		return
 	}
 
+	// Render the message from a stored template when one is referenced
+	if req.TemplateID != "" {
+		message, err := renderPublishedTemplate(req.TemplateID, req.Variables)
+		if err != nil {
+			logger.Warn(ctx, "Failed to render notification template", map[string]interface{}{
+				"user_id":     req.UserID,
+				"template_id": req.TemplateID,
+				"error":       err.Error(),
+			})
+
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+
+			logger.CountRequest(ctx, "/notifications/send", 422)
+			logger.RecordDuration(ctx, "/notifications/send", time.Since(start))
+			return
+		}
+		req.Message = message
+	}
+
+	// Apply the channel's size limit before anything is queued
+	parts, err := applySizeLimit(req.Channel, req.Message)
+	if err != nil {
+		logger.Warn(ctx, "Rejected oversized notification", map[string]interface{}{
+			"user_id": req.UserID,
+			"channel": req.Channel,
+			"error":   err.Error(),
+		})
+
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+
+		recordDelivery(ctx, r.Header.Get(tenantHeader), req.Channel, "none", req.Priority, "too_large", time.Since(start))
+		logger.CountRequest(ctx, "/notifications/send", 413)
+		logger.RecordDuration(ctx, "/notifications/send", time.Since(start))
+		return
+	}
+
+	// Pick the tenant's own provider for this channel, if configured
+	tenantID := r.Header.Get(tenantHeader)
+	provider, _, err := tenants.resolve(tenantID, req.Channel)
+	if err != nil {
+		logger.Error(ctx, "Failed to resolve tenant provider", err, map[string]interface{}{
+			"tenant_id": tenantID,
+			"channel":   req.Channel,
+		})
+
+		writeError(w, http.StatusInternalServerError, "Failed to load tenant channel configuration")
+
+		recordDelivery(ctx, tenantID, req.Channel, "unknown", req.Priority, "error", time.Since(start))
+		logger.CountRequest(ctx, "/notifications/send", 500)
+		logger.RecordDuration(ctx, "/notifications/send", time.Since(start))
+		return
+	}
+
+	notificationID := notifications.create(Notification{
+		UserID:   req.UserID,
+		TenantID: tenantID,
+		Channel:  req.Channel,
+		Priority: req.Priority,
+		Provider: provider,
+		Message:  req.Message,
+		Parts:    len(parts),
+	}, parts)
+
 	logger.Info(ctx, "Processing notification request", map[string]interface{}{
-		"user_id":  req.UserID,
-		"channel":  req.Channel,
-		"priority": req.Priority,
+		"notification_id": notificationID,
+		"user_id":         req.UserID,
+		"channel":         req.Channel,
+		"priority":        req.Priority,
+		"template_id":     req.TemplateID,
+		"tenant_id":       tenantID,
+		"provider":        provider,
+		"parts":           len(parts),
 	})
 
-	// Simulate notification processing
-	processingDuration := time.Duration(100+rand.Intn(200)) * time.Millisecond
-	time.Sleep(processingDuration)
+	// Hand every part to the delivery workers and wait for the outcome
+	jobs := make([]*deliveryJob, 0, len(parts))
+	for i, part := range parts {
+		job := &deliveryJob{
+			ctx:            ctx,
+			notificationID: notificationID,
+			userID:         req.UserID,
+			tenantID:       tenantID,
+			channel:        req.Channel,
+			priority:       req.Priority,
+			provider:       provider,
+			message:        part,
+			enqueuedAt:     time.Now(),
+			result:         make(chan deliveryResult, 1),
+		}
+		job.part = partNumber(i, len(parts))
+		if enqueueDelivery(job) {
+			jobs = append(jobs, job)
+			continue
+		}
+
+		// The rejected notification won't be retried from the outbox; parts
+		// already queued are cancelled with the request
+		for j := i; j < len(parts); j++ {
+			outbox.complete(notificationID, partNumber(j, len(parts)))
+		}
+
+		logger.Warn(ctx, "Delivery queue full, rejecting notification", map[string]interface{}{
+			"user_id":      req.UserID,
+			"channel":      req.Channel,
+			"provider":     provider,
+			"queue_size":   cap(deliveryQueue),
+			"parts_queued": len(jobs),
+		})
+		notifications.record(notificationID, TimelineEvent{
+			Event: statusFailed,
+			Error: "delivery queue full",
+		})
+
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, "Delivery queue full")
+
+		recordDelivery(ctx, tenantID, req.Channel, provider, req.Priority, "rejected", time.Since(start))
+		logger.CountRequest(ctx, "/notifications/send", 503)
+		logger.RecordDuration(ctx, "/notifications/send", time.Since(start))
+		return
+	}
+
+	result := waitDeliveries(jobs)
+	processingDuration := result.duration
+
+	// The client disconnected; nobody is left to answer
+	if ctx.Err() != nil {
+		notifications.record(notificationID, TimelineEvent{
+			Event:      statusCancelled,
+			DurationMs: time.Since(start).Milliseconds(),
+			Error:      ctx.Err().Error(),
+		})
+		logger.Warn(ctx, "Notification send cancelled by client", map[string]interface{}{
+			"notification_id": notificationID,
+			"user_id":         req.UserID,
+			"channel":         req.Channel,
+		})
+
+		recordDelivery(ctx, tenantID, req.Channel, provider, req.Priority, "cancelled", processingDuration)
+		logger.CountRequest(ctx, "/notifications/send", 499)
+		logger.RecordDuration(ctx, "/notifications/send", time.Since(start))
+		return
+	}
+
+	if result.err != nil {
+		notifications.record(notificationID, TimelineEvent{
+			Event:      statusFailed,
+			DurationMs: time.Since(start).Milliseconds(),
+			Error:      result.err.Error(),
+		})
 
-	// Simulate failure
-	if rand.Float64() < failRate {
 		logger.Error(ctx, "Notification sending failed",
-			fmt.Errorf("simulated notification failure"),
+			result.err,
 			map[string]interface{}{
+				"notification_id":        notificationID,
 				"user_id":                req.UserID,
 				"channel":                req.Channel,
 				"priority":               req.Priority,
+				"tenant_id":              tenantID,
+				"provider":               provider,
 				"processing_duration_ms": processingDuration.Milliseconds(),
+				"throttle_wait_ms":       result.throttleWait.Milliseconds(),
 			})
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    false,
-			"error": "Failed to send notification",
-		})
+		writeError(w, http.StatusInternalServerError, "Failed to send notification")
 
+		recordDelivery(ctx, tenantID, req.Channel, provider, req.Priority, "failed", processingDuration)
 		logger.CountRequest(ctx, "/notifications/send", 500)
 		logger.RecordDuration(ctx, "/notifications/send", time.Since(start))
 		return
 	}
 
+	notifications.record(notificationID, TimelineEvent{
+		Event:      statusSent,
+		DurationMs: time.Since(start).Milliseconds(),
+	})
+
 	// Log the success
 	logger.Info(ctx, "Notification sent successfully", map[string]interface{}{
+		"notification_id":        notificationID,
 		"user_id":                req.UserID,
 		"channel":                req.Channel,
 		"priority":               req.Priority,
+		"tenant_id":              tenantID,
+		"provider":               provider,
 		"processing_duration_ms": processingDuration.Milliseconds(),
+		"throttle_wait_ms":       result.throttleWait.Milliseconds(),
+		"parts":                  len(parts),
 		"message_preview":        truncateString(req.Message, 50),
 	})
+	recordDelivery(ctx, tenantID, req.Channel, provider, req.Priority, "sent", processingDuration)
 
 	// Success response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"ok":       true,
-		"message":  "Notification sent successfully",
-		"user_id":  req.UserID,
-		"channel":  req.Channel,
-		"priority": req.Priority,
-		"sent_at":  time.Now().UTC().Format(time.RFC3339),
+	writeJSON(w, http.StatusOK, models.SendResponse{
+		OK:       true,
+		ID:       notificationID,
+		Message:  "Notification sent successfully",
+		UserID:   req.UserID,
+		Channel:  req.Channel,
+		Priority: req.Priority,
+		Parts:    len(parts),
+		SentAt:   responseTime(time.Now()),
 	})
 
 	logger.CountRequest(ctx, "/notifications/send", 200)
 	logger.RecordDuration(ctx, "/notifications/send", time.Since(start))
 }
 
+// Helper function to write a JSON response
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Helper function to write an error response
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, models.Error{OK: false, Error: message})
+}
+
+// responseTime is a timestamp of a response: UTC, to the second
+func responseTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
 // Helper function to truncate string
 func truncateString(s string, maxLen int) string {
 	if len(s) <= maxLen {
@@ -215,7 +382,7 @@ func truncateString(s string, maxLen int) string {
 	return s[:maxLen] + "..."
 }
 
-// Get notifications - throughput SLI endpoint
+// Get notifications
 func getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, endSpan := logger.StartSpan(r.Context(), "get_notifications")
 	defer endSpan()
@@ -231,19 +398,14 @@ func getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
 	time.Sleep(processingDuration)
 
 	// Simulate failure
-	if rand.Float64() < failRate {
+	if rand.Float64() < currentFailRate() {
 		logger.Error(ctx, "Failed to retrieve notifications",
 			fmt.Errorf("simulated notification retrieval failure"),
 			map[string]interface{}{
 				"processing_duration_ms": processingDuration.Milliseconds(),
 			})
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    false,
-			"error": "Failed to retrieve notifications",
-		})
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve notifications")
 
 		logger.CountRequest(ctx, "/notifications", 500)
 		logger.RecordDuration(ctx, "/notifications", time.Since(start))
@@ -251,33 +413,33 @@ func getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Simulate notification data
-	notifications := []map[string]interface{}{
+	notifications := []models.NotificationSummary{
 		{
-			"id":       fmt.Sprintf("notif_%d", rand.Intn(1000)),
-			"user_id":  fmt.Sprintf("user_%d", rand.Intn(100)),
-			"message":  "Welcome to our service!",
-			"channel":  "email",
-			"priority": "normal",
-			"status":   "sent",
-			"sent_at":  time.Now().Add(-time.Duration(rand.Intn(3600)) * time.Second).UTC().Format(time.RFC3339),
+			ID:       fmt.Sprintf("notif_%d", rand.Intn(1000)),
+			UserID:   fmt.Sprintf("user_%d", rand.Intn(100)),
+			Message:  "Welcome to our service!",
+			Channel:  "email",
+			Priority: "normal",
+			Status:   "sent",
+			SentAt:   responseTime(time.Now().Add(-time.Duration(rand.Intn(3600)) * time.Second)),
 		},
 		{
-			"id":       fmt.Sprintf("notif_%d", rand.Intn(1000)),
-			"user_id":  fmt.Sprintf("user_%d", rand.Intn(100)),
-			"message":  "Your order has been processed",
-			"channel":  "sms",
-			"priority": "high",
-			"status":   "delivered",
-			"sent_at":  time.Now().Add(-time.Duration(rand.Intn(3600)) * time.Second).UTC().Format(time.RFC3339),
+			ID:       fmt.Sprintf("notif_%d", rand.Intn(1000)),
+			UserID:   fmt.Sprintf("user_%d", rand.Intn(100)),
+			Message:  "Your order has been processed",
+			Channel:  "sms",
+			Priority: "high",
+			Status:   "delivered",
+			SentAt:   responseTime(time.Now().Add(-time.Duration(rand.Intn(3600)) * time.Second)),
 		},
 		{
-			"id":       fmt.Sprintf("notif_%d", rand.Intn(1000)),
-			"user_id":  fmt.Sprintf("user_%d", rand.Intn(100)),
-			"message":  "Weekly digest available",
-			"channel":  "push",
-			"priority": "low",
-			"status":   "pending",
-			"sent_at":  time.Now().Add(-time.Duration(rand.Intn(3600)) * time.Second).UTC().Format(time.RFC3339),
+			ID:       fmt.Sprintf("notif_%d", rand.Intn(1000)),
+			UserID:   fmt.Sprintf("user_%d", rand.Intn(100)),
+			Message:  "Weekly digest available",
+			Channel:  "push",
+			Priority: "low",
+			Status:   "pending",
+			SentAt:   responseTime(time.Now().Add(-time.Duration(rand.Intn(3600)) * time.Second)),
 		},
 	}
 
@@ -287,20 +449,18 @@ func getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
 		"processing_ms": processingDuration.Milliseconds(),
 	})
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"ok":            true,
-		"notifications": notifications,
-		"total_count":   len(notifications),
-		"retrieved_at":  time.Now().UTC().Format(time.RFC3339),
+	writeJSON(w, http.StatusOK, models.NotificationList{
+		OK:            true,
+		Notifications: notifications,
+		TotalCount:    len(notifications),
+		RetrievedAt:   responseTime(time.Now()),
 	})
 
 	logger.CountRequest(ctx, "/notifications", 200)
 	logger.RecordDuration(ctx, "/notifications", time.Since(start))
 }
 
-// Get notification status - availability SLI endpoint
+// Get notification status
 func getNotificationStatusHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, endSpan := logger.StartSpan(r.Context(), "get_notification_status")
 	defer endSpan()
@@ -316,19 +476,14 @@ func getNotificationStatusHandler(w http.ResponseWriter, r *http.Request) {
 	time.Sleep(processingDuration)
 
 	// Simulate failure
-	if rand.Float64() < failRate {
+	if rand.Float64() < currentFailRate() {
 		logger.Error(ctx, "Failed to get notification status",
 			fmt.Errorf("simulated status check failure"),
 			map[string]interface{}{
 				"processing_duration_ms": processingDuration.Milliseconds(),
 			})
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    false,
-			"error": "Failed to get notification status",
-		})
+		writeError(w, http.StatusInternalServerError, "Failed to get notification status")
 
 		logger.CountRequest(ctx, "/notifications/status", 500)
 		logger.RecordDuration(ctx, "/notifications/status", time.Since(start))
@@ -336,56 +491,178 @@ func getNotificationStatusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Simulate status data
-	status := map[string]interface{}{
-		"service_status": "healthy",
-		"queue_size":     rand.Intn(100),
-		"pending_count":  rand.Intn(50),
-		"sent_today":     rand.Intn(1000),
-		"failed_today":   rand.Intn(10),
-		"uptime_seconds": time.Since(startTime).Seconds(),
-		"last_updated":   time.Now().UTC().Format(time.RFC3339),
+	status := models.ServiceStatus{
+		ServiceStatus: "healthy",
+		QueueSize:     rand.Intn(100),
+		PendingCount:  rand.Intn(50),
+		SentToday:     rand.Intn(1000),
+		FailedToday:   rand.Intn(10),
+		UptimeSeconds: clock.Now().Sub(startTime).Seconds(),
+		LastUpdated:   responseTime(time.Now()),
 	}
 
 	logger.Info(ctx, "Notification status retrieved successfully", map[string]interface{}{
 		"duration_ms":   time.Since(start).Milliseconds(),
 		"processing_ms": processingDuration.Milliseconds(),
-		"queue_size":    status["queue_size"],
-		"pending_count": status["pending_count"],
+		"queue_size":    status.QueueSize,
+		"pending_count": status.PendingCount,
 	})
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"ok":     true,
-		"status": status,
+	writeJSON(w, http.StatusOK, models.StatusResponse{
+		OK:     true,
+		Status: status,
 	})
 
 	logger.CountRequest(ctx, "/notifications/status", 200)
 	logger.RecordDuration(ctx, "/notifications/status", time.Since(start))
 }
 
+// traceContextMiddleware continues the caller's trace (TRACE_PROPAGATORS) in
+// the spans the handlers start
+func traceContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(logger.Extract(r)))
+	})
+}
+
 func main() {
+	flag.Parse()
 	port := getEnvString("PORT", "8000")
 
 	// Create router
 	r := mux.NewRouter()
+	r.NotFoundHandler = unmatchedHandler(http.StatusNotFound)
+	r.MethodNotAllowedHandler = unmatchedHandler(http.StatusMethodNotAllowed)
+	r.Use(traceContextMiddleware)
+	// A panicking handler answers 500 and is logged with its stack
+	r.Use(logger.RecoverMiddleware())
+	r.Use(signatureMiddleware)
 
 	// Add routes
-	r.HandleFunc("/healthz", healthzHandler).Methods("GET")
-	r.HandleFunc("/readyz", readyzHandler).Methods("GET")
+	r.Handle("/healthz", newProbeCache("/healthz", probeCacheTTL, checkHealthz)).Methods("GET")
+	r.Handle("/readyz", newProbeCache("/readyz", probeCacheTTL, checkReadyz)).Methods("GET")
+	r.HandleFunc("/openapi.json", openAPIHandler).Methods("GET")
 	r.HandleFunc("/notifications/send", sendNotificationHandler).Methods("POST")
-	r.HandleFunc("/notifications", getNotificationsHandler).Methods("GET")
-	r.HandleFunc("/notifications/status", getNotificationStatusHandler).Methods("GET")
+	// The handlers instrument themselves; SLIMiddleware only adds
+	// sli_requests_total
+	r.Handle("/notifications", logger.SLIMiddleware("/notifications", logging.Throughput())(http.HandlerFunc(getNotificationsHandler))).Methods("GET")
+	r.Handle("/notifications/status", logger.SLIMiddleware("/notifications/status", logging.Availability())(http.HandlerFunc(getNotificationStatusHandler))).Methods("GET")
+	r.HandleFunc("/notifications/{id}/timeline", getNotificationTimelineHandler).Methods("GET")
+	r.HandleFunc("/notifications/{id}/read", markNotificationReadHandler).Methods("POST")
+	r.HandleFunc("/templates", createTemplateHandler).Methods("POST")
+	r.HandleFunc("/templates", listTemplatesHandler).Methods("GET")
+	r.HandleFunc("/templates/{id}", getTemplateHandler).Methods("GET")
+	r.HandleFunc("/templates/{id}", updateTemplateHandler).Methods("PUT")
+	r.HandleFunc("/users/{id}/notifications", listUserNotificationsHandler).Methods("GET")
+	r.HandleFunc("/users/{id}/devices", registerDeviceHandler).Methods("POST")
+	r.HandleFunc("/users/{id}/devices", listDevicesHandler).Methods("GET")
+	r.HandleFunc("/users/{id}/devices/{token}", unregisterDeviceHandler).Methods("DELETE")
+	r.HandleFunc("/tenants/{tenant}/channels", listTenantChannelsHandler).Methods("GET")
+	r.HandleFunc("/tenants/{tenant}/channels/{channel}", putTenantChannelHandler).Methods("PUT")
+	r.HandleFunc("/tenants/{tenant}/channels/{channel}", deleteTenantChannelHandler).Methods("DELETE")
+	if metricsHandler := logger.MetricsHandler(); metricsHandler != nil {
+		r.Handle("/metrics", metricsHandler).Methods("GET")
+	}
+
+	// Admin routes, on the public port unless the admin listener owns them
+	adminServer, err := newAdminServer()
+	if err != nil {
+		logger.Error(context.Background(), "Invalid admin listener configuration", err)
+		// Write out lines held by ASYNC_LOG_BUFFER
+		logger.ForceFlush(context.Background())
+		os.Exit(1)
+	}
+	if adminServer == nil || !adminConfig.ListenerOnly {
+		registerAdminRoutes(r)
+	}
+
+	// Reload notifications and devices kept by the storage backend
+	if err := openStorage(); err != nil {
+		logger.Error(context.Background(), "Failed to open storage", err)
+		logger.ForceFlush(context.Background())
+		os.Exit(1)
+	}
+
+	// --selftest checks the wiring and exits instead of serving
+	if *selfTestMode {
+		os.Exit(runSelfTest(notificationSelfTestChecks()))
+	}
+
+	// Log level, sampling and export interval follow TELEMETRY_CONFIG_FILE
+	if path := getEnvString("TELEMETRY_CONFIG_FILE", ""); path != "" {
+		background.Supervise("telemetry_config", func(ctx context.Context) error {
+			return logger.WatchConfig(ctx, path)
+		})
+	}
+
+	// Soak tests record heap, goroutines and open files over the run
+	if interval := getEnvInt("SOAK_DIAGNOSTICS_INTERVAL_SEC", 0); interval > 0 {
+		diagnostics := logging.SoakDiagnostics{
+			Interval:            time.Duration(interval) * time.Second,
+			HeapGrowthThreshold: uint64(getEnvInt("SOAK_HEAP_GROWTH_MB", 0)) << 20,
+			ProfileDir:          getEnvString("SOAK_PROFILE_DIR", ""),
+		}
+		background.Supervise("soak_diagnostics", func(ctx context.Context) error {
+			return logger.RunSoakDiagnostics(ctx, diagnostics)
+		})
+	}
+
+	// Start delivery workers
+	deliveryWorkers := getEnvInt("DELIVERY_WORKERS", 32)
+	startDeliveryWorkers(deliveryWorkers)
+	startOutboxRelay()
 
 	// Start server
 	logger.Info(context.Background(), "Notification service started successfully", map[string]interface{}{
-		"port":            port,
-		"fail_rate":       failRate,
-		"ready_delay_sec": readyDelay,
-		"service_type":    "notification",
+		"port":             port,
+		"delivery_workers": deliveryWorkers,
+		"fail_rate":        failRate,
+		"channel_profiles": profilesSummary(),
+		"ready_delay_sec":  readyDelay,
+		"request_signing":  len(signingKeys) > 0,
+		"storage_backend":  getEnvString("STORAGE_BACKEND", storageMemory),
+		"service_type":     "notification",
 	})
 
-	if err := http.ListenAndServe(":"+port, r); err != nil {
-		logger.Error(context.Background(), "Server failed to start", err)
+	server := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error(context.Background(), "Server failed to start", err)
+			logger.ForceFlush(context.Background())
+			os.Exit(1)
+		}
+	}()
+	if adminServer != nil {
+		go serveAdmin(adminServer)
+	}
+
+	// Open sends wait for their deliveries, so the workers are stopped only
+	// once the server has drained
+	stop, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	<-stop.Done()
+
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), time.Duration(getEnvInt("SHUTDOWN_TIMEOUT_SEC", 20))*time.Second)
+	defer cancelShutdown()
+
+	logger.Info(ctx, "Notification service shutting down")
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error(ctx, "HTTP server shutdown failed", err)
+	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			logger.Error(ctx, "Admin server shutdown failed", err)
+		}
+	}
+	if err := background.Shutdown(ctx); err != nil {
+		logger.Error(ctx, "Background goroutines did not stop", err)
+	}
+	if err := closeStorage(); err != nil {
+		logger.Error(ctx, "Storage close failed", err)
+	}
+
+	// Export the last spans and metrics, with their own timeout
+	if err := logger.Shutdown(context.Background()); err != nil {
+		logger.Error(ctx, "Telemetry flush failed", err)
 	}
 }
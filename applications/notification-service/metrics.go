@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/faidon-laboratory/go-logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Delivery metrics
+//
+// The shared logger only provides the generic HTTP request metrics, so the
+// delivery-specific instruments are created on the global meter provider that
+// the logger registers. The queue depth and in-flight deliveries are gauges
+// registered with the logger.
+//
+// Label values come from request bodies and tenant configuration, so every
+// label goes through a cardinality guard: known values pass, and once a label
+// has seen its maximum number of distinct values, new ones are reported as
+// "other".
+
+const otherLabelValue = "other"
+
+// labelGuard bounds the number of distinct values a metric label can take
+type labelGuard struct {
+	mu        sync.Mutex
+	allowed   map[string]bool
+	seen      map[string]bool
+	maxValues int
+}
+
+// newLabelGuard creates a guard that always accepts the allowed values and at
+// most maxValues other distinct values
+func newLabelGuard(maxValues int, allowed ...string) *labelGuard {
+	g := &labelGuard{
+		allowed:   make(map[string]bool, len(allowed)),
+		seen:      make(map[string]bool),
+		maxValues: maxValues,
+	}
+	for _, value := range allowed {
+		g.allowed[value] = true
+	}
+	return g
+}
+
+// value returns the label value to record for v
+func (g *labelGuard) value(v string) string {
+	if v == "" {
+		return "none"
+	}
+	if g.allowed[v] {
+		return v
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.seen[v] {
+		return v
+	}
+	if len(g.seen) >= g.maxValues {
+		return otherLabelValue
+	}
+	g.seen[v] = true
+	return v
+}
+
+var (
+	deliveryCounter  metric.Int64Counter
+	deliveryDuration metric.Float64Histogram
+	throttleWait     metric.Float64Histogram
+	invalidPushToken metric.Int64Counter
+
+	channelLabel  = newLabelGuard(0, "email", "sms", "slack", channelPush)
+	priorityLabel = newLabelGuard(0, "low", "normal", "high", "urgent")
+	providerLabel *labelGuard
+	tenantLabel   *labelGuard
+)
+
+func init() {
+	providerLabel = newLabelGuard(getEnvInt("METRICS_MAX_PROVIDERS", 20), defaultProvider)
+	tenantLabel = newLabelGuard(getEnvInt("METRICS_MAX_TENANTS", 50))
+
+	meter := otel.Meter("notification-service")
+
+	var err error
+	deliveryCounter, err = meter.Int64Counter(
+		"notifications_sent_total",
+		metric.WithDescription("Notification sends by channel, provider, priority, tenant and outcome"),
+	)
+	if err != nil {
+		log.Printf("Failed to create notifications_sent_total counter: %v", err)
+	}
+
+	deliveryDuration, err = meter.Float64Histogram(
+		"notification_delivery_duration_seconds",
+		metric.WithDescription("Notification delivery duration in seconds by channel, provider, priority, tenant and outcome"),
+	)
+	if err != nil {
+		log.Printf("Failed to create notification_delivery_duration_seconds histogram: %v", err)
+	}
+
+	throttleWait, err = meter.Float64Histogram(
+		"provider_throttle_wait_seconds",
+		metric.WithDescription("Time deliveries waited for provider quota in seconds"),
+	)
+	if err != nil {
+		log.Printf("Failed to create provider_throttle_wait_seconds histogram: %v", err)
+	}
+
+	invalidPushToken, err = meter.Int64Counter(
+		"push_invalid_tokens_total",
+		metric.WithDescription("Push device tokens removed after provider feedback"),
+	)
+	if err != nil {
+		log.Printf("Failed to create push_invalid_tokens_total counter: %v", err)
+	}
+
+	// Read from the delivery pool whenever the logger's metrics are
+	// collected
+	logger.ObservableGauge("delivery_queue_depth", func(ctx context.Context, observe logging.Observer) {
+		observe(float64(len(deliveryQueue)))
+	})
+	logger.ObservableGauge("deliveries_in_flight", func(ctx context.Context, observe logging.Observer) {
+		observe(float64(deliveriesInFlight.Load()))
+	})
+}
+
+// recordDelivery records the outcome and duration of a single send
+func recordDelivery(ctx context.Context, tenantID, channel, provider, priority, outcome string, duration time.Duration) {
+	attrs := metric.WithAttributes(
+		attribute.String("tenant_id", tenantLabel.value(tenantID)),
+		attribute.String("channel", channelLabel.value(channel)),
+		attribute.String("provider", providerLabel.value(provider)),
+		attribute.String("priority", priorityLabel.value(priority)),
+		attribute.String("outcome", outcome),
+	)
+	if deliveryCounter != nil {
+		deliveryCounter.Add(ctx, 1, attrs)
+	}
+	if deliveryDuration != nil {
+		deliveryDuration.Record(ctx, duration.Seconds(), attrs)
+	}
+}
+
+// recordThrottleWait records how long a delivery waited for its provider's quota
+func recordThrottleWait(ctx context.Context, provider string, wait time.Duration) {
+	if throttleWait != nil {
+		throttleWait.Record(ctx, wait.Seconds(), metric.WithAttributes(
+			attribute.String("provider", providerLabel.value(provider)),
+		))
+	}
+}
+
+// recordInvalidPushToken counts a device token removed after provider feedback
+func recordInvalidPushToken(ctx context.Context, platform string) {
+	if invalidPushToken != nil {
+		invalidPushToken.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("platform", platform),
+		))
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	service "github.com/faidon-laboratory/go-service"
+	bolt "go.etcd.io/bbolt"
+	"notification-service/models"
+)
+
+// Storage migrations
+//
+// The layout of the bbolt file is changed by migrations embedded in the
+// binary (migrations/NNNN_name.json), applied in version order when the file
+// is opened at startup. Each one is a list of steps:
+//
+//	{"create_bucket": "outbox"}   creates a bucket unless it exists
+//
+// and is applied in one transaction together with its record in the
+// "migrations" bucket (version, name, applied_at), so a crash leaves it either
+// applied or not. bbolt.Open holds an exclusive lock on the file, so a second
+// replica pointed at the same file waits instead of migrating concurrently.
+// A file recording a version this binary doesn't know was migrated by a newer
+// release, and the service refuses to start on it.
+//
+// GET /admin/migrations lists the embedded migrations and which are applied.
+
+const bucketMigrations = "migrations"
+
+//go:embed migrations/*.json
+var migrationFiles embed.FS
+
+// migration is one embedded migration file
+type migration struct {
+	Version     int             `json:"version"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Steps       []migrationStep `json:"-"`
+}
+
+// migrationStep is one change made by a migration
+type migrationStep struct {
+	CreateBucket string `json:"create_bucket,omitempty"`
+}
+
+// appliedMigration is the record of a migration applied to the file
+type appliedMigration struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// applied holds the migrations recorded in the file after startup, nil with
+// STORAGE_BACKEND=memory
+var applied map[int]appliedMigration
+
+// loadMigrations parses the embedded migrations in version order
+func loadMigrations() ([]migration, error) {
+	// Glob returns the files sorted by name, which is version order
+	names, err := fs.Glob(migrationFiles, "migrations/*.json")
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]migration, 0, len(names))
+	for _, name := range names {
+		base := strings.TrimSuffix(path.Base(name), ".json")
+		prefix, label, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !found || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name.json", name)
+		}
+		if version != len(migrations)+1 {
+			return nil, fmt.Errorf("migration %s: expected version %d", name, len(migrations)+1)
+		}
+
+		data, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		var file struct {
+			Description string          `json:"description"`
+			Steps       []migrationStep `json:"steps"`
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("migration %s: %w", name, err)
+		}
+		for i, step := range file.Steps {
+			if step.CreateBucket == "" {
+				return nil, fmt.Errorf("migration %s: step %d has no operation", name, i+1)
+			}
+		}
+		migrations = append(migrations, migration{
+			Version:     version,
+			Name:        label,
+			Description: file.Description,
+			Steps:       file.Steps,
+		})
+	}
+	return migrations, nil
+}
+
+// migrate applies the migrations the file is missing and returns every
+// migration it has
+func (s *boltStorage) migrate(migrations []migration) (map[int]appliedMigration, error) {
+	done := make(map[int]appliedMigration)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucketMigrations))
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var record appliedMigration
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("migration record %s: %w", k, err)
+			}
+			done[record.Version] = record
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for version := range done {
+		if version > len(migrations) {
+			return nil, fmt.Errorf("file is at migration %d, newer than this release's %d", version, len(migrations))
+		}
+	}
+
+	for _, m := range migrations {
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+		start := time.Now()
+		record := appliedMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now().UTC()}
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			for _, step := range m.Steps {
+				if _, err := tx.CreateBucketIfNotExists([]byte(step.CreateBucket)); err != nil {
+					return err
+				}
+			}
+			value, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			return tx.Bucket([]byte(bucketMigrations)).Put([]byte(fmt.Sprintf("%04d", m.Version)), value)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("applying migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		done[m.Version] = record
+		logger.Info(context.Background(), "Applied storage migration", map[string]interface{}{
+			"migration":   m.Version,
+			"name":        m.Name,
+			"steps":       len(m.Steps),
+			"duration_ms": time.Since(start).Milliseconds(),
+		})
+	}
+	return done, nil
+}
+
+// Migration status endpoint
+func adminMigrationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "admin_migrations")
+	defer endSpan()
+
+	start := time.Now()
+	logger.AddSpanAttribute(ctx, "admin.identity", service.AdminIdentity(ctx))
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		logger.Error(ctx, "Failed to load storage migrations", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		logger.CountRequest(ctx, "/admin/migrations", 500)
+		logger.RecordDuration(ctx, "/admin/migrations", time.Since(start))
+		return
+	}
+
+	statuses := make([]models.MigrationStatus, len(migrations))
+	current := 0
+	for i, m := range migrations {
+		statuses[i] = models.MigrationStatus{
+			Version:     m.Version,
+			Name:        m.Name,
+			Description: m.Description,
+		}
+		if record, ok := applied[m.Version]; ok {
+			statuses[i].Applied = true
+			statuses[i].AppliedAt = &record.AppliedAt
+			current = m.Version
+		}
+	}
+
+	writeJSON(w, http.StatusOK, models.MigrationList{
+		OK:             true,
+		Backend:        getEnvString("STORAGE_BACKEND", storageMemory),
+		CurrentVersion: current,
+		LatestVersion:  len(migrations),
+		Migrations:     statuses,
+	})
+	logger.CountRequest(ctx, "/admin/migrations", 200)
+	logger.RecordDuration(ctx, "/admin/migrations", time.Since(start))
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"time"
+
+	"github.com/faidon-laboratory/go-service"
+)
+
+// Goroutines is the body of GET /admin/goroutines
+type Goroutines struct {
+	OK                bool                `json:"ok"`
+	Goroutines        []service.TaskInfo  `json:"goroutines"`
+	Stages            []service.StageInfo `json:"stages"`
+	ProcessGoroutines int                 `json:"process_goroutines"`
+}
+
+// ClockChange is the body of POST /admin/clock: Advance is a duration
+// ("90m"), Set a time to jump to
+type ClockChange struct {
+	Advance string     `json:"advance"`
+	Set     *time.Time `json:"set"`
+}
+
+// ClockStatus is the body of GET and POST /admin/clock; Now keeps its
+// nanoseconds
+type ClockStatus struct {
+	OK   bool      `json:"ok"`
+	Now  time.Time `json:"now"`
+	Fake bool      `json:"fake"`
+}
+
+// ChaosFault is an injected fault
+type ChaosFault struct {
+	FailRate  *float64   `json:"fail_rate,omitempty"`
+	LatencyMs int        `json:"latency_ms,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// ChaosChange is the body of PUT /admin/chaos; Duration is how long the
+// fault lasts ("5m"), until cleared if empty
+type ChaosChange struct {
+	FailRate  *float64 `json:"fail_rate"`
+	LatencyMs int      `json:"latency_ms"`
+	Duration  string   `json:"duration"`
+}
+
+// ChaosStatus is the body of /admin/chaos
+type ChaosStatus struct {
+	OK                 bool        `json:"ok"`
+	Fault              *ChaosFault `json:"fault"`
+	FailRate           float64     `json:"fail_rate"`
+	ConfiguredFailRate float64     `json:"configured_fail_rate"`
+	AddedLatencyMs     int64       `json:"added_latency_ms"`
+}
+
+// ScalingStatus is the body of GET /admin/scaling; rates are per second
+type ScalingStatus struct {
+	OK                 bool    `json:"ok"`
+	QueueDepth         int     `json:"queue_depth"`
+	QueueCapacity      int     `json:"queue_capacity"`
+	InFlight           int     `json:"in_flight"`
+	Workers            int     `json:"workers"`
+	ArrivalRate        float64 `json:"arrival_rate"`
+	CompletionRate     float64 `json:"completion_rate"`
+	CapacityRate       float64 `json:"capacity_rate"`
+	AvgDeliverySeconds float64 `json:"avg_delivery_seconds"`
+	DrainTimeSeconds   float64 `json:"drain_time_seconds"`
+	DesiredWorkers     int     `json:"desired_workers"`
+	Saturated          bool    `json:"saturated"`
+	WindowSeconds      int     `json:"window_seconds"`
+}
+
+// ImportError is a rejected line of an import
+type ImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ImportSummary is the result of an import
+type ImportSummary struct {
+	Lines    int           `json:"lines"`
+	Imported int           `json:"imported"`
+	Rejected int           `json:"rejected"`
+	Evicted  int           `json:"evicted"`
+	FirstID  string        `json:"first_id,omitempty"`
+	LastID   string        `json:"last_id,omitempty"`
+	DryRun   bool          `json:"dry_run"`
+	Errors   []ImportError `json:"errors"`
+}
+
+// ImportResponse is the body of POST /admin/import; Error is set when the
+// import stopped early
+type ImportResponse struct {
+	OK      bool          `json:"ok"`
+	Error   string        `json:"error,omitempty"`
+	Summary ImportSummary `json:"summary"`
+}
+
+// MigrationStatus is a migration as listed by /admin/migrations
+type MigrationStatus struct {
+	Version     int        `json:"version"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Applied     bool       `json:"applied"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+}
+
+// MigrationList is the body of GET /admin/migrations
+type MigrationList struct {
+	OK             bool              `json:"ok"`
+	Backend        string            `json:"backend"`
+	CurrentVersion int               `json:"current_version"`
+	LatestVersion  int               `json:"latest_version"`
+	Migrations     []MigrationStatus `json:"migrations"`
+}
+
+// ProjectionRebuild is the body of POST /admin/projections/rebuild
+type ProjectionRebuild struct {
+	OK             bool `json:"ok"`
+	Users          int  `json:"users"`
+	Notifications  int  `json:"notifications"`
+	CorrectedUsers int  `json:"corrected_users"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Device is a registered push notification target
+type Device struct {
+	Token        string     `json:"token"`
+	Platform     string     `json:"platform"`
+	RegisteredAt time.Time  `json:"registered_at"`
+	LastSentAt   *time.Time `json:"last_sent_at,omitempty"`
+}
+
+// DeviceRequest is the body of POST /users/{id}/devices
+type DeviceRequest struct {
+	Token    string `json:"token"`
+	Platform string `json:"platform"`
+}
+
+// DeviceResponse answers a registered device
+type DeviceResponse struct {
+	OK     bool   `json:"ok"`
+	Device Device `json:"device"`
+}
+
+// DeviceList is the body of GET /users/{id}/devices
+type DeviceList struct {
+	OK         bool     `json:"ok"`
+	UserID     string   `json:"user_id"`
+	Devices    []Device `json:"devices"`
+	TotalCount int      `json:"total_count"`
+}
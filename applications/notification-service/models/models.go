@@ -0,0 +1,27 @@
+// Package models holds the request and response bodies of the notification
+// service's API, one type per body instead of anonymous structs and maps.
+//
+// The public API's types are the schemas of the same name in openapi.json,
+// from which the gateway's client (api-gateway/notificationclient) is
+// generated; a field changed here is changed in the document too, and the
+// client regenerated. The admin API's types aren't documented.
+//
+// Timestamps are time.Time in UTC and serialize as RFC 3339; the ones of
+// responses are truncated to the second.
+package models
+
+// Error is the body of every failed request
+type Error struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// Problem is an RFC 9457 problem detail, the body of requests no route
+// matches
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Instance string `json:"instance"`
+}
@@ -0,0 +1,124 @@
+package models
+
+import "time"
+
+// SendRequest is the body of POST /notifications/send
+type SendRequest struct {
+	UserID string `json:"user_id"`
+	// Message is rendered from the template when TemplateID is set
+	Message    string            `json:"message"`
+	Channel    string            `json:"channel"`
+	Priority   string            `json:"priority"`
+	TemplateID string            `json:"template_id"`
+	Variables  map[string]string `json:"variables"`
+}
+
+// SendResponse answers a delivered send
+type SendResponse struct {
+	OK       bool   `json:"ok"`
+	ID       string `json:"id"`
+	Message  string `json:"message"`
+	UserID   string `json:"user_id"`
+	Channel  string `json:"channel"`
+	Priority string `json:"priority"`
+	// Parts is the number of messages the text was split into
+	Parts  int       `json:"parts"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// NotificationSummary is an entry of GET /notifications
+type NotificationSummary struct {
+	ID       string    `json:"id"`
+	UserID   string    `json:"user_id"`
+	Message  string    `json:"message"`
+	Channel  string    `json:"channel"`
+	Priority string    `json:"priority"`
+	Status   string    `json:"status"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+// NotificationList is the body of GET /notifications
+type NotificationList struct {
+	OK            bool                  `json:"ok"`
+	Notifications []NotificationSummary `json:"notifications"`
+	TotalCount    int                   `json:"total_count"`
+	RetrievedAt   time.Time             `json:"retrieved_at"`
+}
+
+// ServiceStatus is the delivery status of the service
+type ServiceStatus struct {
+	ServiceStatus string    `json:"service_status"`
+	QueueSize     int       `json:"queue_size"`
+	PendingCount  int       `json:"pending_count"`
+	SentToday     int       `json:"sent_today"`
+	FailedToday   int       `json:"failed_today"`
+	UptimeSeconds float64   `json:"uptime_seconds"`
+	LastUpdated   time.Time `json:"last_updated"`
+}
+
+// StatusResponse is the body of GET /notifications/status
+type StatusResponse struct {
+	OK     bool          `json:"ok"`
+	Status ServiceStatus `json:"status"`
+}
+
+// TimelineEvent is a single entry in a notification's delivery timeline.
+// DurationMs is the time covered by the event: queue wait for "sending", quota
+// wait for "throttled", the provider call for "attempt" and the whole send for
+// "sent" and "failed".
+type TimelineEvent struct {
+	Timestamp            time.Time `json:"timestamp"`
+	Event                string    `json:"event"`
+	Part                 int       `json:"part,omitempty"`
+	WorkerID             *int      `json:"worker_id,omitempty"`
+	Provider             string    `json:"provider,omitempty"`
+	ProviderResponseCode int       `json:"provider_response_code,omitempty"`
+	DurationMs           int64     `json:"duration_ms,omitempty"`
+	Error                string    `json:"error,omitempty"`
+}
+
+// Notification is the record of a single send
+type Notification struct {
+	ID        string          `json:"id"`
+	UserID    string          `json:"user_id"`
+	TenantID  string          `json:"tenant_id,omitempty"`
+	Channel   string          `json:"channel"`
+	Priority  string          `json:"priority"`
+	Provider  string          `json:"provider"`
+	Status    string          `json:"status"`
+	Message   string          `json:"message"`
+	Parts     int             `json:"parts"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	ReadAt    *time.Time      `json:"read_at,omitempty"`
+	Timeline  []TimelineEvent `json:"timeline,omitempty"`
+}
+
+// Timeline is the body of GET /notifications/{id}/timeline
+type Timeline struct {
+	OK          bool            `json:"ok"`
+	ID          string          `json:"id"`
+	UserID      string          `json:"user_id"`
+	Channel     string          `json:"channel"`
+	Provider    string          `json:"provider"`
+	Status      string          `json:"status"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	TotalTimeMs int64           `json:"total_time_ms"`
+	Timeline    []TimelineEvent `json:"timeline"`
+}
+
+// UserNotifications is the body of GET /users/{id}/notifications
+type UserNotifications struct {
+	OK            bool           `json:"ok"`
+	UserID        string         `json:"user_id"`
+	Notifications []Notification `json:"notifications"`
+	UnreadCount   int            `json:"unread_count"`
+	TotalCount    int            `json:"total_count"`
+}
+
+// ReadResponse is the body of POST /notifications/{id}/read
+type ReadResponse struct {
+	OK           bool         `json:"ok"`
+	Notification Notification `json:"notification"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// TemplateVersion is a single immutable revision of a template
+type TemplateVersion struct {
+	Version   int       `json:"version"`
+	Status    string    `json:"status"`
+	Subject   string    `json:"subject,omitempty"`
+	Body      string    `json:"body"`
+	Variables []string  `json:"variables"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Template is a named notification template with its version history
+type Template struct {
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	Channel          string            `json:"channel"`
+	PublishedVersion int               `json:"published_version,omitempty"`
+	Versions         []TemplateVersion `json:"versions"`
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+}
+
+// TemplateRequest is the body of POST /templates and PUT /templates/{id}
+type TemplateRequest struct {
+	Name      string   `json:"name"`
+	Channel   string   `json:"channel"`
+	Subject   string   `json:"subject"`
+	Body      string   `json:"body"`
+	Variables []string `json:"variables"`
+	Status    string   `json:"status"`
+}
+
+// TemplateResponse answers a created, updated or fetched template
+type TemplateResponse struct {
+	OK       bool      `json:"ok"`
+	Template *Template `json:"template"`
+}
+
+// TemplateList is the body of GET /templates
+type TemplateList struct {
+	OK         bool        `json:"ok"`
+	Templates  []*Template `json:"templates"`
+	TotalCount int         `json:"total_count"`
+}
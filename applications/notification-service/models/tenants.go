@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// TenantChannelConfig is the public view of a tenant's channel configuration
+type TenantChannelConfig struct {
+	TenantID  string    `json:"tenant_id"`
+	Channel   string    `json:"channel"`
+	Provider  string    `json:"provider"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TenantChannelRequest is the body of PUT /tenants/{tenant}/channels/{channel}
+type TenantChannelRequest struct {
+	Provider    string            `json:"provider"`
+	Credentials map[string]string `json:"credentials"`
+}
+
+// TenantChannelResponse answers a configured channel
+type TenantChannelResponse struct {
+	OK      bool                `json:"ok"`
+	Channel TenantChannelConfig `json:"channel"`
+}
+
+// TenantChannelList is the body of GET /tenants/{tenant}/channels
+type TenantChannelList struct {
+	OK       bool                  `json:"ok"`
+	TenantID string                `json:"tenant_id"`
+	Channels []TenantChannelConfig `json:"channels"`
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"notification-service/models"
+)
+
+// Notification records and delivery timeline
+//
+// Every accepted send gets a notification record with an ordered timeline of
+// state transitions and delivery attempts (timestamp, worker, provider
+// response code, error), so slow or failed deliveries can be explained from
+// the API. Records are kept in memory, and in the storage backend if one is
+// configured (see storage.go), and each part waits in an outbox until it is
+// delivered (see outbox.go); the oldest records are evicted once
+// NOTIFICATION_RETENTION records exist. Listings by user go through a
+// per-user projection (see projection.go).
+
+// Notification states
+const (
+	statusReceived  = "received"
+	statusQueued    = "queued"
+	statusSending   = "sending"
+	statusSent      = "sent"
+	statusFailed    = "failed"
+	statusCancelled = "cancelled"
+)
+
+// Timeline event types that are not state transitions
+const (
+	eventThrottled = "throttled"
+	eventAttempt   = "attempt"
+)
+
+// The records are the API's models
+type (
+	Notification  = models.Notification
+	TimelineEvent = models.TimelineEvent
+)
+
+// notificationStore keeps recent notifications in memory
+type notificationStore struct {
+	mu     sync.RWMutex
+	items  map[string]*Notification
+	order  []string
+	limit  int
+	nextID int
+	// byUser is the read model of each user's notifications (projection.go)
+	byUser map[string]*userProjection
+}
+
+var notifications *notificationStore
+
+func init() {
+	notifications = &notificationStore{
+		items:  make(map[string]*Notification),
+		limit:  getEnvInt("NOTIFICATION_RETENTION", 10000),
+		byUser: make(map[string]*userProjection),
+	}
+}
+
+// create assigns an ID to a new notification, records its first event and
+// adds an outbox entry, claimed by the caller, for each of its parts
+func (s *notificationStore) create(n Notification, parts []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	now := clock.Now().UTC()
+	n.ID = fmt.Sprintf("notif_%d", s.nextID)
+	n.Status = statusReceived
+	n.CreatedAt = now
+	n.UpdatedAt = now
+	n.Timeline = []TimelineEvent{{Timestamp: now, Event: statusReceived}}
+
+	s.items[n.ID] = &n
+	s.order = s.insertByCreation(s.order, &n)
+	s.project(&n)
+
+	// The notification and its outbox entries are stored together
+	entries := make([]*outboxEntry, len(parts))
+	records := []storedRecord{{bucket: bucketNotifications, key: n.ID, record: n}}
+	for i, message := range parts {
+		entries[i] = &outboxEntry{NotificationID: n.ID, Part: partNumber(i, len(parts)), Message: message, CreatedAt: now}
+		records = append(records, storedRecord{bucket: bucketOutbox, key: entries[i].key(), record: entries[i]})
+	}
+	outbox.add(entries)
+	persistAll(records...)
+	if len(s.order) > s.limit {
+		s.evictOldest()
+	}
+
+	return n.ID
+}
+
+// insertByCreation adds a notification to IDs kept in creation order, after
+// those created at the same time or earlier. New sends go at the end; only
+// imported history lands in between. Callers hold s.mu.
+func (s *notificationStore) insertByCreation(ids []string, n *Notification) []string {
+	i := len(ids)
+	if i > 0 && s.items[ids[i-1]].CreatedAt.After(n.CreatedAt) {
+		i = sort.Search(len(ids), func(j int) bool { return s.items[ids[j]].CreatedAt.After(n.CreatedAt) })
+	}
+	return slices.Insert(ids, i, n.ID)
+}
+
+// evictOldest drops the oldest notification. Callers hold s.mu.
+func (s *notificationStore) evictOldest() {
+	id := s.order[0]
+	s.unproject(s.items[id])
+	delete(s.items, id)
+	unpersist(bucketNotifications, id)
+	s.order = s.order[1:]
+}
+
+// load restores the notifications kept by a storage backend
+func (s *notificationStore) load(backend storageBackend) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var loaded []*Notification
+	err := backend.load(bucketNotifications, func(key string, value []byte) error {
+		var n Notification
+		if err := json.Unmarshal(value, &n); err != nil {
+			return fmt.Errorf("notification %s: %w", key, err)
+		}
+		loaded = append(loaded, &n)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Restore the creation order; imported records have later IDs than
+	// newer sends, and keys sort as strings (notif_10 before notif_9)
+	sort.SliceStable(loaded, func(i, j int) bool {
+		a, b := loaded[i], loaded[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return notificationSeq(a.ID) < notificationSeq(b.ID)
+	})
+	for _, n := range loaded {
+		s.items[n.ID] = n
+		s.order = append(s.order, n.ID)
+		s.nextID = max(s.nextID, notificationSeq(n.ID))
+	}
+	s.rebuildProjection()
+	for len(s.order) > s.limit {
+		s.evictOldest()
+	}
+	return nil
+}
+
+// notificationSeq returns the number of a notification ID (notif_12)
+func notificationSeq(id string) int {
+	seq, _ := strconv.Atoi(strings.TrimPrefix(id, "notif_"))
+	return seq
+}
+
+// record appends an event to a notification's timeline. Events named after a
+// state also move the notification to that state.
+func (s *notificationStore) record(id string, event TimelineEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.items[id]
+	if !ok {
+		return
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = clock.Now().UTC()
+	}
+	n.Timeline = append(n.Timeline, event)
+	n.UpdatedAt = event.Timestamp
+
+	switch event.Event {
+	case statusQueued, statusSending, statusSent, statusFailed, statusCancelled:
+		wasUnread := isUnread(n)
+		n.Status = event.Event
+		s.reproject(n, wasUnread)
+	}
+	persist(bucketNotifications, id, n)
+}
+
+// get returns a copy of a notification
+func (s *notificationStore) get(id string) (Notification, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n, ok := s.items[id]
+	if !ok {
+		return Notification{}, false
+	}
+	c := *n
+	c.Timeline = append([]TimelineEvent(nil), n.Timeline...)
+	return c, true
+}
+
+// listByUser returns the most recent notifications of a user, newest first,
+// without their timelines, and the user's total unread count
+func (s *notificationStore) listByUser(userID string, limit int) ([]Notification, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p := s.byUser[userID]
+	if p == nil {
+		return []Notification{}, 0
+	}
+	result := make([]Notification, 0, min(limit, len(p.ids)))
+	for i := len(p.ids) - 1; i >= 0 && len(result) < limit; i-- {
+		c := *s.items[p.ids[i]]
+		c.Timeline = nil
+		result = append(result, c)
+	}
+	return result, p.unread
+}
+
+// markRead marks a notification as read, returning false if it doesn't exist
+func (s *notificationStore) markRead(id string) (Notification, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.items[id]
+	if !ok {
+		return Notification{}, false
+	}
+	if n.ReadAt == nil {
+		wasUnread := isUnread(n)
+		now := clock.Now().UTC()
+		n.ReadAt = &now
+		s.reproject(n, wasUnread)
+		persist(bucketNotifications, id, n)
+	}
+	c := *n
+	c.Timeline = nil
+	return c, true
+}
+
+// List user notifications endpoint
+func listUserNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "list_user_notifications")
+	defer endSpan()
+
+	start := time.Now()
+	userID := mux.Vars(r)["id"]
+
+	limit := 20
+	if value, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && value > 0 && value <= 100 {
+		limit = value
+	}
+
+	result, unread := notifications.listByUser(userID, limit)
+
+	writeJSON(w, http.StatusOK, models.UserNotifications{
+		OK:            true,
+		UserID:        userID,
+		Notifications: result,
+		UnreadCount:   unread,
+		TotalCount:    len(result),
+	})
+
+	logger.CountRequest(ctx, "/users/{id}/notifications", 200)
+	logger.RecordDuration(ctx, "/users/{id}/notifications", time.Since(start))
+}
+
+// Mark notification read endpoint
+func markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "mark_notification_read")
+	defer endSpan()
+
+	start := time.Now()
+	id := mux.Vars(r)["id"]
+
+	n, ok := notifications.markRead(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Notification not found")
+		logger.CountRequest(ctx, "/notifications/{id}/read", 404)
+		logger.RecordDuration(ctx, "/notifications/{id}/read", time.Since(start))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.ReadResponse{
+		OK:           true,
+		Notification: n,
+	})
+
+	logger.CountRequest(ctx, "/notifications/{id}/read", 200)
+	logger.RecordDuration(ctx, "/notifications/{id}/read", time.Since(start))
+}
+
+// Get notification timeline endpoint
+func getNotificationTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "get_notification_timeline")
+	defer endSpan()
+
+	start := time.Now()
+	id := mux.Vars(r)["id"]
+
+	n, ok := notifications.get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Notification not found")
+		logger.CountRequest(ctx, "/notifications/{id}/timeline", 404)
+		logger.RecordDuration(ctx, "/notifications/{id}/timeline", time.Since(start))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.Timeline{
+		OK:          true,
+		ID:          n.ID,
+		UserID:      n.UserID,
+		Channel:     n.Channel,
+		Provider:    n.Provider,
+		Status:      n.Status,
+		CreatedAt:   n.CreatedAt,
+		UpdatedAt:   n.UpdatedAt,
+		TotalTimeMs: n.UpdatedAt.Sub(n.CreatedAt).Milliseconds(),
+		Timeline:    n.Timeline,
+	})
+
+	logger.CountRequest(ctx, "/notifications/{id}/timeline", 200)
+	logger.RecordDuration(ctx, "/notifications/{id}/timeline", time.Since(start))
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"time"
+)
+
+// OpenAPI document
+//
+// openapi.json describes the API other services call: sends, the notification
+// list and status, delivery timelines, user inboxes, templates, tenant
+// channels and push devices. It is served at GET /openapi.json, without a
+// request signature, and the gateway's client (api-gateway/notificationclient)
+// is generated from it, so a change to these endpoints goes together with a
+// change to the document and a regenerated client.
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPI document endpoint
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "openapi")
+	defer endSpan()
+
+	start := time.Now()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPISpec)
+
+	logger.CountRequest(ctx, "/openapi.json", 200)
+	logger.RecordDuration(ctx, "/openapi.json", time.Since(start))
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Delivery outbox
+//
+// A send is stored before it is queued, and the delivery queue lives in
+// memory, so a crash between the two would leave a notification "received"
+// that is never delivered. Every part of a new notification therefore gets an
+// outbox entry, written in the same storage transaction as the notification
+// record (see storage.go). The entry is removed once a delivery worker is done
+// with the part, whatever the outcome.
+//
+// The handler that created a notification queues its parts itself. Entries
+// left over from a previous run are picked up by the outbox relay, which polls
+// every OUTBOX_RELAY_INTERVAL_MS and queues them for the delivery workers with
+// nobody waiting on the result; the relay records the final state instead.
+// Before queuing a part it checks the notification's timeline, so a part
+// already accepted by the provider, or a notification that already reached a
+// final state, is dropped from the outbox instead of being sent twice. Only a
+// crash during the provider call itself can repeat a part.
+
+// outboxEntry is a part of a notification waiting to be delivered
+type outboxEntry struct {
+	NotificationID string    `json:"notification_id"`
+	Part           int       `json:"part,omitempty"`
+	Message        string    `json:"message"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// key is the storage key of the entry
+func (e *outboxEntry) key() string {
+	return outboxKey(e.NotificationID, e.Part)
+}
+
+// outboxKey is the storage key of a notification part
+func outboxKey(notificationID string, part int) string {
+	return fmt.Sprintf("%s/%d", notificationID, part)
+}
+
+// partNumber is the number of the i-th of count parts, 0 for a message sent
+// in one part
+func partNumber(i, count int) int {
+	if count > 1 {
+		return i + 1
+	}
+	return 0
+}
+
+// outboxStore keeps the pending outbox entries. Claimed entries are being
+// delivered by this process; the relay only picks up unclaimed ones.
+type outboxStore struct {
+	mu      sync.Mutex
+	entries map[string]*outboxEntry
+	claimed map[string]bool
+}
+
+var (
+	outbox              *outboxStore
+	outboxRelayInterval time.Duration
+)
+
+func init() {
+	outbox = &outboxStore{
+		entries: make(map[string]*outboxEntry),
+		claimed: make(map[string]bool),
+	}
+	outboxRelayInterval = time.Duration(getEnvInt("OUTBOX_RELAY_INTERVAL_MS", 1000)) * time.Millisecond
+}
+
+// add registers the entries of a new notification, claimed by the caller.
+// The caller persists them with the notification.
+func (o *outboxStore) add(entries []*outboxEntry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, e := range entries {
+		o.entries[e.key()] = e
+		o.claimed[e.key()] = true
+	}
+}
+
+// load restores the entries kept by a storage backend, unclaimed
+func (o *outboxStore) load(backend storageBackend) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return backend.load(bucketOutbox, func(key string, value []byte) error {
+		var e outboxEntry
+		if err := json.Unmarshal(value, &e); err != nil {
+			return fmt.Errorf("outbox entry %s: %w", key, err)
+		}
+		o.entries[key] = &e
+		return nil
+	})
+}
+
+// claimUnclaimed claims and returns every unclaimed entry, oldest first
+func (o *outboxStore) claimUnclaimed() []*outboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var result []*outboxEntry
+	for key, e := range o.entries {
+		if !o.claimed[key] {
+			o.claimed[key] = true
+			result = append(result, e)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.NotificationID != b.NotificationID {
+			return notificationSeq(a.NotificationID) < notificationSeq(b.NotificationID)
+		}
+		return a.Part < b.Part
+	})
+	return result
+}
+
+// release gives entries back to the relay
+func (o *outboxStore) release(entries []*outboxEntry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, e := range entries {
+		delete(o.claimed, e.key())
+	}
+}
+
+// complete removes the entry of a notification part
+func (o *outboxStore) complete(notificationID string, part int) {
+	key := outboxKey(notificationID, part)
+
+	o.mu.Lock()
+	_, ok := o.entries[key]
+	delete(o.entries, key)
+	delete(o.claimed, key)
+	o.mu.Unlock()
+
+	if ok {
+		unpersist(bucketOutbox, key)
+	}
+}
+
+// pending returns the number of entries left for a notification
+func (o *outboxStore) pending(notificationID string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	count := 0
+	for _, e := range o.entries {
+		if e.NotificationID == notificationID {
+			count++
+		}
+	}
+	return count
+}
+
+// size returns the number of entries
+func (o *outboxStore) size() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+// partDelivered tells whether the provider accepted a part of a notification
+func partDelivered(n Notification, part int) bool {
+	for _, event := range n.Timeline {
+		if event.Event == eventAttempt && event.Part == part && event.Error == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// startOutboxRelay starts the relay of entries left over from a previous run
+func startOutboxRelay() {
+	if pending := outbox.size(); pending > 0 {
+		logger.Info(context.Background(), "Resuming deliveries from the outbox", map[string]interface{}{
+			"pending_parts": pending,
+		})
+	}
+	background.Supervise("outbox_relay", func(ctx context.Context) error {
+		ticker := clock.NewTicker(outboxRelayInterval)
+		defer ticker.Stop()
+		for {
+			relayOutbox()
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C():
+			}
+		}
+	})
+}
+
+// relayOutbox queues the unclaimed outbox entries for delivery
+func relayOutbox() {
+	entries := outbox.claimUnclaimed()
+	for len(entries) > 0 {
+		// Relay a notification's parts together
+		n := 1
+		for n < len(entries) && entries[n].NotificationID == entries[0].NotificationID {
+			n++
+		}
+		if !relayNotification(entries[:n]) {
+			// The queue is full; try again on the next tick
+			outbox.release(entries[n:])
+			return
+		}
+		entries = entries[n:]
+	}
+}
+
+// relayNotification queues the pending parts of one notification, returning
+// false if the delivery queue is full. Parts not queued are released.
+func relayNotification(entries []*outboxEntry) bool {
+	id := entries[0].NotificationID
+	n, ok := notifications.get(id)
+	if !ok || n.Status == statusSent || n.Status == statusFailed || n.Status == statusCancelled {
+		for _, e := range entries {
+			outbox.complete(id, e.Part)
+		}
+		return true
+	}
+
+	ctx, endSpan := logger.StartSpan(context.Background(), "relay_notification")
+	logger.AddSpanAttribute(ctx, "notification_id", id)
+
+	start := time.Now()
+	var jobs []*deliveryJob
+	for i, e := range entries {
+		if partDelivered(n, e.Part) {
+			outbox.complete(id, e.Part)
+			continue
+		}
+		job := &deliveryJob{
+			ctx:            ctx,
+			notificationID: id,
+			part:           e.Part,
+			userID:         n.UserID,
+			tenantID:       n.TenantID,
+			channel:        n.Channel,
+			priority:       n.Priority,
+			provider:       n.Provider,
+			message:        e.Message,
+			enqueuedAt:     time.Now(),
+			result:         make(chan deliveryResult, 1),
+		}
+		if !enqueueDelivery(job) {
+			// Parts already queued finish on their own
+			outbox.release(entries[i:])
+			goFinishRelayed(ctx, endSpan, n, jobs, start)
+			return false
+		}
+		jobs = append(jobs, job)
+	}
+	goFinishRelayed(ctx, endSpan, n, jobs, start)
+	return true
+}
+
+// goFinishRelayed runs finishRelayed in the background group
+func goFinishRelayed(ctx context.Context, endSpan func(), n Notification, jobs []*deliveryJob, start time.Time) {
+	err := background.Go("outbox_finish", func(context.Context) error {
+		finishRelayed(ctx, endSpan, n, jobs, start)
+		return nil
+	})
+	if err != nil {
+		// Shutting down; the workers stop after the relay, which waits here
+		finishRelayed(ctx, endSpan, n, jobs, start)
+	}
+}
+
+// finishRelayed waits for relayed parts and, once the notification has no
+// outbox entries left, records its final state
+func finishRelayed(ctx context.Context, endSpan func(), n Notification, jobs []*deliveryJob, start time.Time) {
+	defer endSpan()
+
+	result := waitDeliveries(jobs)
+	if outbox.pending(n.ID) > 0 {
+		return
+	}
+
+	event := TimelineEvent{Event: statusSent, DurationMs: time.Since(start).Milliseconds()}
+	outcome := "sent"
+	if result.err != nil {
+		event.Event = statusFailed
+		event.Error = result.err.Error()
+		outcome = "failed"
+	}
+	notifications.record(n.ID, event)
+	recordDelivery(ctx, n.TenantID, n.Channel, n.Provider, n.Priority, outcome, result.duration)
+
+	logger.Info(ctx, "Relayed notification from the outbox", map[string]interface{}{
+		"notification_id": n.ID,
+		"user_id":         n.UserID,
+		"channel":         n.Channel,
+		"parts":           len(jobs),
+		"outcome":         outcome,
+	})
+}
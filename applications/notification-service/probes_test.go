@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/faidon-laboratory/go-logging"
+)
+
+// BenchmarkProbeCache serves /healthz under parallel load with and without
+// the cache, on a logger writing to io.Discard
+func BenchmarkProbeCache(b *testing.B) {
+	saved := logger
+	b.Cleanup(func() { logger = saved })
+	logger = logging.New(logging.Config{
+		ServiceName: "notification-service",
+		Version:     "bench",
+		Environment: "bench",
+		LogLevel:    "info",
+		Handler:     slog.NewJSONHandler(io.Discard, nil),
+	})
+
+	for _, bench := range []struct {
+		name string
+		ttl  time.Duration
+	}{
+		{"uncached", 0},
+		{"cached", 500 * time.Millisecond},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			handler := newProbeCache("/healthz", bench.ttl, checkHealthz)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+				for pb.Next() {
+					handler.ServeHTTP(httptest.NewRecorder(), req)
+				}
+			})
+		})
+	}
+}
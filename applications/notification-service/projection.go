@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	service "github.com/faidon-laboratory/go-service"
+	"notification-service/models"
+)
+
+// User notification projection
+//
+// GET /users/{id}/notifications reads a per-user read model instead of
+// scanning every record: for each user, the IDs of their notifications in
+// creation order and their unread count (sent and not yet read). The
+// notification store updates it on every change it makes (create, state
+// transitions, read, eviction), so a listing costs the page size whatever
+// the retention, and the unread count is a lookup.
+//
+// The projection is derived from the records and rebuilt from them at
+// startup. POST /admin/projections/rebuild rebuilds it on a running service,
+// to recover if it ever disagrees with the records, and reports how many
+// users' entries it corrected.
+
+// userProjection is the read model of one user's notifications
+type userProjection struct {
+	ids    []string
+	unread int
+}
+
+// isUnread tells whether a notification counts as unread
+func isUnread(n *Notification) bool {
+	return n.ReadAt == nil && n.Status == statusSent
+}
+
+// project adds a new notification to its user's entry. Callers hold s.mu.
+func (s *notificationStore) project(n *Notification) {
+	p := s.byUser[n.UserID]
+	if p == nil {
+		p = &userProjection{}
+		s.byUser[n.UserID] = p
+	}
+	p.ids = s.insertByCreation(p.ids, n)
+	if isUnread(n) {
+		p.unread++
+	}
+}
+
+// reproject updates the unread count of a notification's user after a
+// change, given whether it was unread before. Callers hold s.mu.
+func (s *notificationStore) reproject(n *Notification, wasUnread bool) {
+	p := s.byUser[n.UserID]
+	if p == nil {
+		return
+	}
+	switch now := isUnread(n); {
+	case now && !wasUnread:
+		p.unread++
+	case !now && wasUnread:
+		p.unread--
+	}
+}
+
+// unproject removes an evicted notification from its user's entry. Eviction
+// takes the oldest record, which is also its user's oldest. Callers hold s.mu.
+func (s *notificationStore) unproject(n *Notification) {
+	p := s.byUser[n.UserID]
+	if p == nil {
+		return
+	}
+	if len(p.ids) > 0 && p.ids[0] == n.ID {
+		p.ids = p.ids[1:]
+	} else if i := slices.Index(p.ids, n.ID); i >= 0 {
+		p.ids = slices.Delete(p.ids, i, i+1)
+	}
+	if isUnread(n) {
+		p.unread--
+	}
+	if len(p.ids) == 0 {
+		delete(s.byUser, n.UserID)
+	}
+}
+
+// rebuildProjection recomputes every user's entry from the records and
+// returns the number of users and how many entries were wrong. Callers hold
+// s.mu.
+func (s *notificationStore) rebuildProjection() (users, corrected int) {
+	rebuilt := make(map[string]*userProjection)
+	for _, id := range s.order {
+		n := s.items[id]
+		p := rebuilt[n.UserID]
+		if p == nil {
+			p = &userProjection{}
+			rebuilt[n.UserID] = p
+		}
+		p.ids = append(p.ids, id)
+		if isUnread(n) {
+			p.unread++
+		}
+	}
+
+	for userID, p := range rebuilt {
+		old := s.byUser[userID]
+		if old == nil || old.unread != p.unread || !slices.Equal(old.ids, p.ids) {
+			corrected++
+		}
+	}
+	for userID := range s.byUser {
+		if rebuilt[userID] == nil {
+			corrected++
+		}
+	}
+	s.byUser = rebuilt
+	return len(rebuilt), corrected
+}
+
+// Projection rebuild endpoint
+func adminRebuildProjectionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "admin_rebuild_projections")
+	defer endSpan()
+
+	start := time.Now()
+	logger.AddSpanAttribute(ctx, "admin.identity", service.AdminIdentity(ctx))
+
+	notifications.mu.Lock()
+	users, corrected := notifications.rebuildProjection()
+	records := len(notifications.order)
+	notifications.mu.Unlock()
+
+	logger.Info(ctx, "Rebuilt user notification projection", map[string]interface{}{
+		"users":         users,
+		"notifications": records,
+		"corrected":     corrected,
+		"duration_ms":   time.Since(start).Milliseconds(),
+	})
+
+	writeJSON(w, http.StatusOK, models.ProjectionRebuild{
+		OK:             true,
+		Users:          users,
+		Notifications:  records,
+		CorrectedUsers: corrected,
+	})
+	logger.CountRequest(ctx, "/admin/projections/rebuild", 200)
+	logger.RecordDuration(ctx, "/admin/projections/rebuild", time.Since(start))
+}
@@ -0,0 +1,26 @@
+package main
+
+// Prometheus exporter
+//
+// Environments that scrape /metrics instead of running the OTLP pipeline set
+// METRICS_EXPORTER=prometheus (the default is "otlp"). The shared logger then
+// serves every metric at /metrics - the HTTP request metrics as well as the
+// delivery metrics and gauges - while still pushing them to ALLOY_URL.
+
+const (
+	metricsExporterOTLP       = "otlp"
+	metricsExporterPrometheus = "prometheus"
+)
+
+// prometheusEnabled reports whether METRICS_EXPORTER asks for /metrics
+func prometheusEnabled() bool {
+	switch exporter := getEnvString("METRICS_EXPORTER", metricsExporterOTLP); exporter {
+	case metricsExporterOTLP:
+		return false
+	case metricsExporterPrometheus:
+		return true
+	default:
+		configWarning("Unknown METRICS_EXPORTER %q, using OTLP", exporter)
+		return false
+	}
+}
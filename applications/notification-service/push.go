@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"notification-service/models"
+)
+
+// Push notifications
+//
+// Users register device tokens per platform. Sends on the push channel fan out
+// to every registered device through the platform's adapter (FCM for Android,
+// APNs for iOS). The adapters are stubs that simulate the providers, including
+// their "token no longer valid" feedback; devices reported as invalid are
+// removed so they aren't retried on the next send.
+
+const (
+	channelPush = "push"
+
+	platformAndroid = "android"
+	platformIOS     = "ios"
+
+	eventDeviceRemoved = "device_removed"
+)
+
+// Device is the API's model of a push target
+type Device = models.Device
+
+// pushResponse is the provider's answer to a single push
+type pushResponse struct {
+	statusCode   int
+	invalidToken bool
+}
+
+// pushAdapter delivers a push message to a single device
+type pushAdapter interface {
+	Name() string
+	Send(ctx context.Context, token, message string) (pushResponse, error)
+}
+
+// deviceStore keeps registered devices per user in memory, and in the
+// storage backend if one is configured
+type deviceStore struct {
+	mu      sync.RWMutex
+	devices map[string]map[string]*Device
+}
+
+// persistedDevice is a device as kept by the storage backend
+type persistedDevice struct {
+	UserID string `json:"user_id"`
+	Device
+}
+
+// deviceKey is the storage key of a user's device
+func deviceKey(userID, token string) string {
+	return userID + "\x00" + token
+}
+
+var (
+	devices      = &deviceStore{devices: make(map[string]map[string]*Device)}
+	pushAdapters map[string]pushAdapter
+)
+
+func init() {
+	invalidRate := getEnvFloat("PUSH_INVALID_TOKEN_RATE", 0.01)
+	pushAdapters = map[string]pushAdapter{
+		platformAndroid: &fcmAdapter{invalidRate: invalidRate},
+		platformIOS:     &apnsAdapter{invalidRate: invalidRate},
+	}
+}
+
+// register adds or refreshes a device for a user
+func (s *deviceStore) register(userID string, device Device) Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.devices[userID] == nil {
+		s.devices[userID] = make(map[string]*Device)
+	}
+	if existing, ok := s.devices[userID][device.Token]; ok {
+		device.LastSentAt = existing.LastSentAt
+	}
+	s.devices[userID][device.Token] = &device
+	persist(bucketDevices, deviceKey(userID, device.Token), persistedDevice{UserID: userID, Device: device})
+	return device
+}
+
+// load restores the devices kept by a storage backend
+func (s *deviceStore) load(backend storageBackend) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return backend.load(bucketDevices, func(key string, value []byte) error {
+		var stored persistedDevice
+		if err := json.Unmarshal(value, &stored); err != nil {
+			return fmt.Errorf("device %q: %w", key, err)
+		}
+		if s.devices[stored.UserID] == nil {
+			s.devices[stored.UserID] = make(map[string]*Device)
+		}
+		s.devices[stored.UserID][stored.Token] = &stored.Device
+		return nil
+	})
+}
+
+// list returns the devices of a user ordered by registration time
+func (s *deviceStore) list(userID string) []Device {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Device, 0, len(s.devices[userID]))
+	for _, device := range s.devices[userID] {
+		result = append(result, *device)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].RegisteredAt.Before(result[j].RegisteredAt)
+	})
+	return result
+}
+
+// remove deletes a device, returning false if it wasn't registered
+func (s *deviceStore) remove(userID, token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.devices[userID][token]; !ok {
+		return false
+	}
+	delete(s.devices[userID], token)
+	unpersist(bucketDevices, deviceKey(userID, token))
+	return true
+}
+
+// markSent records a successful push to a device
+func (s *deviceStore) markSent(userID, token string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if device, ok := s.devices[userID][token]; ok {
+		device.LastSentAt = &at
+		persist(bucketDevices, deviceKey(userID, token), persistedDevice{UserID: userID, Device: *device})
+	}
+}
+
+// sendPush delivers a push job to all of the user's devices. The send succeeds
+// if at least one device accepted the message.
+func sendPush(ctx context.Context, job *deliveryJob, workerID int) (int, error) {
+	targets := devices.list(job.userID)
+	if len(targets) == 0 {
+		return http.StatusNotFound, fmt.Errorf("user %s has no registered devices", job.userID)
+	}
+
+	delivered := 0
+	lastCode := 0
+	var lastErr error
+	for _, device := range targets {
+		adapter := pushAdapters[device.Platform]
+
+		start := time.Now()
+		resp, err := adapter.Send(ctx, device.Token, job.message)
+		lastCode = resp.statusCode
+
+		attempt := TimelineEvent{
+			Event:                eventAttempt,
+			Part:                 job.part,
+			WorkerID:             &workerID,
+			Provider:             adapter.Name(),
+			ProviderResponseCode: resp.statusCode,
+			DurationMs:           time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			attempt.Error = err.Error()
+			lastErr = err
+		}
+		notifications.record(job.notificationID, attempt)
+
+		// Provider feedback says the token is dead, stop sending to it
+		if resp.invalidToken {
+			devices.remove(job.userID, device.Token)
+			recordInvalidPushToken(ctx, device.Platform)
+			notifications.record(job.notificationID, TimelineEvent{
+				Event:    eventDeviceRemoved,
+				Part:     job.part,
+				WorkerID: &workerID,
+				Provider: adapter.Name(),
+				Error:    "device token no longer valid",
+			})
+			logger.Warn(ctx, "Removed invalid push device", map[string]interface{}{
+				"user_id":  job.userID,
+				"platform": device.Platform,
+				"provider": adapter.Name(),
+			})
+			continue
+		}
+
+		if err == nil {
+			delivered++
+			devices.markSent(job.userID, device.Token, time.Now().UTC())
+		}
+	}
+
+	if delivered == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no valid devices for user %s", job.userID)
+		}
+		return lastCode, lastErr
+	}
+	return http.StatusOK, nil
+}
+
+// fcmAdapter simulates Firebase Cloud Messaging
+type fcmAdapter struct {
+	invalidRate float64
+}
+
+func (a *fcmAdapter) Name() string { return "fcm" }
+
+func (a *fcmAdapter) Send(ctx context.Context, token, message string) (pushResponse, error) {
+	if err := simulatePushLatency(ctx, 40, 120); err != nil {
+		return pushResponse{}, err
+	}
+	// FCM answers 404 UNREGISTERED for tokens of uninstalled apps
+	if strings.HasPrefix(token, "invalid") || rand.Float64() < a.invalidRate {
+		return pushResponse{statusCode: http.StatusNotFound, invalidToken: true}, fmt.Errorf("fcm: UNREGISTERED")
+	}
+	if rand.Float64() < currentFailRate() {
+		return pushResponse{statusCode: http.StatusServiceUnavailable}, fmt.Errorf("fcm: UNAVAILABLE")
+	}
+	return pushResponse{statusCode: http.StatusOK}, nil
+}
+
+// apnsAdapter simulates the Apple Push Notification service
+type apnsAdapter struct {
+	invalidRate float64
+}
+
+func (a *apnsAdapter) Name() string { return "apns" }
+
+func (a *apnsAdapter) Send(ctx context.Context, token, message string) (pushResponse, error) {
+	if err := simulatePushLatency(ctx, 60, 180); err != nil {
+		return pushResponse{}, err
+	}
+	// APNs answers 410 Unregistered for tokens that are no longer active
+	if strings.HasPrefix(token, "invalid") || rand.Float64() < a.invalidRate {
+		return pushResponse{statusCode: http.StatusGone, invalidToken: true}, fmt.Errorf("apns: Unregistered")
+	}
+	if rand.Float64() < currentFailRate() {
+		return pushResponse{statusCode: http.StatusInternalServerError}, fmt.Errorf("apns: InternalServerError")
+	}
+	return pushResponse{statusCode: http.StatusOK}, nil
+}
+
+// simulatePushLatency sleeps for a random duration in [minMs, maxMs)
+func simulatePushLatency(ctx context.Context, minMs, maxMs int) error {
+	timer := time.NewTimer(time.Duration(minMs+rand.Intn(maxMs-minMs))*time.Millisecond + chaosLatency())
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Register device endpoint
+func registerDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "register_device")
+	defer endSpan()
+
+	start := time.Now()
+	userID := mux.Vars(r)["id"]
+
+	var req models.DeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error(ctx, "Failed to parse device registration", err)
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		logger.CountRequest(ctx, "/users/{id}/devices", 400)
+		logger.RecordDuration(ctx, "/users/{id}/devices", time.Since(start))
+		return
+	}
+
+	if _, ok := pushAdapters[req.Platform]; !ok || req.Token == "" {
+		writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("token is required and platform must be %q or %q", platformAndroid, platformIOS))
+		logger.CountRequest(ctx, "/users/{id}/devices", 422)
+		logger.RecordDuration(ctx, "/users/{id}/devices", time.Since(start))
+		return
+	}
+
+	device := devices.register(userID, Device{
+		Token:        req.Token,
+		Platform:     req.Platform,
+		RegisteredAt: time.Now().UTC(),
+	})
+
+	logger.Info(ctx, "Push device registered", map[string]interface{}{
+		"user_id":  userID,
+		"platform": req.Platform,
+	})
+
+	writeJSON(w, http.StatusCreated, models.DeviceResponse{
+		OK:     true,
+		Device: device,
+	})
+
+	logger.CountRequest(ctx, "/users/{id}/devices", 201)
+	logger.RecordDuration(ctx, "/users/{id}/devices", time.Since(start))
+}
+
+// List devices endpoint
+func listDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "list_devices")
+	defer endSpan()
+
+	start := time.Now()
+	userID := mux.Vars(r)["id"]
+
+	result := devices.list(userID)
+
+	writeJSON(w, http.StatusOK, models.DeviceList{
+		OK:         true,
+		UserID:     userID,
+		Devices:    result,
+		TotalCount: len(result),
+	})
+
+	logger.CountRequest(ctx, "/users/{id}/devices", 200)
+	logger.RecordDuration(ctx, "/users/{id}/devices", time.Since(start))
+}
+
+// Unregister device endpoint
+func unregisterDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "unregister_device")
+	defer endSpan()
+
+	start := time.Now()
+	vars := mux.Vars(r)
+	userID, token := vars["id"], vars["token"]
+
+	if !devices.remove(userID, token) {
+		writeError(w, http.StatusNotFound, "Device not found")
+		logger.CountRequest(ctx, "/users/{id}/devices/{token}", 404)
+		logger.RecordDuration(ctx, "/users/{id}/devices/{token}", time.Since(start))
+		return
+	}
+
+	logger.Info(ctx, "Push device unregistered", map[string]interface{}{
+		"user_id": userID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+
+	logger.CountRequest(ctx, "/users/{id}/devices/{token}", 204)
+	logger.RecordDuration(ctx, "/users/{id}/devices/{token}", time.Since(start))
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"notification-service/models"
+)
+
+// Autoscaling hints
+//
+// GET /admin/scaling reports this replica's delivery backlog for external
+// autoscalers: queue depth, sends in flight, the arrival and completion rates
+// over the last SCALING_WINDOW_SEC seconds and how long the backlog takes to
+// drain at full worker capacity. desired_workers is the worker count that
+// keeps up with arrivals and clears the backlog within SCALING_TARGET_DRAIN_SEC.
+//
+// The fields are flat numbers so KEDA's metrics-api scaler can read them
+// directly, e.g. valueLocation "queue_depth" or "desired_workers", with
+// authMode bearer and an ADMIN_TOKENS token. Each replica reports its own
+// queue.
+
+var (
+	scalingWindow      int
+	scalingTargetDrain float64
+
+	deliveryWorkerCount int
+	deliveriesInFlight  atomic.Int64
+	deliveryStats       *rateWindow
+)
+
+func init() {
+	scalingWindow = getEnvInt("SCALING_WINDOW_SEC", 60)
+	if scalingWindow < 1 {
+		scalingWindow = 1
+	}
+	scalingTargetDrain = float64(getEnvInt("SCALING_TARGET_DRAIN_SEC", 30))
+	deliveryStats = newRateWindow(scalingWindow)
+}
+
+// rateBucket holds one second of delivery activity
+type rateBucket struct {
+	second      int64
+	arrivals    int
+	completions int
+	busy        time.Duration
+}
+
+// rateWindow counts queue arrivals and completed deliveries per second over
+// a sliding window
+type rateWindow struct {
+	mu      sync.Mutex
+	buckets []rateBucket
+	started time.Time
+}
+
+func newRateWindow(seconds int) *rateWindow {
+	return &rateWindow{buckets: make([]rateBucket, seconds), started: time.Now()}
+}
+
+// bucket returns the bucket for now, clearing it if it holds an older second
+func (w *rateWindow) bucket(now time.Time) *rateBucket {
+	second := now.Unix()
+	b := &w.buckets[second%int64(len(w.buckets))]
+	if b.second != second {
+		*b = rateBucket{second: second}
+	}
+	return b
+}
+
+// arrived counts a job entering the delivery queue
+func (w *rateWindow) arrived(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.bucket(now).arrivals++
+}
+
+// completed counts a job a worker spent busy on
+func (w *rateWindow) completed(now time.Time, busy time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	b := w.bucket(now)
+	b.completions++
+	b.busy += busy
+}
+
+// rates returns arrivals and completions per second and the average time a
+// worker spends on a job, over the window (or the uptime, if shorter)
+func (w *rateWindow) rates(now time.Time) (arrivalRate, completionRate float64, avgBusy time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	oldest := now.Unix() - int64(len(w.buckets)) + 1
+	var arrivals, completions int
+	var busy time.Duration
+	for _, b := range w.buckets {
+		if b.second >= oldest && b.second <= now.Unix() {
+			arrivals += b.arrivals
+			completions += b.completions
+			busy += b.busy
+		}
+	}
+
+	span := math.Min(float64(len(w.buckets)), math.Max(now.Sub(w.started).Seconds(), 1))
+	arrivalRate = float64(arrivals) / span
+	completionRate = float64(completions) / span
+	if completions > 0 {
+		avgBusy = busy / time.Duration(completions)
+	}
+	return arrivalRate, completionRate, avgBusy
+}
+
+// Scaling hints endpoint
+func adminScalingHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "admin_scaling")
+	defer endSpan()
+
+	start := time.Now()
+
+	queueDepth := len(deliveryQueue)
+	inFlight := int(deliveriesInFlight.Load())
+	backlog := float64(queueDepth + inFlight)
+	arrivalRate, completionRate, avgBusy := deliveryStats.rates(time.Now())
+
+	// Until a delivery has finished there is nothing to estimate from
+	var capacity, drainTime float64
+	desiredWorkers := deliveryWorkerCount
+	if avgBusy > 0 {
+		perWorker := 1 / avgBusy.Seconds()
+		capacity = float64(deliveryWorkerCount) * perWorker
+		if capacity > 0 {
+			drainTime = backlog / capacity
+		}
+		needed := (arrivalRate + backlog/scalingTargetDrain) / perWorker
+		desiredWorkers = max(1, int(math.Ceil(needed)))
+	}
+
+	writeJSON(w, http.StatusOK, models.ScalingStatus{
+		OK:                 true,
+		QueueDepth:         queueDepth,
+		QueueCapacity:      cap(deliveryQueue),
+		InFlight:           inFlight,
+		Workers:            deliveryWorkerCount,
+		ArrivalRate:        roundRate(arrivalRate),
+		CompletionRate:     roundRate(completionRate),
+		CapacityRate:       roundRate(capacity),
+		AvgDeliverySeconds: roundRate(avgBusy.Seconds()),
+		DrainTimeSeconds:   roundRate(drainTime),
+		DesiredWorkers:     desiredWorkers,
+		Saturated:          capacity > 0 && arrivalRate >= capacity,
+		WindowSeconds:      scalingWindow,
+	})
+	logger.CountRequest(ctx, "/admin/scaling", 200)
+	logger.RecordDuration(ctx, "/admin/scaling", time.Since(start))
+}
+
+// roundRate rounds to three decimals for readability
+func roundRate(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
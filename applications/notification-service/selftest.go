@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"time"
+)
+
+// Startup self-test
+//
+// `notification-service --selftest` checks the wiring and exits instead of
+// serving traffic: the configuration (no setting fell back to its default
+// because it was invalid) and telemetry (a test log line, span and metric
+// reach Alloy). The service calls no other services, so there are no
+// dependencies to check. Each check is logged; the exit code is 1 if any
+// failed, so the same image can run it as an init container.
+
+var selfTestMode = flag.Bool("selftest", false, "check configuration and telemetry, then exit")
+
+// selfTestCheck is one check of the self-test
+type selfTestCheck struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// runSelfTest runs the checks in order and returns the exit code
+func runSelfTest(checks []selfTestCheck) int {
+	ctx := context.Background()
+	failed := 0
+	for _, check := range checks {
+		start := time.Now()
+		err := check.run(ctx)
+		fields := map[string]interface{}{
+			"check":       check.name,
+			"duration_ms": time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			failed++
+			logger.Error(ctx, "Self-test check failed", err, fields)
+		} else {
+			logger.Info(ctx, "Self-test check passed", fields)
+		}
+	}
+
+	logger.Info(ctx, "Self-test finished", map[string]interface{}{
+		"checks": len(checks),
+		"failed": failed,
+	})
+	logger.Shutdown(ctx)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// notificationSelfTestChecks are the checks of the notification service
+func notificationSelfTestChecks() []selfTestCheck {
+	return []selfTestCheck{
+		{name: "config", run: checkConfig},
+		{name: "telemetry", run: logger.SelfTest},
+	}
+}
+
+// checkConfig fails if settings were invalid
+func checkConfig(ctx context.Context) error {
+	var errs []error
+	for _, warning := range config.Warnings() {
+		errs = append(errs, errors.New(warning))
+	}
+	return errors.Join(errs...)
+}
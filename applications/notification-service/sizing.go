@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Message size limits
+//
+// Each channel can have a maximum message size in characters
+// (CHANNEL_MESSAGE_LIMITS, e.g. "sms=160:split,slack=4000:truncate"). Oversized
+// messages are handled according to the channel's policy, falling back to
+// MESSAGE_SIZE_POLICY:
+//
+//	reject   - the send fails with 413
+//	truncate - the message is cut and ends with an ellipsis marker
+//	split    - the message is delivered as several parts
+
+const (
+	sizePolicyReject   = "reject"
+	sizePolicyTruncate = "truncate"
+	sizePolicySplit    = "split"
+
+	ellipsisMarker = "…"
+)
+
+var errMessageTooLarge = errors.New("message exceeds channel size limit")
+
+// channelSizeLimit is the size limit and overflow policy of a channel
+type channelSizeLimit struct {
+	maxSize int
+	policy  string
+}
+
+var channelSizeLimits map[string]channelSizeLimit
+
+func init() {
+	channelSizeLimits = parseChannelSizeLimits(
+		getEnvString("CHANNEL_MESSAGE_LIMITS", "sms=160:split,slack=4000:truncate,push=240:truncate"),
+		getEnvString("MESSAGE_SIZE_POLICY", sizePolicyReject),
+	)
+}
+
+// parseChannelSizeLimits parses "channel=max[:policy],..." into size limits
+func parseChannelSizeLimits(spec, defaultPolicy string) map[string]channelSizeLimit {
+	limits := make(map[string]channelSizeLimit)
+	for _, entry := range strings.Split(spec, ",") {
+		channel, value, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found {
+			continue
+		}
+		size, policy, _ := strings.Cut(value, ":")
+		maxSize, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil || maxSize <= 0 {
+			continue
+		}
+		if policy == "" {
+			policy = defaultPolicy
+		}
+		switch policy {
+		case sizePolicyReject, sizePolicyTruncate, sizePolicySplit:
+		default:
+			policy = sizePolicyReject
+		}
+		limits[strings.TrimSpace(channel)] = channelSizeLimit{maxSize: maxSize, policy: policy}
+	}
+	return limits
+}
+
+// applySizeLimit returns the message parts to deliver on a channel, or
+// errMessageTooLarge if the message must be rejected
+func applySizeLimit(channel, message string) ([]string, error) {
+	limit, ok := channelSizeLimits[channel]
+	runes := []rune(message)
+	if !ok || len(runes) <= limit.maxSize {
+		return []string{message}, nil
+	}
+
+	switch limit.policy {
+	case sizePolicyTruncate:
+		marker := []rune(ellipsisMarker)
+		if limit.maxSize <= len(marker) {
+			// No room for text; the marker alone still shows the cut
+			return []string{string(marker[:limit.maxSize])}, nil
+		}
+		return []string{string(runes[:limit.maxSize-len(marker)]) + ellipsisMarker}, nil
+
+	case sizePolicySplit:
+		parts := make([]string, 0, (len(runes)+limit.maxSize-1)/limit.maxSize)
+		for len(runes) > 0 {
+			n := min(limit.maxSize, len(runes))
+			parts = append(parts, string(runes[:n]))
+			runes = runes[n:]
+		}
+		return parts, nil
+
+	default:
+		return nil, fmt.Errorf("%w: %d characters, %s allows %d", errMessageTooLarge, len(runes), channel, limit.maxSize)
+	}
+}
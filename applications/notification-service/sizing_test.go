@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// withSizeLimits replaces channelSizeLimits for the duration of a test
+func withSizeLimits(t *testing.T, limits map[string]channelSizeLimit) {
+	t.Helper()
+	previous := channelSizeLimits
+	channelSizeLimits = limits
+	t.Cleanup(func() { channelSizeLimits = previous })
+}
+
+func TestApplySizeLimitReject(t *testing.T) {
+	withSizeLimits(t, map[string]channelSizeLimit{"sms": {maxSize: 5, policy: sizePolicyReject}})
+
+	tests := []struct {
+		name    string
+		channel string
+		message string
+		wantErr bool
+	}{
+		{"under the limit", "sms", "hi", false},
+		{"at the limit", "sms", "hello", false},
+		{"at the limit in runes", "sms", "héllö", false},
+		{"over the limit", "sms", "hello!", true},
+		{"channel without a limit", "email", strings.Repeat("x", 1000), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := applySizeLimit(tt.channel, tt.message)
+			if tt.wantErr {
+				if !errors.Is(err, errMessageTooLarge) {
+					t.Fatalf("err = %v, want errMessageTooLarge", err)
+				}
+				if parts != nil {
+					t.Errorf("parts = %q, want none", parts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want := []string{tt.message}; !reflect.DeepEqual(parts, want) {
+				t.Errorf("parts = %q, want %q", parts, want)
+			}
+		})
+	}
+}
+
+func TestApplySizeLimitTruncate(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int
+		message string
+		want    string
+	}{
+		{"ascii", 10, "The quick brown fox", "The quick…"},
+		{"multi-byte", 4, "héllö wörld", "hél…"},
+		{"emoji", 3, "🙂🙂🙂🙂", "🙂🙂…"},
+		{"room for the marker only", 1, "hello", "…"},
+		{"not over the limit", 10, "short", "short"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSizeLimits(t, map[string]channelSizeLimit{"push": {maxSize: tt.maxSize, policy: sizePolicyTruncate}})
+
+			parts, err := applySizeLimit("push", tt.message)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(parts) != 1 || parts[0] != tt.want {
+				t.Fatalf("parts = %q, want [%q]", parts, tt.want)
+			}
+			if utf8.RuneCountInString(tt.message) > tt.maxSize {
+				if n := utf8.RuneCountInString(parts[0]); n != tt.maxSize {
+					t.Errorf("truncated to %d runes, want %d", n, tt.maxSize)
+				}
+				if !strings.HasSuffix(parts[0], ellipsisMarker) {
+					t.Errorf("%q doesn't end in %q", parts[0], ellipsisMarker)
+				}
+			}
+		})
+	}
+}
+
+func TestApplySizeLimitSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int
+		message string
+		want    []string
+	}{
+		{"ascii", 4, "abcdefghij", []string{"abcd", "efgh", "ij"}},
+		{"exact multiple", 3, "abcdef", []string{"abc", "def"}},
+		{"two-byte runes", 2, "ééééé", []string{"éé", "éé", "é"}},
+		{"mixed widths", 3, "a€🙂bc€", []string{"a€🙂", "bc€"}},
+		{"not over the limit", 10, "short", []string{"short"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSizeLimits(t, map[string]channelSizeLimit{"sms": {maxSize: tt.maxSize, policy: sizePolicySplit}})
+
+			parts, err := applySizeLimit("sms", tt.message)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(parts, tt.want) {
+				t.Fatalf("parts = %q, want %q", parts, tt.want)
+			}
+			for _, part := range parts {
+				if !utf8.ValidString(part) {
+					t.Errorf("part %q splits a rune", part)
+				}
+			}
+			if joined := strings.Join(parts, ""); joined != tt.message {
+				t.Errorf("parts join to %q, want %q", joined, tt.message)
+			}
+		})
+	}
+}
+
+func TestParseChannelSizeLimits(t *testing.T) {
+	tests := []struct {
+		name          string
+		spec          string
+		defaultPolicy string
+		want          map[string]channelSizeLimit
+	}{
+		{
+			name:          "policies",
+			spec:          "sms=160:split, slack=4000:truncate,push=240:reject",
+			defaultPolicy: sizePolicyReject,
+			want: map[string]channelSizeLimit{
+				"sms":   {maxSize: 160, policy: sizePolicySplit},
+				"slack": {maxSize: 4000, policy: sizePolicyTruncate},
+				"push":  {maxSize: 240, policy: sizePolicyReject},
+			},
+		},
+		{
+			name:          "default policy",
+			spec:          "sms=160",
+			defaultPolicy: sizePolicyTruncate,
+			want:          map[string]channelSizeLimit{"sms": {maxSize: 160, policy: sizePolicyTruncate}},
+		},
+		{
+			name:          "unknown policy falls back to reject",
+			spec:          "sms=160:shorten",
+			defaultPolicy: sizePolicySplit,
+			want:          map[string]channelSizeLimit{"sms": {maxSize: 160, policy: sizePolicyReject}},
+		},
+		{
+			name:          "unknown default policy falls back to reject",
+			spec:          "sms=160",
+			defaultPolicy: "drop",
+			want:          map[string]channelSizeLimit{"sms": {maxSize: 160, policy: sizePolicyReject}},
+		},
+		{
+			name:          "invalid entries skipped",
+			spec:          "sms,slack=abc,push=0,email=-5,webhook=100",
+			defaultPolicy: sizePolicyReject,
+			want:          map[string]channelSizeLimit{"webhook": {maxSize: 100, policy: sizePolicyReject}},
+		},
+		{
+			name:          "empty",
+			spec:          "",
+			defaultPolicy: sizePolicyReject,
+			want:          map[string]channelSizeLimit{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseChannelSizeLimits(tt.spec, tt.defaultPolicy); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseChannelSizeLimits(%q, %q) = %v, want %v", tt.spec, tt.defaultPolicy, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Storage
+//
+// Notification records and registered devices live in memory. With
+// STORAGE_BACKEND=bbolt every change is also written to an embedded bbolt
+// file at STORAGE_PATH and the stores are reloaded from it at startup, so a
+// single-node lab keeps its notifications and devices across restarts
+// without running a database. Evicted notifications are deleted from the
+// file too, so it stays within NOTIFICATION_RETENTION records. A write that
+// fails is logged and the change is kept in memory only. A new notification
+// is written in one transaction with its outbox entries, from which
+// deliveries cut short by a restart are resumed (see outbox.go). The buckets
+// are created by the file's migrations (see migrations.go).
+
+const (
+	storageMemory = "memory"
+	storageBbolt  = "bbolt"
+
+	bucketNotifications = "notifications"
+	bucketDevices       = "devices"
+	bucketOutbox        = "outbox"
+)
+
+// storageBackend persists the records of the in-memory stores as JSON
+// values in buckets
+type storageBackend interface {
+	// load calls fn with every record of a bucket
+	load(bucket string, fn func(key string, value []byte) error) error
+	put(bucket, key string, value []byte) error
+	delete(bucket, key string) error
+	// update applies writes all together or not at all
+	update(writes []storageWrite) error
+	close() error
+}
+
+// storageWrite is a put of value under key, or a delete if value is nil
+type storageWrite struct {
+	bucket string
+	key    string
+	value  []byte
+}
+
+// storage is the configured backend, nil with STORAGE_BACKEND=memory
+var storage storageBackend
+
+// openStorage opens the backend selected by STORAGE_BACKEND and loads the
+// stores from it
+func openStorage() error {
+	switch backend := getEnvString("STORAGE_BACKEND", storageMemory); backend {
+	case storageMemory:
+		return nil
+	case storageBbolt:
+		db, err := openBoltStorage(getEnvString("STORAGE_PATH", "notification-service.db"))
+		if err != nil {
+			return err
+		}
+		migrations, err := loadMigrations()
+		if err == nil {
+			applied, err = db.migrate(migrations)
+		}
+		if err != nil {
+			db.close()
+			return fmt.Errorf("migrating storage: %w", err)
+		}
+		storage = db
+	default:
+		return fmt.Errorf("unknown STORAGE_BACKEND %q, expected memory or bbolt", backend)
+	}
+
+	if err := notifications.load(storage); err != nil {
+		return fmt.Errorf("loading notifications: %w", err)
+	}
+	if err := devices.load(storage); err != nil {
+		return fmt.Errorf("loading devices: %w", err)
+	}
+	if err := outbox.load(storage); err != nil {
+		return fmt.Errorf("loading outbox: %w", err)
+	}
+	return nil
+}
+
+// closeStorage closes the backend, if any
+func closeStorage() error {
+	if storage == nil {
+		return nil
+	}
+	return storage.close()
+}
+
+// persist writes a record to the backend, if any
+func persist(bucket, key string, record interface{}) {
+	if storage == nil {
+		return
+	}
+	value, err := json.Marshal(record)
+	if err == nil {
+		err = storage.put(bucket, key, value)
+	}
+	if err != nil {
+		logger.Error(context.Background(), "Failed to persist record", err, map[string]interface{}{
+			"bucket": bucket,
+			"key":    key,
+		})
+	}
+}
+
+// storedRecord is a record for persistAll, or a delete if record is nil
+type storedRecord struct {
+	bucket string
+	key    string
+	record interface{}
+}
+
+// persistAll writes records to the backend, if any, in one transaction
+func persistAll(records ...storedRecord) {
+	if storage == nil {
+		return
+	}
+	writes := make([]storageWrite, len(records))
+	keys := make([]string, len(records))
+	var err error
+	for i, r := range records {
+		writes[i] = storageWrite{bucket: r.bucket, key: r.key}
+		keys[i] = r.bucket + "/" + r.key
+		if r.record != nil && err == nil {
+			writes[i].value, err = json.Marshal(r.record)
+		}
+	}
+	if err == nil {
+		err = storage.update(writes)
+	}
+	if err != nil {
+		logger.Error(context.Background(), "Failed to persist records", err, map[string]interface{}{
+			"keys": strings.Join(keys, ","),
+		})
+	}
+}
+
+// unpersist deletes a record from the backend, if any
+func unpersist(bucket, key string) {
+	if storage == nil {
+		return
+	}
+	if err := storage.delete(bucket, key); err != nil {
+		logger.Error(context.Background(), "Failed to delete persisted record", err, map[string]interface{}{
+			"bucket": bucket,
+			"key":    key,
+		})
+	}
+}
+
+// boltStorage is a storageBackend in a bbolt file
+type boltStorage struct {
+	db *bolt.DB
+}
+
+// openBoltStorage opens (or creates) the bbolt file at path; migrate it
+// before use
+func openBoltStorage(path string) (*boltStorage, error) {
+	// A second process on the same file waits a moment, then fails
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	return &boltStorage{db: db}, nil
+}
+
+func (s *boltStorage) load(bucket string, fn func(key string, value []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
+
+func (s *boltStorage) put(bucket, key string, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).Put([]byte(key), value)
+	})
+}
+
+func (s *boltStorage) delete(bucket, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).Delete([]byte(key))
+	})
+}
+
+func (s *boltStorage) update(writes []storageWrite) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, write := range writes {
+			b := tx.Bucket([]byte(write.bucket))
+			var err error
+			if write.value == nil {
+				err = b.Delete([]byte(write.key))
+			} else {
+				err = b.Put([]byte(write.key), write.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStorage) close() error {
+	return s.db.Close()
+}
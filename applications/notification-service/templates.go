@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/gorilla/mux"
+	"notification-service/models"
+)
+
+// Notification templates
+//
+// Templates are stored in memory and versioned: every PUT creates a new
+// version instead of mutating the previous one. A version is either a draft
+// or published; sends that reference a template always render the latest
+// published version. Templates are rendered once with sample values when they
+// are saved so that broken templates are rejected before they reach a send.
+
+const (
+	templateStatusDraft     = "draft"
+	templateStatusPublished = "published"
+)
+
+// Templates are the API's models
+type (
+	Template        = models.Template
+	TemplateVersion = models.TemplateVersion
+)
+
+// templateStore keeps all templates in memory
+type templateStore struct {
+	mu        sync.RWMutex
+	templates map[string]*Template
+	nextID    int
+}
+
+var templates = &templateStore{templates: make(map[string]*Template)}
+
+// create stores a new template with the request as version 1
+func (s *templateStore) create(req models.TemplateRequest) *Template {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	now := time.Now().UTC()
+	tmpl := &Template{
+		ID:        fmt.Sprintf("tmpl_%d", s.nextID),
+		Name:      req.Name,
+		Channel:   req.Channel,
+		CreatedAt: now,
+	}
+	s.addVersion(tmpl, req, now)
+	s.templates[tmpl.ID] = tmpl
+
+	return cloneTemplate(tmpl)
+}
+
+// update appends a new version to an existing template
+func (s *templateStore) update(id string, req models.TemplateRequest) (*Template, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmpl, ok := s.templates[id]
+	if !ok {
+		return nil, false
+	}
+	if req.Name != "" {
+		tmpl.Name = req.Name
+	}
+	if req.Channel != "" {
+		tmpl.Channel = req.Channel
+	}
+	s.addVersion(tmpl, req, time.Now().UTC())
+
+	return cloneTemplate(tmpl), true
+}
+
+// addVersion appends a version; the caller must hold the write lock
+func (s *templateStore) addVersion(tmpl *Template, req models.TemplateRequest, now time.Time) {
+	version := TemplateVersion{
+		Version:   len(tmpl.Versions) + 1,
+		Status:    req.Status,
+		Subject:   req.Subject,
+		Body:      req.Body,
+		Variables: req.Variables,
+		CreatedAt: now,
+	}
+	tmpl.Versions = append(tmpl.Versions, version)
+	if version.Status == templateStatusPublished {
+		tmpl.PublishedVersion = version.Version
+	}
+	tmpl.UpdatedAt = now
+}
+
+// get returns a copy of a template
+func (s *templateStore) get(id string) (*Template, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tmpl, ok := s.templates[id]
+	if !ok {
+		return nil, false
+	}
+	return cloneTemplate(tmpl), true
+}
+
+// list returns copies of all templates, oldest first (by ID when created
+// at the same time)
+func (s *templateStore) list() []*Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*Template, 0, len(s.templates))
+	for _, tmpl := range s.templates {
+		result = append(result, cloneTemplate(tmpl))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// cloneTemplate returns a deep copy that is safe to use outside the store lock
+func cloneTemplate(t *Template) *Template {
+	c := *t
+	c.Versions = append([]TemplateVersion(nil), t.Versions...)
+	return &c
+}
+
+// publishedVersion returns the version of a template that sends should use
+func publishedVersion(t *Template) (TemplateVersion, bool) {
+	if t.PublishedVersion == 0 {
+		return TemplateVersion{}, false
+	}
+	return t.Versions[t.PublishedVersion-1], true
+}
+
+// renderVersion executes a template version with the given variables
+func renderVersion(v TemplateVersion, vars map[string]string) (subject, body string, err error) {
+	subject, err = renderText("subject", v.Subject, vars)
+	if err != nil {
+		return "", "", err
+	}
+	body, err = renderText("body", v.Body, vars)
+	if err != nil {
+		return "", "", err
+	}
+	return subject, body, nil
+}
+
+// renderText parses and executes text, failing on any missing variable
+func renderText(name, text string, vars map[string]string) (string, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// validateTemplateRequest checks required fields and renders the template
+// with placeholder values for every declared variable
+func validateTemplateRequest(req *models.TemplateRequest, requireName bool) error {
+	if requireName && req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if req.Body == "" {
+		return fmt.Errorf("body is required")
+	}
+	if req.Status == "" {
+		req.Status = templateStatusDraft
+	}
+	if req.Status != templateStatusDraft && req.Status != templateStatusPublished {
+		return fmt.Errorf("status must be %q or %q", templateStatusDraft, templateStatusPublished)
+	}
+
+	sample := make(map[string]string, len(req.Variables))
+	for _, name := range req.Variables {
+		sample[name] = "{" + name + "}"
+	}
+	version := TemplateVersion{Subject: req.Subject, Body: req.Body}
+	if _, _, err := renderVersion(version, sample); err != nil {
+		return err
+	}
+	return nil
+}
+
+// renderPublishedTemplate renders the published version of a template for a send
+func renderPublishedTemplate(id string, vars map[string]string) (string, error) {
+	tmpl, ok := templates.get(id)
+	if !ok {
+		return "", fmt.Errorf("template %s not found", id)
+	}
+	version, ok := publishedVersion(tmpl)
+	if !ok {
+		return "", fmt.Errorf("template %s has no published version", id)
+	}
+	_, body, err := renderVersion(version, vars)
+	return body, err
+}
+
+// Create template endpoint
+func createTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "create_template")
+	defer endSpan()
+
+	start := time.Now()
+
+	var req models.TemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error(ctx, "Failed to parse template request", err)
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		logger.CountRequest(ctx, "/templates", 400)
+		logger.RecordDuration(ctx, "/templates", time.Since(start))
+		return
+	}
+
+	if err := validateTemplateRequest(&req, true); err != nil {
+		logger.Warn(ctx, "Rejected invalid template", map[string]interface{}{
+			"name":  req.Name,
+			"error": err.Error(),
+		})
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		logger.CountRequest(ctx, "/templates", 422)
+		logger.RecordDuration(ctx, "/templates", time.Since(start))
+		return
+	}
+
+	tmpl := templates.create(req)
+
+	logger.Info(ctx, "Template created", map[string]interface{}{
+		"template_id": tmpl.ID,
+		"name":        tmpl.Name,
+		"status":      req.Status,
+	})
+
+	writeJSON(w, http.StatusCreated, models.TemplateResponse{
+		OK:       true,
+		Template: tmpl,
+	})
+
+	logger.CountRequest(ctx, "/templates", 201)
+	logger.RecordDuration(ctx, "/templates", time.Since(start))
+}
+
+// List templates endpoint
+func listTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "list_templates")
+	defer endSpan()
+
+	start := time.Now()
+
+	result := templates.list()
+
+	writeJSON(w, http.StatusOK, models.TemplateList{
+		OK:         true,
+		Templates:  result,
+		TotalCount: len(result),
+	})
+
+	logger.CountRequest(ctx, "/templates", 200)
+	logger.RecordDuration(ctx, "/templates", time.Since(start))
+}
+
+// Get template endpoint
+func getTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "get_template")
+	defer endSpan()
+
+	start := time.Now()
+	id := mux.Vars(r)["id"]
+
+	tmpl, ok := templates.get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Template not found")
+		logger.CountRequest(ctx, "/templates/{id}", 404)
+		logger.RecordDuration(ctx, "/templates/{id}", time.Since(start))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.TemplateResponse{
+		OK:       true,
+		Template: tmpl,
+	})
+
+	logger.CountRequest(ctx, "/templates/{id}", 200)
+	logger.RecordDuration(ctx, "/templates/{id}", time.Since(start))
+}
+
+// Update template endpoint - stores the request as a new version
+func updateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "update_template")
+	defer endSpan()
+
+	start := time.Now()
+	id := mux.Vars(r)["id"]
+
+	var req models.TemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error(ctx, "Failed to parse template request", err)
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		logger.CountRequest(ctx, "/templates/{id}", 400)
+		logger.RecordDuration(ctx, "/templates/{id}", time.Since(start))
+		return
+	}
+
+	if err := validateTemplateRequest(&req, false); err != nil {
+		logger.Warn(ctx, "Rejected invalid template", map[string]interface{}{
+			"template_id": id,
+			"error":       err.Error(),
+		})
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		logger.CountRequest(ctx, "/templates/{id}", 422)
+		logger.RecordDuration(ctx, "/templates/{id}", time.Since(start))
+		return
+	}
+
+	tmpl, ok := templates.update(id, req)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Template not found")
+		logger.CountRequest(ctx, "/templates/{id}", 404)
+		logger.RecordDuration(ctx, "/templates/{id}", time.Since(start))
+		return
+	}
+
+	logger.Info(ctx, "Template updated", map[string]interface{}{
+		"template_id": tmpl.ID,
+		"version":     len(tmpl.Versions),
+		"status":      req.Status,
+	})
+
+	writeJSON(w, http.StatusOK, models.TemplateResponse{
+		OK:       true,
+		Template: tmpl,
+	})
+
+	logger.CountRequest(ctx, "/templates/{id}", 200)
+	logger.RecordDuration(ctx, "/templates/{id}", time.Since(start))
+}
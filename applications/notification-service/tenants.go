@@ -0,0 +1,261 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"notification-service/models"
+)
+
+// Per-tenant channel configuration
+//
+// Tenants can bring their own provider credentials (a Slack webhook, an SMTP
+// account, ...) per channel. Credentials are encrypted with AES-GCM before
+// they are stored and are only decrypted at send time. The tenant of a send is
+// taken from the X-Tenant-ID header propagated by the gateway; sends without a
+// tenant, or for a channel the tenant has not configured, use the default
+// provider.
+
+const (
+	tenantHeader    = "X-Tenant-ID"
+	defaultProvider = "default"
+)
+
+// TenantChannelConfig is the API's model of a channel configuration
+type TenantChannelConfig = models.TenantChannelConfig
+
+// tenantChannel is the stored configuration with encrypted credentials
+type tenantChannel struct {
+	TenantChannelConfig
+	sealedCredentials []byte
+}
+
+// tenantStore keeps encrypted tenant channel configuration in memory
+type tenantStore struct {
+	mu       sync.RWMutex
+	channels map[string]map[string]*tenantChannel
+	aead     cipher.AEAD
+}
+
+var tenants *tenantStore
+
+func init() {
+	secret := getEnvString("TENANT_CREDENTIALS_KEY", "")
+	key := sha256.Sum256([]byte(secret))
+	if secret == "" {
+		// Without a configured key, credentials only need to be readable by
+		// this process, so a random key is good enough
+		if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+			panic(fmt.Sprintf("failed to generate tenant credentials key: %v", err))
+		}
+	}
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		panic(fmt.Sprintf("failed to create tenant credentials cipher: %v", err))
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create tenant credentials cipher: %v", err))
+	}
+
+	tenants = &tenantStore{
+		channels: make(map[string]map[string]*tenantChannel),
+		aead:     aead,
+	}
+}
+
+// put encrypts and stores the credentials for a tenant channel
+func (s *tenantStore) put(tenantID, channel string, req models.TenantChannelRequest) (TenantChannelConfig, error) {
+	plaintext, err := json.Marshal(req.Credentials)
+	if err != nil {
+		return TenantChannelConfig{}, err
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return TenantChannelConfig{}, err
+	}
+	// The tenant and channel are bound as additional data so a sealed blob
+	// can't be moved to another tenant
+	sealed := s.aead.Seal(nonce, nonce, plaintext, []byte(tenantID+"/"+channel))
+
+	entry := &tenantChannel{
+		TenantChannelConfig: TenantChannelConfig{
+			TenantID:  tenantID,
+			Channel:   channel,
+			Provider:  req.Provider,
+			UpdatedAt: time.Now().UTC(),
+		},
+		sealedCredentials: sealed,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.channels[tenantID] == nil {
+		s.channels[tenantID] = make(map[string]*tenantChannel)
+	}
+	s.channels[tenantID][channel] = entry
+
+	return entry.TenantChannelConfig, nil
+}
+
+// list returns the public configuration of all channels of a tenant
+func (s *tenantStore) list(tenantID string) []TenantChannelConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]TenantChannelConfig, 0, len(s.channels[tenantID]))
+	for _, entry := range s.channels[tenantID] {
+		result = append(result, entry.TenantChannelConfig)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Channel < result[j].Channel
+	})
+	return result
+}
+
+// delete removes a tenant channel configuration
+func (s *tenantStore) delete(tenantID, channel string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.channels[tenantID][channel]; !ok {
+		return false
+	}
+	delete(s.channels[tenantID], channel)
+	return true
+}
+
+// resolve returns the provider and decrypted credentials to use for a send
+func (s *tenantStore) resolve(tenantID, channel string) (string, map[string]string, error) {
+	s.mu.RLock()
+	entry, ok := s.channels[tenantID][channel]
+	s.mu.RUnlock()
+	if !ok {
+		return defaultProvider, nil, nil
+	}
+
+	nonceSize := s.aead.NonceSize()
+	nonce, ciphertext := entry.sealedCredentials[:nonceSize], entry.sealedCredentials[nonceSize:]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, []byte(tenantID+"/"+channel))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decrypt credentials for tenant %s channel %s: %w", tenantID, channel, err)
+	}
+
+	var credentials map[string]string
+	if err := json.Unmarshal(plaintext, &credentials); err != nil {
+		return "", nil, err
+	}
+	return entry.Provider, credentials, nil
+}
+
+// Put tenant channel configuration endpoint
+func putTenantChannelHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "put_tenant_channel")
+	defer endSpan()
+
+	start := time.Now()
+	vars := mux.Vars(r)
+	tenantID, channel := vars["tenant"], vars["channel"]
+
+	var req models.TenantChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error(ctx, "Failed to parse tenant channel request", err)
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		logger.CountRequest(ctx, "/tenants/{tenant}/channels/{channel}", 400)
+		logger.RecordDuration(ctx, "/tenants/{tenant}/channels/{channel}", time.Since(start))
+		return
+	}
+
+	if req.Provider == "" || len(req.Credentials) == 0 {
+		writeError(w, http.StatusUnprocessableEntity, "provider and credentials are required")
+		logger.CountRequest(ctx, "/tenants/{tenant}/channels/{channel}", 422)
+		logger.RecordDuration(ctx, "/tenants/{tenant}/channels/{channel}", time.Since(start))
+		return
+	}
+
+	config, err := tenants.put(tenantID, channel, req)
+	if err != nil {
+		logger.Error(ctx, "Failed to store tenant channel configuration", err, map[string]interface{}{
+			"tenant_id": tenantID,
+			"channel":   channel,
+		})
+		writeError(w, http.StatusInternalServerError, "Failed to store channel configuration")
+		logger.CountRequest(ctx, "/tenants/{tenant}/channels/{channel}", 500)
+		logger.RecordDuration(ctx, "/tenants/{tenant}/channels/{channel}", time.Since(start))
+		return
+	}
+
+	// Never log the credentials themselves
+	logger.Info(ctx, "Tenant channel configured", map[string]interface{}{
+		"tenant_id": tenantID,
+		"channel":   channel,
+		"provider":  req.Provider,
+	})
+
+	writeJSON(w, http.StatusOK, models.TenantChannelResponse{
+		OK:      true,
+		Channel: config,
+	})
+
+	logger.CountRequest(ctx, "/tenants/{tenant}/channels/{channel}", 200)
+	logger.RecordDuration(ctx, "/tenants/{tenant}/channels/{channel}", time.Since(start))
+}
+
+// List tenant channel configuration endpoint
+func listTenantChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "list_tenant_channels")
+	defer endSpan()
+
+	start := time.Now()
+	tenantID := mux.Vars(r)["tenant"]
+
+	channels := tenants.list(tenantID)
+
+	writeJSON(w, http.StatusOK, models.TenantChannelList{
+		OK:       true,
+		TenantID: tenantID,
+		Channels: channels,
+	})
+
+	logger.CountRequest(ctx, "/tenants/{tenant}/channels", 200)
+	logger.RecordDuration(ctx, "/tenants/{tenant}/channels", time.Since(start))
+}
+
+// Delete tenant channel configuration endpoint
+func deleteTenantChannelHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, endSpan := logger.StartSpan(r.Context(), "delete_tenant_channel")
+	defer endSpan()
+
+	start := time.Now()
+	vars := mux.Vars(r)
+	tenantID, channel := vars["tenant"], vars["channel"]
+
+	if !tenants.delete(tenantID, channel) {
+		writeError(w, http.StatusNotFound, "Channel configuration not found")
+		logger.CountRequest(ctx, "/tenants/{tenant}/channels/{channel}", 404)
+		logger.RecordDuration(ctx, "/tenants/{tenant}/channels/{channel}", time.Since(start))
+		return
+	}
+
+	logger.Info(ctx, "Tenant channel configuration removed", map[string]interface{}{
+		"tenant_id": tenantID,
+		"channel":   channel,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+
+	logger.CountRequest(ctx, "/tenants/{tenant}/channels/{channel}", 204)
+	logger.RecordDuration(ctx, "/tenants/{tenant}/channels/{channel}", time.Since(start))
+}
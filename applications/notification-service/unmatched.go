@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"notification-service/models"
+)
+
+// Unmatched requests
+//
+// Requests that match no route (404) or a route but not its method (405)
+// never reach a handler, so the router's NotFound and MethodNotAllowed
+// handlers give them a span, count them in http_requests_total under the
+// "unmatched" endpoint and answer with an RFC 9457 problem+json body. They
+// are logged at debug level only: most of them are scanners and typos.
+
+const unmatchedRoute = "unmatched"
+
+// writeProblem writes an application/problem+json error response
+func writeProblem(w http.ResponseWriter, status int, detail string, r *http.Request) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	})
+}
+
+// unmatchedHandler answers requests the router has no handler for
+func unmatchedHandler(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, endSpan := logger.StartSpan(r.Context(), "unmatched_route")
+		defer endSpan()
+
+		start := time.Now()
+		logger.AddSpanAttribute(ctx, "http.method", r.Method)
+		logger.AddSpanAttribute(ctx, "http.target", r.URL.Path)
+		logger.AddSpanAttributeInt(ctx, "http.status_code", status)
+
+		detail := "No endpoint matches " + r.URL.Path
+		if status == http.StatusMethodNotAllowed {
+			detail = r.Method + " is not supported on " + r.URL.Path
+		}
+		logger.Debug(ctx, "Unmatched request", map[string]interface{}{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status_code": status,
+		})
+
+		writeProblem(w, status, detail, r)
+		logger.CountRequest(ctx, unmatchedRoute, status)
+		logger.RecordDuration(ctx, unmatchedRoute, time.Since(start))
+	}
+}
@@ -1,5 +1,7 @@
+import hmac
 import os
 import random
+import threading
 import time
 from flask import Flask, jsonify, request
 from faidon_laboratory_logging import Logger, Config
@@ -12,6 +14,17 @@ READY_DELAY = int(os.getenv("READINESS_DELAY_SEC", "10"))
 GREETING = os.getenv("GREETING", "hello")
 START_TIME = time.time()
 
+# /admin requires ADMIN_TOKEN as a bearer token; without it every admin request
+# is rejected, unless ADMIN_AUTH=none opens them for local development
+ADMIN_TOKEN = os.getenv("ADMIN_TOKEN", "")
+ADMIN_AUTH = os.getenv("ADMIN_AUTH", "")
+
+# Fault injected through /admin/chaos: fail_rate replaces FAIL_RATE and
+# latency_ms is added to every request's processing time. A fault with a
+# duration clears itself when it runs out.
+_chaos_lock = threading.Lock()
+_chaos = None
+
 # Initialize logger
 logger = Logger(Config(
     service_name=os.getenv("SERVICE_NAME", "user-service"),
@@ -20,6 +33,95 @@ logger = Logger(Config(
     alloy_url=os.getenv("ALLOY_URL", "grafana-alloy.monitoring.svc.cluster.local:4318")
 ))
 
+if not ADMIN_TOKEN and ADMIN_AUTH != "none":
+    logger.warn("No ADMIN_TOKEN set, admin requests are rejected (ADMIN_AUTH=none opens them)")
+
+def active_fault():
+    """Return the injected fault, clearing it once it has expired"""
+    global _chaos
+    with _chaos_lock:
+        if _chaos and _chaos.get("expires_at") and time.time() >= _chaos["expires_at"]:
+            _chaos = None
+        return _chaos
+
+def current_fail_rate():
+    fault = active_fault()
+    if fault and fault.get("fail_rate") is not None:
+        return fault["fail_rate"]
+    return FAIL_RATE
+
+def chaos_latency():
+    """Seconds added to each request's processing time"""
+    fault = active_fault()
+    return fault["latency_ms"] / 1000 if fault else 0
+
+def admin_authorized():
+    """Check the credentials of an admin request"""
+    if ADMIN_TOKEN:
+        authorization = request.headers.get("Authorization", "")
+        return hmac.compare_digest(authorization.encode(), f"Bearer {ADMIN_TOKEN}".encode())
+    return ADMIN_AUTH == "none"
+
+def parse_duration(value):
+    """Parse a duration such as "90s", "5m" or "1h" into seconds"""
+    units = {"ms": 0.001, "s": 1, "m": 60, "h": 3600}
+    for suffix in ("ms", "s", "m", "h"):
+        if value.endswith(suffix):
+            return float(value[:-len(suffix)]) * units[suffix]
+    raise ValueError(f"invalid duration {value!r}")
+
+@app.route("/admin/chaos", methods=["GET", "PUT", "DELETE"])
+def admin_chaos():
+    """Inject, inspect or clear a fault"""
+    global _chaos
+    with logger.start_span("admin_chaos") as span:
+        if not admin_authorized():
+            logger.warn("Admin action", audit=True, allowed=False, method=request.method, path="/admin/chaos")
+            logger.count_request("/admin/chaos", 401)
+            return jsonify({"ok": False, "error": "Admin credentials required"}), 401, {"WWW-Authenticate": 'Bearer realm="admin"'}
+
+        if request.method == "PUT":
+            data = request.get_json(silent=True) or {}
+            try:
+                fail_rate = data.get("fail_rate")
+                if fail_rate is not None:
+                    fail_rate = float(fail_rate)
+                    if not 0 <= fail_rate <= 1:
+                        raise ValueError("fail_rate out of range")
+                latency_ms = int(data.get("latency_ms", 0))
+                if latency_ms < 0:
+                    raise ValueError("negative latency_ms")
+                duration = parse_duration(data["duration"]) if data.get("duration") else 0
+            except (TypeError, ValueError) as e:
+                logger.count_request("/admin/chaos", 400)
+                return jsonify({"ok": False, "error": f'Expected {{"fail_rate": 0-1, "latency_ms": >=0, "duration": "<duration>"}}: {e}'}), 400
+
+            fault = {"fail_rate": fail_rate, "latency_ms": latency_ms}
+            if duration > 0:
+                fault["expires_at"] = time.time() + duration
+            with _chaos_lock:
+                _chaos = fault
+            logger.warn("Fault injected", fail_rate=fail_rate, latency_ms=latency_ms,
+                        duration=data.get("duration", ""))
+        elif request.method == "DELETE":
+            with _chaos_lock:
+                cleared = _chaos is not None
+                _chaos = None
+            if cleared:
+                logger.info("Fault cleared")
+
+        fault = active_fault()
+        if fault and fault.get("expires_at"):
+            fault = dict(fault, expires_at=time.strftime("%Y-%m-%dT%H:%M:%SZ", time.gmtime(fault["expires_at"])))
+        logger.count_request("/admin/chaos", 200)
+        return jsonify({
+            "ok": True,
+            "fault": fault,
+            "fail_rate": current_fail_rate(),
+            "configured_fail_rate": FAIL_RATE,
+            "added_latency_ms": int(chaos_latency() * 1000),
+        }), 200
+
 @app.route("/healthz")
 def healthz():
     with logger.start_span("healthz") as span:
@@ -51,9 +153,9 @@ def work():
         
         try:
             # Simulate user data processing
-            time.sleep(processing_duration)
+            time.sleep(processing_duration + chaos_latency())
             
-            if random.random() < FAIL_RATE:
+            if random.random() < current_fail_rate():
                 logger.error("User processing failed", 
                            Exception("simulated user service failure"),
                            method=request.method,
@@ -98,9 +200,9 @@ def get_user(user_id):
         
         try:
             # Simulate user lookup
-            time.sleep(processing_duration)
+            time.sleep(processing_duration + chaos_latency())
             
-            if random.random() < FAIL_RATE:
+            if random.random() < current_fail_rate():
                 logger.error("User lookup failed", 
                            Exception("simulated user lookup failure"),
                            method=request.method,
@@ -156,9 +258,9 @@ def create_user():
                 return jsonify({"ok": False, "error": "Name and email are required"}), 400
             
             # Simulate user creation processing
-            time.sleep(processing_duration)
+            time.sleep(processing_duration + chaos_latency())
             
-            if random.random() < FAIL_RATE:
+            if random.random() < current_fail_rate():
                 logger.error("User creation failed", 
                            Exception("simulated user creation failure"),
                            method=request.method,
@@ -210,9 +312,9 @@ def get_user_profile(user_id):
         
         try:
             # Simulate profile lookup
-            time.sleep(processing_duration)
+            time.sleep(processing_duration + chaos_latency())
             
-            if random.random() < FAIL_RATE:
+            if random.random() < current_fail_rate():
                 logger.error("User profile lookup failed", 
                            Exception("simulated profile lookup failure"),
                            method=request.method,
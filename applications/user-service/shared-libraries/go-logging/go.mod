@@ -1,6 +1,6 @@
 module github.com/faidon-laboratory/go-logging
 
-go 1.23
+go 1.23.0
 
 require (
 	go.opentelemetry.io/otel v1.38.0
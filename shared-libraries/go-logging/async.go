@@ -0,0 +1,171 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Asynchronous output
+//
+// Writing a line to stdout blocks the request that logs it while the pipe is
+// busy, e.g. while the node's log agent falls behind. With
+// Config.AsyncLogBuffer the JSON lines go into a ring buffer of that many
+// lines instead, and a background goroutine writes them out in order. When
+// the buffer is full the oldest line is dropped, so logging never blocks,
+// and counted in log_buffer_dropped_total. ForceFlush and Shutdown write out
+// what is buffered; after Shutdown lines are written synchronously again.
+// Lines sent to Config.Handler or over OTLP don't go through the buffer.
+
+// asyncWriter buffers the lines written to it and writes them to out from a
+// background goroutine
+type asyncWriter struct {
+	out     io.Writer
+	dropped metric.Int64Counter
+
+	mu    sync.Mutex
+	lines [][]byte
+	head  int
+	count int
+
+	// outMu serializes the writes to out
+	outMu   sync.Mutex
+	wake    chan struct{}
+	flushes chan chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	stopped sync.Once
+}
+
+// newAsyncWriter starts a writer buffering up to size lines for out
+func newAsyncWriter(out io.Writer, size int, meter metric.Meter) *asyncWriter {
+	w := &asyncWriter{
+		out:     out,
+		lines:   make([][]byte, size),
+		wake:    make(chan struct{}, 1),
+		flushes: make(chan chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if meter != nil {
+		var err error
+		w.dropped, err = meter.Int64Counter(
+			"log_buffer_dropped_total",
+			metric.WithDescription("Log lines dropped because the async log buffer was full"),
+		)
+		if err != nil {
+			log.Printf("Failed to create log_buffer_dropped_total counter: %v", err)
+		}
+	}
+	go w.run()
+	return w
+}
+
+// Write buffers a copy of one line, dropping the oldest if the buffer is full
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	select {
+	case <-w.done:
+		w.outMu.Lock()
+		defer w.outMu.Unlock()
+		return w.out.Write(p)
+	default:
+	}
+
+	line := append([]byte(nil), p...)
+	dropped := false
+	w.mu.Lock()
+	if w.count == len(w.lines) {
+		w.lines[w.head] = nil
+		w.head = (w.head + 1) % len(w.lines)
+		w.count--
+		dropped = true
+	}
+	w.lines[(w.head+w.count)%len(w.lines)] = line
+	w.count++
+	w.mu.Unlock()
+
+	if dropped && w.dropped != nil {
+		w.dropped.Add(context.Background(), 1)
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// run writes the buffered lines until the writer is closed
+func (w *asyncWriter) run() {
+	defer close(w.done)
+	for {
+		select {
+		case <-w.wake:
+			w.drain()
+		case flushed := <-w.flushes:
+			w.drain()
+			close(flushed)
+		case <-w.stop:
+			w.drain()
+			return
+		}
+	}
+}
+
+// drain writes every buffered line
+func (w *asyncWriter) drain() {
+	var batch [][]byte
+	for {
+		w.mu.Lock()
+		batch = batch[:0]
+		for ; w.count > 0; w.count-- {
+			batch = append(batch, w.lines[w.head])
+			w.lines[w.head] = nil
+			w.head = (w.head + 1) % len(w.lines)
+		}
+		w.mu.Unlock()
+		if len(batch) == 0 {
+			return
+		}
+
+		w.outMu.Lock()
+		for _, line := range batch {
+			w.out.Write(line)
+		}
+		w.outMu.Unlock()
+	}
+}
+
+// flush waits until the lines buffered so far are written
+func (w *asyncWriter) flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case w.flushes <- flushed:
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close writes the buffered lines and stops the goroutine; later lines are
+// written synchronously
+func (w *asyncWriter) close(ctx context.Context) error {
+	w.stopped.Do(func() { close(w.stop) })
+	select {
+	case <-w.done:
+		// Lines buffered while the goroutine stopped
+		w.drain()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"time"
+
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Export batching
+//
+// Spans, and log lines with LogExport, are queued and sent to AlloyURL in
+// batches; metrics are collected and sent every ExportInterval. The SDK
+// defaults suit most services, but one handling thousands of requests a
+// second fills the span queue between two batches and drops spans, while a
+// quiet one may want its spans in Tempo sooner. Config.Batching sets:
+//
+//	MaxQueueSize        memory: spans or log lines held before new ones are dropped
+//	MaxExportBatchSize  spans or log lines sent per export
+//	BatchTimeout        freshness: longest wait before a partial batch is sent
+//	ExportTimeout       how long one export of spans, log lines or metrics may take
+//
+// Zero values keep the SDK defaults, which read the OTEL_BSP_* and
+// OTEL_BLRP_* environment variables.
+
+// Batching tunes the export of spans, log lines and metrics
+type Batching struct {
+	// MaxQueueSize is the number of spans, and of log lines, held for
+	// export; past it new ones are dropped. 0 means 2048.
+	MaxQueueSize int
+	// MaxExportBatchSize is the most spans or log lines sent in one export;
+	// 0 means 512
+	MaxExportBatchSize int
+	// BatchTimeout is how long spans or log lines wait for a batch to fill
+	// before they are sent anyway; 0 means 5 seconds for spans and 1 for log
+	// lines
+	BatchTimeout time.Duration
+	// ExportTimeout bounds one export of spans, log lines or metrics; 0
+	// means 30 seconds
+	ExportTimeout time.Duration
+}
+
+// spanOptions returns the batch span processor options set in b
+func (b Batching) spanOptions() []sdktrace.BatchSpanProcessorOption {
+	var opts []sdktrace.BatchSpanProcessorOption
+	if b.MaxQueueSize > 0 {
+		opts = append(opts, sdktrace.WithMaxQueueSize(b.MaxQueueSize))
+	}
+	if b.MaxExportBatchSize > 0 {
+		opts = append(opts, sdktrace.WithMaxExportBatchSize(b.MaxExportBatchSize))
+	}
+	if b.BatchTimeout > 0 {
+		opts = append(opts, sdktrace.WithBatchTimeout(b.BatchTimeout))
+	}
+	if b.ExportTimeout > 0 {
+		opts = append(opts, sdktrace.WithExportTimeout(b.ExportTimeout))
+	}
+	return opts
+}
+
+// logOptions returns the batch log processor options set in b
+func (b Batching) logOptions() []sdklog.BatchProcessorOption {
+	var opts []sdklog.BatchProcessorOption
+	if b.MaxQueueSize > 0 {
+		opts = append(opts, sdklog.WithMaxQueueSize(b.MaxQueueSize))
+	}
+	if b.MaxExportBatchSize > 0 {
+		opts = append(opts, sdklog.WithExportMaxBatchSize(b.MaxExportBatchSize))
+	}
+	if b.BatchTimeout > 0 {
+		opts = append(opts, sdklog.WithExportInterval(b.BatchTimeout))
+	}
+	if b.ExportTimeout > 0 {
+		opts = append(opts, sdklog.WithExportTimeout(b.ExportTimeout))
+	}
+	return opts
+}
+
+// metricExportTimeout returns the bound of one metrics export
+func (b Batching) metricExportTimeout() time.Duration {
+	if b.ExportTimeout > 0 {
+		return b.ExportTimeout
+	}
+	return exportTimeout
+}
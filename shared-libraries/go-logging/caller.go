@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Caller and stack traces
+//
+// The same message can be logged from several places, e.g. handlers copied
+// between services. With Config.Caller every line names the code that logged
+// it:
+//
+//	"caller": "api-gateway/summary.go:57", "function": "main.getUserSummaryHandler"
+//
+// The file is given with its directory, which for a service is its module.
+// Lines logged through log/slog with slog.New(logger.Handler()) get the same
+// fields; lines logged by the library itself (the HTTP access line, for one)
+// name the library's code.
+//
+// With Config.StackTraces lines at error level from Error and ErrorFields
+// also carry the stack of the call in "stack", unless they have one already
+// (a recovered panic's).
+
+// maxStackDepth bounds the frames of a logged stack trace
+const maxStackDepth = 32
+
+// emit writes a record at level whose source is the function skip frames up
+// the stack, counted as for runtime.Callers called in emit
+func (l *Logger) emit(ctx context.Context, skip int, level slog.Level, message string, attrs []slog.Attr) {
+	if !l.slog.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(skip, pcs[:])
+	record := slog.NewRecord(time.Now(), level, message, pcs[0])
+	if l.stackTraces && level >= slog.LevelError && !hasAttr(attrs, "stack") {
+		attrs = append(attrs, slog.String("stack", callerStack(skip+1)))
+	}
+	record.AddAttrs(attrs...)
+	_ = l.slog.Handler().Handle(ctx, record)
+}
+
+// hasAttr reports whether attrs has one called key
+func hasAttr(attrs []slog.Attr, key string) bool {
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// callerStack formats the stack from the function skip frames up, counted as
+// for runtime.Callers called in callerStack
+func callerStack(skip int) string {
+	pcs := make([]uintptr, maxStackDepth)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(skip, pcs)])
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// callerHandler adds the caller and function of a record's source
+type callerHandler struct {
+	next slog.Handler
+}
+
+func (h *callerHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *callerHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		record = record.Clone()
+		record.AddAttrs(
+			slog.String("caller", filepath.Join(filepath.Base(filepath.Dir(frame.File)), filepath.Base(frame.File))+":"+strconv.Itoa(frame.Line)),
+			slog.String("function", shortFunction(frame.Function)),
+		)
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *callerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &callerHandler{next: h.next.WithAttrs(attrs)}
+}
+
+func (h *callerHandler) WithGroup(name string) slog.Handler {
+	return &callerHandler{next: h.next.WithGroup(name)}
+}
+
+// shortFunction drops the import path of a function name, leaving
+// package.Function
+func shortFunction(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
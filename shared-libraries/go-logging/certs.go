@@ -0,0 +1,203 @@
+package logging
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLS certificate expiry
+//
+// tls_certificate_expiry_days reports, for every certificate the service
+// knows of, the days left until it expires (negative once it has), computed
+// whenever metrics are collected so the value doesn't go stale between
+// checks. An alert on it warns of an expiring certificate before clients
+// start failing their handshakes.
+//
+// Certificates are learned two ways. HTTPTransport records the certificate
+// of every HTTPS response under the client's name, so an upstream is covered
+// as soon as it is called. MonitorCertificates checks a list of certificates
+// on an interval instead: servers, dialed with TLS only to read the
+// certificate they present, and PEM files, such as the service's own serving
+// certificate. A certificate within WarnBefore of expiring is logged as a
+// warning on every check, an expired one as an error.
+
+const (
+	defaultCertificateInterval = time.Hour
+	defaultCertificateWarning  = 30 * 24 * time.Hour
+	certificateDialTimeout     = 10 * time.Second
+)
+
+// CertificateCheck is a certificate checked by MonitorCertificates; set
+// either Address or File
+type CertificateCheck struct {
+	// Name is the certificate's label in tls_certificate_expiry_days, e.g.
+	// the upstream it belongs to
+	Name string
+	// Address is the host:port of a TLS server whose certificate is checked
+	Address string
+	// File is a PEM file whose first certificate is checked
+	File string
+}
+
+// CertificateMonitor configures MonitorCertificates
+type CertificateMonitor struct {
+	Checks []CertificateCheck
+	// Interval is the time between checks; 0 means an hour
+	Interval time.Duration
+	// WarnBefore is how long before expiry a certificate is logged as
+	// expiring; 0 means 30 days
+	WarnBefore time.Duration
+}
+
+// CertificateCheckForURL returns the check of the server behind an https
+// URL, and false for any other URL
+func CertificateCheckForURL(name, rawURL string) (CertificateCheck, bool) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" {
+		return CertificateCheck{}, false
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = "443"
+	}
+	return CertificateCheck{Name: name, Address: net.JoinHostPort(parsed.Hostname(), port)}, true
+}
+
+// certificateExpiries holds the expiry of the certificates seen, by name
+type certificateExpiries struct {
+	once     sync.Once
+	mu       sync.Mutex
+	notAfter map[string]time.Time
+}
+
+// recordCertificate sets the expiry reported for the certificate called
+// name, registering tls_certificate_expiry_days on first use
+func (l *Logger) recordCertificate(name string, cert *x509.Certificate) {
+	l.certificates.once.Do(func() {
+		l.ObservableGauge("tls_certificate_expiry_days", func(ctx context.Context, observe Observer) {
+			l.certificates.mu.Lock()
+			defer l.certificates.mu.Unlock()
+			for name, notAfter := range l.certificates.notAfter {
+				observe(time.Until(notAfter).Hours()/24, Labels{"certificate": name})
+			}
+		})
+	})
+
+	l.certificates.mu.Lock()
+	defer l.certificates.mu.Unlock()
+	if l.certificates.notAfter == nil {
+		l.certificates.notAfter = make(map[string]time.Time)
+	}
+	l.certificates.notAfter[name] = cert.NotAfter
+}
+
+// MonitorCertificates checks the certificates of config until ctx is done
+func (l *Logger) MonitorCertificates(ctx context.Context, config CertificateMonitor) error {
+	interval := config.Interval
+	if interval <= 0 {
+		interval = defaultCertificateInterval
+	}
+	warnBefore := config.WarnBefore
+	if warnBefore <= 0 {
+		warnBefore = defaultCertificateWarning
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, check := range config.Checks {
+			l.checkCertificate(ctx, check, warnBefore)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkCertificate reads one certificate, records its expiry and logs it if
+// it expires within warnBefore
+func (l *Logger) checkCertificate(ctx context.Context, check CertificateCheck, warnBefore time.Duration) {
+	var cert *x509.Certificate
+	var err error
+	if check.File != "" {
+		cert, err = readCertificateFile(check.File)
+	} else {
+		cert, err = fetchCertificate(ctx, check.Address)
+	}
+	if err != nil {
+		l.WarnFields(ctx, "TLS certificate check failed",
+			String("certificate", check.Name),
+			String("error", err.Error()),
+		)
+		return
+	}
+	l.recordCertificate(check.Name, cert)
+
+	left := time.Until(cert.NotAfter)
+	fields := []Field{
+		String("certificate", check.Name),
+		String("subject", cert.Subject.String()),
+		String("not_after", cert.NotAfter.UTC().Format(time.RFC3339)),
+		Int64("days_left", int64(left.Hours()/24)),
+	}
+	switch {
+	case left <= 0:
+		l.ErrorFields(ctx, "TLS certificate has expired", errors.New("certificate expired"), fields...)
+	case left <= warnBefore:
+		l.WarnFields(ctx, "TLS certificate expires soon", fields...)
+	}
+}
+
+// fetchCertificate returns the certificate a TLS server presents. It isn't
+// verified: an expired or untrusted certificate must still be reported.
+func fetchCertificate(ctx context.Context, address string) (*x509.Certificate, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: certificateDialTimeout},
+		Config:    &tls.Config{ServerName: host, InsecureSkipVerify: true},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s presented no certificate", address)
+	}
+	return certs[0], nil
+}
+
+// readCertificateFile returns the first certificate of a PEM file
+func readCertificateFile(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no certificate found in %s", path)
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+)
+
+// Context fields
+//
+// Fields known for the whole of a request, like its tenant or route, are
+// attached to its context once, typically by a middleware:
+//
+//	ctx = logging.ContextWithFields(ctx, map[string]interface{}{"tenant": tenantID})
+//
+// and every line logged with that context, or one derived from it, carries
+// them, whether logged through the logger or through log/slog with
+// slog.New(logger.Handler()). A field passed with the call wins over a
+// context field of the same key.
+
+type contextFieldsKey struct{}
+
+// ContextWithFields returns a copy of ctx whose log lines carry fields, on
+// top of any fields ctx has already; a field replaces one of the same key
+func ContextWithFields(ctx context.Context, fields map[string]interface{}) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	inherited := contextFields(ctx)
+	attrs := make([]slog.Attr, 0, len(inherited)+len(keys))
+	for _, attr := range inherited {
+		if _, replaced := fields[attr.Key]; !replaced {
+			attrs = append(attrs, attr)
+		}
+	}
+	for _, k := range keys {
+		attrs = append(attrs, slog.Any(k, fields[k]))
+	}
+	return context.WithValue(ctx, contextFieldsKey{}, attrs)
+}
+
+// contextFields returns the fields attached to ctx
+func contextFields(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(contextFieldsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// addContextFields adds the fields of ctx that record doesn't have already
+func addContextFields(ctx context.Context, record *slog.Record) {
+	attrs := contextFields(ctx)
+	if len(attrs) == 0 {
+		return
+	}
+	logged := make(map[string]bool, record.NumAttrs())
+	record.Attrs(func(attr slog.Attr) bool {
+		logged[attr.Key] = true
+		return true
+	})
+	for _, attr := range attrs {
+		if !logged[attr.Key] {
+			record.AddAttrs(attr)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Debug requests
+//
+// A context marked with WithDebug is logged at every level regardless of
+// LogLevel, its new traces are sampled regardless of TraceSampleRatio and
+// tagged debug=true, and the spans it starts are timed so the caller can
+// report where the request spent its time.
+
+type debugKey struct{}
+
+// Timing is how long one span of a debug request took
+type Timing struct {
+	Operation string
+	Duration  time.Duration
+}
+
+// debugRequest collects the span timings of a debug request
+type debugRequest struct {
+	mu      sync.Mutex
+	timings []Timing
+}
+
+// WithDebug marks ctx, and the contexts derived from it, as a debug request
+func WithDebug(ctx context.Context) context.Context {
+	if IsDebug(ctx) {
+		return ctx
+	}
+	return context.WithValue(ctx, debugKey{}, &debugRequest{})
+}
+
+// IsDebug reports whether ctx belongs to a debug request
+func IsDebug(ctx context.Context) bool {
+	return ctx.Value(debugKey{}) != nil
+}
+
+// Timings returns the spans of a debug request that have ended so far, in
+// the order they ended
+func Timings(ctx context.Context) []Timing {
+	debug, ok := ctx.Value(debugKey{}).(*debugRequest)
+	if !ok {
+		return nil
+	}
+	debug.mu.Lock()
+	defer debug.mu.Unlock()
+	return append([]Timing(nil), debug.timings...)
+}
+
+// recordTiming adds a finished span to a debug request
+func recordTiming(ctx context.Context, operation string, duration time.Duration) {
+	if debug, ok := ctx.Value(debugKey{}).(*debugRequest); ok {
+		debug.mu.Lock()
+		debug.timings = append(debug.timings, Timing{Operation: operation, Duration: duration})
+		debug.mu.Unlock()
+	}
+}
+
+// debugSampler samples every span of a debug request and defers to the
+// configured sampler for the rest
+type debugSampler struct {
+	next sdktrace.Sampler
+}
+
+func (s debugSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if !IsDebug(p.ParentContext) {
+		return s.next.ShouldSample(p)
+	}
+	return sdktrace.SamplingResult{
+		Decision:   sdktrace.RecordAndSample,
+		Attributes: []attribute.KeyValue{attribute.Bool("debug", true)},
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s debugSampler) Description() string {
+	return "DebugSampler{" + s.next.Description() + "}"
+}
@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Duplicate suppression
+//
+// An upstream that is down makes every request log the same error, so one
+// outage fills the logs with identical lines. With Config.DedupWindow, a
+// warning or error line is written the first time it is seen, and further
+// lines with the same level, message and "error" field within the window are
+// held back. When the window ends the last of them is written once, with
+// repeat_count set to how many were held back, so the line still shows up
+// at the end of the window with the trace of a recent occurrence. The next
+// occurrence starts a new window. Debug requests are never deduplicated, and
+// ForceFlush and Shutdown write out the pending repeats.
+
+// maxDedupKeys bounds the lines held back at once; others are written as
+// they come
+const maxDedupKeys = 4096
+
+// dedupKey identifies identical lines
+type dedupKey struct {
+	level   slog.Level
+	message string
+	err     string
+}
+
+// dedupEntry is a line seen in the current window and its repeats
+type dedupEntry struct {
+	repeats int
+	// last is the latest repeat, written at the end of the window through
+	// the handler and context it came with
+	last  slog.Record
+	ctx   context.Context
+	next  slog.Handler
+	timer *time.Timer
+}
+
+// logDeduper holds the lines of the current windows, shared by the handlers
+// derived with WithAttrs and WithGroup
+type logDeduper struct {
+	window  time.Duration
+	mu      sync.Mutex
+	entries map[dedupKey]*dedupEntry
+}
+
+// dedupHandler holds back repeated warning and error lines
+type dedupHandler struct {
+	next    slog.Handler
+	deduper *logDeduper
+}
+
+// newLogDeduper returns a deduper of window, or nil if window is 0
+func newLogDeduper(window time.Duration) *logDeduper {
+	if window <= 0 {
+		return nil
+	}
+	return &logDeduper{window: window, entries: make(map[dedupKey]*dedupEntry)}
+}
+
+func (h *dedupHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *dedupHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level < slog.LevelWarn || IsDebug(ctx) {
+		return h.next.Handle(ctx, record)
+	}
+
+	key := dedupKey{level: record.Level, message: record.Message}
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr.Key == "error" {
+			key.err = attr.Value.String()
+			return false
+		}
+		return true
+	})
+
+	d := h.deduper
+	d.mu.Lock()
+	if entry, ok := d.entries[key]; ok {
+		entry.repeats++
+		entry.last = record.Clone()
+		entry.ctx = ctx
+		entry.next = h.next
+		d.mu.Unlock()
+		return nil
+	}
+	if len(d.entries) < maxDedupKeys {
+		d.entries[key] = &dedupEntry{timer: time.AfterFunc(d.window, func() { d.expire(key) })}
+	}
+	d.mu.Unlock()
+	return h.next.Handle(ctx, record)
+}
+
+func (h *dedupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &dedupHandler{next: h.next.WithAttrs(attrs), deduper: h.deduper}
+}
+
+func (h *dedupHandler) WithGroup(name string) slog.Handler {
+	return &dedupHandler{next: h.next.WithGroup(name), deduper: h.deduper}
+}
+
+// expire ends the window of a line, writing its repeats
+func (d *logDeduper) expire(key dedupKey) {
+	d.mu.Lock()
+	entry := d.entries[key]
+	delete(d.entries, key)
+	d.mu.Unlock()
+
+	if entry != nil {
+		entry.write()
+	}
+}
+
+// flush ends every window, writing the repeats held back
+func (d *logDeduper) flush() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	entries := d.entries
+	d.entries = make(map[dedupKey]*dedupEntry)
+	d.mu.Unlock()
+
+	for _, entry := range entries {
+		entry.timer.Stop()
+		entry.write()
+	}
+}
+
+// write writes the last repeat of a line with repeat_count, if there was one
+func (e *dedupEntry) write() {
+	if e.repeats == 0 {
+		return
+	}
+	e.last.AddAttrs(slog.Int("repeat_count", e.repeats))
+	_ = e.next.Handle(context.WithoutCancel(e.ctx), e.last)
+}
@@ -0,0 +1,148 @@
+package logging
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/credentials"
+)
+
+// exportSettings are the connection settings shared by the OTLP exporters
+type exportSettings struct {
+	endpoint string
+	protocol string
+	// tls is nil for plaintext
+	tls     *tls.Config
+	headers map[string]string
+	retry   retrySettings
+}
+
+// newExportSettings checks the export settings of a config. A secured
+// collector gets no telemetry rather than plaintext when TLS can't be set up.
+func newExportSettings(config Config, protocol string) (*exportSettings, error) {
+	settings := &exportSettings{
+		endpoint: config.AlloyURL,
+		protocol: protocol,
+		headers:  config.Headers,
+		retry:    config.ExportRetry.settings(),
+	}
+	if !config.TLS && config.TLSCACert == "" && config.TLSClientCert == "" {
+		return settings, nil
+	}
+
+	settings.tls = &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.TLSCACert != "" {
+		pem, err := os.ReadFile(config.TLSCACert)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.TLSCACert)
+		}
+		settings.tls.RootCAs = pool
+	}
+	if config.TLSClientCert != "" || config.TLSClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(config.TLSClientCert, config.TLSClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		settings.tls.Certificates = []tls.Certificate{cert}
+	}
+	return settings, nil
+}
+
+// newTraceExporter returns the OTLP span exporter for the settings
+func (s *exportSettings) newTraceExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	if s.protocol == ProtocolGRPC {
+		options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(s.endpoint), otlptracegrpc.WithHeaders(s.headers), otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig(s.retry))}
+		if s.tls != nil {
+			options = append(options, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(s.tls)))
+		} else {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, options...)
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(s.endpoint), otlptracehttp.WithHeaders(s.headers), otlptracehttp.WithRetry(otlptracehttp.RetryConfig(s.retry))}
+	if s.tls != nil {
+		options = append(options, otlptracehttp.WithTLSClientConfig(s.tls))
+	} else {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(ctx, options...)
+}
+
+// newMetricExporter returns the OTLP metric exporter for the settings
+func (s *exportSettings) newMetricExporter(ctx context.Context) (sdkmetric.Exporter, error) {
+	if s.protocol == ProtocolGRPC {
+		options := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(s.endpoint), otlpmetricgrpc.WithHeaders(s.headers), otlpmetricgrpc.WithRetry(otlpmetricgrpc.RetryConfig(s.retry))}
+		if s.tls != nil {
+			options = append(options, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(s.tls)))
+		} else {
+			options = append(options, otlpmetricgrpc.WithInsecure())
+		}
+		return otlpmetricgrpc.New(ctx, options...)
+	}
+
+	options := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(s.endpoint), otlpmetrichttp.WithHeaders(s.headers), otlpmetrichttp.WithRetry(otlpmetrichttp.RetryConfig(s.retry))}
+	if s.tls != nil {
+		options = append(options, otlpmetrichttp.WithTLSClientConfig(s.tls))
+	} else {
+		options = append(options, otlpmetrichttp.WithInsecure())
+	}
+	return otlpmetrichttp.New(ctx, options...)
+}
+
+// newLogExporter returns the OTLP log exporter for the settings
+func (s *exportSettings) newLogExporter(ctx context.Context) (sdklog.Exporter, error) {
+	if s.protocol == ProtocolGRPC {
+		options := []otlploggrpc.Option{otlploggrpc.WithEndpoint(s.endpoint), otlploggrpc.WithHeaders(s.headers), otlploggrpc.WithRetry(otlploggrpc.RetryConfig(s.retry))}
+		if s.tls != nil {
+			options = append(options, otlploggrpc.WithTLSCredentials(credentials.NewTLS(s.tls)))
+		} else {
+			options = append(options, otlploggrpc.WithInsecure())
+		}
+		return otlploggrpc.New(ctx, options...)
+	}
+
+	options := []otlploghttp.Option{otlploghttp.WithEndpoint(s.endpoint), otlploghttp.WithHeaders(s.headers), otlploghttp.WithRetry(otlploghttp.RetryConfig(s.retry))}
+	if s.tls != nil {
+		options = append(options, otlploghttp.WithTLSClientConfig(s.tls))
+	} else {
+		options = append(options, otlploghttp.WithInsecure())
+	}
+	return otlploghttp.New(ctx, options...)
+}
+
+// ParseHeaders reads export headers written as "key=value,key2=value2", the
+// format of OTEL_EXPORTER_OTLP_HEADERS; values may be URL-encoded (e.g.
+// "Authorization=Bearer%20s3cret"). Malformed entries are skipped.
+func ParseHeaders(value string) map[string]string {
+	headers := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		key, val, found := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			continue
+		}
+		if decoded, err := url.PathUnescape(strings.TrimSpace(val)); err == nil {
+			headers[key] = decoded
+		}
+	}
+	return headers
+}
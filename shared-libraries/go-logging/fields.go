@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Typed fields
+//
+// The map variants of the logging functions cost a map, a sorted key slice
+// and a boxed value per field on every call. On hot paths, log with typed
+// fields instead; they are written in the order given:
+//
+//	logger.InfoFields(ctx, "HTTP request",
+//		logging.String("route", route),
+//		logging.Int("status_code", status),
+//	)
+//
+// Up to five fields are logged without allocating.
+
+// Field is a typed log field
+type Field = slog.Attr
+
+// String returns a string field
+func String(key, value string) Field {
+	return slog.String(key, value)
+}
+
+// Int returns an int field
+func Int(key string, value int) Field {
+	return slog.Int(key, value)
+}
+
+// Int64 returns an int64 field
+func Int64(key string, value int64) Field {
+	return slog.Int64(key, value)
+}
+
+// Float64 returns a float64 field
+func Float64(key string, value float64) Field {
+	return slog.Float64(key, value)
+}
+
+// Bool returns a bool field
+func Bool(key string, value bool) Field {
+	return slog.Bool(key, value)
+}
+
+// Any returns a field of any value, as the map variants log it
+func Any(key string, value interface{}) Field {
+	return slog.Any(key, value)
+}
+
+// Err returns the "error" field of err
+func Err(err error) Field {
+	return slog.String("error", err.Error())
+}
+
+// InfoFields logs an info message with typed fields
+func (l *Logger) InfoFields(ctx context.Context, message string, fields ...Field) {
+	l.emit(ctx, 3, slog.LevelInfo, message, fields)
+}
+
+// ErrorFields logs an error message with typed fields and fails the span in
+// ctx (see Fail)
+func (l *Logger) ErrorFields(ctx context.Context, message string, err error, fields ...Field) {
+	l.Fail(ctx, err)
+	l.emit(ctx, 3, slog.LevelError, message, append([]Field{Err(err)}, fields...))
+}
+
+// WarnFields logs a warning message with typed fields
+func (l *Logger) WarnFields(ctx context.Context, message string, fields ...Field) {
+	l.emit(ctx, 3, slog.LevelWarn, message, fields)
+}
+
+// DebugFields logs a debug message with typed fields
+func (l *Logger) DebugFields(ctx context.Context, message string, fields ...Field) {
+	l.emit(ctx, 3, slog.LevelDebug, message, fields)
+}
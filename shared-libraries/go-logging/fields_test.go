@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// benchmarkLogger returns a logger writing JSON to io.Discard, without
+// exporters
+func benchmarkLogger() *Logger {
+	return newLogger(Config{
+		ServiceName: "bench",
+		LogLevel:    "info",
+		Handler:     slog.NewJSONHandler(io.Discard, nil),
+	})
+}
+
+// BenchmarkInfoMap logs the access line of HTTPMiddleware with a map
+func BenchmarkInfoMap(b *testing.B) {
+	l := benchmarkLogger()
+	ctx := context.Background()
+	duration := 42 * time.Millisecond
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Info(ctx, "HTTP request", map[string]interface{}{
+			"method":      "GET",
+			"route":       "/users/{id}",
+			"path":        "/users/42",
+			"status_code": 200,
+			"bytes":       512,
+			"duration_ms": duration.Milliseconds(),
+		})
+	}
+}
+
+// BenchmarkInfoFields logs the same line with typed fields, and with five of
+// them, the most logged without allocating
+func BenchmarkInfoFields(b *testing.B) {
+	l := benchmarkLogger()
+	ctx := context.Background()
+	duration := 42 * time.Millisecond
+
+	b.Run("six", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			l.InfoFields(ctx, "HTTP request",
+				String("method", "GET"),
+				String("route", "/users/{id}"),
+				String("path", "/users/42"),
+				Int("status_code", 200),
+				Int("bytes", 512),
+				Int64("duration_ms", duration.Milliseconds()),
+			)
+		}
+	})
+	b.Run("five", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			l.InfoFields(ctx, "HTTP request",
+				String("method", "GET"),
+				String("route", "/users/{id}"),
+				Int("status_code", 200),
+				Int("bytes", 512),
+				Int64("duration_ms", duration.Milliseconds()),
+			)
+		}
+	})
+}
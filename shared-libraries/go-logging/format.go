@@ -0,0 +1,166 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output formats
+//
+// Config.Format picks how the stdout lines are written:
+//
+//	json     one JSON object per line (default), for log collectors
+//	logfmt   key=value pairs with the same keys, for grep and less
+//	console  "15:04:05.000 INFO  message key=value ...", the level colored,
+//	         for a service run by hand with go run
+//
+// The console format leaves out colors when NO_COLOR is set. File sinks
+// always write JSON, as they are read by log shippers; Config.Handler
+// replaces the format altogether.
+
+// Output formats
+const (
+	FormatJSON    = "json"
+	FormatLogfmt  = "logfmt"
+	FormatConsole = "console"
+)
+
+// newFormatHandler writes log lines to w in format
+func newFormatHandler(format string, w io.Writer) slog.Handler {
+	switch strings.ToLower(format) {
+	case "", FormatJSON:
+		return newJSONHandler(w)
+	case FormatLogfmt:
+		return slog.NewTextHandler(w, outputOptions)
+	case FormatConsole:
+		_, noColor := os.LookupEnv("NO_COLOR")
+		return &consoleHandler{out: w, mu: new(sync.Mutex), color: !noColor}
+	}
+	log.Printf("Unknown log format %q, writing JSON", format)
+	return newJSONHandler(w)
+}
+
+// ANSI escape codes of the console format
+const (
+	colorReset = "\x1b[0m"
+	colorDim   = "\x1b[2m"
+	colorBold  = "\x1b[1m"
+)
+
+// levelColors are the colors of the console format's levels
+var levelColors = map[slog.Level]string{
+	slog.LevelDebug: "\x1b[36m", // cyan
+	slog.LevelInfo:  "\x1b[32m", // green
+	slog.LevelWarn:  "\x1b[33m", // yellow
+	slog.LevelError: "\x1b[31m", // red
+}
+
+// consoleHandler writes one human-readable line per record
+type consoleHandler struct {
+	out   io.Writer
+	mu    *sync.Mutex
+	color bool
+	// attrs are the attributes added by WithAttrs, keys prefixed with their
+	// groups
+	attrs  []slog.Attr
+	prefix string
+}
+
+func (h *consoleHandler) Enabled(context.Context, slog.Level) bool {
+	// Level filtering is done by contextHandler
+	return true
+}
+
+func (h *consoleHandler) Handle(_ context.Context, record slog.Record) error {
+	var buf bytes.Buffer
+	h.paint(&buf, colorDim, record.Time.Format("15:04:05.000"))
+	buf.WriteByte(' ')
+	h.paint(&buf, levelColors[record.Level], fmt.Sprintf("%-5s", record.Level.String()))
+	buf.WriteByte(' ')
+	h.paint(&buf, colorBold, record.Message)
+
+	for _, attr := range h.attrs {
+		h.writeAttr(&buf, "", attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		h.writeAttr(&buf, h.prefix, attr)
+		return true
+	})
+	buf.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.out.Write(buf.Bytes())
+	return err
+}
+
+// writeAttr writes " key=value", flattening groups into dotted keys
+func (h *consoleHandler) writeAttr(buf *bytes.Buffer, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			h.writeAttr(buf, prefix, member)
+		}
+		return
+	}
+
+	buf.WriteByte(' ')
+	h.paint(buf, colorDim, prefix+attr.Key+"=")
+	var value string
+	switch attr.Value.Kind() {
+	case slog.KindTime:
+		value = attr.Value.Time().Format(time.RFC3339)
+	default:
+		value = attr.Value.String()
+	}
+	// Multi-line values such as stack traces are kept on one line
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = strconv.Quote(value)
+	}
+	buf.WriteString(value)
+}
+
+// paint writes s in color, or plain without colors
+func (h *consoleHandler) paint(buf *bytes.Buffer, color, s string) {
+	if !h.color || color == "" {
+		buf.WriteString(s)
+		return
+	}
+	buf.WriteString(color)
+	buf.WriteString(s)
+	buf.WriteString(colorReset)
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, attr := range attrs {
+		attr.Key = h.prefix + attr.Key
+		next.attrs = append(next.attrs, attr)
+	}
+	return &next
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	next := *h
+	next.prefix = h.prefix + name + "."
+	return &next
+}
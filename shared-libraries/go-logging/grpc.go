@@ -0,0 +1,263 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// gRPC instrumentation
+//
+// The interceptors give gRPC calls the telemetry HTTPMiddleware and
+// HTTPTransport give HTTP requests, so dashboards and alerts work across
+// both:
+//
+//	server := grpc.NewServer(
+//		grpc.ChainUnaryInterceptor(logger.UnaryServerInterceptor()),
+//		grpc.ChainStreamInterceptor(logger.StreamServerInterceptor()),
+//	)
+//	conn, err := grpc.NewClient(target,
+//		grpc.WithChainUnaryInterceptor(logger.UnaryClientInterceptor("user-service")),
+//		grpc.WithChainStreamInterceptor(logger.StreamClientInterceptor("user-service")),
+//	)
+//
+// A served call continues the caller's trace from the request metadata, runs
+// in a server span named after the full method (/users.v1.Users/GetUser),
+// is counted in http_requests_total and timed in
+// http_request_duration_seconds with the method as endpoint, and is logged
+// as a "gRPC request" line. The status_code label holds the HTTP status of
+// the call's gRPC code (NotFound is 404, Unavailable 503, Canceled 499), so
+// the 5xx error ratio covers gRPC calls too; the gRPC code is on the span
+// and the log line. A call sent passes the trace on in its metadata, runs in
+// a "<name> <method>" client span and is timed in
+// http_client_request_duration_seconds. Codes mapping to a 5xx fail the
+// span and log the call.
+//
+// A stream is one call from its start until the handler returns (server) or
+// until the client has received its end (io.EOF or an error); a client that
+// drops a stream without reading it to the end leaves its span open.
+
+// grpcHTTPStatus maps gRPC codes to HTTP statuses, as grpc-gateway does
+var grpcHTTPStatus = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           StatusClientClosedRequest,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+}
+
+// grpcStatus returns the gRPC code of a call's error and its HTTP status
+func grpcStatus(err error) (codes.Code, int) {
+	code := status.Code(err)
+	if errors.Is(err, context.Canceled) {
+		code = codes.Canceled
+	}
+	httpStatus, ok := grpcHTTPStatus[code]
+	if !ok {
+		httpStatus = http.StatusInternalServerError
+	}
+	return code, httpStatus
+}
+
+// metadataCarrier reads and writes trace context in gRPC metadata
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// UnaryServerInterceptor instruments the unary calls a server handles
+func (l *Logger) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, finish := l.startServerCall(ctx, info.FullMethod)
+		resp, err := handler(ctx, req)
+		finish(err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor instruments the streams a server handles
+func (l *Logger) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, finish := l.startServerCall(stream.Context(), info.FullMethod)
+		err := handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+		finish(err)
+		return err
+	}
+}
+
+// serverStream is a server stream with the context of its span
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// startServerCall continues the caller's trace in a server span for method;
+// finish records the call with the handler's error
+func (l *Logger) startServerCall(ctx context.Context, method string) (context.Context, func(err error)) {
+	start := time.Now()
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = l.propagator.Extract(ctx, metadataCarrier(md))
+	}
+	ctx = ContextWithFields(ctx, map[string]interface{}{"route": method})
+	ctx, endSpan := l.StartSpan(ctx, method, ServerSpan())
+
+	return ctx, func(err error) {
+		defer endSpan()
+		code, httpStatus := grpcStatus(err)
+		duration := time.Since(start)
+
+		if span := trace.SpanFromContext(ctx); span.IsRecording() {
+			span.SetAttributes(
+				attribute.String("rpc.system", "grpc"),
+				attribute.String("rpc.method", method),
+				attribute.Int("rpc.grpc.status_code", int(code)),
+			)
+			if httpStatus >= http.StatusInternalServerError {
+				span.SetStatus(otelcodes.Error, code.String())
+			}
+		}
+		l.CountRequest(ctx, method, httpStatus)
+		l.RecordDuration(ctx, method, duration)
+		l.InfoFields(ctx, "gRPC request",
+			String("method", method),
+			String("code", code.String()),
+			Int("status_code", httpStatus),
+			Int64("duration_ms", duration.Milliseconds()),
+		)
+	}
+}
+
+// UnaryClientInterceptor instruments the unary calls sent to the service
+// called name
+func (l *Logger) UnaryClientInterceptor(name string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, finish := l.startClientCall(ctx, name, method)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		finish(err)
+		return err
+	}
+}
+
+// StreamClientInterceptor instruments the streams opened to the service
+// called name
+func (l *Logger) StreamClientInterceptor(name string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, finish := l.startClientCall(ctx, name, method)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			finish(err)
+			return nil, err
+		}
+		return &clientStream{ClientStream: stream, finish: finish}, nil
+	}
+}
+
+// clientStream records a client stream once it has been received to its end
+type clientStream struct {
+	grpc.ClientStream
+	finish func(err error)
+	once   sync.Once
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		callErr := err
+		if errors.Is(err, io.EOF) {
+			callErr = nil
+		}
+		s.once.Do(func() { s.finish(callErr) })
+	}
+	return err
+}
+
+// startClientCall starts a client span for a call of method on the service
+// called name and sends its trace context in the outgoing metadata; finish
+// records the call with its error
+func (l *Logger) startClientCall(ctx context.Context, name, method string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, endSpan := l.StartSpan(ctx, name+" "+method, ClientSpan())
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	l.propagator.Inject(ctx, metadataCarrier(md))
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	return ctx, func(err error) {
+		defer endSpan()
+		code, httpStatus := grpcStatus(err)
+		duration := time.Since(start)
+
+		if l.initialized && l.clientDuration != nil {
+			l.clientDuration.Record(ctx, duration.Seconds(), metric.WithAttributes(
+				attribute.String("client", name),
+				attribute.String("method", method),
+				attribute.String("status_code", strconv.Itoa(httpStatus)),
+				attribute.String("service", l.serviceName),
+			))
+		}
+		if span := trace.SpanFromContext(ctx); span.IsRecording() {
+			span.SetAttributes(
+				attribute.String("rpc.system", "grpc"),
+				attribute.String("rpc.method", method),
+				attribute.Int("rpc.grpc.status_code", int(code)),
+			)
+			if httpStatus >= http.StatusInternalServerError {
+				span.SetStatus(otelcodes.Error, code.String())
+			}
+		}
+		if httpStatus >= http.StatusInternalServerError {
+			l.ErrorFields(ctx, "gRPC client request failed", err,
+				String("client", name),
+				String("method", method),
+				String("code", code.String()),
+				Int64("duration_ms", duration.Milliseconds()),
+			)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Log output
+//
+// Log lines go through a log/slog handler per sink (see sinks.go): by default
+// a JSON handler on stdout in the documented format (or Config.Format, see
+// format.go), or Config.Handler to send them elsewhere. Either way the logger
+// wraps each handler to apply LogLevel (ignored for debug requests) and add
+// the trace context, so slog.New(logger.Handler()) behaves the same for code
+// using log/slog directly.
+//
+// With Config.LogExport or an OTLP sink the lines are also handed to the
+// OpenTelemetry slog bridge and exported over OTLP. Those records carry the
+// trace context in their own fields and the service in the resource, so the
+// trace_id, span_id, service, version and environment attributes are only
+// added to the output handler.
+
+// logLevels maps LogLevel names to slog levels
+var logLevels = map[string]slog.Level{
+	"DEBUG": slog.LevelDebug,
+	"INFO":  slog.LevelInfo,
+	"WARN":  slog.LevelWarn,
+	"ERROR": slog.LevelError,
+}
+
+// outputOptions name the keys of the JSON and logfmt lines timestamp, level
+// and message
+var outputOptions = &slog.HandlerOptions{
+	// Level filtering is done by contextHandler
+	Level: slog.Level(-1 << 10),
+	ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+		if len(groups) > 0 {
+			return attr
+		}
+		switch attr.Key {
+		case slog.TimeKey:
+			return slog.String("timestamp", attr.Value.Time().UTC().Format(time.RFC3339))
+		case slog.MessageKey:
+			attr.Key = "message"
+		}
+		return attr
+	},
+}
+
+// newJSONHandler writes log lines as JSON objects with timestamp, level and
+// message keys
+func newJSONHandler(w io.Writer) slog.Handler {
+	return slog.NewJSONHandler(w, outputOptions)
+}
+
+// newHandler returns the handler of the logger's lines
+func (l *Logger) newHandler(config Config) slog.Handler {
+	var outputs fanoutHandler
+	for _, sink := range logSinks(config) {
+		if handler := l.sinkHandler(config, sink); handler != nil {
+			outputs = append(outputs, handler)
+		}
+	}
+
+	var handler slog.Handler
+	switch len(outputs) {
+	case 0:
+		log.Printf("No usable log sink, writing to stdout")
+		handler = l.sinkHandler(config, Sink{Kind: SinkStdout})
+	case 1:
+		handler = outputs[0]
+	default:
+		handler = outputs
+	}
+
+	// Sampled lines are dropped from every output alike
+	if sampler := newLogSampler(config.LogSampling, l.meter); sampler != nil {
+		handler = &samplingHandler{next: handler, sampler: sampler}
+	}
+	if l.deduper = newLogDeduper(config.DedupWindow); l.deduper != nil {
+		handler = &dedupHandler{next: handler, deduper: l.deduper}
+	}
+	if config.Caller {
+		handler = &callerHandler{next: handler}
+	}
+	// Counted before sampling and deduplication drop any
+	return &countingHandler{next: handler, logger: l}
+}
+
+// contextHandler applies the minimum level, except for debug requests, adds
+// the fields of the record's context (see contextfields.go) and its trace
+// context if traceAttrs is set
+type contextHandler struct {
+	next       slog.Handler
+	minLevel   *slog.LevelVar
+	traceAttrs bool
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if level < h.minLevel.Level() && !IsDebug(ctx) {
+		return false
+	}
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if len(contextFields(ctx)) > 0 {
+		record = record.Clone()
+		addContextFields(ctx, &record)
+	}
+
+	// Also for traces that aren't sampled, so logs of one request can still
+	// be grouped
+	if spanContext := trace.SpanContextFromContext(ctx); h.traceAttrs && spanContext.IsValid() {
+		record = record.Clone()
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{next: h.next.WithAttrs(attrs), minLevel: h.minLevel, traceAttrs: h.traceAttrs}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{next: h.next.WithGroup(name), minLevel: h.minLevel, traceAttrs: h.traceAttrs}
+}
+
+// fanoutHandler hands every record to each of its handlers
+type fanoutHandler []slog.Handler
+
+func (h fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, next := range h {
+		if next.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h fanoutHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, next := range h {
+		if next.Enabled(ctx, record.Level) {
+			errs = append(errs, next.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanoutHandler, len(h))
+	for i, next := range h {
+		handlers[i] = next.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (h fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make(fanoutHandler, len(h))
+	for i, next := range h {
+		handlers[i] = next.WithGroup(name)
+	}
+	return handlers
+}
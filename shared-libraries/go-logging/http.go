@@ -0,0 +1,210 @@
+package logging
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HTTP instrumentation
+//
+// HTTPMiddleware does for a handler what every handler used to do by hand:
+// it continues the caller's trace (see propagation.go), runs the handler in a
+// server span named "<METHOD> <route>", counts the request and records its
+// duration under the route with the status the handler wrote, and logs an
+// access line. A request whose client went away before anything was written is
+// counted as 499. A 5xx response fails the span.
+//
+// HTTPClient and HTTPTransport do the same for outgoing requests: they pass
+// the trace on to the called service and time the call. Over HTTPS they also
+// record the expiry of the service's certificate (see certs.go).
+
+// StatusClientClosedRequest is recorded for requests abandoned by the client
+const StatusClientClosedRequest = 499
+
+// HTTPMiddleware instruments the requests of one route; routeName is the
+// metric's endpoint label and should be the path template (/users/{id}),
+// not the request path. The requests are also counted against slis (see
+// sli.go), and every line logged with the request's context carries the
+// route.
+func (l *Logger) HTTPMiddleware(routeName string, slis ...SLI) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ctx := ContextWithFields(l.Extract(r), map[string]interface{}{"route": routeName})
+			// The route is set when the span starts for the route sampler
+			ctx, endSpan := l.StartSpan(ctx, r.Method+" "+routeName, ServerSpan(), SpanAttributes(String(routeAttribute, routeName)))
+			defer endSpan()
+
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			status := sw.statusOf(ctx)
+			duration := time.Since(start)
+
+			if span := trace.SpanFromContext(ctx); span.IsRecording() {
+				span.SetAttributes(
+					attribute.String("http.method", r.Method),
+					attribute.String("http.route", routeName),
+					attribute.Int("http.status_code", status),
+				)
+				if status >= http.StatusInternalServerError {
+					span.SetStatus(codes.Error, http.StatusText(status))
+				}
+			}
+			l.CountRequest(ctx, routeName, status)
+			l.RecordDuration(ctx, routeName, duration)
+			l.RecordSLIs(ctx, routeName, status, duration, slis...)
+			l.InfoFields(ctx, "HTTP request",
+				String("method", r.Method),
+				String("route", routeName),
+				String("path", r.URL.Path),
+				Int("status_code", status),
+				Int("bytes", sw.bytes),
+				Int64("duration_ms", duration.Milliseconds()),
+			)
+		})
+	}
+}
+
+// statusWriter records the status and size of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+// statusOf returns the status written, 499 if the client went away before
+// anything was and 200 if the handler wrote nothing
+func (sw *statusWriter) statusOf(ctx context.Context) int {
+	switch {
+	case sw.status == 0 && errors.Is(ctx.Err(), context.Canceled):
+		return StatusClientClosedRequest
+	case sw.status == 0:
+		return http.StatusOK
+	}
+	return sw.status
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += n
+	return n, err
+}
+
+func (sw *statusWriter) Flush() {
+	if flusher, ok := sw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (sw *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hijacker.Hijack()
+}
+
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// HTTPClient returns a client for calls to the service called name, each
+// limited to timeout (none if zero), sent through HTTPTransport
+func (l *Logger) HTTPClient(name string, timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: l.HTTPTransport(name, nil)}
+}
+
+// HTTPTransport instruments the requests sent through next
+// (http.DefaultTransport if nil) to the service called name: each runs in a
+// "<name> <METHOD>" client span whose trace context is sent in the
+// traceparent header, its duration is recorded in http_client_request_duration_seconds
+// and failures are logged and fail the span: transport errors as errors, 5xx
+// responses as warnings
+func (l *Logger) HTTPTransport(name string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &clientTransport{logger: l, name: name, next: next}
+}
+
+// clientTransport is the transport of HTTPTransport
+type clientTransport struct {
+	logger *Logger
+	name   string
+	next   http.RoundTripper
+}
+
+func (t *clientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	ctx, endSpan := t.logger.StartSpan(req.Context(), t.name+" "+req.Method, ClientSpan())
+	defer endSpan()
+
+	// A transport must not modify the caller's request
+	req = req.Clone(ctx)
+	t.logger.Inject(ctx, req)
+
+	resp, err := t.next.RoundTrip(req)
+	duration := time.Since(start)
+
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	if t.logger.initialized && t.logger.clientDuration != nil {
+		t.logger.clientDuration.Record(ctx, duration.Seconds(), metric.WithAttributes(
+			attribute.String("client", t.name),
+			attribute.String("method", req.Method),
+			attribute.String("status_code", status),
+			attribute.String("service", t.logger.serviceName),
+		))
+	}
+	if err == nil {
+		t.logger.AddSpanAttributeInt(ctx, "http.status_code", resp.StatusCode)
+	}
+	if err == nil && resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		t.logger.recordCertificate(t.name, resp.TLS.PeerCertificates[0])
+	}
+
+	switch {
+	case err != nil && !errors.Is(err, context.Canceled):
+		t.logger.ErrorFields(ctx, "HTTP client request failed", err,
+			String("client", t.name),
+			String("method", req.Method),
+			String("url", req.URL.Redacted()),
+			Int64("duration_ms", duration.Milliseconds()),
+		)
+	case err == nil && resp.StatusCode >= 500:
+		if span := trace.SpanFromContext(ctx); span.IsRecording() {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+		t.logger.WarnFields(ctx, "HTTP client request returned a server error",
+			String("client", t.name),
+			String("method", req.Method),
+			String("url", req.URL.Redacted()),
+			Int64("duration_ms", duration.Milliseconds()),
+			Int("status_code", resp.StatusCode),
+		)
+	}
+	return resp, err
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Logger interface
+//
+// Code that only logs, traces and counts through the logger can take an
+// Interface instead of a *Logger, so it can be handed Nop() where its
+// telemetry doesn't matter:
+//
+//	type Handlers struct {
+//		Logger logging.Interface
+//	}
+//
+//	h := &Handlers{Logger: logging.Nop()}
+//
+// Nop is a *Logger that writes and exports nothing: spans aren't recorded,
+// metrics go to a no-op meter, and the OpenTelemetry pipeline, the OTEL_*
+// variables and the global propagator and providers are left alone, so a
+// Nop handed to a library doesn't replace its host's. Tests that assert on
+// the telemetry use NewForTesting instead.
+
+// Interface is what handlers use of a *Logger
+type Interface interface {
+	Info(ctx context.Context, message string, fields ...map[string]interface{})
+	Error(ctx context.Context, message string, err error, fields ...map[string]interface{})
+	Warn(ctx context.Context, message string, fields ...map[string]interface{})
+	Debug(ctx context.Context, message string, fields ...map[string]interface{})
+	InfoFields(ctx context.Context, message string, fields ...Field)
+	ErrorFields(ctx context.Context, message string, err error, fields ...Field)
+	WarnFields(ctx context.Context, message string, fields ...Field)
+	DebugFields(ctx context.Context, message string, fields ...Field)
+
+	StartSpan(ctx context.Context, operation string, opts ...SpanOption) (context.Context, func())
+	AddSpanEvent(ctx context.Context, event string, fields ...map[string]interface{})
+	AddSpanAttribute(ctx context.Context, key, value string)
+	AddSpanAttributeInt(ctx context.Context, key string, value int)
+	AddSpanAttributeFloat(ctx context.Context, key string, value float64)
+	AddSpanAttributeBool(ctx context.Context, key string, value bool)
+	AddSpanAttributes(ctx context.Context, attributes map[string]interface{})
+	Fail(ctx context.Context, err error)
+
+	Counter(name string) *Counter
+	UpDownCounter(name string) *UpDownCounter
+	Histogram(name string, buckets ...float64) *Histogram
+	Gauge(name string) *Gauge
+	CountRequest(ctx context.Context, endpoint string, statusCode int)
+	RecordDuration(ctx context.Context, endpoint string, duration time.Duration)
+	CountSLI(ctx context.Context, sli string, good bool)
+
+	StartJob(ctx context.Context, name string) (context.Context, func(err error))
+	Go(ctx context.Context, fn func(ctx context.Context))
+}
+
+var _ Interface = (*Logger)(nil)
+
+// Nop returns a logger that writes and exports nothing
+func Nop() *Logger {
+	return newLogger(Config{Handler: discardHandler{}, keepGlobals: true})
+}
+
+// discardHandler drops every line
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Nop and NewForTesting loggers are created next to the service's own, so
+// they must not replace its global propagator or providers
+func TestLoggersKeepGlobals(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		newLogger func() *Logger
+	}{
+		{"Nop", Nop},
+		{"NewForTesting", func() *Logger {
+			logger, _ := NewForTesting()
+			return logger
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			savedPropagator := otel.GetTextMapPropagator()
+			savedTracerProvider := otel.GetTracerProvider()
+			savedMeterProvider := otel.GetMeterProvider()
+			t.Cleanup(func() {
+				otel.SetTextMapPropagator(savedPropagator)
+				otel.SetTracerProvider(savedTracerProvider)
+				otel.SetMeterProvider(savedMeterProvider)
+			})
+
+			propagator := propagation.Baggage{}
+			tracerProvider := sdktrace.NewTracerProvider()
+			meterProvider := sdkmetric.NewMeterProvider()
+			otel.SetTextMapPropagator(propagator)
+			otel.SetTracerProvider(tracerProvider)
+			otel.SetMeterProvider(meterProvider)
+
+			logger := tc.newLogger()
+			ctx, end := logger.StartSpan(context.Background(), "operation")
+			logger.Info(ctx, "message")
+			end()
+			logger.CountRequest(ctx, "/endpoint", 200)
+
+			if got := otel.GetTextMapPropagator(); got != propagator {
+				t.Errorf("global propagator = %T, want the one set before", got)
+			}
+			if got := otel.GetTracerProvider(); got != tracerProvider {
+				t.Errorf("global tracer provider = %T, want the one set before", got)
+			}
+			if got := otel.GetMeterProvider(); got != meterProvider {
+				t.Errorf("global meter provider = %T, want the one set before", got)
+			}
+		})
+	}
+}
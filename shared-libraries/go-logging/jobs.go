@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Background jobs
+//
+// Work done outside a request (queue workers, schedulers, periodic refreshes)
+// should not become a child of whatever span is in its context: a worker's
+// context usually has none, and a request's span has ended long before the
+// job runs, so Tempo shows the job as an orphan or buries it under a finished
+// request. StartJob gives each run of a job its own root span instead. A span
+// in ctx, such as the request that queued the job, is linked to the run, and
+// the run's trace ID is added to that span as a "job_started" event, so each
+// can be found from the other.
+
+// StartJob starts the root span of one run of a background job. The returned
+// context carries ctx's values and cancellation with the new span; the
+// returned function ends the run, marking the span as failed if err is not
+// nil, and records its duration in background_job_duration_seconds.
+//
+// A job that must outlive the request that queued it should be started with
+// context.WithoutCancel(r.Context()).
+func (l *Logger) StartJob(ctx context.Context, name string) (context.Context, func(err error)) {
+	start := time.Now()
+	if !l.initialized || l.tracer == nil {
+		return ctx, func(err error) { l.recordJob(ctx, name, err, time.Since(start)) }
+	}
+
+	origin := trace.SpanFromContext(ctx)
+	opts := []trace.SpanStartOption{
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("service", l.serviceName),
+			attribute.String("version", l.version),
+			attribute.String("environment", l.environment),
+			attribute.String("job", name),
+		),
+	}
+	if origin.SpanContext().IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{
+			SpanContext: origin.SpanContext(),
+			Attributes:  []attribute.KeyValue{attribute.String("link.type", "origin")},
+		}))
+	}
+
+	ctx, span := l.tracer.Start(ctx, name, opts...)
+	if origin.IsRecording() {
+		origin.AddEvent("job_started", trace.WithAttributes(
+			attribute.String("job", name),
+			attribute.String("job.trace_id", span.SpanContext().TraceID().String()),
+		))
+	}
+
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		l.recordJob(ctx, name, err, time.Since(start))
+	}
+}
+
+// recordJob records the duration and outcome of a job run
+func (l *Logger) recordJob(ctx context.Context, name string, err error, duration time.Duration) {
+	if !l.initialized || l.jobDuration == nil {
+		return
+	}
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	l.jobDuration.Record(ctx, duration.Seconds(), metric.WithAttributes(
+		attribute.String("job", name),
+		attribute.String("outcome", outcome),
+		attribute.String("service", l.serviceName),
+	))
+}
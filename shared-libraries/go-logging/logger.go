@@ -2,20 +2,26 @@ package logging
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -28,109 +34,392 @@ type Logger struct {
 	meter           metric.Meter
 	requestCounter  metric.Int64Counter
 	requestDuration metric.Float64Histogram
+	clientDuration  metric.Float64Histogram
+	jobDuration     metric.Float64Histogram
+	sliCounter      metric.Int64Counter
+	logMessages     metric.Int64Counter
+	exportFailures  metric.Int64Counter
+	exportDropped   metric.Int64Counter
+	exportQueues    exportQueues
+	exportBuffer    int
+	propagator      propagation.TextMapPropagator
+	instruments     instruments
+	certificates    certificateExpiries
 	initialized     bool
+	slog            *slog.Logger
+	minLevel        *slog.LevelVar
+	sampleRatio     float64
+	envSampler      sdktrace.Sampler
+	routes          map[string]RouteTelemetry
+	sampler         *reloadableSampler
+	exportInterval  time.Duration
+	batching        Batching
+	metricReader    *intervalReader
+	durationBuckets []float64
+	exemplarFilter  exemplar.Filter
+	runtimeMetrics  bool
+	logExport       bool
+	stackTraces     bool
+	prometheus      bool
+	keepGlobals     bool
+	metricsHandler  http.Handler
+	flushTimeout    time.Duration
+	tracerProvider  *sdktrace.TracerProvider
+	meterProvider   *sdkmetric.MeterProvider
+	loggerProvider  *sdklog.LoggerProvider
+	asyncOutput     *asyncWriter
+	deduper         *logDeduper
+	sinkFiles       []*os.File
+	// setupErr is why telemetry isn't (fully) exported, reported by SelfTest
+	setupErr error
 }
 
-// Config holds the configuration for the logger
+// Config holds the configuration for the logger. ServiceName, Version,
+// Environment, AlloyURL, Protocol and TraceSampleRatio fall back to the
+// standard OTEL_* environment variables when empty (see otelenv.go).
 type Config struct {
 	ServiceName string
 	Version     string
 	Environment string
 	AlloyURL    string
+	// Protocol is the OTLP transport to AlloyURL: "http" (default, usually
+	// port 4318) or "grpc" (usually port 4317)
+	Protocol string
+	// TLS sends telemetry over TLS, verified against the system roots or
+	// TLSCACert; setting TLSCACert or TLSClientCert implies it
+	TLS bool
+	// TLSCACert is a PEM file of CAs trusted for the collector
+	TLSCACert string
+	// TLSClientCert and TLSClientKey are PEM files of a client certificate
+	// for collectors requiring mutual TLS
+	TLSClientCert string
+	TLSClientKey  string
+	// Headers are sent with every export, e.g. an Authorization token
+	Headers map[string]string
+
+	// LogLevel is the lowest level written: "debug" (default), "info", "warn" or "error"
+	LogLevel string
+	// Handler receives the log lines; nil writes them to stdout in Format
+	Handler slog.Handler
+	// Format is the format of the stdout lines: "json" (default), "logfmt"
+	// or "console" (see format.go)
+	Format string
+	// Caller adds the file, line and function that logged each line (see
+	// caller.go)
+	Caller bool
+	// StackTraces adds the stack of the call to lines logged by Error and
+	// ErrorFields
+	StackTraces bool
+	// AsyncLogBuffer is the number of stdout lines buffered for a background
+	// writer, dropping the oldest when full (see async.go); 0 writes them
+	// synchronously
+	AsyncLogBuffer int
+	// LogSampling limits repeated log lines (see sampling.go); nil writes
+	// them all
+	LogSampling *LogSampling
+	// DedupWindow collapses identical warning and error lines within the
+	// window into one with a repeat_count (see dedup.go); 0 writes them all
+	DedupWindow time.Duration
+	// LogExport also sends the log lines to AlloyURL over OTLP, with the
+	// resource of the spans and metrics and their trace context
+	LogExport bool
+	// Sinks are the destinations of the log lines, each with its own level
+	// (see sinks.go); empty means stdout, plus OTLP with LogExport
+	Sinks []Sink
+	// TraceSampleRatio is the fraction of new traces sampled; 0 samples all.
+	// Traces started upstream follow the caller's decision.
+	TraceSampleRatio float64
+	// traceSampler is the sampler of OTEL_TRACES_SAMPLER, used while
+	// TraceSampleRatio is 0
+	traceSampler sdktrace.Sampler
+	// keepGlobals leaves the global OpenTelemetry propagator and providers
+	// alone, for loggers that mustn't affect the rest of the process
+	keepGlobals bool
+	// Routes quiets the spans and metrics of noisy routes such as probes, by
+	// route name (see routetelemetry.go)
+	Routes map[string]RouteTelemetry
+	// ExportInterval is how often metrics are exported over OTLP; 0 means a
+	// minute
+	ExportInterval time.Duration
+	// Batching tunes the queues and batches of the OTLP export (see
+	// batching.go); zero values keep the SDK defaults
+	Batching Batching
+	// ExportRetry sets the retries of failed exports and the buffer of the
+	// spans and log lines they couldn't send (see retry.go)
+	ExportRetry ExportRetry
+	// FlushTimeout bounds ForceFlush and Shutdown; 0 means 5 seconds
+	FlushTimeout time.Duration
+	// Propagators are the trace context formats read from and written to
+	// requests: "tracecontext", "baggage", "b3" and "b3multi"; empty means
+	// DefaultPropagators
+	Propagators []string
+	// DurationBuckets are the bucket boundaries, in seconds, of
+	// http_request_duration_seconds; empty means DefaultDurationBuckets
+	DurationBuckets []float64
+	// PrometheusExporter also serves the metrics for scraping, from the
+	// handler returned by MetricsHandler (see prometheus.go); it works with
+	// or without an AlloyURL
+	PrometheusExporter bool
+	// RuntimeMetrics exports goroutine, memory, GC pause and CPU metrics of
+	// the Go runtime (see runtime.go)
+	RuntimeMetrics bool
+	// Exemplars picks the measurements kept as exemplars, each carrying its
+	// trace ID: "trace_based" (default, those made within a sampled span),
+	// "always_on" or "always_off"
+	Exemplars string
 }
 
+const defaultFlushTimeout = 5 * time.Second
+
+// DefaultDurationBuckets are the request duration buckets, with boundaries at
+// the 100ms, 300ms and 1s SLO thresholds so their compliance can be read from
+// the histogram without interpolating
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.2, 0.3, 0.5, 1, 2.5, 5, 10}
+
+// Exemplar filters
+const (
+	ExemplarsTraceBased = "trace_based"
+	ExemplarsAlwaysOn   = "always_on"
+	ExemplarsAlwaysOff  = "always_off"
+)
+
+// OTLP protocols
+const (
+	ProtocolHTTP = "http"
+	ProtocolGRPC = "grpc"
+)
+
 // New creates a new logger instance
 func New(config Config) *Logger {
+	return newLogger(withOTelEnv(config))
+}
+
+// newLogger creates a logger of config as given, without the OTEL_*
+// fallbacks
+func newLogger(config Config) *Logger {
 	logger := &Logger{
-		serviceName: config.ServiceName,
-		version:     config.Version,
-		environment: config.Environment,
+		serviceName:     config.ServiceName,
+		version:         config.Version,
+		environment:     config.Environment,
+		sampleRatio:     config.TraceSampleRatio,
+		envSampler:      config.traceSampler,
+		routes:          config.Routes,
+		exportInterval:  config.ExportInterval,
+		batching:        config.Batching,
+		exportBuffer:    config.ExportRetry.bufferSize(),
+		durationBuckets: config.DurationBuckets,
+		runtimeMetrics:  config.RuntimeMetrics,
+		logExport:       hasSink(logSinks(config), SinkOTLP),
+		prometheus:      config.PrometheusExporter,
+		keepGlobals:     config.keepGlobals,
+		flushTimeout:    config.FlushTimeout,
+		minLevel:        new(slog.LevelVar),
+		stackTraces:     config.StackTraces,
+	}
+	if logger.flushTimeout <= 0 {
+		logger.flushTimeout = defaultFlushTimeout
+	}
+	if len(logger.durationBuckets) == 0 {
+		logger.durationBuckets = DefaultDurationBuckets
+	}
+
+	switch strings.ToLower(config.Exemplars) {
+	case "", ExemplarsTraceBased:
+		logger.exemplarFilter = exemplar.TraceBasedFilter
+	case ExemplarsAlwaysOn:
+		logger.exemplarFilter = exemplar.AlwaysOnFilter
+	case ExemplarsAlwaysOff:
+		logger.exemplarFilter = exemplar.AlwaysOffFilter
+	default:
+		log.Printf("Unknown exemplar filter %q, using trace_based", config.Exemplars)
+		logger.exemplarFilter = exemplar.TraceBasedFilter
+	}
+
+	logger.minLevel.Set(slog.LevelDebug)
+	if config.LogLevel != "" {
+		level, ok := logLevels[strings.ToUpper(config.LogLevel)]
+		if !ok {
+			log.Printf("Unknown log level %q, logging everything", config.LogLevel)
+		} else {
+			logger.minLevel.Set(level)
+		}
 	}
 
-	// Initialize OpenTelemetry if AlloyURL is provided
+	// Trace context is propagated whether or not telemetry is exported
+	logger.setupPropagator(config.Propagators)
+
+	// Export over OTLP if AlloyURL is provided
+	var export *exportSettings
 	if config.AlloyURL != "" {
-		logger.initOpenTelemetry(config.AlloyURL)
+		protocol := strings.ToLower(config.Protocol)
+		switch protocol {
+		case ProtocolHTTP, ProtocolGRPC:
+		case "":
+			protocol = ProtocolHTTP
+		default:
+			log.Printf("Unknown OTLP protocol %q, using http", config.Protocol)
+			protocol = ProtocolHTTP
+		}
+
+		var err error
+		export, err = newExportSettings(config, protocol)
+		if err != nil {
+			log.Printf("Invalid OTLP TLS settings, not exporting telemetry: %v", err)
+			logger.setupErr = fmt.Errorf("invalid OTLP TLS settings: %w", err)
+		}
 	}
+	if export != nil || logger.prometheus {
+		logger.initOpenTelemetry(export)
+	}
+
+	// Set up after the exporters, as log lines may go out over OTLP too
+	logger.slog = slog.New(logger.newHandler(config))
 
 	return logger
 }
 
-// initOpenTelemetry sets up OpenTelemetry components
-func (l *Logger) initOpenTelemetry(alloyURL string) {
+// initOpenTelemetry sets up OpenTelemetry components; without export
+// settings only the metrics are set up, for Prometheus
+func (l *Logger) initOpenTelemetry(export *exportSettings) {
 	ctx := context.Background()
 
-	// Create resource with service information
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName(l.serviceName),
-			semconv.ServiceVersion(l.version),
-			semconv.DeploymentEnvironment(l.environment),
-		),
-	)
+	// Create resource with service information and where it runs
+	res, err := l.newResource(ctx)
 	if err != nil {
 		log.Printf("Failed to create resource: %v", err)
+		l.setupErr = fmt.Errorf("creating resource: %w", err)
 		return
 	}
 
 	// Initialize tracing
-	l.initTracing(ctx, res, alloyURL)
+	if export != nil {
+		l.initTracing(ctx, res, export)
+	}
 
 	// Initialize metrics
-	l.initMetrics(ctx, res, alloyURL)
+	l.initMetrics(ctx, res, export)
+
+	// Initialize log export
+	if l.logExport && export != nil {
+		l.initLogs(ctx, res, export)
+	}
 
 	l.initialized = true
 }
 
 // initTracing sets up tracing
-func (l *Logger) initTracing(ctx context.Context, res *resource.Resource, alloyURL string) {
+func (l *Logger) initTracing(ctx context.Context, res *resource.Resource, export *exportSettings) {
 	// Create OTLP trace exporter
-	traceExporter, err := otlptracehttp.New(ctx,
-		otlptracehttp.WithEndpoint(alloyURL),
-		otlptracehttp.WithInsecure(),
-	)
+	traceExporter, err := export.newTraceExporter(ctx)
 	if err != nil {
 		log.Printf("Failed to create trace exporter: %v", err)
+		l.setupErr = errors.Join(l.setupErr, fmt.Errorf("creating trace exporter: %w", err))
 		return
 	}
 
+	// Sample a share of new traces, follow the caller's decision otherwise
+	l.sampler = newReloadableSampler(l.sampleRatio)
+	if l.envSampler != nil {
+		l.sampler.use(l.envSampler)
+	}
+
 	// Create trace provider
 	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(traceExporter),
+		sdktrace.WithBatcher(&bufferingSpanExporter{
+			SpanExporter: traceExporter,
+			buffer:       newExportBuffer[sdktrace.ReadOnlySpan](l, signalTraces, l.exportBuffer),
+			logger:       l,
+		}, l.batching.spanOptions()...),
 		sdktrace.WithResource(res),
+		sdktrace.WithSampler(debugSampler{next: newRouteSampler(l.routes, l.sampler)}),
 	)
 
 	// Set global trace provider
-	otel.SetTracerProvider(tp)
+	if !l.keepGlobals {
+		otel.SetTracerProvider(tp)
+	}
+	l.tracerProvider = tp
 
 	// Create tracer
 	l.tracer = tp.Tracer(l.serviceName)
 }
 
 // initMetrics sets up metrics
-func (l *Logger) initMetrics(ctx context.Context, res *resource.Resource, alloyURL string) {
+func (l *Logger) initMetrics(ctx context.Context, res *resource.Resource, export *exportSettings) {
+	var readers []sdkmetric.Reader
+
 	// Create OTLP metric exporter
-	metricExporter, err := otlpmetrichttp.New(ctx,
-		otlpmetrichttp.WithEndpoint(alloyURL),
-		otlpmetrichttp.WithInsecure(),
-	)
-	if err != nil {
-		log.Printf("Failed to create metric exporter: %v", err)
-		return
+	if export != nil {
+		metricExporter, err := export.newMetricExporter(ctx)
+		if err != nil {
+			log.Printf("Failed to create metric exporter: %v", err)
+			l.setupErr = errors.Join(l.setupErr, fmt.Errorf("creating metric exporter: %w", err))
+		} else {
+			l.metricReader = newIntervalReader(&countingMetricExporter{Exporter: metricExporter, logger: l}, l.exportInterval, l.batching.metricExportTimeout())
+			readers = append(readers, l.metricReader)
+		}
 	}
 
-	// Create meter provider
-	mp := sdkmetric.NewMeterProvider(
-		sdkmetric.WithResource(res),
-		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
-	)
+	// Create Prometheus reader, next to the OTLP one
+	if l.prometheus {
+		reader, err := l.newPrometheusReader()
+		if err != nil {
+			log.Printf("Failed to create Prometheus exporter: %v", err)
+			l.setupErr = errors.Join(l.setupErr, fmt.Errorf("creating Prometheus exporter: %w", err))
+		} else {
+			readers = append(readers, reader)
+		}
+	}
+
+	if len(readers) == 0 {
+		return
+	}
+	mp := l.newMeterProvider(res, readers...)
 
 	// Set global meter provider
-	otel.SetMeterProvider(mp)
+	if !l.keepGlobals {
+		otel.SetMeterProvider(mp)
+	}
+	l.meterProvider = mp
 
 	// Create meter
 	l.meter = mp.Meter(l.serviceName)
 
-	// Create metrics
+	if l.runtimeMetrics {
+		if err := l.startRuntimeMetrics(mp); err != nil {
+			log.Printf("Failed to start runtime metrics: %v", err)
+			l.setupErr = errors.Join(l.setupErr, fmt.Errorf("starting runtime metrics: %w", err))
+		}
+	}
+
+	l.createMetrics()
+}
+
+// newMeterProvider returns a meter provider collected by readers, with the
+// request duration buckets as a view. Histograms keep one exemplar per
+// bucket, so a slow bucket in Grafana links to a trace of a request that
+// landed in it.
+func (l *Logger) newMeterProvider(res *resource.Resource, readers ...sdkmetric.Reader) *sdkmetric.MeterProvider {
+	opts := []sdkmetric.Option{
+		sdkmetric.WithResource(res),
+		sdkmetric.WithExemplarFilter(l.exemplarFilter),
+		sdkmetric.WithView(sdkmetric.NewView(
+			sdkmetric.Instrument{Name: "http_request_duration_seconds"},
+			sdkmetric.Stream{
+				Aggregation:                       sdkmetric.AggregationExplicitBucketHistogram{Boundaries: l.durationBuckets},
+				ExemplarReservoirProviderSelector: sdkmetric.DefaultExemplarReservoirProviderSelector,
+			},
+		)),
+	}
+	for _, reader := range readers {
+		opts = append(opts, sdkmetric.WithReader(reader))
+	}
+	return sdkmetric.NewMeterProvider(opts...)
+}
+
+// createMetrics creates the logger's own instruments on l.meter
+func (l *Logger) createMetrics() {
+	var err error
 	l.requestCounter, err = l.meter.Int64Counter(
 		"http_requests_total",
 		metric.WithDescription("HTTP requests"),
@@ -146,68 +435,208 @@ func (l *Logger) initMetrics(ctx context.Context, res *resource.Resource, alloyU
 	if err != nil {
 		log.Printf("Failed to create http_request_duration_seconds histogram: %v", err)
 	}
+
+	l.clientDuration, err = l.meter.Float64Histogram(
+		"http_client_request_duration_seconds",
+		metric.WithDescription("Duration of outgoing HTTP requests in seconds"),
+	)
+	if err != nil {
+		log.Printf("Failed to create http_client_request_duration_seconds histogram: %v", err)
+	}
+
+	l.jobDuration, err = l.meter.Float64Histogram(
+		"background_job_duration_seconds",
+		metric.WithDescription("Duration of background job runs in seconds"),
+	)
+	if err != nil {
+		log.Printf("Failed to create background_job_duration_seconds histogram: %v", err)
+	}
+
+	l.sliCounter, err = l.meter.Int64Counter(
+		"sli_requests_total",
+		metric.WithDescription("Requests counted against the SLIs of their route, by endpoint, sli, target and outcome"),
+	)
+	if err != nil {
+		log.Printf("Failed to create sli_requests_total counter: %v", err)
+	}
+
+	l.logMessages, err = l.meter.Int64Counter(
+		"log_messages_total",
+		metric.WithDescription("Log lines logged, by level"),
+	)
+	if err != nil {
+		log.Printf("Failed to create log_messages_total counter: %v", err)
+	}
+
+	l.createExportMetrics()
+}
+
+// initLogs sets up the export of log lines
+func (l *Logger) initLogs(ctx context.Context, res *resource.Resource, export *exportSettings) {
+	logExporter, err := export.newLogExporter(ctx)
+	if err != nil {
+		log.Printf("Failed to create log exporter: %v", err)
+		l.setupErr = errors.Join(l.setupErr, fmt.Errorf("creating log exporter: %w", err))
+		return
+	}
+
+	l.loggerProvider = sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(&bufferingLogExporter{
+			Exporter: logExporter,
+			buffer:   newExportBuffer[sdklog.Record](l, signalLogs, l.exportBuffer),
+			logger:   l,
+		}, l.batching.logOptions()...)),
+	)
+}
+
+// Lifecycle functions
+
+// ForceFlush writes the log lines and exports the spans, metrics and (with
+// LogExport) log lines buffered so far, waiting at most FlushTimeout
+func (l *Logger) ForceFlush(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, l.flushTimeout)
+	defer cancel()
+
+	var errs []error
+	l.deduper.flush()
+	if l.asyncOutput != nil {
+		errs = append(errs, l.asyncOutput.flush(ctx))
+	}
+	for _, file := range l.sinkFiles {
+		errs = append(errs, file.Sync())
+	}
+	if l.tracerProvider != nil {
+		errs = append(errs, l.tracerProvider.ForceFlush(ctx))
+	}
+	if l.meterProvider != nil {
+		errs = append(errs, l.meterProvider.ForceFlush(ctx))
+	}
+	if l.loggerProvider != nil {
+		errs = append(errs, l.loggerProvider.ForceFlush(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown exports the buffered telemetry and stops the exporters,
+// waiting at most FlushTimeout. Call it last when the service stops (e.g. on
+// SIGTERM); logging still works afterwards, telemetry is dropped.
+func (l *Logger) Shutdown(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, l.flushTimeout)
+	defer cancel()
+
+	var errs []error
+	l.deduper.flush()
+	if l.asyncOutput != nil {
+		errs = append(errs, l.asyncOutput.close(ctx))
+	}
+	for _, file := range l.sinkFiles {
+		errs = append(errs, file.Sync())
+	}
+	if l.tracerProvider != nil {
+		errs = append(errs, l.tracerProvider.Shutdown(ctx))
+	}
+	if l.meterProvider != nil {
+		errs = append(errs, l.meterProvider.Shutdown(ctx))
+	}
+	if l.loggerProvider != nil {
+		errs = append(errs, l.loggerProvider.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// SelfTest checks that telemetry reaches the collector: it writes a log line,
+// records a span (sampled whatever TraceSampleRatio says) and a
+// selftest_runs_total metric, and flushes them. It returns why telemetry
+// couldn't be set up or exported; without an AlloyURL only the log line is
+// written and it returns nil.
+func (l *Logger) SelfTest(ctx context.Context) error {
+	if l.setupErr != nil {
+		return l.setupErr
+	}
+
+	ctx, endSpan := l.StartSpan(WithDebug(ctx), "selftest")
+	l.Info(ctx, "Telemetry self-test", map[string]interface{}{
+		"exporting": l.initialized,
+	})
+	if l.meter != nil {
+		counter, err := l.meter.Int64Counter("selftest_runs_total", metric.WithDescription("Telemetry self-tests"))
+		if err != nil {
+			endSpan()
+			return fmt.Errorf("creating selftest_runs_total counter: %w", err)
+		}
+		counter.Add(ctx, 1)
+	}
+	endSpan()
+
+	return l.ForceFlush(ctx)
 }
 
 // Logging functions
 
 // Info logs an info message
 func (l *Logger) Info(ctx context.Context, message string, fields ...map[string]interface{}) {
-	l.log(ctx, "INFO", message, fields...)
+	l.log(ctx, slog.LevelInfo, message, fields...)
 }
 
-// Error logs an error message
+// Error logs an error message and fails the span in ctx (see Fail)
 func (l *Logger) Error(ctx context.Context, message string, err error, fields ...map[string]interface{}) {
+	l.Fail(ctx, err)
 	allFields := []map[string]interface{}{{"error": err.Error()}}
 	allFields = append(allFields, fields...)
-	l.log(ctx, "ERROR", message, allFields...)
+	l.log(ctx, slog.LevelError, message, allFields...)
 }
 
 // Warn logs a warning message
 func (l *Logger) Warn(ctx context.Context, message string, fields ...map[string]interface{}) {
-	l.log(ctx, "WARN", message, fields...)
+	l.log(ctx, slog.LevelWarn, message, fields...)
 }
 
 // Debug logs a debug message
 func (l *Logger) Debug(ctx context.Context, message string, fields ...map[string]interface{}) {
-	l.log(ctx, "DEBUG", message, fields...)
+	l.log(ctx, slog.LevelDebug, message, fields...)
 }
 
-// log is the internal logging function
-func (l *Logger) log(ctx context.Context, level, message string, fields ...map[string]interface{}) {
-	logData := map[string]interface{}{
-		"timestamp":   time.Now().UTC().Format(time.RFC3339),
-		"level":       level,
-		"message":     message,
-		"service":     l.serviceName,
-		"version":     l.version,
-		"environment": l.environment,
-	}
+// Handler returns the handler behind the logger, with the service fields,
+// LogLevel and trace context applied, for code logging through log/slog:
+//
+//	slog.SetDefault(slog.New(logger.Handler()))
+func (l *Logger) Handler() slog.Handler {
+	return l.slog.Handler()
+}
 
-	// Add trace context automatically
-	if l.initialized && l.tracer != nil {
-		if span := trace.SpanFromContext(ctx); span.IsRecording() {
-			logData["trace_id"] = span.SpanContext().TraceID().String()
-			logData["span_id"] = span.SpanContext().SpanID().String()
-		}
+// log is the internal logging function
+func (l *Logger) log(ctx context.Context, level slog.Level, message string, fields ...map[string]interface{}) {
+	if !l.slog.Enabled(ctx, level) {
+		return
 	}
 
-	// Merge all fields
+	// Merge all fields, later maps win
+	merged := make(map[string]interface{})
 	for _, fieldMap := range fields {
 		for k, v := range fieldMap {
-			logData[k] = v
+			merged[k] = v
 		}
 	}
+	keys := make([]string, 0, len(merged))
+	for k := range merged {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, slog.Any(k, merged[k]))
+	}
 
-	// Send to stdout (will be collected by Loki)
-	jsonData, _ := json.Marshal(logData)
-	log.Println(string(jsonData))
+	// Skipping log and the Info, Error, Warn or Debug that called it
+	l.emit(ctx, 4, level, message, attrs)
 }
 
 // Metric functions
 
 // CountRequest increments the request counter
 func (l *Logger) CountRequest(ctx context.Context, endpoint string, statusCode int) {
-	if l.initialized && l.requestCounter != nil {
+	if l.initialized && l.requestCounter != nil && !l.skipMetrics(endpoint) {
 		l.requestCounter.Add(ctx, 1, metric.WithAttributes(
 			attribute.String("endpoint", endpoint),
 			attribute.String("status_code", fmt.Sprintf("%d", statusCode)),
@@ -216,9 +645,10 @@ func (l *Logger) CountRequest(ctx context.Context, endpoint string, statusCode i
 	}
 }
 
-// RecordDuration records request duration
+// RecordDuration records request duration. Pass the request's context while
+// its span is still open: a sampled span's trace ID becomes the exemplar.
 func (l *Logger) RecordDuration(ctx context.Context, endpoint string, duration time.Duration) {
-	if l.initialized && l.requestDuration != nil {
+	if l.initialized && l.requestDuration != nil && !l.skipMetrics(endpoint) {
 		l.requestDuration.Record(ctx, duration.Seconds(), metric.WithAttributes(
 			attribute.String("endpoint", endpoint),
 			attribute.String("service", l.serviceName),
@@ -228,10 +658,18 @@ func (l *Logger) RecordDuration(ctx context.Context, endpoint string, duration t
 
 // Tracing functions
 
-// StartSpan starts a new span
-func (l *Logger) StartSpan(ctx context.Context, operation string) (context.Context, func()) {
+// StartSpan starts a new span, internal unless opts say otherwise (see
+// spans.go)
+func (l *Logger) StartSpan(ctx context.Context, operation string, opts ...SpanOption) (context.Context, func()) {
+	// Debug requests report how long each span took
+	endTiming := func() {}
+	if IsDebug(ctx) {
+		started := time.Now()
+		endTiming = func() { recordTiming(ctx, operation, time.Since(started)) }
+	}
+
 	if l.initialized && l.tracer != nil {
-		ctx, span := l.tracer.Start(ctx, operation)
+		ctx, span := l.tracer.Start(ctx, operation, opts...)
 		span.SetAttributes(
 			attribute.String("service", l.serviceName),
 			attribute.String("version", l.version),
@@ -240,11 +678,12 @@ func (l *Logger) StartSpan(ctx context.Context, operation string) (context.Conte
 
 		return ctx, func() {
 			span.End()
+			endTiming()
 		}
 	}
 
 	// Return no-op if not initialized
-	return ctx, func() {}
+	return ctx, endTiming
 }
 
 // AddSpanEvent adds an event to the current span
@@ -267,11 +706,60 @@ func (l *Logger) AddSpanEvent(ctx context.Context, event string, fields ...map[s
 	}
 }
 
-// AddSpanAttribute adds an attribute to the current span
+// Fail records err on the current span and sets its status to error, so the
+// failure shows in trace views and not only in the logs. Error and
+// ErrorFields call it; call it directly for errors that are returned rather
+// than logged.
+func (l *Logger) Fail(ctx context.Context, err error) {
+	if err == nil || !l.initialized || l.tracer == nil {
+		return
+	}
+	if span := trace.SpanFromContext(ctx); span.IsRecording() {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// AddSpanAttribute adds a string attribute to the current span
 func (l *Logger) AddSpanAttribute(ctx context.Context, key, value string) {
+	l.setSpanAttributes(ctx, attribute.String(key, value))
+}
+
+// AddSpanAttributeInt adds an int attribute to the current span, so TraceQL
+// can compare it as a number
+func (l *Logger) AddSpanAttributeInt(ctx context.Context, key string, value int) {
+	l.setSpanAttributes(ctx, attribute.Int(key, value))
+}
+
+// AddSpanAttributeFloat adds a float attribute to the current span
+func (l *Logger) AddSpanAttributeFloat(ctx context.Context, key string, value float64) {
+	l.setSpanAttributes(ctx, attribute.Float64(key, value))
+}
+
+// AddSpanAttributeBool adds a bool attribute to the current span
+func (l *Logger) AddSpanAttributeBool(ctx context.Context, key string, value bool) {
+	l.setSpanAttributes(ctx, attribute.Bool(key, value))
+}
+
+// AddSpanAttributes adds attributes to the current span, typed after their
+// values: integers, floats and bools keep their type, other values are
+// written as strings
+func (l *Logger) AddSpanAttributes(ctx context.Context, attributes map[string]interface{}) {
+	if len(attributes) == 0 {
+		return
+	}
+	attrs := make([]attribute.KeyValue, 0, len(attributes))
+	for key, value := range attributes {
+		attrs = append(attrs, attributeOf(Any(key, value)))
+	}
+	l.setSpanAttributes(ctx, attrs...)
+}
+
+// setSpanAttributes sets attrs on the current span if it is recording
+func (l *Logger) setSpanAttributes(ctx context.Context, attrs ...attribute.KeyValue) {
 	if l.initialized && l.tracer != nil {
 		if span := trace.SpanFromContext(ctx); span.IsRecording() {
-			span.SetAttributes(attribute.String(key, value))
+			span.SetAttributes(attrs...)
 		}
 	}
 }
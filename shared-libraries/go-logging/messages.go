@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Log message counts
+//
+// Every line logged is counted in log_messages_total by level and service, so
+// an error spike can be alerted on from metrics alone, also when the service
+// answers no requests and its HTTP metrics go quiet. Lines are counted as
+// logged, before sampling and deduplication, and only at levels some output
+// writes.
+
+// countingHandler counts the lines handed to the logger's handler
+type countingHandler struct {
+	next   slog.Handler
+	logger *Logger
+}
+
+func (h *countingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *countingHandler) Handle(ctx context.Context, record slog.Record) error {
+	if h.logger.logMessages != nil {
+		h.logger.logMessages.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("level", strings.ToLower(record.Level.String())),
+			attribute.String("service", h.logger.serviceName),
+		))
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *countingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &countingHandler{next: h.next.WithAttrs(attrs), logger: h.logger}
+}
+
+func (h *countingHandler) WithGroup(name string) slog.Handler {
+	return &countingHandler{next: h.next.WithGroup(name), logger: h.logger}
+}
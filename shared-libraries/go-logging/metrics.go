@@ -0,0 +1,228 @@
+package logging
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// Application metrics
+//
+// Counter, UpDownCounter, Histogram and Gauge create instruments on the
+// logger's meter, so a service can record its own metrics
+// (workflows_processed_total, queue depths) next to the HTTP ones without
+// using the OpenTelemetry SDK. An instrument is created once per name and
+// returned again on later calls; without an OTLP endpoint they record
+// nothing. Every recording carries the service label, plus the labels passed
+// with it. ObservableGauge registers a gauge read from a callback whenever
+// metrics are collected, for values the service already tracks.
+
+// Labels are the attributes of one recording
+type Labels map[string]string
+
+// Counter is a monotonically increasing metric
+type Counter struct {
+	logger     *Logger
+	instrument metric.Float64Counter
+}
+
+// UpDownCounter is a metric changed by the amounts added to it, e.g. +1 when
+// work starts and -1 when it ends
+type UpDownCounter struct {
+	logger     *Logger
+	instrument metric.Float64UpDownCounter
+}
+
+// Histogram is a distribution of recorded values
+type Histogram struct {
+	logger     *Logger
+	instrument metric.Float64Histogram
+}
+
+// Gauge is a metric set to its current value
+type Gauge struct {
+	logger     *Logger
+	instrument metric.Float64Gauge
+}
+
+// instruments caches the instruments created by name
+type instruments struct {
+	mu             sync.Mutex
+	counters       map[string]*Counter
+	upDownCounters map[string]*UpDownCounter
+	histograms     map[string]*Histogram
+	gauges         map[string]*Gauge
+	observed       map[string]bool
+}
+
+// Observer reports one value of an observable gauge
+type Observer func(value float64, labels ...Labels)
+
+// appMeter returns the meter of application metrics, a no-op one if
+// metrics aren't exported
+func (l *Logger) appMeter() metric.Meter {
+	if l.initialized && l.meter != nil {
+		return l.meter
+	}
+	return noop.NewMeterProvider().Meter(l.serviceName)
+}
+
+// Counter returns the counter called name, creating it on first use
+func (l *Logger) Counter(name string) *Counter {
+	l.instruments.mu.Lock()
+	defer l.instruments.mu.Unlock()
+
+	if c, ok := l.instruments.counters[name]; ok {
+		return c
+	}
+	instrument, err := l.appMeter().Float64Counter(name)
+	if err != nil {
+		log.Printf("Failed to create %s counter: %v", name, err)
+		instrument, _ = noop.NewMeterProvider().Meter("").Float64Counter(name)
+	}
+	c := &Counter{logger: l, instrument: instrument}
+	if l.instruments.counters == nil {
+		l.instruments.counters = make(map[string]*Counter)
+	}
+	l.instruments.counters[name] = c
+	return c
+}
+
+// UpDownCounter returns the up-down counter called name, creating it on
+// first use
+func (l *Logger) UpDownCounter(name string) *UpDownCounter {
+	l.instruments.mu.Lock()
+	defer l.instruments.mu.Unlock()
+
+	if c, ok := l.instruments.upDownCounters[name]; ok {
+		return c
+	}
+	instrument, err := l.appMeter().Float64UpDownCounter(name)
+	if err != nil {
+		log.Printf("Failed to create %s up-down counter: %v", name, err)
+		instrument, _ = noop.NewMeterProvider().Meter("").Float64UpDownCounter(name)
+	}
+	c := &UpDownCounter{logger: l, instrument: instrument}
+	if l.instruments.upDownCounters == nil {
+		l.instruments.upDownCounters = make(map[string]*UpDownCounter)
+	}
+	l.instruments.upDownCounters[name] = c
+	return c
+}
+
+// Histogram returns the histogram called name, creating it on first use with
+// the bucket boundaries (the SDK's defaults if none). Boundaries passed after
+// the first call are ignored.
+func (l *Logger) Histogram(name string, buckets ...float64) *Histogram {
+	l.instruments.mu.Lock()
+	defer l.instruments.mu.Unlock()
+
+	if h, ok := l.instruments.histograms[name]; ok {
+		return h
+	}
+	var opts []metric.Float64HistogramOption
+	if len(buckets) > 0 {
+		opts = append(opts, metric.WithExplicitBucketBoundaries(buckets...))
+	}
+	instrument, err := l.appMeter().Float64Histogram(name, opts...)
+	if err != nil {
+		log.Printf("Failed to create %s histogram: %v", name, err)
+		instrument, _ = noop.NewMeterProvider().Meter("").Float64Histogram(name)
+	}
+	h := &Histogram{logger: l, instrument: instrument}
+	if l.instruments.histograms == nil {
+		l.instruments.histograms = make(map[string]*Histogram)
+	}
+	l.instruments.histograms[name] = h
+	return h
+}
+
+// Gauge returns the gauge called name, creating it on first use
+func (l *Logger) Gauge(name string) *Gauge {
+	l.instruments.mu.Lock()
+	defer l.instruments.mu.Unlock()
+
+	if g, ok := l.instruments.gauges[name]; ok {
+		return g
+	}
+	instrument, err := l.appMeter().Float64Gauge(name)
+	if err != nil {
+		log.Printf("Failed to create %s gauge: %v", name, err)
+		instrument, _ = noop.NewMeterProvider().Meter("").Float64Gauge(name)
+	}
+	g := &Gauge{logger: l, instrument: instrument}
+	if l.instruments.gauges == nil {
+		l.instruments.gauges = make(map[string]*Gauge)
+	}
+	l.instruments.gauges[name] = g
+	return g
+}
+
+// ObservableGauge registers a gauge called name whose values callback
+// reports, through observe, each time metrics are collected. A name can only
+// be registered once; later registrations are ignored.
+func (l *Logger) ObservableGauge(name string, callback func(ctx context.Context, observe Observer)) {
+	l.instruments.mu.Lock()
+	defer l.instruments.mu.Unlock()
+
+	if l.instruments.observed[name] {
+		log.Printf("Observable gauge %s is already registered", name)
+		return
+	}
+	_, err := l.appMeter().Float64ObservableGauge(name, metric.WithFloat64Callback(
+		func(ctx context.Context, o metric.Float64Observer) error {
+			callback(ctx, func(value float64, labels ...Labels) {
+				o.Observe(value, metric.WithAttributes(l.metricAttributes(labels)...))
+			})
+			return nil
+		},
+	))
+	if err != nil {
+		log.Printf("Failed to create %s observable gauge: %v", name, err)
+		return
+	}
+	if l.instruments.observed == nil {
+		l.instruments.observed = make(map[string]bool)
+	}
+	l.instruments.observed[name] = true
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc(ctx context.Context, labels ...Labels) {
+	c.Add(ctx, 1, labels...)
+}
+
+// Add adds a non-negative value to the counter
+func (c *Counter) Add(ctx context.Context, value float64, labels ...Labels) {
+	c.instrument.Add(ctx, value, metric.WithAttributes(c.logger.metricAttributes(labels)...))
+}
+
+// Add adds a positive or negative value to the counter
+func (c *UpDownCounter) Add(ctx context.Context, value float64, labels ...Labels) {
+	c.instrument.Add(ctx, value, metric.WithAttributes(c.logger.metricAttributes(labels)...))
+}
+
+// Record adds a value to the histogram
+func (h *Histogram) Record(ctx context.Context, value float64, labels ...Labels) {
+	h.instrument.Record(ctx, value, metric.WithAttributes(h.logger.metricAttributes(labels)...))
+}
+
+// Set sets the gauge to a value
+func (g *Gauge) Set(ctx context.Context, value float64, labels ...Labels) {
+	g.instrument.Record(ctx, value, metric.WithAttributes(g.logger.metricAttributes(labels)...))
+}
+
+// metricAttributes converts labels to attributes with the service label
+func (l *Logger) metricAttributes(labels []Labels) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String("service", l.serviceName)}
+	for _, set := range labels {
+		for k, v := range set {
+			attrs = append(attrs, attribute.String(k, v))
+		}
+	}
+	return attrs
+}
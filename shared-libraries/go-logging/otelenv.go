@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Standard OpenTelemetry environment
+//
+// A deployment can configure the logger as it would any OpenTelemetry SDK.
+// Config fields left empty fall back to the standard variables:
+//
+//	AlloyURL          OTEL_EXPORTER_OTLP_ENDPOINT (e.g. http://alloy:4318; an
+//	                  https endpoint implies TLS, its path is ignored)
+//	Protocol          OTEL_EXPORTER_OTLP_PROTOCOL ("grpc", "http/protobuf")
+//	ServiceName       OTEL_SERVICE_NAME, then service.name of
+//	                  OTEL_RESOURCE_ATTRIBUTES
+//	Version           service.version of OTEL_RESOURCE_ATTRIBUTES
+//	Environment       deployment.environment of OTEL_RESOURCE_ATTRIBUTES
+//	TraceSampleRatio  OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG
+//
+// The other OTEL_RESOURCE_ATTRIBUTES (key=value pairs, comma-separated) are
+// added to the resource of the spans, metrics and log lines. Config fields
+// that are set win over the environment.
+
+// withOTelEnv fills the empty fields of config from the OTEL_* variables
+func withOTelEnv(config Config) Config {
+	if config.AlloyURL == "" {
+		if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+			var secure bool
+			config.AlloyURL, secure = otlpEndpoint(endpoint)
+			config.TLS = config.TLS || secure
+		}
+	}
+	if config.Protocol == "" {
+		switch protocol := os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"); protocol {
+		case "":
+		case "grpc":
+			config.Protocol = ProtocolGRPC
+		case "http/protobuf":
+			config.Protocol = ProtocolHTTP
+		default:
+			log.Printf("Unsupported OTEL_EXPORTER_OTLP_PROTOCOL %q, using http", protocol)
+		}
+	}
+
+	attributes := ParseHeaders(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if config.ServiceName == "" {
+		config.ServiceName = os.Getenv("OTEL_SERVICE_NAME")
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = attributes["service.name"]
+	}
+	if config.Version == "" {
+		config.Version = attributes["service.version"]
+	}
+	if config.Environment == "" {
+		config.Environment = attributes["deployment.environment"]
+	}
+	if config.TraceSampleRatio == 0 {
+		config.traceSampler = samplerFromEnv()
+	}
+	return config
+}
+
+// otlpEndpoint returns the host:port of an OTLP endpoint URL and whether it
+// is served over TLS; an endpoint without a scheme is taken as host:port
+func otlpEndpoint(endpoint string) (string, bool) {
+	if !strings.Contains(endpoint, "://") {
+		return endpoint, false
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" {
+		log.Printf("Invalid OTEL_EXPORTER_OTLP_ENDPOINT %q, ignoring it", endpoint)
+		return "", false
+	}
+	return parsed.Host, parsed.Scheme == "https"
+}
+
+// samplerFromEnv returns the sampler named by OTEL_TRACES_SAMPLER, with the
+// ratio of OTEL_TRACES_SAMPLER_ARG, or nil if none is named
+func samplerFromEnv() sdktrace.Sampler {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_TRACES_SAMPLER")))
+	if name == "" {
+		return nil
+	}
+	ratio := 1.0
+	if arg := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); arg != "" {
+		parsed, err := strconv.ParseFloat(arg, 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			log.Printf("Invalid OTEL_TRACES_SAMPLER_ARG %q, sampling all traces", arg)
+		} else {
+			ratio = parsed
+		}
+	}
+
+	switch name {
+	case "always_on":
+		return sdktrace.AlwaysSample()
+	case "always_off":
+		return sdktrace.NeverSample()
+	case "traceidratio":
+		return sdktrace.TraceIDRatioBased(ratio)
+	case "parentbased_always_on":
+		return sdktrace.ParentBased(sdktrace.AlwaysSample())
+	case "parentbased_always_off":
+		return sdktrace.ParentBased(sdktrace.NeverSample())
+	case "parentbased_traceidratio":
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+	}
+	log.Printf("Unsupported OTEL_TRACES_SAMPLER %q, ignoring it", name)
+	return nil
+}
@@ -0,0 +1,43 @@
+package logging
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// Prometheus exporter
+//
+// Clusters that scrape /metrics instead of running Alloy set
+// Config.PrometheusExporter. The logger's meter provider then gets a
+// Prometheus reader next to the OTLP one (if AlloyURL is set), so every
+// metric - the HTTP request metrics, application metrics and the global
+// meter provider's instruments alike - is both pushed and served:
+//
+//	logger := logging.New(logging.Config{..., PrometheusExporter: true})
+//	r.Handle("/metrics", logger.MetricsHandler())
+//
+// Without an AlloyURL only metrics are collected; spans and log export stay
+// off. Metric names follow the Prometheus conventions of the OpenTelemetry
+// exporter (units and _total suffixes added where missing).
+
+// newPrometheusReader returns a reader collected on each scrape of the
+// metrics handler
+func (l *Logger) newPrometheusReader() (sdkmetric.Reader, error) {
+	registry := prometheus.NewRegistry()
+	exporter, err := otelprometheus.New(otelprometheus.WithRegisterer(registry))
+	if err != nil {
+		return nil, err
+	}
+	l.metricsHandler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	return exporter, nil
+}
+
+// MetricsHandler serves the metrics in the Prometheus text format; it's nil
+// unless PrometheusExporter is set
+func (l *Logger) MetricsHandler() http.Handler {
+	return l.metricsHandler
+}
@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Context propagation
+//
+// The logger registers a composite TextMapPropagator built from
+// Config.Propagators as the global propagator, and uses it for incoming
+// requests (Extract, HTTPMiddleware) and outgoing ones (Inject,
+// HTTPTransport). The default is W3C TraceContext plus Baggage; B3 can be
+// added for callers or services still on Zipkin headers.
+
+// Propagator names for Config.Propagators
+const (
+	PropagatorTraceContext = "tracecontext"
+	PropagatorBaggage      = "baggage"
+	// PropagatorB3 is the single "b3" header, PropagatorB3Multi the
+	// X-B3-* headers
+	PropagatorB3      = "b3"
+	PropagatorB3Multi = "b3multi"
+)
+
+// DefaultPropagators are used when Config.Propagators is empty
+var DefaultPropagators = []string{PropagatorTraceContext, PropagatorBaggage}
+
+// newPropagator builds the composite propagator of the named formats,
+// skipping unknown names
+func newPropagator(names []string) (propagation.TextMapPropagator, error) {
+	if len(names) == 0 {
+		names = DefaultPropagators
+	}
+
+	var propagators []propagation.TextMapPropagator
+	var unknown []string
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case PropagatorTraceContext:
+			propagators = append(propagators, propagation.TraceContext{})
+		case PropagatorBaggage:
+			propagators = append(propagators, propagation.Baggage{})
+		case PropagatorB3:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case PropagatorB3Multi:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case "":
+		default:
+			unknown = append(unknown, name)
+		}
+	}
+
+	var err error
+	if len(unknown) > 0 {
+		err = fmt.Errorf("unknown propagators %s", strings.Join(unknown, ", "))
+		log.Printf("Ignoring %v", err)
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), err
+}
+
+// setupPropagator installs the configured propagator on the logger and,
+// unless keepGlobals, as the global one
+func (l *Logger) setupPropagator(names []string) {
+	propagator, err := newPropagator(names)
+	if err != nil {
+		l.setupErr = err
+	}
+	l.propagator = propagator
+	if !l.keepGlobals {
+		otel.SetTextMapPropagator(propagator)
+	}
+}
+
+// Extract returns the request's context continuing the trace (and baggage)
+// its headers carry
+func (l *Logger) Extract(r *http.Request) context.Context {
+	return l.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+}
+
+// Inject adds the trace (and baggage) of ctx to the request's headers
+func (l *Logger) Inject(ctx context.Context, req *http.Request) {
+	l.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+}
@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// Panic recovery
+//
+// net/http catches a handler's panic by itself, but only to print it to
+// stderr and drop the connection: the client gets no response, the span is
+// never failed and the request isn't counted. RecoverMiddleware catches it
+// first. It logs the panic at error level with its stack trace and the trace
+// and span IDs of the request, fails the span in the request's context and
+// answers 500 unless the handler had already started its response. Placed
+// inside HTTPMiddleware the span it fails is the request's and the 500 is
+// counted like any other.
+//
+// A panic in a goroutine of its own takes the whole process down. Go runs fn
+// in a goroutine that recovers and reports the panic the same way, failing
+// the span in ctx.
+//
+// Both count the panics they recover in panics_recovered_total, by kind
+// (http or goroutine).
+
+// RecoverMiddleware recovers the panics of a handler, logging and counting
+// them and answering 500. http.ErrAbortHandler, which aborts a response on
+// purpose, is passed on.
+func (l *Logger) RecoverMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w}
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				l.recovered(r.Context(), "http", "HTTP handler panicked", recovered,
+					String("method", r.Method),
+					String("path", r.URL.Path),
+				)
+				if sw.status == 0 {
+					sw.Header().Set("Content-Type", "application/json")
+					sw.WriteHeader(http.StatusInternalServerError)
+					sw.Write([]byte(`{"ok":false,"error":"Internal server error"}` + "\n"))
+				}
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
+
+// Go runs fn in a new goroutine, recovering and logging its panics
+func (l *Logger) Go(ctx context.Context, fn func(ctx context.Context)) {
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				l.recovered(ctx, "goroutine", "Goroutine panicked", recovered)
+			}
+		}()
+		fn(ctx)
+	}()
+}
+
+// recovered reports a recovered panic: it fails the span in ctx, logs the
+// panic with the stack of the goroutine it happened in and counts it
+func (l *Logger) recovered(ctx context.Context, kind, message string, recovered interface{}, fields ...Field) {
+	err, ok := recovered.(error)
+	if ok {
+		err = fmt.Errorf("panic: %w", err)
+	} else {
+		err = fmt.Errorf("panic: %v", recovered)
+	}
+	l.ErrorFields(ctx, message, err, append(fields, String("stack", string(debug.Stack())))...)
+	l.Counter("panics_recovered_total").Inc(ctx, Labels{"kind": kind})
+}
@@ -0,0 +1,299 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Runtime reload
+//
+// The log level, trace sample ratio and metric export interval can change
+// while the service runs, each swapped atomically in place: SetLogLevel,
+// SetTraceSampleRatio and SetExportInterval. WatchConfig applies them from a
+// file of KEY=VALUE lines, e.g. a mounted ConfigMap:
+//
+//	LOG_LEVEL=info
+//	TRACE_SAMPLE_RATIO=0.1
+//	METRICS_EXPORT_INTERVAL_SEC=15
+//
+// The file is read at start, whenever it changes (checked every
+// configPollInterval) and on SIGHUP. Keys left out keep their value; an
+// invalid value is logged and the previous one kept. Sink levels set in
+// Config.Sinks are fixed.
+
+const (
+	configPollInterval = 10 * time.Second
+
+	defaultExportInterval = time.Minute
+	exportTimeout         = 30 * time.Second
+)
+
+// Reloadable settings
+const (
+	SettingLogLevel         = "LOG_LEVEL"
+	SettingTraceSampleRatio = "TRACE_SAMPLE_RATIO"
+	SettingExportInterval   = "METRICS_EXPORT_INTERVAL_SEC"
+)
+
+// SetLogLevel changes the lowest level written: "debug", "info", "warn" or
+// "error"
+func (l *Logger) SetLogLevel(level string) error {
+	parsed, ok := logLevels[strings.ToUpper(level)]
+	if !ok {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	l.minLevel.Set(parsed)
+	return nil
+}
+
+// SetTraceSampleRatio changes the fraction of new traces sampled; 0 samples
+// all
+func (l *Logger) SetTraceSampleRatio(ratio float64) error {
+	if l.sampler == nil {
+		return errors.New("tracing is not set up")
+	}
+	if ratio < 0 || ratio > 1 {
+		return fmt.Errorf("sample ratio %g is not between 0 and 1", ratio)
+	}
+	l.sampler.set(ratio)
+	return nil
+}
+
+// SetExportInterval changes how often metrics are exported over OTLP
+func (l *Logger) SetExportInterval(interval time.Duration) error {
+	if l.metricReader == nil {
+		return errors.New("metrics are not exported over OTLP")
+	}
+	if interval <= 0 {
+		return fmt.Errorf("export interval %s is not positive", interval)
+	}
+	l.metricReader.setInterval(interval)
+	return nil
+}
+
+// WatchConfig applies the settings of a file at start, when it changes and on
+// SIGHUP, until ctx is done
+func (l *Logger) WatchConfig(ctx context.Context, path string) error {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	var last []byte
+	for {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			l.Error(ctx, "Failed to read telemetry config", err, map[string]interface{}{
+				"path": path,
+			})
+		} else if last == nil || !bytes.Equal(data, last) {
+			l.applySettings(ctx, path, data)
+			last = data
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hangup:
+			// Reapply even if unchanged, e.g. after a SetLogLevel
+			last = nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// applySettings applies the KEY=VALUE lines of a config file
+func (l *Logger) applySettings(ctx context.Context, path string, data []byte) {
+	changed := make(map[string]interface{})
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		var err error
+		switch key {
+		case SettingLogLevel:
+			err = l.SetLogLevel(value)
+		case SettingTraceSampleRatio:
+			var ratio float64
+			if ratio, err = strconv.ParseFloat(value, 64); err == nil {
+				err = l.SetTraceSampleRatio(ratio)
+			}
+		case SettingExportInterval:
+			var seconds int
+			if seconds, err = strconv.Atoi(value); err == nil {
+				err = l.SetExportInterval(time.Duration(seconds) * time.Second)
+			}
+		default:
+			l.Warn(ctx, "Unknown telemetry setting", map[string]interface{}{
+				"path": path,
+				"key":  key,
+			})
+			continue
+		}
+		if err != nil {
+			l.Error(ctx, "Invalid telemetry setting", err, map[string]interface{}{
+				"path":  path,
+				"key":   key,
+				"value": value,
+			})
+			continue
+		}
+		changed[key] = value
+	}
+
+	changed["path"] = path
+	l.Info(ctx, "Telemetry settings applied", changed)
+}
+
+// reloadableSampler samples a ratio of new traces that can change, and
+// follows the caller's decision for traces started upstream
+type reloadableSampler struct {
+	current atomic.Pointer[sdktrace.Sampler]
+}
+
+func newReloadableSampler(ratio float64) *reloadableSampler {
+	s := &reloadableSampler{}
+	s.set(ratio)
+	return s
+}
+
+func (s *reloadableSampler) set(ratio float64) {
+	root := sdktrace.AlwaysSample()
+	if ratio > 0 && ratio < 1 {
+		root = sdktrace.TraceIDRatioBased(ratio)
+	}
+	s.use(sdktrace.ParentBased(root))
+}
+
+// use makes sampler decide from now on
+func (s *reloadableSampler) use(sampler sdktrace.Sampler) {
+	s.current.Store(&sampler)
+}
+
+func (s *reloadableSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	return (*s.current.Load()).ShouldSample(p)
+}
+
+func (s *reloadableSampler) Description() string {
+	return (*s.current.Load()).Description()
+}
+
+// intervalReader exports metrics at an interval that can change. It does the
+// job of the SDK's periodic reader, whose interval is fixed, on top of a
+// manual reader.
+type intervalReader struct {
+	*sdkmetric.ManualReader
+	exporter sdkmetric.Exporter
+	interval atomic.Int64
+	timeout  time.Duration
+	// mu keeps exports apart, as exporters may not be called concurrently
+	mu       sync.Mutex
+	reset    chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+	shutdown sync.Once
+}
+
+// newIntervalReader starts exporting to exporter every interval (a minute if
+// 0), each export taking at most timeout
+func newIntervalReader(exporter sdkmetric.Exporter, interval, timeout time.Duration) *intervalReader {
+	if interval <= 0 {
+		interval = defaultExportInterval
+	}
+	r := &intervalReader{
+		ManualReader: sdkmetric.NewManualReader(
+			sdkmetric.WithTemporalitySelector(exporter.Temporality),
+			sdkmetric.WithAggregationSelector(exporter.Aggregation),
+		),
+		exporter: exporter,
+		timeout:  timeout,
+		reset:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	r.interval.Store(int64(interval))
+	go r.run()
+	return r
+}
+
+func (r *intervalReader) setInterval(interval time.Duration) {
+	r.interval.Store(int64(interval))
+	select {
+	case r.reset <- struct{}{}:
+	default:
+	}
+}
+
+func (r *intervalReader) run() {
+	defer close(r.stopped)
+	ticker := time.NewTicker(time.Duration(r.interval.Load()))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+			if err := r.export(ctx); err != nil {
+				otel.Handle(err)
+			}
+			cancel()
+		case <-r.reset:
+			ticker.Reset(time.Duration(r.interval.Load()))
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// export collects the metrics and exports them
+func (r *intervalReader) export(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var data metricdata.ResourceMetrics
+	if err := r.Collect(ctx, &data); err != nil {
+		return err
+	}
+	return r.exporter.Export(ctx, &data)
+}
+
+// ForceFlush exports the metrics now
+func (r *intervalReader) ForceFlush(ctx context.Context) error {
+	if err := r.export(ctx); err != nil {
+		return err
+	}
+	return r.exporter.ForceFlush(ctx)
+}
+
+// Shutdown exports the metrics a last time and stops the exporter
+func (r *intervalReader) Shutdown(ctx context.Context) error {
+	err := sdkmetric.ErrReaderShutdown
+	r.shutdown.Do(func() {
+		close(r.done)
+		<-r.stopped
+		err = errors.Join(r.export(ctx), r.ManualReader.Shutdown(ctx), r.exporter.Shutdown(ctx))
+	})
+	return err
+}
@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// Resource detection
+//
+// Besides service.name, service.version and deployment.environment, the
+// resource of every span and metric says where the process runs, so traces
+// and metrics can be joined with the pod and node metrics of the cluster:
+//
+//	k8s.pod.name        POD_NAME, or HOSTNAME inside a cluster
+//	k8s.namespace.name  POD_NAMESPACE, or the service account's namespace file
+//	k8s.node.name       NODE_NAME
+//	host.name           the OS host name
+//	container.id        from the process's cgroup
+//
+// Attributes of OTEL_RESOURCE_ATTRIBUTES are added as well (see otelenv.go).
+//
+// POD_NAME, POD_NAMESPACE and NODE_NAME are meant to be set from the downward
+// API (fieldRef metadata.name, metadata.namespace and spec.nodeName). An
+// attribute that can't be found is left out.
+
+// serviceAccountNamespaceFile holds the pod's namespace in Kubernetes
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// newResource describes the service and where it runs
+func (l *Logger) newResource(ctx context.Context) (*resource.Resource, error) {
+	res, err := resource.New(ctx,
+		// OTEL_RESOURCE_ATTRIBUTES, overridden by the Config
+		resource.WithFromEnv(),
+		resource.WithAttributes(
+			semconv.ServiceName(l.serviceName),
+			semconv.ServiceVersion(l.version),
+			semconv.DeploymentEnvironment(l.environment),
+		),
+		resource.WithAttributes(kubernetesAttributes()...),
+		resource.WithHost(),
+		resource.WithContainer(),
+	)
+	// A detector that fails still leaves the others' attributes
+	if errors.Is(err, resource.ErrPartialResource) && res != nil {
+		return res, nil
+	}
+	return res, err
+}
+
+// kubernetesAttributes are the k8s.* attributes found in the environment
+func kubernetesAttributes() []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+
+	// The pod's host name is its name, unless hostname is set in the spec
+	podName := os.Getenv("POD_NAME")
+	if podName == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		podName = os.Getenv("HOSTNAME")
+	}
+	if podName != "" {
+		attrs = append(attrs, semconv.K8SPodName(podName))
+	}
+
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		if data, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+			namespace = strings.TrimSpace(string(data))
+		}
+	}
+	if namespace != "" {
+		attrs = append(attrs, semconv.K8SNamespaceName(namespace))
+	}
+
+	if nodeName := os.Getenv("NODE_NAME"); nodeName != "" {
+		attrs = append(attrs, semconv.K8SNodeName(nodeName))
+	}
+	return attrs
+}
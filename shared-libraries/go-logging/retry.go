@@ -0,0 +1,290 @@
+package logging
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Export retry and buffering
+//
+// While Alloy restarts, exports fail. The OTLP exporters retry a failed
+// export with exponential backoff, from InitialInterval up to MaxInterval
+// between attempts, for at most MaxElapsedTime (and the export's
+// ExportTimeout, see batching.go). Spans and log lines of an export that
+// still fails are kept in memory, up to BufferSize of each, and sent again
+// with the next export; past BufferSize the oldest are dropped. Metrics need
+// no buffer: they are exported as running totals, so the next export after
+// the outage carries what was counted during it.
+//
+// The pipeline reports on itself:
+//
+//	otel_export_failures_total  exports that failed after their retries, by signal
+//	otel_export_queue_length    spans or log lines buffered for the next export, by signal
+//	otel_export_dropped_total   spans or log lines dropped from a full buffer, by signal
+//
+// Signals are "traces", "metrics" and "logs". Failures of the metrics
+// export itself only reach Alloy once it is back, so alert on them from
+// Prometheus (PrometheusExporter) or on gaps in the other metrics.
+
+// Export signals
+const (
+	signalTraces  = "traces"
+	signalMetrics = "metrics"
+	signalLogs    = "logs"
+)
+
+// defaultExportBufferSize is the default of ExportRetry.BufferSize
+const defaultExportBufferSize = 2048
+
+// ExportRetry configures the retries of failed exports and the buffer of
+// what they couldn't send
+type ExportRetry struct {
+	// InitialInterval is the wait after a failed attempt before the first
+	// retry; 0 means 5 seconds
+	InitialInterval time.Duration
+	// MaxInterval bounds the wait between retries; 0 means 30 seconds
+	MaxInterval time.Duration
+	// MaxElapsedTime is how long an export is retried; 0 means a minute
+	MaxElapsedTime time.Duration
+	// BufferSize is the number of spans, and of log lines, kept for the
+	// next export when an export fails; 0 means 2048, negative keeps none
+	BufferSize int
+}
+
+// retrySettings has the fields of the OTLP exporters' RetryConfig types, so
+// it converts to each of them
+type retrySettings struct {
+	Enabled         bool
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	MaxElapsedTime  time.Duration
+}
+
+// settings returns the retry settings of r, with the SDK defaults for unset
+// fields
+func (r ExportRetry) settings() retrySettings {
+	settings := retrySettings{
+		Enabled:         true,
+		InitialInterval: 5 * time.Second,
+		MaxInterval:     30 * time.Second,
+		MaxElapsedTime:  time.Minute,
+	}
+	if r.InitialInterval > 0 {
+		settings.InitialInterval = r.InitialInterval
+	}
+	if r.MaxInterval > 0 {
+		settings.MaxInterval = r.MaxInterval
+	}
+	if r.MaxElapsedTime > 0 {
+		settings.MaxElapsedTime = r.MaxElapsedTime
+	}
+	return settings
+}
+
+// bufferSize returns the size of the export buffers
+func (r ExportRetry) bufferSize() int {
+	if r.BufferSize == 0 {
+		return defaultExportBufferSize
+	}
+	return max(r.BufferSize, 0)
+}
+
+// exportBuffer keeps the items of failed exports for the next one
+type exportBuffer[T any] struct {
+	signal string
+	size   int
+	logger *Logger
+
+	mu    sync.Mutex
+	items []T
+}
+
+// queuedExports is an exportBuffer of any item type
+type queuedExports interface {
+	length() int
+	signalName() string
+}
+
+// exportQueues are the buffers reported in otel_export_queue_length; the log
+// buffer is added after the gauge's callback is registered
+type exportQueues struct {
+	mu     sync.Mutex
+	queues []queuedExports
+}
+
+// add registers a buffer
+func (q *exportQueues) add(queue queuedExports) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queues = append(q.queues, queue)
+}
+
+// all returns the registered buffers
+func (q *exportQueues) all() []queuedExports {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]queuedExports(nil), q.queues...)
+}
+
+// newExportBuffer returns a buffer of size items for signal, reported in
+// otel_export_queue_length
+func newExportBuffer[T any](l *Logger, signal string, size int) *exportBuffer[T] {
+	b := &exportBuffer[T]{signal: signal, size: size, logger: l}
+	l.exportQueues.add(b)
+	return b
+}
+
+// take empties the buffer, returning what it held
+func (b *exportBuffer[T]) take() []T {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	items := b.items
+	b.items = nil
+	return items
+}
+
+// keep buffers the items of a failed export, dropping the oldest if they
+// don't all fit
+func (b *exportBuffer[T]) keep(ctx context.Context, items []T) {
+	b.mu.Lock()
+	dropped := 0
+	if excess := len(b.items) + len(items) - b.size; excess > 0 {
+		dropped = excess
+		if excess >= len(b.items) {
+			items = items[excess-len(b.items):]
+			b.items = nil
+		} else {
+			b.items = b.items[excess:]
+		}
+	}
+	b.items = append(b.items, items...)
+	b.mu.Unlock()
+
+	if dropped > 0 && b.logger.exportDropped != nil {
+		b.logger.exportDropped.Add(ctx, int64(dropped), metric.WithAttributes(
+			attribute.String("signal", b.signal),
+			attribute.String("service", b.logger.serviceName),
+		))
+	}
+}
+
+func (b *exportBuffer[T]) length() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.items)
+}
+
+func (b *exportBuffer[T]) signalName() string {
+	return b.signal
+}
+
+// exportFailed counts an export of signal that failed after its retries
+func (l *Logger) exportFailed(ctx context.Context, signal string) {
+	if l.exportFailures == nil {
+		return
+	}
+	l.exportFailures.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("signal", signal),
+		attribute.String("service", l.serviceName),
+	))
+}
+
+// createExportMetrics creates the metrics of the export pipeline
+func (l *Logger) createExportMetrics() {
+	var err error
+	l.exportFailures, err = l.meter.Int64Counter(
+		"otel_export_failures_total",
+		metric.WithDescription("Telemetry exports that failed after their retries, by signal"),
+	)
+	if err != nil {
+		log.Printf("Failed to create otel_export_failures_total counter: %v", err)
+	}
+
+	l.exportDropped, err = l.meter.Int64Counter(
+		"otel_export_dropped_total",
+		metric.WithDescription("Spans and log lines dropped from a full export buffer, by signal"),
+	)
+	if err != nil {
+		log.Printf("Failed to create otel_export_dropped_total counter: %v", err)
+	}
+
+	_, err = l.meter.Int64ObservableGauge(
+		"otel_export_queue_length",
+		metric.WithDescription("Spans and log lines buffered for the next export after a failed one, by signal"),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			for _, queue := range l.exportQueues.all() {
+				o.Observe(int64(queue.length()), metric.WithAttributes(
+					attribute.String("signal", queue.signalName()),
+					attribute.String("service", l.serviceName),
+				))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		log.Printf("Failed to create otel_export_queue_length gauge: %v", err)
+	}
+}
+
+// bufferingSpanExporter sends the spans of failed exports again with the
+// next export
+type bufferingSpanExporter struct {
+	sdktrace.SpanExporter
+	buffer *exportBuffer[sdktrace.ReadOnlySpan]
+	logger *Logger
+}
+
+func (e *bufferingSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	batch := append(e.buffer.take(), spans...)
+	err := e.SpanExporter.ExportSpans(ctx, batch)
+	if err != nil {
+		e.logger.exportFailed(ctx, signalTraces)
+		e.buffer.keep(ctx, batch)
+	}
+	return err
+}
+
+// countingMetricExporter counts failed metric exports
+type countingMetricExporter struct {
+	sdkmetric.Exporter
+	logger *Logger
+}
+
+func (e *countingMetricExporter) Export(ctx context.Context, data *metricdata.ResourceMetrics) error {
+	err := e.Exporter.Export(ctx, data)
+	if err != nil {
+		e.logger.exportFailed(ctx, signalMetrics)
+	}
+	return err
+}
+
+// bufferingLogExporter sends the log lines of failed exports again with the
+// next export
+type bufferingLogExporter struct {
+	sdklog.Exporter
+	buffer *exportBuffer[sdklog.Record]
+	logger *Logger
+}
+
+func (e *bufferingLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	buffered := e.buffer.take()
+	err := e.Exporter.Export(ctx, append(buffered, records...))
+	if err != nil {
+		e.logger.exportFailed(ctx, signalLogs)
+		// The records are only lent to Export
+		for _, record := range records {
+			buffered = append(buffered, record.Clone())
+		}
+		e.buffer.keep(ctx, buffered)
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Quiet routes
+//
+// Kubelet probes hit /healthz and /readyz every few seconds on every pod,
+// and their spans and request metrics crowd out the traffic dashboards are
+// for. Config.Routes quiets routes by name, the name given to
+// HTTPMiddleware or passed to CountRequest:
+//
+//	Routes: logging.QuietRoutes(0, "/healthz", "/readyz"),
+//
+// A quiet route's server spans are sampled at TraceRatio (none at 0),
+// whatever TraceSampleRatio and the caller say; the spans of a debug request
+// are still kept. With SkipMetrics its requests are left out of
+// http_requests_total, http_request_duration_seconds and sli_requests_total.
+// Spans are matched on the http.route attribute set when they start, which
+// HTTPMiddleware does; the access log line is written either way.
+
+// RouteTelemetry is the telemetry kept for a route
+type RouteTelemetry struct {
+	// TraceRatio is the fraction of the route's requests traced; 0 traces
+	// none
+	TraceRatio float64
+	// SkipMetrics leaves the route's requests out of the HTTP metrics
+	SkipMetrics bool
+}
+
+// QuietRoutes returns the settings of routes traced at traceRatio and left
+// out of the metrics; empty names are skipped
+func QuietRoutes(traceRatio float64, routes ...string) map[string]RouteTelemetry {
+	quiet := make(map[string]RouteTelemetry)
+	for _, route := range routes {
+		if route = strings.TrimSpace(route); route != "" {
+			quiet[route] = RouteTelemetry{TraceRatio: traceRatio, SkipMetrics: true}
+		}
+	}
+	return quiet
+}
+
+// routeAttribute is the span attribute quiet routes are matched on
+const routeAttribute = "http.route"
+
+// skipMetrics tells whether the requests of route are left out of the
+// metrics
+func (l *Logger) skipMetrics(route string) bool {
+	return l.routes[route].SkipMetrics
+}
+
+// routeSampler samples the server spans of quiet routes at their ratio and
+// defers to next for the rest
+type routeSampler struct {
+	routes map[string]sdktrace.Sampler
+	next   sdktrace.Sampler
+}
+
+// newRouteSampler returns next with the quiet routes of routes, or next
+// itself if there are none
+func newRouteSampler(routes map[string]RouteTelemetry, next sdktrace.Sampler) sdktrace.Sampler {
+	if len(routes) == 0 {
+		return next
+	}
+	s := routeSampler{routes: make(map[string]sdktrace.Sampler), next: next}
+	for route, telemetry := range routes {
+		s.routes[route] = sdktrace.TraceIDRatioBased(telemetry.TraceRatio)
+	}
+	return s
+}
+
+func (s routeSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if p.Kind == trace.SpanKindServer {
+		for _, attr := range p.Attributes {
+			if attr.Key != attribute.Key(routeAttribute) {
+				continue
+			}
+			if sampler, ok := s.routes[attr.Value.AsString()]; ok {
+				return sampler.ShouldSample(p)
+			}
+			break
+		}
+	}
+	return s.next.ShouldSample(p)
+}
+
+func (s routeSampler) Description() string {
+	return "RouteSampler{" + s.next.Description() + "}"
+}
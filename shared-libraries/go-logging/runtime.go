@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"runtime/metrics"
+
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// Runtime metrics
+//
+// With Config.RuntimeMetrics the logger exports the Go runtime's resource
+// usage next to the service's own metrics. OpenTelemetry's runtime
+// instrumentation reports goroutines (go.goroutine.count), heap and total
+// memory (go.memory.used, go.memory.allocated, go.memory.gc.goal),
+// GOMAXPROCS and GOGC. It has no GC pause or CPU figures, so two counters
+// are added from the runtime's own accounting:
+//
+//	go.gc.pause.time  total stop-the-world GC pause, with go.gc.count cycles
+//	go.cpu.time       CPU time spent by the process's Go code, by class:
+//	                  user (goroutines), gc and scavenge (the runtime)
+//
+// CPU time is the runtime's estimate: it leaves out time in system calls and
+// cgo, so it reads a little below what the kernel accounts to the container.
+
+// cpuClasses maps the go.cpu.time classes to runtime/metrics names
+var cpuClasses = map[string]string{
+	"user":     "/cpu/classes/user:cpu-seconds",
+	"gc":       "/cpu/classes/gc/total:cpu-seconds",
+	"scavenge": "/cpu/classes/scavenge/total:cpu-seconds",
+}
+
+// startRuntimeMetrics registers the runtime metrics on a meter provider
+func (l *Logger) startRuntimeMetrics(mp *sdkmetric.MeterProvider) error {
+	if err := runtime.Start(runtime.WithMeterProvider(mp)); err != nil {
+		return fmt.Errorf("starting runtime instrumentation: %w", err)
+	}
+
+	meter := mp.Meter("github.com/faidon-laboratory/go-logging/runtime")
+	gcPause, err := meter.Float64ObservableCounter("go.gc.pause.time",
+		metric.WithDescription("Total stop-the-world pause of garbage collections"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+	gcCount, err := meter.Int64ObservableCounter("go.gc.count",
+		metric.WithDescription("Completed garbage collection cycles"),
+		metric.WithUnit("{cycle}"),
+	)
+	if err != nil {
+		return err
+	}
+	cpuTime, err := meter.Float64ObservableCounter("go.cpu.time",
+		metric.WithDescription("Estimated CPU time of the process's Go code"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		var stats debug.GCStats
+		debug.ReadGCStats(&stats)
+		o.ObserveFloat64(gcPause, stats.PauseTotal.Seconds())
+		o.ObserveInt64(gcCount, stats.NumGC)
+
+		// Collections can overlap (ForceFlush during an export), so each
+		// reads into its own samples
+		samples := make([]metrics.Sample, 0, len(cpuClasses))
+		classes := make([]string, 0, len(cpuClasses))
+		for class, name := range cpuClasses {
+			samples = append(samples, metrics.Sample{Name: name})
+			classes = append(classes, class)
+		}
+		metrics.Read(samples)
+		for i, sample := range samples {
+			if sample.Value.Kind() == metrics.KindFloat64 {
+				o.ObserveFloat64(cpuTime, sample.Value.Float64(),
+					metric.WithAttributes(attribute.String("class", classes[i])))
+			}
+		}
+		return nil
+	}, gcPause, gcCount, cpuTime)
+	return err
+}
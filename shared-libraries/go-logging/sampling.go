@@ -0,0 +1,147 @@
+package logging
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Log sampling
+//
+// A hot loop logging the same error can write thousands of lines a second
+// and flood Loki. With Config.LogSampling, lines are counted per level and
+// message within each Tick: the first Initial are written, then one in every
+// Thereafter, and the rest are dropped and counted in log_lines_dropped_total
+// by level. Distinct messages don't crowd each other out, and debug requests
+// are never sampled. Sampling applies to every output, stdout and OTLP alike.
+
+// LogSampling limits repeated log lines
+type LogSampling struct {
+	// Tick is the window the counts are kept for; 0 means a second
+	Tick time.Duration
+	// Initial lines of a level and message are written in each Tick; 0
+	// turns sampling off
+	Initial int
+	// Thereafter keeps one in every Thereafter lines past Initial; 0 drops
+	// them all
+	Thereafter int
+	// Levels are the sampled levels ("debug", "info", "warn", "error");
+	// empty means all
+	Levels []string
+}
+
+// maxSampledKeys bounds the messages counted in a Tick; later ones share a
+// single count
+const maxSampledKeys = 4096
+
+// samplingKey identifies the lines counted together
+type samplingKey struct {
+	level   slog.Level
+	message string
+}
+
+// samplingHandler drops lines over the LogSampling limits
+type samplingHandler struct {
+	next    slog.Handler
+	sampler *logSampler
+}
+
+// logSampler keeps the counts of the current Tick, shared by the handlers
+// derived with WithAttrs and WithGroup
+type logSampler struct {
+	config  LogSampling
+	levels  map[slog.Level]bool
+	dropped metric.Int64Counter
+
+	mu          sync.Mutex
+	windowStart time.Time
+	counts      map[samplingKey]int
+}
+
+// newLogSampler returns the sampler of a config, or nil if it samples nothing
+func newLogSampler(config *LogSampling, meter metric.Meter) *logSampler {
+	if config == nil || config.Initial <= 0 {
+		return nil
+	}
+	s := &logSampler{config: *config, counts: make(map[samplingKey]int)}
+	if s.config.Tick <= 0 {
+		s.config.Tick = time.Second
+	}
+	if len(config.Levels) > 0 {
+		s.levels = make(map[slog.Level]bool)
+		for _, name := range config.Levels {
+			level, ok := logLevels[strings.ToUpper(name)]
+			if !ok {
+				log.Printf("Unknown log sampling level %q, ignoring it", name)
+				continue
+			}
+			s.levels[level] = true
+		}
+	}
+	if meter != nil {
+		var err error
+		s.dropped, err = meter.Int64Counter(
+			"log_lines_dropped_total",
+			metric.WithDescription("Log lines dropped by sampling, by level"),
+		)
+		if err != nil {
+			log.Printf("Failed to create log_lines_dropped_total counter: %v", err)
+		}
+	}
+	return s
+}
+
+// allow tells whether to write a line, counting it
+func (s *logSampler) allow(level slog.Level, message string, now time.Time) bool {
+	if s.levels != nil && !s.levels[level] {
+		return true
+	}
+
+	s.mu.Lock()
+	if now.Sub(s.windowStart) >= s.config.Tick {
+		s.windowStart = now
+		clear(s.counts)
+	}
+	key := samplingKey{level: level, message: message}
+	if _, ok := s.counts[key]; !ok && len(s.counts) >= maxSampledKeys {
+		key.message = ""
+	}
+	s.counts[key]++
+	n := s.counts[key]
+	s.mu.Unlock()
+
+	if n <= s.config.Initial {
+		return true
+	}
+	return s.config.Thereafter > 0 && (n-s.config.Initial)%s.config.Thereafter == 0
+}
+
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, record slog.Record) error {
+	if IsDebug(ctx) || h.sampler.allow(record.Level, record.Message, time.Now()) {
+		return h.next.Handle(ctx, record)
+	}
+	if h.sampler.dropped != nil {
+		h.sampler.dropped.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("level", strings.ToLower(record.Level.String())),
+		))
+	}
+	return nil
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{next: h.next.WithAttrs(attrs), sampler: h.sampler}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{next: h.next.WithGroup(name), sampler: h.sampler}
+}
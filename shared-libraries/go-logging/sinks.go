@@ -0,0 +1,156 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+)
+
+// Log sinks
+//
+// Config.Sinks sends every log line to several destinations at once, each
+// with its own lowest level, e.g. everything to a local file, info and up to
+// stdout for Loki and only warnings over OTLP:
+//
+//	Sinks: []logging.Sink{
+//		{Kind: logging.SinkStdout, Level: "info"},
+//		{Kind: logging.SinkFile, Path: "/var/log/app/service.log"},
+//		{Kind: logging.SinkOTLP, Level: "warn"},
+//	}
+//
+// A sink without a Level follows LogLevel. Lines of debug requests reach
+// every sink. Without Sinks the lines go to stdout, and over OTLP too with
+// LogExport. A sink that can't be opened is left out, and reported by
+// SelfTest.
+
+// Sink kinds
+const (
+	// SinkStdout writes JSON lines to stdout, or to Config.Handler if set
+	SinkStdout = "stdout"
+	// SinkFile appends JSON lines to Path, creating it if needed
+	SinkFile = "file"
+	// SinkOTLP exports the lines to AlloyURL through the OpenTelemetry slog
+	// bridge
+	SinkOTLP = "otlp"
+)
+
+// Sink is a destination of log lines
+type Sink struct {
+	Kind string
+	// Path is the file of a file sink
+	Path string
+	// Level is the lowest level written to the sink: "debug", "info",
+	// "warn" or "error"; empty means LogLevel
+	Level string
+}
+
+// ParseSinks parses sinks from a comma-separated "kind[:path][@level]" list,
+// e.g. "stdout@info,file:/var/log/app/service.log,otlp@warn"
+func ParseSinks(value string) []Sink {
+	var sinks []Sink
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var sink Sink
+		if i := strings.LastIndex(entry, "@"); i >= 0 {
+			entry, sink.Level = entry[:i], entry[i+1:]
+		}
+		sink.Kind, sink.Path, _ = strings.Cut(entry, ":")
+		sinks = append(sinks, sink)
+	}
+	return sinks
+}
+
+// logSinks returns the sinks of a config
+func logSinks(config Config) []Sink {
+	if len(config.Sinks) > 0 {
+		return config.Sinks
+	}
+	sinks := []Sink{{Kind: SinkStdout}}
+	if config.LogExport {
+		sinks = append(sinks, Sink{Kind: SinkOTLP})
+	}
+	return sinks
+}
+
+// hasSink reports whether sinks include one of a kind
+func hasSink(sinks []Sink, kind string) bool {
+	for _, sink := range sinks {
+		if strings.ToLower(sink.Kind) == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// sinkHandler returns the handler of a sink, nil if it can't be used
+func (l *Logger) sinkHandler(config Config, sink Sink) slog.Handler {
+	minLevel := l.minLevel
+	if sink.Level != "" {
+		level, ok := logLevels[strings.ToUpper(sink.Level)]
+		if !ok {
+			log.Printf("Unknown level %q of %s log sink, using LogLevel", sink.Level, sink.Kind)
+		} else {
+			minLevel = new(slog.LevelVar)
+			minLevel.Set(level)
+		}
+	}
+
+	var output slog.Handler
+	switch strings.ToLower(sink.Kind) {
+	case SinkStdout:
+		output = config.Handler
+		if output == nil {
+			var out io.Writer = os.Stdout
+			if config.AsyncLogBuffer > 0 {
+				l.asyncOutput = newAsyncWriter(os.Stdout, config.AsyncLogBuffer, l.meter)
+				out = l.asyncOutput
+			}
+			output = newFormatHandler(config.Format, out)
+		}
+
+	case SinkFile:
+		file, err := os.OpenFile(sink.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			log.Printf("Failed to open log file: %v", err)
+			l.setupErr = errors.Join(l.setupErr, fmt.Errorf("opening log sink: %w", err))
+			return nil
+		}
+		l.sinkFiles = append(l.sinkFiles, file)
+		output = newJSONHandler(file)
+
+	case SinkOTLP:
+		// The records carry the trace context in their own fields and the
+		// service in the resource
+		if l.loggerProvider == nil {
+			if config.AlloyURL == "" {
+				log.Printf("OTLP log sink needs an AlloyURL, leaving it out")
+			}
+			return nil
+		}
+		bridge := otelslog.NewHandler(l.serviceName,
+			otelslog.WithVersion(l.version),
+			otelslog.WithLoggerProvider(l.loggerProvider),
+		)
+		return &contextHandler{next: bridge, minLevel: minLevel}
+
+	default:
+		log.Printf("Unknown log sink %q, leaving it out", sink.Kind)
+		return nil
+	}
+
+	handler := &contextHandler{next: output, minLevel: minLevel, traceAttrs: true}
+	return handler.WithAttrs([]slog.Attr{
+		slog.String("service", config.ServiceName),
+		slog.String("version", config.Version),
+		slog.String("environment", config.Environment),
+	})
+}
@@ -0,0 +1,145 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Service level indicators
+//
+// A route declares the SLIs it is measured by when it is registered, and the
+// middleware counts its requests against them in sli_requests_total (by
+// endpoint, sli, target and outcome, good or bad), so the SLO is good / total
+// over a window:
+//
+//	availability  requests answered without a 5xx are good
+//	latency       requests answered within the target are good; 5xx
+//	              responses are left to the availability SLI
+//	throughput    every request answered without a 5xx is counted as good;
+//	              the SLI is their rate
+//
+// Requests the client abandoned (499) count against no SLI.
+//
+// Where the status doesn't tell whether a request met its objective, e.g. a
+// 200 response missing the parts of a failed upstream, the handler judges it
+// and counts it with CountSLI under an SLI name of its own:
+//
+//	logger.CountSLI(ctx, "user_summary_complete", !summary.Partial)
+//
+// so the SLO query is the same good / total for every SLI, without status
+// codes in PromQL.
+
+// SLI kinds
+const (
+	SLIAvailability = "availability"
+	SLILatency      = "latency"
+	SLIThroughput   = "throughput"
+)
+
+// SLI is an indicator a route is measured by
+type SLI struct {
+	Kind string
+	// Target is the latency threshold of a latency SLI
+	Target time.Duration
+}
+
+// Availability returns the availability SLI
+func Availability() SLI {
+	return SLI{Kind: SLIAvailability}
+}
+
+// Latency returns the SLI of requests answered within target
+func Latency(target time.Duration) SLI {
+	return SLI{Kind: SLILatency, Target: target}
+}
+
+// Throughput returns the throughput SLI
+func Throughput() SLI {
+	return SLI{Kind: SLIThroughput}
+}
+
+// String returns the SLI as listed, e.g. "latency<=300ms"
+func (s SLI) String() string {
+	if s.Kind == SLILatency {
+		return s.Kind + "<=" + s.Target.String()
+	}
+	return s.Kind
+}
+
+// SLIStrings lists SLIs as strings
+func SLIStrings(slis []SLI) []string {
+	names := make([]string, len(slis))
+	for i, s := range slis {
+		names[i] = s.String()
+	}
+	return names
+}
+
+// RecordSLIs counts one request of a route against its SLIs
+func (l *Logger) RecordSLIs(ctx context.Context, routeName string, status int, duration time.Duration, slis ...SLI) {
+	if !l.initialized || l.sliCounter == nil || status == StatusClientClosedRequest || l.skipMetrics(routeName) {
+		return
+	}
+	failed := status >= http.StatusInternalServerError
+	for _, s := range slis {
+		good := !failed
+		target := ""
+		switch s.Kind {
+		case SLILatency:
+			if failed {
+				continue
+			}
+			good = duration <= s.Target
+			target = s.Target.String()
+		case SLIThroughput:
+			if failed {
+				continue
+			}
+		}
+		l.countSLI(ctx, routeName, s.Kind, target, good)
+	}
+}
+
+// CountSLI counts one event against sli, judged good or bad by the caller.
+// The event has no endpoint or target.
+func (l *Logger) CountSLI(ctx context.Context, sli string, good bool) {
+	if !l.initialized || l.sliCounter == nil {
+		return
+	}
+	l.countSLI(ctx, "", sli, "", good)
+}
+
+// countSLI adds one to sli_requests_total
+func (l *Logger) countSLI(ctx context.Context, endpoint, sli, target string, good bool) {
+	outcome := "bad"
+	if good {
+		outcome = "good"
+	}
+	l.sliCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("endpoint", endpoint),
+		attribute.String("sli", sli),
+		attribute.String("target", target),
+		attribute.String("outcome", outcome),
+		attribute.String("service", l.serviceName),
+	))
+}
+
+// SLIMiddleware counts the requests of a route against its SLIs, for routes
+// that aren't wrapped in HTTPMiddleware, which takes the SLIs itself
+func (l *Logger) SLIMiddleware(routeName string, slis ...SLI) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(slis) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			l.RecordSLIs(r.Context(), routeName, sw.statusOf(r.Context()), time.Since(start), slis...)
+		})
+	}
+}
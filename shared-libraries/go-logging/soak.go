@@ -0,0 +1,155 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// Soak diagnostics
+//
+// A slow leak only shows over hours, so a soak test needs a record of the
+// process's resources over its whole run. RunSoakDiagnostics takes one every
+// SoakDiagnostics.Interval: it logs a "Soak diagnostics" line with the heap
+// in use, the goroutines and the open file descriptors, each with its change
+// since the diagnostics started, and sets them on gauges:
+//
+//	soak_heap_bytes, soak_heap_growth_bytes
+//	soak_goroutines, soak_goroutine_growth
+//	soak_open_fds, soak_open_fd_growth
+//
+// Open file descriptors are counted from /proc/self/fd, so only on Linux;
+// elsewhere they are left out. With HeapGrowthThreshold set, a heap that has
+// grown by more than that since start gets a heap profile written to
+// ProfileDir, to be read with go tool pprof. The next profile waits until
+// the heap has grown by the threshold again, so a leak leaves a series of
+// profiles to diff rather than one per report.
+
+const defaultSoakInterval = time.Minute
+
+// SoakDiagnostics configures RunSoakDiagnostics
+type SoakDiagnostics struct {
+	// Interval is the time between reports; 0 means a minute
+	Interval time.Duration
+	// HeapGrowthThreshold is the heap growth in bytes past which a heap
+	// profile is written; 0 writes none
+	HeapGrowthThreshold uint64
+	// ProfileDir is where heap profiles are written; empty means the
+	// system's temporary directory
+	ProfileDir string
+}
+
+// resourceSample is one reading of the process's resources; openFDs is -1
+// where they can't be counted
+type resourceSample struct {
+	heapBytes  uint64
+	goroutines int
+	openFDs    int
+}
+
+// RunSoakDiagnostics reports the process's resources until ctx is done
+func (l *Logger) RunSoakDiagnostics(ctx context.Context, config SoakDiagnostics) error {
+	interval := config.Interval
+	if interval <= 0 {
+		interval = defaultSoakInterval
+	}
+	profileDir := config.ProfileDir
+	if profileDir == "" {
+		profileDir = os.TempDir()
+	}
+
+	started := time.Now()
+	baseline := sampleResources()
+	nextProfile := baseline.heapBytes + config.HeapGrowthThreshold
+	l.Info(ctx, "Soak diagnostics started", map[string]interface{}{
+		"interval_sec":          interval.Seconds(),
+		"heap_growth_threshold": config.HeapGrowthThreshold,
+		"profile_dir":           profileDir,
+		"heap_bytes":            baseline.heapBytes,
+		"goroutines":            baseline.goroutines,
+		"open_fds":              baseline.openFDs,
+	})
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current := sampleResources()
+		heapGrowth := int64(current.heapBytes) - int64(baseline.heapBytes)
+		goroutineGrowth := current.goroutines - baseline.goroutines
+		fields := map[string]interface{}{
+			"uptime_sec":        int64(time.Since(started).Seconds()),
+			"heap_bytes":        current.heapBytes,
+			"heap_growth_bytes": heapGrowth,
+			"goroutines":        current.goroutines,
+			"goroutine_growth":  goroutineGrowth,
+		}
+		l.Gauge("soak_heap_bytes").Set(ctx, float64(current.heapBytes))
+		l.Gauge("soak_heap_growth_bytes").Set(ctx, float64(heapGrowth))
+		l.Gauge("soak_goroutines").Set(ctx, float64(current.goroutines))
+		l.Gauge("soak_goroutine_growth").Set(ctx, float64(goroutineGrowth))
+		if current.openFDs >= 0 && baseline.openFDs >= 0 {
+			fdGrowth := current.openFDs - baseline.openFDs
+			fields["open_fds"] = current.openFDs
+			fields["open_fd_growth"] = fdGrowth
+			l.Gauge("soak_open_fds").Set(ctx, float64(current.openFDs))
+			l.Gauge("soak_open_fd_growth").Set(ctx, float64(fdGrowth))
+		}
+		l.Info(ctx, "Soak diagnostics", fields)
+
+		if config.HeapGrowthThreshold > 0 && current.heapBytes > nextProfile {
+			path, err := writeHeapProfile(profileDir, l.serviceName)
+			if err != nil {
+				l.Error(ctx, "Failed to write heap profile", err, map[string]interface{}{
+					"profile_dir": profileDir,
+				})
+			} else {
+				l.Warn(ctx, "Heap grew past the soak threshold, profile written", map[string]interface{}{
+					"path":              path,
+					"heap_bytes":        current.heapBytes,
+					"heap_growth_bytes": heapGrowth,
+				})
+			}
+			nextProfile = current.heapBytes + config.HeapGrowthThreshold
+		}
+	}
+}
+
+// sampleResources reads the process's heap, goroutines and open files
+func sampleResources() resourceSample {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	sample := resourceSample{
+		heapBytes:  stats.HeapAlloc,
+		goroutines: runtime.NumGoroutine(),
+		openFDs:    -1,
+	}
+	if entries, err := os.ReadDir("/proc/self/fd"); err == nil {
+		// Less the descriptor ReadDir had open on the directory
+		sample.openFDs = len(entries) - 1
+	}
+	return sample
+}
+
+// writeHeapProfile writes a heap profile to dir, returning its path
+func writeHeapProfile(dir, service string) (string, error) {
+	path := filepath.Join(dir, fmt.Sprintf("heap-%s-%s.pprof", service, time.Now().UTC().Format("20060102T150405.000Z")))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
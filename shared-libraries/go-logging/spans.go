@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"math"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span options
+//
+// StartSpan starts an internal span by default. Options set its kind, its
+// first attributes and links to other spans:
+//
+//	ctx, endSpan := logger.StartSpan(ctx, "deliver_notification",
+//		logging.ConsumerSpan(),
+//		logging.SpanAttributes(logging.String("provider", provider)),
+//		logging.LinkedTo(origin),
+//	)
+//
+// HTTPMiddleware starts server spans and HTTPTransport client spans, so
+// Tempo's service graph pairs a call with the request it caused.
+
+// SpanOption configures a span started by StartSpan
+type SpanOption = trace.SpanStartOption
+
+// ServerSpan marks a span as handling a request from another service
+func ServerSpan() SpanOption {
+	return trace.WithSpanKind(trace.SpanKindServer)
+}
+
+// ClientSpan marks a span as a call to another service
+func ClientSpan() SpanOption {
+	return trace.WithSpanKind(trace.SpanKindClient)
+}
+
+// ProducerSpan marks a span as handing work to a queue
+func ProducerSpan() SpanOption {
+	return trace.WithSpanKind(trace.SpanKindProducer)
+}
+
+// ConsumerSpan marks a span as processing work taken from a queue
+func ConsumerSpan() SpanOption {
+	return trace.WithSpanKind(trace.SpanKindConsumer)
+}
+
+// SpanAttributes sets attributes on a span when it starts, where samplers
+// can see them
+func SpanAttributes(fields ...Field) SpanOption {
+	attrs := make([]attribute.KeyValue, len(fields))
+	for i, f := range fields {
+		attrs[i] = attributeOf(f)
+	}
+	return trace.WithAttributes(attrs...)
+}
+
+// LinkedTo links a span to the span in ctx, such as the request that queued
+// the work; a ctx without a span adds no link
+func LinkedTo(ctx context.Context) SpanOption {
+	link := trace.LinkFromContext(ctx)
+	if !link.SpanContext.IsValid() {
+		return trace.WithLinks()
+	}
+	return trace.WithLinks(link)
+}
+
+// attributeOf converts a typed field to a span attribute; values without an
+// attribute type are written as strings
+func attributeOf(f Field) attribute.KeyValue {
+	v := f.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return attribute.String(f.Key, v.String())
+	case slog.KindInt64:
+		return attribute.Int64(f.Key, v.Int64())
+	case slog.KindUint64:
+		if u := v.Uint64(); u <= math.MaxInt64 {
+			return attribute.Int64(f.Key, int64(u))
+		}
+	case slog.KindFloat64:
+		return attribute.Float64(f.Key, v.Float64())
+	case slog.KindBool:
+		return attribute.Bool(f.Key, v.Bool())
+	}
+	return attribute.String(f.Key, v.String())
+}
@@ -0,0 +1,259 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Testing
+//
+// NewForTesting returns a logger keeping its telemetry in memory instead of
+// exporting it, and a Recorder to assert on it, so handler tests can check
+// what a service logs, traces and counts without a collector:
+//
+//	logger, recorder := logging.NewForTesting()
+//	handler.ServeHTTP(w, r)
+//	if len(recorder.SpansByName("send_notification")) != 1 { ... }
+//	if recorder.MetricValue("http_requests_total", logging.Labels{"status_code": "200"}) != 1 { ... }
+//
+// Every span is sampled and ended spans are recorded right away; metrics are
+// collected when read. Log lines are recorded at every level and not
+// written anywhere. The global OpenTelemetry propagator and providers are
+// left alone, so tests can run in parallel, each with its own logger.
+
+// Recorder holds the telemetry of a logger from NewForTesting
+type Recorder struct {
+	spans  *tracetest.InMemoryExporter
+	reader *sdkmetric.ManualReader
+
+	mu   sync.Mutex
+	logs []LogRecord
+}
+
+// LogRecord is a recorded log line
+type LogRecord struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	// Fields are the line's fields, including service, trace_id and span_id;
+	// fields of a group are keyed "group.key"
+	Fields map[string]interface{}
+}
+
+// NewForTesting creates a logger recording its telemetry in memory
+func NewForTesting() (*Logger, *Recorder) {
+	recorder := &Recorder{
+		spans:  tracetest.NewInMemoryExporter(),
+		reader: sdkmetric.NewManualReader(),
+	}
+	// Without the OTEL_* fallbacks, which could turn on exporting, and
+	// without replacing the global propagator
+	logger := newLogger(Config{
+		ServiceName: "test",
+		Version:     "test",
+		Environment: "test",
+		Handler:     &recordingHandler{recorder: recorder},
+		keepGlobals: true,
+	})
+
+	res, err := logger.newResource(context.Background())
+	if err != nil {
+		logger.setupErr = err
+		return logger, recorder
+	}
+
+	logger.tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(recorder.spans),
+		sdktrace.WithResource(res),
+	)
+	logger.tracer = logger.tracerProvider.Tracer(logger.serviceName)
+
+	logger.meterProvider = logger.newMeterProvider(res, recorder.reader)
+	logger.meter = logger.meterProvider.Meter(logger.serviceName)
+	logger.createMetrics()
+
+	logger.initialized = true
+	return logger, recorder
+}
+
+// Spans returns the ended spans, in the order they ended
+func (r *Recorder) Spans() tracetest.SpanStubs {
+	return r.spans.GetSpans()
+}
+
+// SpansByName returns the ended spans of an operation
+func (r *Recorder) SpansByName(name string) tracetest.SpanStubs {
+	var spans tracetest.SpanStubs
+	for _, span := range r.spans.GetSpans() {
+		if span.Name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// Logs returns the recorded log lines
+func (r *Recorder) Logs() []LogRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]LogRecord(nil), r.logs...)
+}
+
+// LogsByMessage returns the recorded log lines with a message
+func (r *Recorder) LogsByMessage(message string) []LogRecord {
+	var logs []LogRecord
+	for _, record := range r.Logs() {
+		if record.Message == message {
+			logs = append(logs, record)
+		}
+	}
+	return logs
+}
+
+// MetricValue returns the value of a metric summed over the series whose
+// labels include labels: the total of a counter, the value of a gauge or the
+// number of measurements of a histogram. It's 0 if nothing was recorded.
+func (r *Recorder) MetricValue(name string, labels Labels) float64 {
+	var data metricdata.ResourceMetrics
+	if err := r.reader.Collect(context.Background(), &data); err != nil {
+		return 0
+	}
+
+	var value float64
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name != name {
+				continue
+			}
+			switch agg := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				value += sumPoints(agg.DataPoints, labels)
+			case metricdata.Sum[float64]:
+				value += sumPoints(agg.DataPoints, labels)
+			case metricdata.Gauge[int64]:
+				value += sumPoints(agg.DataPoints, labels)
+			case metricdata.Gauge[float64]:
+				value += sumPoints(agg.DataPoints, labels)
+			case metricdata.Histogram[int64]:
+				value += countPoints(agg.DataPoints, labels)
+			case metricdata.Histogram[float64]:
+				value += countPoints(agg.DataPoints, labels)
+			}
+		}
+	}
+	return value
+}
+
+// Reset forgets the recorded spans and log lines; metrics are cumulative and
+// keep their values
+func (r *Recorder) Reset() {
+	r.spans.Reset()
+	r.mu.Lock()
+	r.logs = nil
+	r.mu.Unlock()
+}
+
+func sumPoints[N int64 | float64](points []metricdata.DataPoint[N], labels Labels) float64 {
+	var sum float64
+	for _, p := range points {
+		if hasLabels(p.Attributes.ToSlice(), labels) {
+			sum += float64(p.Value)
+		}
+	}
+	return sum
+}
+
+func countPoints[N int64 | float64](points []metricdata.HistogramDataPoint[N], labels Labels) float64 {
+	var count float64
+	for _, p := range points {
+		if hasLabels(p.Attributes.ToSlice(), labels) {
+			count += float64(p.Count)
+		}
+	}
+	return count
+}
+
+// hasLabels reports whether a series has all of labels
+func hasLabels(attrs []attribute.KeyValue, labels Labels) bool {
+	for key, want := range labels {
+		found := false
+		for _, attr := range attrs {
+			if string(attr.Key) == key && attr.Value.Emit() == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// recordingHandler records log lines in a Recorder
+type recordingHandler struct {
+	recorder *Recorder
+	attrs    []slog.Attr
+	prefix   string
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *recordingHandler) Handle(_ context.Context, record slog.Record) error {
+	fields := make(map[string]interface{})
+	for _, attr := range h.attrs {
+		addField(fields, "", attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		addField(fields, h.prefix, attr)
+		return true
+	})
+
+	h.recorder.mu.Lock()
+	defer h.recorder.mu.Unlock()
+	h.recorder.logs = append(h.recorder.logs, LogRecord{
+		Time:    record.Time,
+		Level:   record.Level,
+		Message: record.Message,
+		Fields:  fields,
+	})
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefixed := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		prefixed[i] = slog.Attr{Key: h.prefix + attr.Key, Value: attr.Value}
+	}
+	return &recordingHandler{
+		recorder: h.recorder,
+		attrs:    append(append([]slog.Attr(nil), h.attrs...), prefixed...),
+		prefix:   h.prefix,
+	}
+}
+
+func (h *recordingHandler) WithGroup(name string) slog.Handler {
+	return &recordingHandler{recorder: h.recorder, attrs: h.attrs, prefix: h.prefix + name + "."}
+}
+
+// addField adds an attribute to fields, flattening groups
+func addField(fields map[string]interface{}, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		for _, member := range value.Group() {
+			addField(fields, prefix+attr.Key+".", member)
+		}
+		return
+	}
+	fields[prefix+attr.Key] = value.Any()
+}
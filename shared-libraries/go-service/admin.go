@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// How an admin caller authenticated
+const (
+	AdminAuthNone   = "none"
+	AdminAuthToken  = "bearer_token"
+	AdminAuthClient = "client_certificate"
+)
+
+// AdminLogger is the subset of the shared logger used for the audit log
+type AdminLogger interface {
+	Info(ctx context.Context, message string, fields ...map[string]interface{})
+	Warn(ctx context.Context, message string, fields ...map[string]interface{})
+}
+
+// Admin authenticates the callers of a service's admin endpoints and serves
+// them on their own listener. A caller is identified by either
+//
+//	a bearer token  ADMIN_TOKENS maps identities to tokens
+//	                ("alice=s3cret,deploy-bot=t0ken"); a single ADMIN_TOKEN
+//	                is accepted as the identity "admin"
+//	a client cert   on the admin listener with ADMIN_CLIENT_CA set, a
+//	                certificate signed by that CA; its common name is the
+//	                identity
+//
+// With neither configured every admin request is rejected, unless
+// ADMIN_AUTH=none opens the endpoints, which is only meant for local
+// development.
+//
+// ADMIN_PORT starts a secondary listener serving only the admin routes, over
+// TLS when ADMIN_TLS_CERT and ADMIN_TLS_KEY are set. ADMIN_LISTENER_ONLY=true
+// then keeps them off the public port.
+type Admin struct {
+	Port         string
+	TLSCert      string
+	TLSKey       string
+	ClientCA     string
+	ListenerOnly bool
+	// Open accepts requests without credentials (ADMIN_AUTH=none)
+	Open bool
+
+	tokens []adminToken
+}
+
+// adminToken is a bearer token and the identity it belongs to
+type adminToken struct {
+	identity string
+	token    []byte
+}
+
+type adminIdentityKey struct{}
+
+// LoadAdmin reads the admin settings, reporting invalid ones to config
+func LoadAdmin(config *Config) *Admin {
+	a := &Admin{
+		Port:         config.String("ADMIN_PORT", ""),
+		TLSCert:      config.String("ADMIN_TLS_CERT", ""),
+		TLSKey:       config.String("ADMIN_TLS_KEY", ""),
+		ClientCA:     config.String("ADMIN_CLIENT_CA", ""),
+		ListenerOnly: config.String("ADMIN_LISTENER_ONLY", "false") == "true",
+	}
+
+	if token := config.String("ADMIN_TOKEN", ""); token != "" {
+		a.tokens = append(a.tokens, adminToken{identity: "admin", token: []byte(token)})
+	}
+	for i, entry := range strings.Split(config.String("ADMIN_TOKENS", ""), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		identity, token, found := strings.Cut(entry, "=")
+		if !found || identity == "" || token == "" {
+			// Don't log the entry, it may be a bare token
+			config.Warn("Ignoring ADMIN_TOKENS entry %d, expected identity=token", i+1)
+			continue
+		}
+		a.tokens = append(a.tokens, adminToken{identity: identity, token: []byte(token)})
+	}
+
+	switch auth := config.String("ADMIN_AUTH", ""); auth {
+	case "":
+		if len(a.tokens) == 0 && a.ClientCA == "" {
+			config.Warn("No ADMIN_TOKEN, ADMIN_TOKENS or ADMIN_CLIENT_CA set, admin requests are rejected (ADMIN_AUTH=none opens them)")
+		}
+	case AdminAuthNone:
+		a.Open = true
+	default:
+		config.Warn("Unknown ADMIN_AUTH %q, admin credentials are required", auth)
+	}
+	return a
+}
+
+// AcceptsTokens reports whether any bearer token is configured
+func (a *Admin) AcceptsTokens() bool {
+	return len(a.tokens) > 0
+}
+
+// Authenticate identifies the caller of an admin endpoint
+func (a *Admin) Authenticate(r *http.Request) (identity, method string, ok bool) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		if name := r.TLS.VerifiedChains[0][0].Subject.CommonName; name != "" {
+			return name, AdminAuthClient, true
+		}
+	}
+
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		for _, candidate := range a.tokens {
+			if subtle.ConstantTimeCompare([]byte(token), candidate.token) == 1 {
+				return candidate.identity, AdminAuthToken, true
+			}
+		}
+	}
+
+	if a.Open {
+		return "anonymous", AdminAuthNone, true
+	}
+	return "", "", false
+}
+
+// AdminIdentity returns the identity authenticated for an admin request
+func AdminIdentity(ctx context.Context) string {
+	identity, _ := ctx.Value(adminIdentityKey{}).(string)
+	return identity
+}
+
+// AdminHooks are the parts of the admin middleware left to the service
+type AdminHooks struct {
+	// Logger receives the audit log
+	Logger AdminLogger
+	// Reject answers a request without valid credentials
+	Reject http.HandlerFunc
+	// Authenticated, if set, is told how long authentication took
+	Authenticated func(ctx context.Context, elapsed time.Duration)
+}
+
+// auditWriter records the status of an admin response
+type auditWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (aw *auditWriter) WriteHeader(status int) {
+	aw.status = status
+	aw.ResponseWriter.WriteHeader(status)
+}
+
+func (aw *auditWriter) Unwrap() http.ResponseWriter {
+	return aw.ResponseWriter
+}
+
+// Middleware authenticates admin requests and writes the audit log. Every
+// admin request, allowed or not, is logged: a line with "audit": true, the
+// identity, how it authenticated and the action's status, at info level
+// (warn when denied).
+func (a *Admin) Middleware(hooks AdminHooks) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authStart := time.Now()
+			identity, method, ok := a.Authenticate(r)
+			if hooks.Authenticated != nil {
+				hooks.Authenticated(r.Context(), time.Since(authStart))
+			}
+			aw := &auditWriter{ResponseWriter: w, status: http.StatusOK}
+
+			if ok {
+				next.ServeHTTP(aw, r.WithContext(context.WithValue(r.Context(), adminIdentityKey{}, identity)))
+			} else {
+				aw.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				hooks.Reject(aw, r)
+			}
+
+			// Denied attempts are warnings
+			audit := hooks.Logger.Info
+			if !ok {
+				audit = hooks.Logger.Warn
+			}
+			audit(r.Context(), "Admin action", map[string]interface{}{
+				"audit":       true,
+				"identity":    identity,
+				"auth_method": method,
+				"allowed":     ok,
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"status_code": aw.status,
+				"remote_addr": r.RemoteAddr,
+			})
+		})
+	}
+}
+
+// NewServer returns the admin listener serving handler, or nil when
+// ADMIN_PORT is unset. With ADMIN_CLIENT_CA it requires a client certificate
+// signed by that CA.
+func (a *Admin) NewServer(handler http.Handler) (*http.Server, error) {
+	if a.Port == "" {
+		return nil, nil
+	}
+
+	server := &http.Server{Addr: ":" + a.Port, Handler: handler}
+
+	if a.ClientCA != "" {
+		if a.TLSCert == "" || a.TLSKey == "" {
+			return nil, errors.New("ADMIN_CLIENT_CA requires ADMIN_TLS_CERT and ADMIN_TLS_KEY")
+		}
+		pem, err := os.ReadFile(a.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("reading ADMIN_CLIENT_CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", a.ClientCA)
+		}
+		server.TLSConfig = &tls.Config{
+			ClientCAs:  pool,
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	return server, nil
+}
+
+// Serve runs the admin listener until it is shut down. It returns nil once
+// the server is closed.
+func (a *Admin) Serve(server *http.Server) error {
+	var err error
+	if a.TLSCert != "" {
+		err = server.ListenAndServeTLS(a.TLSCert, a.TLSKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Clock tells the wall-clock time. Logic that depends on it (readiness
+// delays, schedules) reads the time through a Clock so it can run against a
+// Fake instead of waiting for real time to pass.
+type Clock interface {
+	Now() time.Time
+	// NewTicker returns a ticker firing every d on this clock
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks like time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the real clock
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct{ *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// ConfiguredClock returns the clock selected by FAKE_CLOCK_START: a Fake
+// stopped at that time (RFC 3339) when it is set, the system clock otherwise.
+// It runs before the logger exists, so it reports to the standard log.
+func ConfiguredClock(config *Config) Clock {
+	start := config.String("FAKE_CLOCK_START", "")
+	if start == "" {
+		return SystemClock
+	}
+	t, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		config.Warn("Invalid FAKE_CLOCK_START %q, using the system clock: %v", start, err)
+		return SystemClock
+	}
+	log.Printf("Using a fake clock starting at %s", t.UTC().Format(time.RFC3339))
+	return NewFake(t)
+}
+
+// ErrClockChange is returned by Move for a change that doesn't give exactly
+// one of a duration and a time
+var ErrClockChange = errors.New("expected either a duration to advance by or a time to set")
+
+// Fake is a Clock that only moves when told to. Its tickers fire when Advance
+// or Set moves the time past their next tick; like time.Ticker they drop
+// ticks a slow receiver can't take, so a large jump fires a ticker once.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers map[*fakeTicker]struct{}
+}
+
+// NewFake returns a fake clock stopped at start
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start, tickers: make(map[*fakeTicker]struct{})}
+}
+
+// Now returns the fake time
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance moves the fake time forward by d
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.set(f.now.Add(d))
+}
+
+// Set moves the fake time to t. Moving it backwards restarts the tickers'
+// periods from t.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.set(t)
+}
+
+// Move applies a change requested through an admin API: advance is a
+// duration for time.ParseDuration, set a time to move to. Exactly one of them
+// must be given.
+func (f *Fake) Move(advance string, set *time.Time) error {
+	if (advance == "") == (set == nil) {
+		return ErrClockChange
+	}
+	if set != nil {
+		f.Set(*set)
+		return nil
+	}
+	d, err := time.ParseDuration(advance)
+	if err != nil {
+		return err
+	}
+	f.Advance(d)
+	return nil
+}
+
+func (f *Fake) set(t time.Time) {
+	backwards := t.Before(f.now)
+	f.now = t
+	for ticker := range f.tickers {
+		if backwards {
+			ticker.next = t.Add(ticker.period)
+			continue
+		}
+		if t.Before(ticker.next) {
+			continue
+		}
+		select {
+		case ticker.c <- t:
+		default:
+		}
+		// Skip the ticks in between, as a real ticker drops them
+		missed := t.Sub(ticker.next) / ticker.period
+		ticker.next = ticker.next.Add((missed + 1) * ticker.period)
+	}
+}
+
+// NewTicker returns a ticker driven by the fake time
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("service: non-positive interval for Fake.NewTicker")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ticker := &fakeTicker{clock: f, c: make(chan time.Time, 1), period: d, next: f.now.Add(d)}
+	f.tickers[ticker] = struct{}{}
+	return ticker
+}
+
+type fakeTicker struct {
+	clock  *Fake
+	c      chan time.Time
+	period time.Duration
+	next   time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	delete(t.clock.tickers, t)
+}
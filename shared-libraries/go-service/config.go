@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Config reads the settings of a service. Defaults depend on ENVIRONMENT:
+// each environment can have a profile of KEY=VALUE lines
+// (profiles/<environment>.env in the service's embedded files). A setting is
+// taken from the first of: the process environment, the file named by
+// CONFIG_FILE (same format), the profile, and the default passed by the
+// caller. Without ENVIRONMENT the development profile is used.
+type Config struct {
+	profiles fs.FS
+
+	once   sync.Once
+	values map[string]string
+
+	mu       sync.Mutex
+	warnings []string
+}
+
+// NewConfig returns the settings of a service whose profiles are in profiles
+func NewConfig(profiles fs.FS) *Config {
+	return &Config{profiles: profiles}
+}
+
+// Value returns a setting, empty if unset
+func (c *Config) Value(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	c.once.Do(c.load)
+	return c.values[key]
+}
+
+// String returns a setting, or defaultValue if unset
+func (c *Config) String(key, defaultValue string) string {
+	if value := c.Value(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// Int returns an integer setting, or defaultValue if unset or invalid
+func (c *Config) Int(key string, defaultValue int) int {
+	if value := c.Value(key); value != "" {
+		if intValue, err := strconv.Atoi(value); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+// Float returns a decimal setting, or defaultValue if unset or invalid
+func (c *Config) Float(key string, defaultValue float64) float64 {
+	if value := c.Value(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// Warn logs an invalid setting to the standard log, as settings are read
+// before the logger exists, and keeps it for Warnings
+func (c *Config) Warn(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	log.Print(message)
+
+	c.mu.Lock()
+	c.warnings = append(c.warnings, message)
+	c.mu.Unlock()
+}
+
+// Warnings returns the invalid settings found so far, which fell back to
+// their defaults
+func (c *Config) Warnings() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.warnings...)
+}
+
+// load merges the environment's profile with CONFIG_FILE
+func (c *Config) load() {
+	c.values = make(map[string]string)
+
+	var fileValues map[string]string
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err == nil {
+			fileValues, err = parseConfig(file)
+			file.Close()
+		}
+		if err != nil {
+			c.Warn("Failed to read CONFIG_FILE %s: %v", path, err)
+		}
+	}
+
+	environment := os.Getenv("ENVIRONMENT")
+	if environment == "" {
+		environment = fileValues["ENVIRONMENT"]
+	}
+	if environment == "" {
+		environment = "development"
+	}
+
+	if c.profiles != nil {
+		if profile, err := c.profiles.Open("profiles/" + environment + ".env"); err == nil {
+			profileValues, err := parseConfig(profile)
+			profile.Close()
+			if err != nil {
+				c.Warn("Failed to read %s config profile: %v", environment, err)
+			}
+			for key, value := range profileValues {
+				c.values[key] = value
+			}
+		}
+	}
+	for key, value := range fileValues {
+		c.values[key] = value
+	}
+}
+
+// parseConfig reads KEY=VALUE lines, skipping blank lines and # comments
+func parseConfig(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(text, "=")
+		if !found || strings.TrimSpace(key) == "" {
+			return values, fmt.Errorf("line %d: expected KEY=VALUE", line)
+		}
+		values[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,3 @@
+module github.com/faidon-laboratory/go-service
+
+go 1.23
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Logger is the subset of the shared logger used by Group
+type Logger interface {
+	Info(ctx context.Context, message string, fields ...map[string]interface{})
+	Error(ctx context.Context, message string, err error, fields ...map[string]interface{})
+}
+
+// ErrStopped is returned when starting a goroutine on a group that is shutting down
+var ErrStopped = errors.New("service group is stopped")
+
+// Group runs the background goroutines of a service. Every goroutine has a
+// name, panics are recovered and logged instead of crashing the process, and
+// Shutdown stops them in order.
+//
+// Goroutines started under the same name form a stage and are stopped
+// together. Stages are stopped in reverse order of their first start, so work
+// started last (e.g. a scheduler feeding a worker pool) stops before the
+// things it depends on.
+type Group struct {
+	logger Logger
+
+	mu      sync.Mutex
+	stages  []*stage
+	byName  map[string]*stage
+	tasks   map[uint64]*task
+	nextID  uint64
+	stopped bool
+}
+
+// stage holds the goroutines started under one name
+type stage struct {
+	name   string
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	started  int
+	panics   int
+	failures int
+}
+
+// task is one running goroutine
+type task struct {
+	id        uint64
+	stage     *stage
+	startedAt time.Time
+	restarts  int
+}
+
+// TaskInfo describes a running goroutine
+type TaskInfo struct {
+	ID        uint64    `json:"id"`
+	Name      string    `json:"name"`
+	StartedAt time.Time `json:"started_at"`
+	RunningMs int64     `json:"running_ms"`
+	Restarts  int       `json:"restarts"`
+}
+
+// StageInfo summarises the goroutines started under one name
+type StageInfo struct {
+	Name     string `json:"name"`
+	Running  int    `json:"running"`
+	Started  int    `json:"started"`
+	Panics   int    `json:"panics"`
+	Failures int    `json:"failures"`
+	Stopping bool   `json:"stopping"`
+}
+
+// NewGroup creates an empty group
+func NewGroup(logger Logger) *Group {
+	return &Group{
+		logger: logger,
+		byName: make(map[string]*stage),
+		tasks:  make(map[uint64]*task),
+	}
+}
+
+// Go runs fn in a new goroutine. The context passed to fn is cancelled when
+// the goroutine's stage is stopped. A panic ends the goroutine and is logged
+// with its stack; a returned error other than context.Canceled is logged.
+func (g *Group) Go(name string, fn func(ctx context.Context) error) error {
+	return g.start(name, fn, false)
+}
+
+// Supervise is like Go but restarts fn after a panic, waiting a second
+// between attempts, until the stage is stopped. It suits long-lived loops
+// such as queue workers, which would otherwise silently shrink their pool.
+// Whatever fn was doing when it panicked is dropped: a worker whose callers
+// wait for a result should recover, fail the job in hand and panic again.
+func (g *Group) Supervise(name string, fn func(ctx context.Context) error) error {
+	return g.start(name, fn, true)
+}
+
+func (g *Group) start(name string, fn func(ctx context.Context) error, restart bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.stopped {
+		return ErrStopped
+	}
+	s, ok := g.byName[name]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		s = &stage{name: name, ctx: ctx, cancel: cancel}
+		g.byName[name] = s
+		g.stages = append(g.stages, s)
+	}
+
+	g.nextID++
+	t := &task{id: g.nextID, stage: s, startedAt: time.Now()}
+	g.tasks[t.id] = t
+	s.started++
+	s.wg.Add(1)
+
+	go func() {
+		defer g.finish(t)
+		for {
+			panicked := g.run(t, fn)
+			if !panicked || !restart || s.ctx.Err() != nil {
+				return
+			}
+			select {
+			case <-time.After(time.Second):
+			case <-s.ctx.Done():
+				return
+			}
+			g.mu.Lock()
+			t.restarts++
+			g.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// run calls fn once, reporting whether it panicked
+func (g *Group) run(t *task, fn func(ctx context.Context) error) (panicked bool) {
+	s := t.stage
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			panicked = true
+			g.mu.Lock()
+			s.panics++
+			g.mu.Unlock()
+			g.logger.Error(s.ctx, "Goroutine panicked", fmt.Errorf("panic: %v", recovered), map[string]interface{}{
+				"goroutine":    s.name,
+				"goroutine_id": t.id,
+				"stack":        string(debug.Stack()),
+			})
+		}
+	}()
+
+	if err := fn(s.ctx); err != nil && !errors.Is(err, context.Canceled) {
+		g.mu.Lock()
+		s.failures++
+		g.mu.Unlock()
+		g.logger.Error(s.ctx, "Goroutine failed", err, map[string]interface{}{
+			"goroutine":    s.name,
+			"goroutine_id": t.id,
+		})
+	}
+	return false
+}
+
+// finish removes a goroutine from the registry
+func (g *Group) finish(t *task) {
+	g.mu.Lock()
+	delete(g.tasks, t.id)
+	g.mu.Unlock()
+	t.stage.wg.Done()
+}
+
+// Tasks lists the running goroutines, oldest first
+func (g *Group) Tasks() []TaskInfo {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	tasks := make([]TaskInfo, 0, len(g.tasks))
+	for _, t := range g.tasks {
+		tasks = append(tasks, TaskInfo{
+			ID:        t.id,
+			Name:      t.stage.name,
+			StartedAt: t.startedAt.UTC(),
+			RunningMs: now.Sub(t.startedAt).Milliseconds(),
+			Restarts:  t.restarts,
+		})
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks
+}
+
+// Stages summarises every name goroutines were started under, in start order
+func (g *Group) Stages() []StageInfo {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	running := make(map[*stage]int, len(g.stages))
+	for _, t := range g.tasks {
+		running[t.stage]++
+	}
+	stages := make([]StageInfo, 0, len(g.stages))
+	for _, s := range g.stages {
+		stages = append(stages, StageInfo{
+			Name:     s.name,
+			Running:  running[s],
+			Started:  s.started,
+			Panics:   s.panics,
+			Failures: s.failures,
+			Stopping: s.ctx.Err() != nil,
+		})
+	}
+	return stages
+}
+
+// Shutdown stops the stages one at a time in reverse start order, waiting
+// for each to return before cancelling the next. It gives up when ctx is
+// done, returning an error naming the stage still running.
+func (g *Group) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	g.stopped = true
+	stages := append([]*stage(nil), g.stages...)
+	g.mu.Unlock()
+
+	for i := len(stages) - 1; i >= 0; i-- {
+		s := stages[i]
+		s.cancel()
+
+		done := make(chan struct{})
+		go func() {
+			s.wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			g.logger.Info(ctx, "Goroutines stopped", map[string]interface{}{
+				"goroutine": s.name,
+			})
+		case <-ctx.Done():
+			return fmt.Errorf("goroutines %q did not stop: %w", s.name, ctx.Err())
+		}
+	}
+	return nil
+}